@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"land/protocol"
+)
+
+var directions = []string{"up", "down", "left", "right"}
+
+// chatLines are what bots say when they chat.
+var chatLines = []string{"gg", "nice", "over here", "watch the left side", "that was close", "again?"}
+
+// outbound is a message as clients send it.
+type outbound struct {
+	Type    string `json:"type"`
+	Seq     uint64 `json:"seq"`
+	Payload any    `json:"payload"`
+}
+
+// inbound is a message as the server sends it, before its payload is read.
+type inbound struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// errGameOver ends a session whose game has finished, so the bot can find
+// another.
+var errGameOver = errors.New("game over")
+
+// bot is one simulated player. It plays game after game until the run ends,
+// connecting afresh for each one.
+type bot struct {
+	id    int
+	cfg   *config
+	stats *botStats
+	rand  *rand.Rand
+}
+
+func (b *bot) run(ctx context.Context) {
+	b.rand = rand.New(rand.NewSource(time.Now().UnixNano() + int64(b.id)))
+	for ctx.Err() == nil {
+		err := b.play(ctx)
+		if errors.Is(err, errGameOver) {
+			b.stats.games()
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			b.stats.failed(err)
+		}
+		return
+	}
+}
+
+// play runs one session: it connects, joins a game and plays it until the
+// game ends, the run ends or the connection fails.
+func (b *bot) play(ctx context.Context) error {
+	start := time.Now()
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, b.cfg.url, nil)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	defer ws.Close()
+
+	s := &session{bot: b, ws: ws}
+	hello := protocol.HelloPayload{Version: protocol.Version, Client: "loadtest"}
+	if b.cfg.deltas {
+		hello.Features = []string{"delta"}
+	}
+	if err := s.send("hello", hello); err != nil {
+		return err
+	}
+	if msg, err := s.read(); err != nil {
+		return err
+	} else if msg.Type != "welcome" {
+		return fmt.Errorf("expected welcome, got %s", msg.Type)
+	}
+	b.stats.connected(time.Since(start))
+
+	if err := s.send("join", protocol.JoinPayload{Name: fmt.Sprintf("bot-%d", b.id)}); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.readLoop() }()
+
+	moves := time.NewTicker(time.Duration(float64(time.Second) / b.cfg.moveRate))
+	defer moves.Stop()
+	pings := time.NewTicker(b.cfg.pingInterval)
+	defer pings.Stop()
+	var chat <-chan time.Time
+	if b.cfg.chatInterval > 0 {
+		chat = time.After(b.nextChat())
+	}
+
+	for {
+		var err error
+		select {
+		case <-moves.C:
+			if s.playing() {
+				err = s.send("move", protocol.MovePayload{Direction: directions[b.rand.Intn(len(directions))]})
+			}
+		case <-pings.C:
+			err = s.ping()
+		case <-chat:
+			err = s.send("chat", protocol.ChatPayload{Message: chatLines[b.rand.Intn(len(chatLines))]})
+			chat = time.After(b.nextChat())
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			s.close()
+			<-done
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextChat is how long until the bot next chats, drawn so the chat messages
+// come chatInterval apart on average.
+func (b *bot) nextChat() time.Duration {
+	return time.Duration(b.rand.ExpFloat64() * float64(b.cfg.chatInterval))
+}
+
+// session is a bot's connection. Everything it sends goes out from the bot's
+// goroutine; readLoop has the connection's reads to itself.
+type session struct {
+	bot *bot
+	ws  *websocket.Conn
+	seq uint64
+
+	mu            sync.Mutex
+	phase         string
+	lastBroadcast time.Time
+	pings         map[int64]time.Time
+}
+
+func (s *session) send(msgType string, payload any) error {
+	s.seq++
+	data, err := json.Marshal(outbound{Type: msgType, Seq: s.seq, Payload: payload})
+	if err != nil {
+		return err
+	}
+	s.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := s.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("write %s: %w", msgType, err)
+	}
+	return nil
+}
+
+// ping sends a ping, noting when it went so its pong gives the round trip.
+func (s *session) ping() error {
+	now := time.Now()
+	clientTime := now.UnixMilli()
+	s.mu.Lock()
+	if s.pings == nil {
+		s.pings = make(map[int64]time.Time)
+	}
+	if _, ok := s.pings[clientTime]; !ok {
+		s.pings[clientTime] = now
+	}
+	s.mu.Unlock()
+	return s.send("ping", protocol.PingPayload{ClientTime: clientTime})
+}
+
+// close says goodbye, after which the server closes the connection and
+// readLoop returns.
+func (s *session) close() {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "load test over")
+	s.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	s.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+}
+
+func (s *session) playing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.phase == "inProgress" || s.phase == "overtime"
+}
+
+func (s *session) read() (inbound, error) {
+	var msg inbound
+	_, data, err := s.ws.ReadMessage()
+	if err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("bad message: %w", err)
+	}
+	return msg, nil
+}
+
+// readLoop reads the server's messages until the connection closes or the
+// game is over, recording what they say about the server's health.
+func (s *session) readLoop() error {
+	stats := s.bot.stats
+	for {
+		msg, err := s.read()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case "gameState":
+			var state protocol.GameStatePayload
+			if err := json.Unmarshal(msg.Payload, &state); err != nil {
+				return fmt.Errorf("bad gameState: %w", err)
+			}
+			s.broadcast(state.Phase)
+		case "stateDelta":
+			var delta protocol.StateDeltaPayload
+			if err := json.Unmarshal(msg.Payload, &delta); err != nil {
+				return fmt.Errorf("bad stateDelta: %w", err)
+			}
+			s.broadcast(delta.Phase)
+		case "pong":
+			var pong protocol.PongPayload
+			if err := json.Unmarshal(msg.Payload, &pong); err != nil {
+				return fmt.Errorf("bad pong: %w", err)
+			}
+			s.mu.Lock()
+			sent, ok := s.pings[pong.ClientTime]
+			delete(s.pings, pong.ClientTime)
+			s.mu.Unlock()
+			if ok {
+				stats.rtt(time.Since(sent))
+			}
+		case "error":
+			var e protocol.ErrorPayload
+			if err := json.Unmarshal(msg.Payload, &e); err != nil {
+				return fmt.Errorf("bad error: %w", err)
+			}
+			stats.serverError(e.Code)
+		case "gameOver":
+			return errGameOver
+		}
+	}
+}
+
+// broadcast notes a state broadcast from a room in phase. Gaps are only
+// measured between broadcasts of a game under way, when the room ticks.
+func (s *session) broadcast(phase string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playing := phase == "inProgress" || phase == "overtime"
+	if playing && !s.lastBroadcast.IsZero() {
+		s.bot.stats.gap(now.Sub(s.lastBroadcast))
+	}
+	s.phase = phase
+	s.lastBroadcast = time.Time{}
+	if playing {
+		s.lastBroadcast = now
+	}
+}
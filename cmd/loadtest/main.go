@@ -0,0 +1,105 @@
+// Command loadtest plays the game with many headless bots at once, to see
+// how a server holds up before real players find out. Each bot opens a
+// websocket to /ws, says hello, joins through matchmaking and, once its
+// room's game is under way, moves about at a rate the server accepts,
+// chatting now and then and pinging to measure the round trip. At the end
+// it prints a summary and exits with status 1 if the failures went over the
+// thresholds.
+//
+//	go run ./cmd/loadtest -url ws://localhost:8080/ws -bots 200 -ramp 20 -duration 2m
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// maxMoveRate is the server's move rate for a player without boosts. Bots
+// moving faster get their moves dropped and are eventually kicked.
+const maxMoveRate = 10
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.url, "url", "ws://localhost:8080/ws", "websocket endpoint of the server under test")
+	flag.IntVar(&cfg.bots, "bots", 50, "number of bots to connect")
+	flag.Float64Var(&cfg.ramp, "ramp", 10, "bots connected per second while ramping up (0 connects them all at once)")
+	flag.DurationVar(&cfg.duration, "duration", time.Minute, "how long to run, ramp-up included")
+	flag.Float64Var(&cfg.moveRate, "move-rate", 4, fmt.Sprintf("moves per second per bot, at most %d", maxMoveRate))
+	flag.DurationVar(&cfg.chatInterval, "chat-interval", 30*time.Second, "average time between a bot's chat messages (0 disables chat)")
+	flag.DurationVar(&cfg.pingInterval, "ping-interval", time.Second, "time between a bot's pings")
+	flag.BoolVar(&cfg.deltas, "deltas", true, "ask for state deltas, as the browser client does")
+	flag.Float64Var(&cfg.maxFailed, "max-failed", 0.01, "fail the run if more than this fraction of bots can't connect or are disconnected")
+	flag.IntVar(&cfg.maxErrors, "max-errors", 0, "fail the run if the server sends more than this many error messages in all")
+	flag.DurationVar(&cfg.maxRTT, "max-rtt", 0, "fail the run if the 99th percentile round trip is longer than this (0 disables)")
+	flag.Parse()
+
+	if cfg.bots <= 0 {
+		log.Fatal("-bots must be at least 1")
+	}
+	if cfg.moveRate <= 0 || cfg.moveRate > maxMoveRate {
+		log.Fatalf("-move-rate must be above 0 and at most %d", maxMoveRate)
+	}
+	if cfg.pingInterval <= 0 {
+		log.Fatal("-ping-interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	log.Printf("Running %d bots against %s for %v", cfg.bots, cfg.url, cfg.duration)
+	results := make([]*botStats, cfg.bots)
+	var wg sync.WaitGroup
+	started := time.Now()
+ramp:
+	for i := range results {
+		if cfg.ramp > 0 {
+			due := started.Add(time.Duration(float64(i) / cfg.ramp * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				results = results[:i]
+				break ramp
+			}
+		}
+		b := &bot{id: i, cfg: &cfg, stats: newBotStats()}
+		results[i] = b.stats
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	s := summarize(results, time.Since(started))
+	s.print(os.Stdout)
+	if failures := s.check(&cfg); len(failures) > 0 {
+		for _, failure := range failures {
+			log.Print(failure)
+		}
+		os.Exit(1)
+	}
+}
+
+// config is the run's settings, from the flags.
+type config struct {
+	url          string
+	bots         int
+	ramp         float64
+	duration     time.Duration
+	moveRate     float64
+	chatInterval time.Duration
+	pingInterval time.Duration
+	deltas       bool
+	maxFailed    float64
+	maxErrors    int
+	maxRTT       time.Duration
+}
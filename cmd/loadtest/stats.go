@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// botStats is what one bot measured. Its session's goroutines record into
+// it concurrently.
+type botStats struct {
+	mu       sync.Mutex
+	connects []time.Duration
+	rtts     []time.Duration
+	gaps     []time.Duration
+	played   int
+	errors   map[string]int
+	failure  string
+}
+
+func newBotStats() *botStats {
+	return &botStats{errors: make(map[string]int)}
+}
+
+// connected records a connection's time from dialing to the welcome.
+func (s *botStats) connected(took time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connects = append(s.connects, took)
+}
+
+func (s *botStats) rtt(took time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rtts = append(s.rtts, took)
+}
+
+// gap records the time between two state broadcasts.
+func (s *botStats) gap(took time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gaps = append(s.gaps, took)
+}
+
+func (s *botStats) games() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.played++
+}
+
+// serverError records an error message from the server, by code.
+func (s *botStats) serverError(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[code]++
+}
+
+// failed records why the bot stopped before the run was over: the close
+// code if the server closed the connection, otherwise the error.
+func (s *botStats) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		s.failure = "close " + strconv.Itoa(closeErr.Code)
+		if closeErr.Text != "" {
+			s.failure += " (" + closeErr.Text + ")"
+		}
+		return
+	}
+	s.failure = err.Error()
+}
+
+// summary is the whole run's measurements.
+type summary struct {
+	elapsed  time.Duration
+	bots     int
+	failed   int
+	games    int
+	connects []time.Duration
+	rtts     []time.Duration
+	gaps     []time.Duration
+	errors   map[string]int
+	failures map[string]int
+}
+
+func summarize(results []*botStats, elapsed time.Duration) *summary {
+	s := &summary{
+		elapsed:  elapsed,
+		bots:     len(results),
+		errors:   make(map[string]int),
+		failures: make(map[string]int),
+	}
+	for _, r := range results {
+		r.mu.Lock()
+		s.connects = append(s.connects, r.connects...)
+		s.rtts = append(s.rtts, r.rtts...)
+		s.gaps = append(s.gaps, r.gaps...)
+		s.games += r.played
+		for code, n := range r.errors {
+			s.errors[code] += n
+		}
+		if r.failure != "" {
+			s.failed++
+			s.failures[r.failure]++
+		}
+		r.mu.Unlock()
+	}
+	slices.Sort(s.connects)
+	slices.Sort(s.rtts)
+	slices.Sort(s.gaps)
+	return s
+}
+
+func (s *summary) errorCount() int {
+	n := 0
+	for _, count := range s.errors {
+		n += count
+	}
+	return n
+}
+
+func (s *summary) print(w io.Writer) {
+	fmt.Fprintf(w, "bots:             %d over %v, %d failed, %d games finished\n",
+		s.bots, s.elapsed.Round(time.Second), s.failed, s.games)
+	fmt.Fprintf(w, "connect latency:  %s\n", distribution(s.connects))
+	fmt.Fprintf(w, "round trip:       %s\n", distribution(s.rtts))
+	fmt.Fprintf(w, "broadcast gap:    %s\n", distribution(s.gaps))
+	fmt.Fprintf(w, "server errors:    %d\n", s.errorCount())
+	printCounts(w, s.errors)
+	fmt.Fprintf(w, "failures:         %d\n", s.failed)
+	printCounts(w, s.failures)
+}
+
+// check lists the thresholds the run went over.
+func (s *summary) check(cfg *config) []string {
+	var failures []string
+	if rate := float64(s.failed) / float64(max(s.bots, 1)); rate > cfg.maxFailed {
+		failures = append(failures, fmt.Sprintf("%d of %d bots failed, over the limit of %.1f%%", s.failed, s.bots, 100*cfg.maxFailed))
+	}
+	if n := s.errorCount(); n > cfg.maxErrors {
+		failures = append(failures, fmt.Sprintf("server sent %d errors, over the limit of %d", n, cfg.maxErrors))
+	}
+	if cfg.maxRTT > 0 {
+		if p99 := percentile(s.rtts, 99); p99 > cfg.maxRTT {
+			failures = append(failures, fmt.Sprintf("99th percentile round trip was %v, over the limit of %v", p99, cfg.maxRTT))
+		}
+	}
+	return failures
+}
+
+// distribution describes sorted samples by their percentiles.
+func distribution(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("p50 %v  p95 %v  p99 %v  max %v  (%d samples)",
+		percentile(samples, 50), percentile(samples, 95), percentile(samples, 99),
+		samples[len(samples)-1].Round(time.Microsecond), len(samples))
+}
+
+// percentile is the pth percentile of sorted samples, zero if there are none.
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	i := min(len(samples)*p/100, len(samples)-1)
+	return samples[i].Round(time.Microsecond)
+}
+
+func printCounts(w io.Writer, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %6d  %s\n", counts[key], key)
+	}
+}
@@ -0,0 +1,162 @@
+// Command sim plays many matches between bots with the game engine alone,
+// with no server and no clock, and prints how often each seat won, so the
+// effect of a rule change can be measured before anyone plays it.
+//
+//	go run ./cmd/sim -runs 5000 -mode classic -players greedy,greedy,random,random
+//
+// Run i is seeded with -seed plus i, so a surprising run can be replayed on
+// its own with -runs 1 and its seed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"land/internal/game"
+)
+
+// drivers maps the bot names -players accepts to their drivers.
+var drivers = map[string]func() game.Driver{
+	"random": func() game.Driver { return game.RandomBot{} },
+	"greedy": func() game.Driver { return game.GreedyBot{} },
+	"idle":   func() game.Driver { return &game.Script{} },
+}
+
+func main() {
+	var (
+		runs      = flag.Int("runs", 1000, "number of matches to play")
+		mode      = flag.String("mode", "classic", "game mode: "+strings.Join(game.Modes(), ", "))
+		boardSize = flag.Int("board", 40, "board size in cells")
+		interval  = flag.Duration("interval", 100*time.Millisecond, "time a step stands for")
+		duration  = flag.Duration("duration", 3*time.Minute, "match length")
+		steal     = flag.Bool("steal", true, "allow claiming other players' cells")
+		radius    = flag.Int("spawn-radius", 1, "radius of each player's starting territory")
+		seats     = flag.String("players", "greedy,greedy,random,random", "comma-separated bots, one per seat: "+botNames())
+		leaveAt   = flag.Int("leave-at", 0, "step at which the last seat leaves, to measure the leaver rule (0 stays)")
+		seed      = flag.Int64("seed", 1, "seed of the first run")
+		workers   = flag.Int("workers", runtime.GOMAXPROCS(0), "matches played at once")
+	)
+	var leavers game.TerritoryRule
+	flag.Var(&leavers, "leaver-territory", "what happens to a leaving player's cells: keep, neutral or decay")
+	flag.Parse()
+
+	bots := strings.Split(*seats, ",")
+	for _, bot := range bots {
+		if drivers[bot] == nil {
+			log.Fatalf("unknown bot %q, want one of %s", bot, botNames())
+		}
+	}
+	if *runs <= 0 || *workers <= 0 {
+		log.Fatal("-runs and -workers must be at least 1")
+	}
+
+	config := func(run int) game.SimConfig {
+		cfg := game.SimConfig{
+			Mode:        *mode,
+			BoardSize:   *boardSize,
+			Interval:    *interval,
+			Duration:    *duration,
+			Steal:       *steal,
+			Leavers:     leavers,
+			SpawnRadius: *radius,
+			Seed:        *seed + int64(run),
+		}
+		for i, bot := range bots {
+			cfg.Players = append(cfg.Players, game.SimPlayer{
+				ID:     fmt.Sprintf("seat%d", i+1),
+				Color:  fmt.Sprintf("color%d", i+1),
+				Driver: drivers[bot](),
+			})
+		}
+		if *leaveAt > 0 {
+			cfg.Players[len(cfg.Players)-1].LeaveAt = *leaveAt
+		}
+		return cfg
+	}
+
+	start := time.Now()
+	tally := newTally(len(bots))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range jobs {
+				result, err := game.Simulate(config(run))
+				if err != nil {
+					log.Fatal(err)
+				}
+				tally.add(result)
+			}
+		}()
+	}
+	for run := range *runs {
+		jobs <- run
+	}
+	close(jobs)
+	wg.Wait()
+
+	tally.print(bots, time.Since(start))
+}
+
+func botNames() string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// tally adds up the results of the runs.
+type tally struct {
+	mu       sync.Mutex
+	runs     int
+	steps    int
+	noWinner int
+	wins     []int
+	scores   []int
+}
+
+func newTally(seats int) *tally {
+	return &tally{wins: make([]int, seats), scores: make([]int, seats)}
+}
+
+func (t *tally) add(result game.SimResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.runs++
+	t.steps += result.Steps
+	if result.Winner == nil {
+		t.noWinner++
+	}
+	for seat := range t.wins {
+		id := fmt.Sprintf("seat%d", seat+1)
+		if result.Winner != nil && result.Winner.ID == id {
+			t.wins[seat]++
+		}
+		t.scores[seat] += result.Scores[id]
+	}
+}
+
+func (t *tally) print(bots []string, took time.Duration) {
+	fmt.Printf("%d runs in %v, %.0f steps on average, %d without a winner\n\n",
+		t.runs, took.Round(time.Millisecond), float64(t.steps)/float64(t.runs), t.noWinner)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "seat\tbot\twins\twin rate\tavg score\t")
+	for seat, bot := range bots {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%.1f%%\t%.1f\t\n", seat+1, bot, t.wins[seat],
+			100*float64(t.wins[seat])/float64(t.runs), float64(t.scores[seat])/float64(t.runs))
+	}
+	w.Flush()
+}
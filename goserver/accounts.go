@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// RegisterRequest is the body of POST /register. It is all a registration
+// may set: everything else about a new account, its score and rating among
+// them, starts at the default.
+type RegisterRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	Email     string `json:"email"`
+	Character string `json:"character"`
+	Color     string `json:"color"`
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// minNameLength is the shortest account name accepted, in runes; the
+// longest is maxNameLength.
+const minNameLength = 3
+
+// namePattern is what account names may be made of: letters, digits,
+// spaces and _ - . between them.
+var namePattern = regexp.MustCompile(`^[\p{L}\p{N}_.-]+( [\p{L}\p{N}_.-]+)*$`)
+
+// checkName says what is wrong with an account name, if anything.
+func checkName(name string) string {
+	switch n := utf8.RuneCountInString(name); {
+	case n < minNameLength:
+		return fmt.Sprintf("Name must be at least %d characters", minNameLength)
+	case n > maxNameLength:
+		return fmt.Sprintf("Name must be at most %d characters", maxNameLength)
+	case !namePattern.MatchString(name):
+		return "Name may only have letters, digits, single spaces and _ - ."
+	case profanity.contains(name):
+		return "Name is not allowed"
+	}
+	return ""
+}
+
+// errAlreadyRegistered rejects registering a guest account a second time
+// with different details.
+var errAlreadyRegistered = errors.New("account is already registered")
+
+// passwordCost is the bcrypt cost new passwords are hashed at.
+var passwordCost = bcrypt.DefaultCost
+
+// registerPlayer creates an account from the posted details and answers
+// with it and a token to connect as it. A name checkName rejects gets a 400
+// and one that is already taken a 409; the color and character are checked
+// as preferences are. Sent with a guest account's token, it registers that
+// account instead, keeping its ID and so its matches and scores.
+func registerPlayer(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Accounts are disabled"})
+		return
+	}
+
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if problem := checkName(req.Name); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), passwordCost)
+	if err != nil {
+		// Only a password over bcrypt's 72 byte limit gets here.
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+	if token := requestToken(c); token != "" {
+		registerGuest(c, token, req, hash)
+		return
+	}
+	prefs, ok := registrationPreferences(c, 0, req)
+	if !ok {
+		return
+	}
+
+	player := models.Player{
+		Name:         req.Name,
+		Email:        req.Email,
+		PasswordHash: string(hash),
+		Character:    prefs["character"].(string),
+		Color:        prefs["color"].(string),
+	}
+	err = db.Create(&player).Error
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "Name is already taken"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create player"})
+		return
+	}
+
+	respondWithToken(c, player)
+}
+
+// registerGuest turns the guest account the token is for into a registered
+// one. Retrying a registration that went through answers as the first did.
+func registerGuest(c *gin.Context, token string, req RegisterRequest, hash []byte) {
+	account, err := checkToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	prefs, ok := registrationPreferences(c, account.ID, req)
+	if !ok {
+		return
+	}
+
+	var player models.Player
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&player, account.ID).Error; err != nil {
+			return err
+		}
+		if !player.Guest {
+			if player.Name == req.Name && bcrypt.CompareHashAndPassword([]byte(player.PasswordHash), []byte(req.Password)) == nil {
+				return nil
+			}
+			return errAlreadyRegistered
+		}
+		player.Name = req.Name
+		player.Email = req.Email
+		player.PasswordHash = string(hash)
+		player.Character = prefs["character"].(string)
+		player.Color = prefs["color"].(string)
+		player.Guest = false
+		return tx.Select("Name", "Email", "EmailVerified", "PasswordHash", "Character", "Color", "Guest").Updates(&player).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest account not found"})
+		return
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "Name is already taken"})
+		return
+	case errors.Is(err, errAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is already registered"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register player"})
+		return
+	}
+
+	respondWithToken(c, player)
+}
+
+// registrationPreferences checks the color and character a registration
+// asks for as the account's preferences, answering and reporting false if
+// they won't do. The account is zero for a new one.
+func registrationPreferences(c *gin.Context, accountID uint, req RegisterRequest) (map[string]any, bool) {
+	prefs := map[string]any{}
+	ok := preferenceUpdates(c, accountID, PreferencesRequest{Color: &req.Color, Character: &req.Character}, prefs)
+	return prefs, ok
+}
+
+// loginPlayer checks an account's name and password and answers with the
+// account and a fresh token. Unknown names and wrong passwords get the same
+// 401. Logins for a name are rate limited, and a name that fails too often
+// is locked out for a while, whether or not it has an account.
+func loginPlayer(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Accounts are disabled"})
+		return
+	}
+
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if wait := loginFailures.locked(req.Name); wait > 0 {
+		tooManyRequests(c, wait, "Too many failed logins; try again later")
+		return
+	}
+	if wait := loginNameLimiter.allow(req.Name); wait > 0 {
+		tooManyRequests(c, wait, "Too many logins; try again later")
+		return
+	}
+
+	var player models.Player
+	err := db.Where("name = ?", req.Name).First(&player).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		loginFailures.failed(req.Name)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Wrong name or password"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load player"})
+		return
+	}
+	// Guests and accounts from before passwords have no hash, which never
+	// matches.
+	if bcrypt.CompareHashAndPassword([]byte(player.PasswordHash), []byte(req.Password)) != nil {
+		loginFailures.failed(req.Name)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Wrong name or password"})
+		return
+	}
+	loginFailures.succeeded(req.Name)
+
+	respondWithToken(c, player)
+}
+
+// respondWithToken starts a session for the account and answers with the
+// account and the session's token.
+func respondWithToken(c *gin.Context, player models.Player) {
+	token, _, err := startSession(player, requestClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"player": player, "token": token})
+}
+
+// deletedName is what a deleted account's name becomes in recorded matches
+// and chat logs.
+const deletedName = "Deleted player"
+
+// deleteAccount deletes the account the request's token is for. The row is
+// kept, anonymized and soft-deleted, so the matches it played keep their
+// shape, but everything that identified the player goes: their name there,
+// in match results and in chat logs, email, password, preferences, friends,
+// stats, season scores, achievements, coins and purchases, sessions and
+// linked OAuth identities. A live connection is closed.
+// Deleting an account again answers the same way.
+func deleteAccount(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+
+	flushChatLogs()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var player models.Player
+		if err := tx.Unscoped().First(&player, account.ID).Error; err != nil {
+			return err
+		}
+		if player.DeletedAt.Valid {
+			return nil
+		}
+		err := tx.Model(&player).Select("Name", "Email", "EmailVerified", "PasswordHash", "Character", "Color", "Coins").Updates(models.Player{
+			Name: fmt.Sprintf("deleted-%d", player.ID),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.MatchResult{}).Where("account_id = ?", player.ID).Update("name", deletedName).Error; err != nil {
+			return err
+		}
+		if err := anonymizeChatLogs(tx, player.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("player_id = ? OR friend_id = ?", player.ID, player.ID).Delete(&models.FriendLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", player.ID).Delete(&models.PlayerStats{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", player.ID).Delete(&models.SeasonScore{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", player.ID).Delete(&models.PlayerAchievement{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", player.ID).Delete(&models.InventoryItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ? OR muted_account_id = ?", player.ID, player.ID).Delete(&models.PlayerMute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", player.ID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("account_id = ?", player.ID).Delete(&models.OAuthIdentity{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&player).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	log.Printf("Deleted account %d", account.ID)
+	disconnectPlayers(func(p *Player) bool { return p.AccountID == account.ID }, closeAccountDeleted, "account deleted")
+	// Chat sent while the account was being deleted was logged with its
+	// name still on.
+	flushChatLogs()
+	if err := anonymizeChatLogs(db, account.ID); err != nil {
+		log.Printf("Failed to anonymize the chat logs of account %d: %v", account.ID, err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"deleted": true, "accountID": account.ID})
+}
+
+// disconnectPlayers closes the connections of the players that match, for
+// good: a player in a room loses their seat rather than having it held for
+// them. match must only look at what a player signed in with, which
+// doesn't change.
+func disconnectPlayers(match func(*Player) bool, closeCode int, reason string) {
+	seated := make(map[*Player]bool)
+	for _, room := range rooms.List() {
+		room.do(func() {
+			for _, player := range room.Players {
+				if !match(player) {
+					continue
+				}
+				seated[player] = true
+				player.Evicted = true
+				if player.Conn == nil {
+					dropHold(player)
+				} else {
+					player.Conn.CloseWith(closeCode, reason)
+				}
+			}
+		})
+	}
+	for _, player := range connected.List() {
+		if match(player) && !seated[player] {
+			player.Conn.CloseWith(closeCode, reason)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"land/internal/wstest"
+	"land/models"
+)
+
+// loginResponse is the body of a successful POST /register or /login.
+type loginResponse struct {
+	Player struct {
+		ID   uint   `json:"ID"`
+		Name string `json:"name"`
+	} `json:"player"`
+	Token string `json:"token"`
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	useTestDB(t)
+	server := startServer(t)
+
+	w := serveRequest(t, http.MethodPost, "/register", "", `{"name":"alice","password":"correct horse"}`)
+	expectStatus(t, w, http.StatusOK)
+	if body := strings.ToLower(w.Body.String()); strings.Contains(body, "password") || strings.Contains(body, "$2a$") {
+		t.Fatalf("registration answered with the password or its hash: %s", w.Body)
+	}
+	var registered loginResponse
+	decodeBody(t, w, &registered)
+
+	expectStatus(t, serveRequest(t, http.MethodPost, "/register", "", `{"name":"alice","password":"another"}`), http.StatusConflict)
+	expectStatus(t, serveRequest(t, http.MethodPost, "/register", "", `{"name":"bob"}`), http.StatusBadRequest)
+	expectStatus(t, serveRequest(t, http.MethodPost, "/login", "", `{"name":"alice","password":"wrong horse"}`), http.StatusUnauthorized)
+	expectStatus(t, serveRequest(t, http.MethodPost, "/login", "", `{"name":"nobody","password":"correct horse"}`), http.StatusUnauthorized)
+
+	w = serveRequest(t, http.MethodPost, "/login", "", `{"name":"alice","password":"correct horse"}`)
+	expectStatus(t, w, http.StatusOK)
+	var login loginResponse
+	decodeBody(t, w, &login)
+	if login.Player.ID != registered.Player.ID || login.Token == "" {
+		t.Fatalf("logged in as %+v, want alice's account %d and a token", login, registered.Player.ID)
+	}
+
+	// The token signs the connection in as alice.
+	client := wstest.Dial(t, server.URL+"/ws?token="+login.Token)
+	var welcome WelcomePayload
+	if err := client.Welcome.Decode(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	if welcome.AccountID != registered.Player.ID || welcome.Name != "alice" || welcome.Guest {
+		t.Fatalf("welcomed as account %d, %q, guest %v; want alice", welcome.AccountID, welcome.Name, welcome.Guest)
+	}
+}
+
+// craftedFields are fields of an account a registration body has no say in,
+// set to values that would stand out if any of them were taken.
+const craftedFields = `"score":999999,"rating":3000,"games":50,"wins":50,"coins":100000,` +
+	`"guest":true,"emailVerified":true,"passwordHash":"x","renamedAt":"2000-01-01T00:00:00Z",` +
+	`"ID":77,"id":77,"CreatedAt":"2000-01-01T00:00:00Z","DeletedAt":"2000-01-01T00:00:00Z"`
+
+// A registration sets the name, password, email, color and character, and
+// nothing else about the account, however the body is crafted.
+func TestRegisterIgnoresCraftedFields(t *testing.T) {
+	useTestDB(t)
+	start := time.Now().Add(-time.Minute)
+	w := serveRequest(t, http.MethodPost, "/register", "", `{"name":"alice","password":"secret",`+craftedFields+`}`)
+	expectStatus(t, w, http.StatusOK)
+	var registered loginResponse
+	decodeBody(t, w, &registered)
+
+	var account models.Player
+	if err := db.First(&account, registered.Player.ID).Error; err != nil {
+		t.Fatalf("registered account isn't there to find: %v", err)
+	}
+	if account.ID == 77 || account.CreatedAt.Before(start) || account.RenamedAt != nil {
+		t.Fatalf("account %d created %v, renamed %v: took its model fields from the body", account.ID, account.CreatedAt, account.RenamedAt)
+	}
+	fresh := models.Player{Name: "alice", Rating: models.DefaultRating, PasswordHash: account.PasswordHash}
+	fresh.Model = account.Model
+	if account != fresh {
+		t.Fatalf("registered %+v, want a fresh account", account)
+	}
+
+	// Registering a guest account keeps what it has and takes nothing more.
+	guest := models.Player{Name: "Guest 1234", Guest: true, Rating: models.DefaultRating, Coins: 5}
+	if err := db.Create(&guest).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := startSession(guest, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = serveRequest(t, http.MethodPost, "/register", token, `{"name":"bob","password":"secret",`+craftedFields+`}`)
+	expectStatus(t, w, http.StatusOK)
+	account = models.Player{}
+	if err := db.First(&account, guest.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !account.CreatedAt.Equal(guest.CreatedAt) {
+		t.Fatalf("guest account created %v, registered as created %v", guest.CreatedAt, account.CreatedAt)
+	}
+	fresh = models.Player{Name: "bob", Rating: models.DefaultRating, Coins: 5, PasswordHash: account.PasswordHash}
+	fresh.Model = account.Model
+	if account != fresh {
+		t.Fatalf("registered guest %+v, want %+v", account, fresh)
+	}
+}
+
+// Names are held to checkName's rules and cosmetics to the account's
+// unlocks, as renames and preferences are.
+func TestRegisterValidation(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &registerLimiter, nil)
+	free := palette[slices.IndexFunc(palette, PaletteColor.Free)]
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty name", `{"name":"","password":"secret"}`, http.StatusBadRequest},
+		{"short name", `{"name":"al","password":"secret"}`, http.StatusBadRequest},
+		{"long name", fmt.Sprintf(`{"name":%q,"password":"secret"}`, strings.Repeat("a", maxNameLength+1)), http.StatusBadRequest},
+		{"leading space", `{"name":" alice","password":"secret"}`, http.StatusBadRequest},
+		{"double space", `{"name":"al  ice","password":"secret"}`, http.StatusBadRequest},
+		{"markup", `{"name":"<b>alice</b>","password":"secret"}`, http.StatusBadRequest},
+		{"password over bcrypt's limit", fmt.Sprintf(`{"name":"alice","password":%q}`, strings.Repeat("x", 73)), http.StatusBadRequest},
+		{"bad color", `{"name":"alice","password":"secret","color":"#12"}`, http.StatusBadRequest},
+		{"locked color", `{"name":"alice","password":"secret","color":"gold"}`, http.StatusForbidden},
+		{"long character", fmt.Sprintf(`{"name":"alice","password":"secret","character":%q}`, strings.Repeat("c", maxCharacterLength+1)), http.StatusBadRequest},
+		{"unbought character", `{"name":"alice","password":"secret","character":"knight"}`, http.StatusForbidden},
+		{"free color by hex", fmt.Sprintf(`{"name":"José 2","password":"secret","color":%q}`, free.Hex), http.StatusOK},
+		{"taken name", `{"name":"José 2","password":"secret"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, serveRequest(t, http.MethodPost, "/register", "", tt.body), tt.status)
+		})
+	}
+
+	var accounts []models.Player
+	if err := db.Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != "José 2" || accounts[0].Color != free.ID {
+		t.Fatalf("accounts %+v, want José 2 alone, in %s", accounts, free.ID)
+	}
+}
+
+// findPersonalData returns every value in the database that has any of
+// the strings in it, as table.column: value.
+func findPersonalData(t *testing.T, personal ...string) []string {
+	t.Helper()
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, table := range tables {
+		var rows []map[string]any
+		if err := db.Table(table).Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			for column, value := range row {
+				text, ok := value.(string)
+				if !ok {
+					continue
+				}
+				for _, p := range personal {
+					if strings.Contains(text, p) {
+						found = append(found, fmt.Sprintf("%s.%s: %q", table, column, text))
+					}
+				}
+			}
+		}
+	}
+	return found
+}
+
+// Deleting an account leaves nothing in the database that identifies the
+// player, signs out every session and closes the live connection, and
+// deleting it again changes nothing.
+func TestDeleteAccount(t *testing.T) {
+	useTestDB(t)
+	server := startServer(t)
+	const name, email, ip = "zelda", "zelda@example.com", "203.0.113.7"
+	w := serveRequest(t, http.MethodPost, "/register", "", fmt.Sprintf(`{"name":%q,"password":"correct horse","email":%q}`, name, email))
+	expectStatus(t, w, http.StatusOK)
+	var registered loginResponse
+	decodeBody(t, w, &registered)
+	zelda := registered.Player.ID
+	bob, _ := newAccount(t, "bob")
+
+	var account models.Player
+	if err := db.First(&account, zelda).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := startSession(account, ClientInfo{IP: ip, UserAgent: "zelda's browser"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []any{
+		&models.Match{RoomID: "ROOM01", Results: []models.MatchResult{
+			{AccountID: zelda, PlayerID: "p1", Name: name, Placement: 1},
+			{AccountID: bob.ID, PlayerID: "p2", Name: "bob", Placement: 2},
+		}},
+		&models.ChatLog{RoomID: "ROOM01", AccountID: zelda, PlayerID: "p1", Name: name, Text: "gg", SentAt: time.Now()},
+		&models.FriendLink{PlayerID: zelda, FriendID: bob.ID, Status: "accepted"},
+		&models.OAuthIdentity{Provider: "github", Subject: "zelda-on-github", AccountID: zelda},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	joinRaw(t, ws, server.createRoom(t, ""), "ignored")
+	ws.SetReadDeadline(time.Now().Add(expectTimeout))
+	for {
+		var msg Envelope
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "gameState" {
+			break
+		}
+	}
+
+	expectStatus(t, serveRequest(t, http.MethodDelete, "/players/me", token, ""), http.StatusAccepted)
+
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, closeAccountDeleted) {
+				t.Fatalf("connection ended with %v, want close code %d", err, closeAccountDeleted)
+			}
+			break
+		}
+	}
+	if found := findPersonalData(t, name, email, ip, "zelda-on-github", "$2a$"); len(found) > 0 {
+		t.Fatalf("personal data left after deletion: %v", found)
+	}
+	for _, token := range []string{token, registered.Token} {
+		expectStatus(t, serveRequest(t, http.MethodGet, "/players/me/friends", token, ""), http.StatusUnauthorized)
+	}
+	var results int64
+	db.Model(&models.MatchResult{}).Where("name = ?", deletedName).Count(&results)
+	if results != 1 {
+		t.Fatalf("%d match results under %q, want zelda's", results, deletedName)
+	}
+
+	// A second request that got past the session check before the first
+	// went through is answered the same way.
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/players/me", nil)
+	c.Set(accountKey, Account{ID: zelda})
+	deleteAccount(c)
+	expectStatus(t, w, http.StatusAccepted)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"land/models"
+)
+
+// achievement is an achievement's definition: what it is called and what a
+// player's game must have been like to unlock it.
+type achievement struct {
+	ID          string
+	Name        string
+	Description string
+	Unlocked    func(game PlayerGame) bool
+}
+
+// PlayerGame is how one player did in a finished game, as achievements see
+// it. Claimed is how many cells they took during the game and Eliminated
+// how many players they eliminated, by taking the last cell of a player who
+// finished with none.
+type PlayerGame struct {
+	Standing
+	Won        bool
+	Claimed    int
+	Eliminated int
+	BoardCells int
+}
+
+// achievements are every achievement there is.
+var achievements = []achievement{
+	{
+		ID:          "first_win",
+		Name:        "First Victory",
+		Description: "Win a game",
+		Unlocked:    func(game PlayerGame) bool { return game.Won },
+	},
+	{
+		ID:          "claim_100",
+		Name:        "Land Grab",
+		Description: "Claim 100 cells in one game",
+		Unlocked:    func(game PlayerGame) bool { return game.Claimed >= 100 },
+	},
+	{
+		ID:          "majority_win",
+		Name:        "Landslide",
+		Description: "Win holding more than half the board",
+		Unlocked:    func(game PlayerGame) bool { return game.Won && game.Territory*2 > game.BoardCells },
+	},
+	{
+		ID:          "eliminate_3",
+		Name:        "Conqueror",
+		Description: "Eliminate 3 players in one game",
+		Unlocked:    func(game PlayerGame) bool { return game.Eliminated >= 3 },
+	},
+}
+
+// AchievementView is an achievement an account has unlocked.
+type AchievementView struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UnlockedAt  time.Time `json:"unlockedAt"`
+}
+
+// syncAchievements brings the achievements table in step with
+// achievements.
+func syncAchievements() error {
+	rows := make([]models.Achievement, len(achievements))
+	for i, a := range achievements {
+		rows[i] = models.Achievement{ID: a.ID, Name: a.Name, Description: a.Description}
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description"}),
+	}).Create(&rows).Error
+}
+
+// awardAchievements unlocks the achievements earned in each game the room
+// finishes, telling players who are still connected. It runs as a bus
+// subscriber, so the room is long gone by the time the database has been
+// written.
+func awardAchievements(roomID string) func(Event) {
+	claimed := make(map[string]int)
+	// lastTakenBy is who last took a cell from each color.
+	lastTakenBy := make(map[string]string)
+	return func(event Event) {
+		switch e := event.(type) {
+		case CellClaimed:
+			claimed[e.Player.ID]++
+			if e.From != "" {
+				lastTakenBy[e.From] = e.Player.ID
+			}
+		case GameEnded:
+			eliminated := make(map[string]int)
+			for _, standing := range e.Standings {
+				if standing.Territory == 0 {
+					if by, ok := lastTakenBy[standing.Color]; ok && by != standing.PlayerID {
+						eliminated[by]++
+					}
+				}
+			}
+			for _, standing := range e.Standings {
+				if standing.AccountID == 0 {
+					continue
+				}
+				game := PlayerGame{
+					Standing:   standing,
+					Won:        e.Winner != nil && e.Winner.ID == standing.PlayerID,
+					Claimed:    claimed[standing.PlayerID],
+					Eliminated: eliminated[standing.PlayerID],
+					BoardCells: e.BoardSize * e.BoardSize,
+				}
+				if err := unlockAchievements(game); err != nil {
+					log.Printf("Failed to award achievements in room %s to account %d: %v", roomID, standing.AccountID, err)
+				}
+			}
+			clear(claimed)
+			clear(lastTakenBy)
+		}
+	}
+}
+
+// unlockAchievements unlocks the achievements the game earned that the
+// account doesn't have yet, and tells the account about each.
+func unlockAchievements(game PlayerGame) error {
+	now := time.Now()
+	for _, a := range achievements {
+		if !a.Unlocked(game) {
+			continue
+		}
+		unlock := models.PlayerAchievement{AccountID: game.AccountID, AchievementID: a.ID, UnlockedAt: now}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&unlock)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		notifyAccount(game.AccountID, Message{
+			Type:    "achievementUnlocked",
+			Payload: AchievementUnlockedPayload{ID: a.ID, Name: a.Name, Description: a.Description},
+		})
+	}
+	return nil
+}
+
+// playerAchievementsHandler serves the achievements an account has
+// unlocked, oldest first.
+func playerAchievementsHandler(c *gin.Context) {
+	id, ok := accountParam(c, "id")
+	if !ok || !requireDB(c) {
+		return
+	}
+
+	var account models.Player
+	err := db.First(&account, id).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load achievements"})
+		return
+	}
+	views := []AchievementView{}
+	err = db.Table("player_achievements").
+		Select("achievements.id, achievements.name, achievements.description, player_achievements.unlocked_at").
+		Joins("JOIN achievements ON achievements.id = player_achievements.achievement_id").
+		Where("player_achievements.account_id = ?", id).
+		Order("player_achievements.unlocked_at ASC").Order("achievements.id ASC").
+		Scan(&views).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load achievements"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accountID": id, "achievements": views})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	afkCheckInterval = 5 * time.Second
+
+	// afkGrace is how long a warned player has to send something before
+	// being disconnected.
+	afkGrace = 15 * time.Second
+)
+
+// runAFKChecker periodically warns players and spectators who have been
+// silent for too long, and disconnects those who ignore the warning.
+func runAFKChecker() {
+	ticker := time.NewTicker(afkCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range rooms.List() {
+			checkAFK(room)
+		}
+	}
+}
+
+func checkAFK(room *Room) {
+	room.do(func() {
+		for _, player := range room.Players {
+			if player.Conn == nil {
+				continue
+			}
+			switch afkState(player.LastActivity, &player.AFKWarnedAt, afkTimeout) {
+			case "warn":
+				sendMessage(player, Message{
+					Type:    "afkWarning",
+					Payload: AFKWarningPayload{ExpiresAt: player.AFKWarnedAt.Add(afkGrace).UnixMilli()},
+				})
+			case "disconnect":
+				log.Printf("Disconnecting AFK player %s from room %s", player.ID, room.ID)
+				player.Evicted = true
+				player.Conn.CloseWith(closeAFK, "afk")
+			}
+		}
+
+		for _, subscriber := range room.Spectators {
+			spectator, ok := subscriber.(*Spectator)
+			if !ok {
+				continue
+			}
+			switch afkState(spectator.LastActivity, &spectator.AFKWarnedAt, spectatorAFK) {
+			case "warn":
+				writeMessage(spectator.Conn, spectator.Codec, Message{
+					Type:    "afkWarning",
+					Payload: AFKWarningPayload{ExpiresAt: spectator.AFKWarnedAt.Add(afkGrace).UnixMilli()},
+				})
+			case "disconnect":
+				log.Printf("Disconnecting AFK spectator %s from room %s", spectator.ID, room.ID)
+				spectator.Conn.CloseWith(closeAFK, "afk")
+			}
+		}
+	})
+}
+
+// afkState decides what to do about a connection that was last active at
+// lastActivity: "warn" it (recording the warning time), "disconnect" it once
+// the warning has gone unanswered for afkGrace, or nothing.
+func afkState(lastActivity time.Time, warnedAt *time.Time, timeout time.Duration) string {
+	switch {
+	case timeout <= 0 || time.Since(lastActivity) < timeout:
+		return ""
+	case warnedAt.IsZero():
+		*warnedAt = time.Now()
+		return "warn"
+	case time.Since(*warnedAt) >= afkGrace:
+		return "disconnect"
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"land/models"
+)
+
+// Page sizes for the audit log.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditFailures counts the privileged actions whose audit entry couldn't be
+// written. /debug/rooms reports it.
+var auditFailures atomic.Int64
+
+// audit records a privileged action that succeeded. It is called on every
+// privileged action's success path; an entry that can't be written is
+// logged in full and counted in auditFailures, for writing by hand, but
+// doesn't undo the action.
+func audit(actor, action, target, reason string) {
+	entry := models.AuditEntry{Actor: actor, Action: action, Target: target, Reason: reason, CreatedAt: time.Now()}
+	if db == nil {
+		log.Printf("AUDIT (not persisted, no database): %s %s %s: %s", actor, action, target, reason)
+		return
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		auditFailures.Add(1)
+		record, _ := json.Marshal(entry)
+		log.Printf("AUDIT WRITE FAILED for %s %s %s: %v; entry: %s", actor, action, target, err, record)
+	}
+}
+
+// auditActor is who took a privileged action requested of the debug server:
+// the operator named by the X-Operator header, or the request's remote
+// address without one.
+func auditActor(r *http.Request) string {
+	if operator := r.Header.Get("X-Operator"); operator != "" {
+		return operator
+	}
+	return r.RemoteAddr
+}
+
+// debugAuditHandler serves the audit log, newest first. actor keeps the
+// entries of one actor, and since and until, as RFC 3339 times, those in a
+// time range; limit and offset page through it. It is served by the debug
+// server.
+func debugAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		http.Error(w, "persistence is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	query := db.Model(&models.AuditEntry{})
+	if actor := r.URL.Query().Get("actor"); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	for _, bound := range []struct{ param, cond string }{{"since", "created_at >= ?"}, {"until", "created_at < ?"}} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "invalid "+bound.param, http.StatusBadRequest)
+			return
+		}
+		query = query.Where(bound.cond, t)
+	}
+	limit, offset := defaultAuditLimit, 0
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"limit", &limit}, {"offset", &offset}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid "+param.name, http.StatusBadRequest)
+			return
+		}
+		*param.value = n
+	}
+	limit = min(max(limit, 1), maxAuditLimit)
+
+	entries := []models.AuditEntry{}
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"entries": entries, "limit": limit, "offset": offset})
+}
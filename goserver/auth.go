@@ -0,0 +1,310 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+var (
+	// authSecret signs account tokens, set by a flag. Without one the server
+	// makes up a secret at startup, and tokens stop working when it restarts.
+	authSecret []byte
+
+	// tokenTTL is how long an account token stays valid, set by a flag.
+	tokenTTL = 7 * 24 * time.Hour
+
+	// allowGuests lets players connect without an account token, set by a
+	// flag. With a database they get a guest account of their own, which
+	// can be registered later.
+	allowGuests = true
+
+	// guestRetention is how long an unused guest account that never finished
+	// a match is kept, set by a flag. Zero keeps them forever.
+	guestRetention = 30 * 24 * time.Hour
+)
+
+// guestPruneBatch is how many guest accounts pruneGuests deletes at a time.
+const guestPruneBatch = 500
+
+// tokenIssuer names this server in the tokens it signs.
+const tokenIssuer = "land"
+
+var (
+	errAuthRequired = &JoinError{Code: "AUTH_REQUIRED", CloseCode: closeUnauthorized, Message: "an account token is required"}
+	errBadToken     = &JoinError{Code: "INVALID_TOKEN", CloseCode: closeUnauthorized, Message: "the account token is invalid or has expired"}
+)
+
+// Account is the account a connection signed in with. Its ID is zero for a
+// guest without one, when there is no database to keep guest accounts in.
+// Token is set only for a guest account made for this connection, for the
+// client to keep and come back with. Color and Character are the account's
+// preferences and SessionID the session the token belongs to, when there
+// is a database to load them from.
+type Account struct {
+	ID        uint
+	Name      string
+	Guest     bool
+	Token     string
+	Color     string
+	Character string
+	SessionID uint
+}
+
+// accountClaims are the claims in an account token. The subject is the
+// account ID.
+type accountClaims struct {
+	Name  string `json:"name"`
+	Guest bool   `json:"guest,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// initAuth picks the signing secret: the flag's, or a random one.
+func initAuth(secret string) {
+	if secret != "" {
+		authSecret = []byte(secret)
+		return
+	}
+	authSecret = make([]byte, 32)
+	if _, err := crand.Read(authSecret); err != nil {
+		panic(err)
+	}
+	log.Printf("No -auth-secret given, account tokens will not survive a restart")
+}
+
+// issueToken signs a token for the account, valid for tokenTTL.
+func issueToken(account models.Player) (string, error) {
+	now := time.Now()
+	claims := accountClaims{
+		Name:  account.Name,
+		Guest: account.Guest,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        generateRandomString(16),
+			Issuer:    tokenIssuer,
+			Subject:   strconv.FormatUint(uint64(account.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(authSecret)
+}
+
+// parseToken checks a token's signature, issuer and expiry and returns the
+// account it was issued for.
+func parseToken(token string) (Account, error) {
+	var claims accountClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return authSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return Account{}, err
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return Account{}, fmt.Errorf("bad subject %q", claims.Subject)
+	}
+	return Account{ID: uint(id), Name: claims.Name, Guest: claims.Guest}, nil
+}
+
+// authenticate resolves the token a client connected with to its account.
+// No token makes a new guest account, if guests are allowed; client
+// describes the client for the guest's session.
+func authenticate(token string, client ClientInfo) (Account, *JoinError) {
+	if token == "" {
+		if !allowGuests {
+			return Account{}, errAuthRequired
+		}
+		if db == nil {
+			return Account{Guest: true}, nil
+		}
+		if wait := guestLimiter.allow(client.IP); wait > 0 {
+			log.Printf("Not creating a guest account for %s, which has made too many", client.IP)
+			return Account{Guest: true}, nil
+		}
+		account, err := mintGuest(client)
+		if err != nil {
+			log.Printf("Failed to create guest account: %v", err)
+			return Account{Guest: true}, nil
+		}
+		return account, nil
+	}
+	account, err := checkToken(token)
+	if err != nil {
+		log.Printf("Rejecting account token: %v", err)
+		return Account{}, errBadToken
+	}
+	unlocked, err := unlockedColors(account.ID)
+	if err != nil {
+		log.Printf("Failed to load unlocked colors of account %d: %v", account.ID, err)
+	}
+	if !colorAllowed(account.Color, unlocked) {
+		account.Color = ""
+	}
+	return account, nil
+}
+
+// checkToken resolves a token to its account. With a database the token's
+// session must be live and the account must still exist; the account's
+// details come from there rather than the token's claims, so a renamed
+// account can't go on using old ones.
+func checkToken(token string) (Account, error) {
+	account, err := parseToken(token)
+	if err != nil || db == nil {
+		return account, err
+	}
+	session, err := touchSession(token)
+	if err != nil {
+		return Account{}, err
+	}
+	if session.AccountID != account.ID {
+		return Account{}, fmt.Errorf("session %d is not account %d's", session.ID, account.ID)
+	}
+	var row models.Player
+	if err := db.First(&row, account.ID).Error; err != nil {
+		return Account{}, fmt.Errorf("account %d: %w", account.ID, err)
+	}
+	account.Name = row.Name
+	account.Guest = row.Guest
+	account.Color = row.Color
+	account.Character = row.Character
+	account.SessionID = session.ID
+	return account, nil
+}
+
+// guestNameAttempts is how many generated names mintGuest tries before
+// giving up.
+const guestNameAttempts = 9
+
+// mintGuest creates a guest account with a generated name and a session
+// for it.
+func mintGuest(client ClientInfo) (Account, error) {
+	for attempt := 1; ; attempt++ {
+		guest := models.Player{Name: guestName(attempt), Guest: true}
+		err := db.Create(&guest).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) && attempt < guestNameAttempts {
+			continue
+		}
+		if err != nil {
+			return Account{}, err
+		}
+		token, session, err := startSession(guest, client)
+		if err != nil {
+			return Account{}, err
+		}
+		return Account{ID: guest.ID, Name: guest.Name, Guest: true, Token: token, SessionID: session}, nil
+	}
+}
+
+// guestNumber picks the number in a guest's name, below n.
+var guestNumber = rand.Int63n
+
+// guestName makes up a name for a guest account on the given attempt. There
+// are only a million six-digit names, which a busy server fills up, so every
+// third attempt adds two digits.
+func guestName(attempt int) string {
+	digits := 6 + 2*((attempt-1)/3)
+	return fmt.Sprintf("Guest%0*d", digits, guestNumber(int64(math.Pow10(digits))))
+}
+
+// pruneGuests deletes the guest accounts made before guestRetention ago
+// that haven't been used since and never finished a match, freeing their
+// names. Every connection without a token gets a guest account, and most
+// never come back.
+func pruneGuests(now time.Time) {
+	if db == nil || guestRetention <= 0 {
+		return
+	}
+	cutoff := now.Add(-guestRetention)
+	var pruned int
+	for {
+		var ids []uint
+		err := db.Model(&models.Player{}).
+			Where("guest = ? AND created_at < ?", true, cutoff).
+			Where("NOT EXISTS (?)", db.Model(&models.Session{}).Select("1").Where("sessions.account_id = players.id AND sessions.last_seen_at >= ?", cutoff)).
+			Where("NOT EXISTS (?)", db.Model(&models.MatchResult{}).Select("1").Where("match_results.account_id = players.id")).
+			Limit(guestPruneBatch).
+			Pluck("id", &ids).Error
+		if err == nil && len(ids) > 0 {
+			err = deleteGuests(ids)
+		}
+		if err != nil {
+			log.Printf("Failed to prune guest accounts: %v", err)
+			break
+		}
+		pruned += len(ids)
+		if len(ids) < guestPruneBatch {
+			break
+		}
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d stale guest accounts", pruned)
+	}
+}
+
+// deleteGuests deletes the guest accounts for good, with everything kept
+// for them.
+func deleteGuests(ids []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&models.Session{}, &models.PlayerStats{}, &models.SeasonScore{}, &models.PlayerAchievement{}, &models.InventoryItem{}} {
+			if err := tx.Where("account_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("account_id IN ? OR muted_account_id IN ?", ids, ids).Delete(&models.PlayerMute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("player_id IN ? OR friend_id IN ?", ids, ids).Delete(&models.FriendLink{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Player{}, ids).Error
+	})
+}
+
+// accountKey is where requireSession leaves the request's account.
+const accountKey = "account"
+
+// requireSession is middleware for routes that act as an account: it
+// checks the request's token, answering 401 if it has no valid one, and
+// leaves the account for sessionAccount.
+func requireSession(c *gin.Context) {
+	account, err := checkToken(requestToken(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A valid session is required"})
+		return
+	}
+	c.Set(accountKey, account)
+}
+
+// sessionAccount is the account requireSession found for the request.
+func sessionAccount(c *gin.Context) Account {
+	return c.MustGet(accountKey).(Account)
+}
+
+// registered reports whether the player is signed in to a registered
+// account, whose name they can't change in game.
+func (p *Player) registered() bool {
+	return p.AccountID != 0 && !p.Guest
+}
+
+// requestToken is the account token sent with an HTTP request: a bearer
+// token in the Authorization header or, for browsers that can't set headers
+// on a websocket, the token query parameter.
+func requestToken(c *gin.Context) string {
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(bearer)
+	}
+	return c.Query("token")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+
+	"land/protocol"
+)
+
+// snapshot builds a full gameState payload, recent chat included, for a
+// client starting to follow the room. Compact snapshots carry the board as a
+// CompactBoard instead of in GameState. It must run on the room's goroutine.
+func snapshot(room *Room, remaining time.Duration, compact bool) GameStatePayload {
+	payload := tickSnapshot(room, remaining, compact)
+	payload.GameState.ChatMessages = room.GameState.Chat.list()
+	return payload
+}
+
+// tickSnapshot is snapshot without the chat history, for the tick's
+// broadcasts: clients already following the room get chat messages as they
+// are sent. It must run on the room's goroutine.
+func tickSnapshot(room *Room, remaining time.Duration, compact bool) GameStatePayload {
+	payload := GameStatePayload{
+		RoomID:      room.ID,
+		GameState:   stateView(room),
+		Remaining:   int(remaining.Seconds()),
+		EndsAt:      room.endsAt(),
+		Spectators:  len(room.Spectators),
+		Phase:       room.Phase.String(),
+		Settings:    (*protocol.RoomSettings)(&room.Settings),
+		LastEventID: room.Events.lastID,
+	}
+	if compact {
+		payload.CompactBoard = protocol.Compact(room.GameState.Board)
+		payload.GameState.Board = nil
+	}
+	return payload
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// lastState is the client's latest gameState, once it has caught up with
+// everything the server sent it before a ping.
+func lastState(t *testing.T, client *wstest.Client) protocol.GameStatePayload {
+	t.Helper()
+	client.Send("ping", protocol.PingPayload{ClientTime: 1})
+	client.ExpectMessage("pong", expectTimeout)
+	var state protocol.GameStatePayload
+	for _, msg := range client.Messages() {
+		if msg.Type == "gameState" {
+			state = protocol.GameStatePayload{}
+			if err := msg.Decode(&state); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return state
+}
+
+// Clients that negotiate compactBoard get the board as a CompactBoard, and
+// the rest as rows of colors; both decode to the room's board.
+func TestCompactBoardSnapshots(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob", "compactBoard")
+	server.startMatch(t, alice)
+
+	var want [][]string
+	room.do(func() {
+		for _, row := range room.GameState.Board {
+			want = append(want, append([]string(nil), row...))
+		}
+	})
+	tests := []struct {
+		name    string
+		client  *wstest.Client
+		compact bool
+	}{
+		{"alice", alice, false},
+		{"bob", bob, true},
+	}
+	for _, tt := range tests {
+		state := lastState(t, tt.client)
+		if compact := state.CompactBoard != nil; compact != tt.compact {
+			t.Fatalf("%s got a compact board: %v, want %v", tt.name, compact, tt.compact)
+		}
+		if tt.compact && state.GameState.Board != nil {
+			t.Fatalf("%s got the board twice", tt.name)
+		}
+		board, err := state.Board()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(board, want) {
+			t.Fatalf("%s sees the board as\n%q\nwant\n%q", tt.name, board, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// broadcastBudget is how long a room's broadcast may take before the
+	// server counts as overloaded, set by a flag.
+	broadcastBudget = 20 * time.Millisecond
+
+	// broadcastBandwidth caps the bytes per second of state broadcasts across
+	// all rooms before the server counts as overloaded, set by a flag. Zero
+	// is unlimited.
+	broadcastBandwidth int64
+)
+
+const (
+	// throttleWindow is how often the throttle reconsiders the snapshot rate.
+	throttleWindow = time.Second
+
+	// The throttle's gap between full snapshots moves between zero, one per
+	// tick, and maxSnapshotGap, never going below minSnapshotGap in between.
+	minSnapshotGap = 100 * time.Millisecond
+	maxSnapshotGap = time.Second
+)
+
+// BroadcastThrottle spaces out full gameState snapshots when broadcasting
+// falls behind. Simulation ticks go on at the room's rate, and so do
+// stateDeltas and the events moves produce; only snapshots to players
+// without deltas and to spectators are held back. Every throttleWindow it
+// doubles the gap between snapshots if the slowest broadcast took longer
+// than broadcastBudget or the window's broadcasts went over
+// broadcastBandwidth, and halves it once both are back under half their
+// limit.
+type BroadcastThrottle struct {
+	mu      sync.Mutex
+	gap     time.Duration
+	slowest time.Duration
+	bytes   int64
+
+	// The previous window's measurements, for the status endpoint.
+	lastSlowest time.Duration
+	lastBytes   int64
+}
+
+var throttle = &BroadcastThrottle{}
+
+// Record notes a room's broadcast: how long it took and how many bytes it
+// queued.
+func (t *BroadcastThrottle) Record(took time.Duration, bytes int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.slowest = max(t.slowest, took)
+	t.bytes += int64(bytes)
+}
+
+// Gap is the least time a room leaves between full snapshots. Zero means
+// every tick.
+func (t *BroadcastThrottle) Gap() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.gap
+}
+
+// adjust ends a window, changing the gap if the window calls for it.
+func (t *BroadcastThrottle) adjust(window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rate := int64(float64(t.bytes) / window.Seconds())
+	over := t.slowest > broadcastBudget || broadcastBandwidth > 0 && rate > broadcastBandwidth
+	under := t.slowest < broadcastBudget/2 && (broadcastBandwidth == 0 || rate < broadcastBandwidth/2)
+
+	switch {
+	case over && t.gap < maxSnapshotGap:
+		t.gap = min(max(2*t.gap, minSnapshotGap), maxSnapshotGap)
+		log.Printf("Broadcasts falling behind (slowest %v, %d B/s), full snapshots at most every %v",
+			t.slowest.Round(time.Microsecond), rate, t.gap)
+	case under && t.gap > 0:
+		t.gap /= 2
+		if t.gap < minSnapshotGap {
+			t.gap = 0
+		}
+		log.Printf("Broadcasts keeping up again, full snapshots at most every %v", t.gap)
+	}
+
+	t.lastSlowest, t.lastBytes = t.slowest, rate
+	t.slowest, t.bytes = 0, 0
+}
+
+func runBroadcastThrottle() {
+	ticker := time.NewTicker(throttleWindow)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		throttle.adjust(throttleWindow)
+	}
+}
+
+// BroadcastStatus is the throttle's state as the status endpoint shows it.
+// SnapshotGapMs is the current least gap between full snapshots, zero
+// meaning every tick; the others are measured over the last window.
+type BroadcastStatus struct {
+	SnapshotGapMs     int64 `json:"snapshotGapMs"`
+	SlowestCycleUs    int64 `json:"slowestCycleUs"`
+	BytesPerSecond    int64 `json:"bytesPerSecond"`
+	BandwidthLimit    int64 `json:"bandwidthLimit"`
+	BroadcastBudgetUs int64 `json:"broadcastBudgetUs"`
+}
+
+func (t *BroadcastThrottle) Status() BroadcastStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return BroadcastStatus{
+		SnapshotGapMs:     t.gap.Milliseconds(),
+		SlowestCycleUs:    t.lastSlowest.Microseconds(),
+		BytesPerSecond:    t.lastBytes,
+		BandwidthLimit:    broadcastBandwidth,
+		BroadcastBudgetUs: broadcastBudget.Microseconds(),
+	}
+}
+
+// QueueStatus is a connection with frames waiting to be written.
+type QueueStatus struct {
+	PlayerID string `json:"playerID"`
+	Queued   int    `json:"queued"`
+}
+
+// sendQueues lists the players whose connections have frames waiting,
+// deepest queue first.
+func sendQueues() []QueueStatus {
+	queues := []QueueStatus{}
+	for _, player := range connected.List() {
+		if conn := player.Conn; conn != nil {
+			if n := conn.Queued(); n > 0 {
+				queues = append(queues, QueueStatus{PlayerID: player.ID, Queued: n})
+			}
+		}
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Queued > queues[j].Queued })
+	return queues
+}
+
+// statusHandler reports the server's load: how many rooms and connections
+// it has, the rates it is broadcasting at and whose sends are backing up.
+func statusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"rooms":      len(rooms.List()),
+		"players":    connected.Len(),
+		"broadcast":  throttle.Status(),
+		"sendQueues": sendQueues(),
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+func TestBroadcastThrottle(t *testing.T) {
+	setForTest(t, &broadcastBudget, 20*time.Millisecond)
+	tests := []struct {
+		name      string
+		bandwidth int64
+		gap       time.Duration
+		slowest   time.Duration
+		bytes     int64 // over the one second window
+		want      time.Duration
+	}{
+		{"keeping up", 0, 0, 5 * time.Millisecond, 1 << 20, 0},
+		{"first time over budget", 0, 0, 30 * time.Millisecond, 0, minSnapshotGap},
+		{"over budget again", 0, 200 * time.Millisecond, 30 * time.Millisecond, 0, 400 * time.Millisecond},
+		{"over budget at the cap", 0, maxSnapshotGap, 30 * time.Millisecond, 0, maxSnapshotGap},
+		{"doubling past the cap", 0, 800 * time.Millisecond, 30 * time.Millisecond, 0, maxSnapshotGap},
+		{"over bandwidth", 1000, 0, 0, 1001, minSnapshotGap},
+		{"under budget but not half", 0, 400 * time.Millisecond, 15 * time.Millisecond, 0, 400 * time.Millisecond},
+		{"under half of budget", 0, 400 * time.Millisecond, 5 * time.Millisecond, 0, 200 * time.Millisecond},
+		{"under half of budget but not bandwidth", 1000, 400 * time.Millisecond, 5 * time.Millisecond, 600, 400 * time.Millisecond},
+		{"halving below the least gap", 0, minSnapshotGap, 5 * time.Millisecond, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setForTest(t, &broadcastBandwidth, tt.bandwidth)
+			throttle := &BroadcastThrottle{gap: tt.gap}
+			throttle.Record(tt.slowest, int(tt.bytes))
+			throttle.Record(tt.slowest/2, 0)
+			throttle.adjust(time.Second)
+			if got := throttle.Gap(); got != tt.want {
+				t.Fatalf("gap = %v, want %v", got, tt.want)
+			}
+			status := throttle.Status()
+			if status.SlowestCycleUs != tt.slowest.Microseconds() || status.BytesPerSecond != tt.bytes {
+				t.Fatalf("status %+v doesn't show the window's %v and %d B/s", status, tt.slowest, tt.bytes)
+			}
+		})
+	}
+}
+
+// countMessages is how many messages of type msgType the client has had.
+func countMessages(client *wstest.Client, msgType string) int {
+	var n int
+	for _, msg := range client.Messages() {
+		if msg.Type == msgType {
+			n++
+		}
+	}
+	return n
+}
+
+// While the throttle holds full snapshots back, players on deltas still get
+// one every tick; the rest get their next snapshot once the gap allows.
+func TestThrottledSnapshots(t *testing.T) {
+	setForTest(t, &snapshotInterval, time.Hour)
+	setForTest(t, &throttle, &BroadcastThrottle{gap: maxSnapshotGap})
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob", "delta")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	server.startMatch(t, alice)
+	bob.ExpectMessage("gameState", expectTimeout)
+
+	// A ping's pong is queued behind whatever the tick sent.
+	caughtUp := func() {
+		t.Helper()
+		alice.Send("ping", protocol.PingPayload{ClientTime: 1})
+		alice.ExpectMessage("pong", expectTimeout)
+	}
+	caughtUp()
+	snapshots := countMessages(alice, "gameState")
+	for range 3 {
+		server.tick(t, room)
+		bob.ExpectMessage("stateDelta", expectTimeout)
+	}
+	caughtUp()
+	if got := countMessages(alice, "gameState"); got != snapshots {
+		t.Fatalf("%d snapshots within the throttle's gap", got-snapshots)
+	}
+
+	throttle.mu.Lock()
+	throttle.gap = 0
+	throttle.mu.Unlock()
+	server.tick(t, room)
+	bob.ExpectMessage("stateDelta", expectTimeout)
+	alice.ExpectMessage("gameState", expectTimeout)
+}
+
+// The status endpoint shows the throttle's current gap and what it measured
+// over the last window.
+func TestStatusShowsBroadcastRates(t *testing.T) {
+	setForTest(t, &broadcastBandwidth, 1<<20)
+	setForTest(t, &throttle, &BroadcastThrottle{})
+	throttle.Record(30*time.Millisecond, 2048)
+	throttle.adjust(time.Second)
+
+	w := serveRequest(t, http.MethodGet, "/status", "", "")
+	expectStatus(t, w, http.StatusOK)
+	var status struct {
+		Broadcast BroadcastStatus `json:"broadcast"`
+	}
+	decodeBody(t, w, &status)
+	want := BroadcastStatus{
+		SnapshotGapMs:     minSnapshotGap.Milliseconds(),
+		SlowestCycleUs:    30000,
+		BytesPerSecond:    2048,
+		BandwidthLimit:    1 << 20,
+		BroadcastBudgetUs: broadcastBudget.Microseconds(),
+	}
+	if status.Broadcast != want {
+		t.Fatalf("broadcast status %+v, want %+v", status.Broadcast, want)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"land/internal/game"
+)
+
+// busBufferSize is how many events a bus subscriber may have waiting. A
+// subscriber that falls further behind misses events rather than holding up
+// the room.
+const busBufferSize = 256
+
+// busSubscribers counts the subscriber goroutines of every room, so shutdown
+// can wait for them to write what the rooms published last.
+var busSubscribers sync.WaitGroup
+
+// Event is something that happened in a room, published on the room's bus.
+type Event interface {
+	event()
+}
+
+// PlayerJoined is a player taking a seat in the room.
+type PlayerJoined struct {
+	Player *Player
+}
+
+// PlayerLeft is a player leaving the room for good.
+type PlayerLeft struct {
+	Player *Player
+}
+
+// PlayerMoved is a player's move taking effect. Seq is the sequence number
+// of the move message.
+type PlayerMoved struct {
+	Player *Player
+	To     Position
+	Seq    uint64
+}
+
+// CellClaimed is a player taking a cell, from its previous owner's color or
+// from neutral.
+type CellClaimed struct {
+	Player *Player
+	Cell   Position
+	From   string
+}
+
+// ChatPosted is a chat message sent to the room.
+type ChatPosted struct {
+	Player *Player
+	Text   string
+}
+
+// GameEnded is the end of the room's game. Winner is nil if nobody scored.
+// Standings has every player in the final roster, best first, and the rest
+// describes the game, so subscribers can record it without the room.
+// Played is the time the game ran, pauses excepted.
+type GameEnded struct {
+	Winner    *Player
+	Scores    map[string]int
+	Standings []Standing
+	Mode      string
+	BoardSize int
+	Seed      int64
+	StartedAt time.Time
+	EndedAt   time.Time
+	Played    time.Duration
+}
+
+// Standing is where a player finished. Players on the same score share a
+// Placement. AccountID is zero for players without an account. Territory
+// is how many cells the player's Color owned at the end, which is their
+// score only in some modes. Team is empty outside team mode.
+type Standing struct {
+	PlayerID  string
+	AccountID uint
+	Guest     bool
+	Name      string
+	Color     string
+	Team      string
+	Score     int
+	Territory int
+	Placement int
+}
+
+// Announced is a broadcast that has no event of its own yet.
+type Announced struct {
+	Message Message
+}
+
+func (PlayerJoined) event() {}
+func (PlayerLeft) event()   {}
+func (PlayerMoved) event()  {}
+func (CellClaimed) event()  {}
+func (ChatPosted) event()   {}
+func (GameEnded) event()    {}
+func (Announced) event()    {}
+
+// EventBus fans a room's events out to its subscribers. Events are
+// published on the room's goroutine, so every subscriber sees them in the
+// order they happened. Each subscriber runs on its own goroutine behind a
+// bounded buffer, and Publish never waits for one: a subscriber whose buffer
+// is full misses the event. Subscribers run apart from the room, so they may
+// rely on the IDs in an event but on nothing else the room owns. The bus
+// belongs to the room's goroutine.
+type EventBus struct {
+	subscribers []*busSubscriber
+	closed      bool
+}
+
+type busSubscriber struct {
+	name    string
+	events  chan Event
+	dropped int
+}
+
+// Subscribe runs handle on every event published from now on, in order, on
+// a goroutine of its own. It must run on the room's goroutine.
+func (b *EventBus) Subscribe(name string, handle func(Event)) {
+	if b.closed {
+		return
+	}
+	s := &busSubscriber{name: name, events: make(chan Event, busBufferSize)}
+	b.subscribers = append(b.subscribers, s)
+	busSubscribers.Add(1)
+	go func() {
+		defer busSubscribers.Done()
+		for event := range s.events {
+			handle(event)
+		}
+	}()
+}
+
+// Publish hands the event to every subscriber without blocking. It must run on
+// the room's goroutine.
+func (b *EventBus) Publish(event Event) {
+	if b.closed {
+		return
+	}
+	for _, s := range b.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			if s.dropped == 0 {
+				log.Printf("Event subscriber %s fell behind, dropping events", s.name)
+			}
+			s.dropped++
+		}
+	}
+}
+
+// Close ends every subscription once its subscriber has handled what is
+// already buffered. It must run on the room's goroutine.
+func (b *EventBus) Close() {
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, s := range b.subscribers {
+		if s.dropped > 0 {
+			log.Printf("Event subscriber %s missed %d events", s.name, s.dropped)
+		}
+		close(s.events)
+	}
+}
+
+// waitForSubscribers waits for every closed bus's subscribers to handle the
+// events they had left, giving up when ctx is done. Subscribers of buses
+// still open keep it waiting, so close the rooms first.
+func waitForSubscribers(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		busSubscribers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Gave up waiting for event subscribers to finish")
+	}
+}
+
+// publish announces an event in the room: the websocket broadcaster turns it
+// into a message for players and spectators, and the bus passes it on to
+// everyone else. The broadcaster runs inline since it only queues frames,
+// each connection's send queue being its buffer. It must run on the room's
+// goroutine.
+func publish(room *Room, event Event) {
+	if msg, ok := eventMessage(event); ok {
+		deliverMessage(room, msg)
+	}
+	room.Bus.Publish(event)
+}
+
+// eventMessage is the message that tells clients about an event, if any.
+func eventMessage(event Event) (Message, bool) {
+	switch e := event.(type) {
+	case PlayerJoined:
+		return Message{
+			Type: "playerJoined",
+			Payload: PlayerJoinedPayload{
+				PlayerID: e.Player.ID,
+				Name:     e.Player.Name,
+				X:        e.Player.Position.X,
+				Y:        e.Player.Position.Y,
+			},
+		}, true
+	case PlayerLeft:
+		return Message{
+			Type:    "playerLeft",
+			Payload: PlayerPayload{PlayerID: e.Player.ID, Name: e.Player.Name},
+		}, true
+	case PlayerMoved:
+		return Message{
+			Type:    "positionUpdate",
+			Payload: PositionPayload{PlayerID: e.Player.ID, X: e.To.X, Y: e.To.Y, Seq: e.Seq},
+		}, true
+	case ChatPosted:
+		return Message{
+			Type:    "chat",
+			Payload: ChatMessagePayload{PlayerID: e.Player.ID, Name: e.Player.Name, Message: e.Text},
+		}, true
+	case GameEnded:
+		var winner *PlayerState
+		if e.Winner != nil {
+			state := playerState(e.Winner)
+			winner = &state
+		}
+		return Message{
+			Type:    "gameOver",
+			Payload: GameOverPayload{Winner: winner, Coins: coinsByPlayer(e.Standings)},
+		}, true
+	case Announced:
+		return e.Message, true
+	}
+	// Claimed cells reach clients through the state broadcasts.
+	return Message{}, false
+}
+
+// publishMatchEvents publishes what a step of the match did. A player who
+// spawned mid-match joins the roster here. It must run on the room's
+// goroutine.
+func publishMatchEvents(room *Room, events []game.Event) {
+	for _, event := range events {
+		switch e := event.(type) {
+		case game.Spawned:
+			if player := room.player(e.Player); player != nil {
+				player.spawned = true
+				publish(room, PlayerJoined{Player: player})
+			}
+		case game.Moved:
+			if player := room.player(e.Player); player != nil {
+				publish(room, PlayerMoved{Player: player, To: e.To, Seq: e.Seq})
+			}
+		case game.Claimed:
+			if player := room.player(e.Player); player != nil {
+				publish(room, CellClaimed{Player: player, Cell: e.Cell, From: e.From})
+			}
+		}
+	}
+}
+
+// MatchStats counts what happened in a room's game, for the log line when
+// it ends. It runs as a bus subscriber.
+type MatchStats struct {
+	roomID string
+	seed   int64
+	moves  int
+	claims int
+	chat   int
+}
+
+func (s *MatchStats) handle(event Event) {
+	switch e := event.(type) {
+	case PlayerMoved:
+		s.moves++
+	case CellClaimed:
+		s.claims++
+	case ChatPosted:
+		s.chat++
+	case GameEnded:
+		winner := "nobody"
+		if e.Winner != nil {
+			winner = e.Winner.ID
+		}
+		log.Printf("Room %s finished: %d moves, %d cells claimed, %d chat messages, won by %s (seed %d)",
+			s.roomID, s.moves, s.claims, s.chat, winner, s.seed)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// chatRate is how many chat messages a player may send per chatInterval,
+	// set by flags. Unused messages carry over up to chatRate, so a player
+	// can send that many at once after a quiet spell.
+	chatRate     = 5
+	chatInterval = 10 * time.Second
+)
+
+// chatHistorySize is how many of a room's latest chat messages are kept to
+// show players who join or come back.
+const chatHistorySize = 100
+
+// chatHistory is a room's latest chat messages, as "name: text" lines. It
+// holds chatHistorySize at most, dropping the oldest to make room.
+type chatHistory struct {
+	lines [chatHistorySize]string
+	next  int // where the next line goes
+	count int
+}
+
+func (h *chatHistory) add(line string) {
+	h.lines[h.next] = line
+	h.next = (h.next + 1) % len(h.lines)
+	h.count = min(h.count+1, len(h.lines))
+}
+
+// list returns the lines kept, oldest first.
+func (h *chatHistory) list() []string {
+	lines := make([]string, 0, h.count)
+	start := (h.next - h.count + len(h.lines)) % len(h.lines)
+	for i := range h.count {
+		lines = append(lines, h.lines[(start+i)%len(h.lines)])
+	}
+	return lines
+}
+
+// Players who go over the chat rate chatViolationLimit times within
+// chatViolationWindow are muted for chatMuteDuration.
+const (
+	chatViolationLimit  = 3
+	chatViolationWindow = time.Minute
+	chatMuteDuration    = time.Minute
+)
+
+// postChat sends a player's chat message to their room, unless they are over
+// the chat rate or muted. It is cleaned of markup and unprintable
+// characters, and filtered words are starred out, or under the room's
+// reject policy the message is refused. Only the chat log keeps the message
+// as it was sent, for moderators.
+func postChat(player *Player, text string) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		if !allowChat(player, time.Now()) {
+			return
+		}
+		shown, ok := filterChat(room, player, text)
+		if !ok {
+			return
+		}
+		room.GameState.Chat.add(player.Name + ": " + shown)
+		logChat(room, player, text)
+		publish(room, ChatPosted{Player: player, Text: shown})
+		log.Printf("%s: %s", player.Name, shown)
+	})
+}
+
+// postTeamChat sends a player's chat message to their team only, tagged as
+// team chat. Like chat it is rate limited and filtered, but it stays out of
+// the room's chat history and event log; the room keeps it instead to show
+// spectators after the game, as its settings allow. Players with no cells
+// left keep talking to their team: losing the board doesn't take them out
+// of it. Outside team modes it is refused with NO_TEAM.
+func postTeamChat(player *Player, text string) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		if player.Team == "" {
+			sendError(player, "NO_TEAM", "team chat needs a team, and you are not on one")
+			return
+		}
+		if !allowChat(player, time.Now()) {
+			return
+		}
+		shown, ok := filterChat(room, player, text)
+		if !ok {
+			return
+		}
+		logTeamChat(room, player, text)
+		chat := ChatMessagePayload{PlayerID: player.ID, Name: player.Name, Message: shown, Channel: ChannelTeam, Team: player.Team}
+		room.GameState.TeamChat = append(room.GameState.TeamChat, chat)
+		if n := len(room.GameState.TeamChat); n > chatHistorySize {
+			room.GameState.TeamChat = slices.Delete(room.GameState.TeamChat, 0, n-chatHistorySize)
+		}
+		msg := Message{Type: "chat", Payload: chat}
+		for _, teammate := range room.Players {
+			if teammate.Team == player.Team && !teammate.mutes(player) {
+				sendMessage(teammate, msg)
+			}
+		}
+		log.Printf("%s to team %s: %s", player.Name, player.Team, shown)
+	})
+}
+
+// revealTeamChat shows the room's spectators the game's team chat, unless
+// the room's settings keep it from them. It must run on the room's
+// goroutine, as the game ends.
+func revealTeamChat(room *Room) {
+	if len(room.GameState.TeamChat) == 0 || room.Settings.SpectatorTeamChat == SpectatorTeamChatNever {
+		return
+	}
+	cache := newPayloadCache(Message{Type: "teamChatLog", Payload: TeamChatLogPayload{Messages: room.GameState.TeamChat}})
+	for _, spectator := range room.Spectators {
+		spectator.Deliver(cache)
+	}
+}
+
+// whisper sends a chat message from a player to one other player in their
+// room, found by ID or, failing that, by name, ignoring case. Only the two
+// of them see it, as a whisper message; it counts against the sender's chat
+// rate and is filtered like chat, but stays out of the room's chat history.
+// The chat log keeps it, marked private.
+func whisper(player *Player, to, text string) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		recipient, problem := whisperRecipient(room, to)
+		switch {
+		case recipient == player:
+			sendError(player, "INVALID_TARGET", "you can't whisper to yourself")
+			return
+		case problem != "":
+			sendError(player, problem, fmt.Sprintf("no player %q to whisper to", to))
+			return
+		case recipient.Conn == nil:
+			sendError(player, "TARGET_DISCONNECTED", fmt.Sprintf("%s is disconnected", recipient.Name))
+			return
+		}
+		if !allowChat(player, time.Now()) {
+			return
+		}
+		shown, ok := filterChat(room, player, text)
+		if !ok {
+			return
+		}
+		logWhisper(room, player, recipient, text)
+		msg := Message{
+			Type: "whisper",
+			Payload: WhisperMessagePayload{
+				FromID:   player.ID,
+				FromName: player.Name,
+				ToID:     recipient.ID,
+				ToName:   recipient.Name,
+				Message:  shown,
+			},
+		}
+		sendMessage(player, msg)
+		if !recipient.mutes(player) {
+			sendMessage(recipient, msg)
+		}
+	})
+}
+
+// whisperRecipient finds who a whisper is to, or says what is wrong with
+// to: UNKNOWN_PLAYER if nobody in the room goes by it, AMBIGUOUS_TARGET if
+// several players share the name. It must run on the room's goroutine.
+func whisperRecipient(room *Room, to string) (*Player, string) {
+	if recipient, ok := room.Players[to]; ok {
+		return recipient, ""
+	}
+	var found *Player
+	for _, other := range room.Players {
+		if !strings.EqualFold(other.Name, to) {
+			continue
+		}
+		if found != nil {
+			return nil, "AMBIGUOUS_TARGET"
+		}
+		found = other
+	}
+	if found == nil {
+		return nil, "UNKNOWN_PLAYER"
+	}
+	return found, ""
+}
+
+// filterChat cleans a message and applies the room's chat filter policy to
+// it, returning the text to show. A message with nothing left once cleaned,
+// or refused under the reject policy, gets the player an error, and ok
+// false. It must run on the room's goroutine.
+func filterChat(room *Room, player *Player, text string) (shown string, ok bool) {
+	text = cleanChat(text)
+	if text == "" {
+		sendError(player, "EMPTY_MESSAGE", "message has nothing in it that can be shown")
+		return "", false
+	}
+	shown, filtered := profanity.mask(text)
+	if filtered && room.Settings.ChatFilter == ChatFilterReject {
+		sendError(player, "CHAT_FILTERED", "message has words this room doesn't allow")
+		return "", false
+	}
+	return shown, true
+}
+
+// cleanChat makes chat text inert wherever a client shows it. It keeps only
+// printable characters, dropping control and formatting characters such as
+// bidi overrides and zero-width spaces, and drops < and > so no markup can
+// form even in a client that puts chat in a page as HTML. Every run of
+// whitespace, newlines included, becomes a single space. Escaping instead
+// would have text clients show the entities.
+func cleanChat(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case r == '<' || r == '>' || r == utf8.RuneError:
+		case unicode.IsGraphic(r):
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// playerName is the name a player without an account goes by when they
+// ask for name: name cleaned as chat is, or a neutral placeholder if that
+// leaves nothing or it has filtered words in it.
+func playerName(player *Player, name string) string {
+	if name = cleanChat(name); name != "" && !profanity.contains(name) {
+		return name
+	}
+	return "Player " + player.ID[:min(len(player.ID), 4)]
+}
+
+// renamePlayer gives a player who hasn't registered a name the one they
+// asked for. The room's goroutine reads the names of seated players, so it
+// renames them there; a player in the lobby is renamed under partiesMutex,
+// which a party's leader needs to queue them. A queued player keeps the name
+// they queued with, as the queue may be seating them.
+func renamePlayer(player *Player, name string) {
+	for {
+		if room := player.Room.Load(); room != nil {
+			room.do(func() { player.Name = playerName(player, name) })
+			return
+		}
+
+		partiesMutex.Lock()
+		queued := queue.Contains(player)
+		seated := player.Room.Load() != nil
+		if !queued && !seated {
+			player.Name = playerName(player, name)
+		}
+		partiesMutex.Unlock()
+
+		if queued {
+			sendError(player, "ALREADY_QUEUED", "names can't change while waiting for a room")
+			return
+		}
+		if !seated {
+			return
+		}
+	}
+}
+
+// allowChat takes one of the player's chat tokens, refilled at chatRate per
+// chatInterval. Without one, or while muted, it tells the player when they
+// may chat again and reports false; going over the rate too often mutes
+// them. Players the host muted for the room can't chat at all. It must run
+// on the room's goroutine.
+func allowChat(player *Player, now time.Time) bool {
+	if player.Room.Load().Muted[player.ID] {
+		sendError(player, "ROOM_MUTED", "the host has muted you in this room")
+		return false
+	}
+	if wait := player.chatMutedUntil.Sub(now); wait > 0 {
+		sendRetryError(player, "CHAT_MUTED", "you are muted for sending chat too fast", wait)
+		return false
+	}
+	if chatRate <= 0 {
+		return true
+	}
+
+	rate := float64(chatRate) / chatInterval.Seconds()
+	if player.chatRefilled.IsZero() {
+		player.chatTokens = float64(chatRate)
+	} else {
+		player.chatTokens = min(player.chatTokens+now.Sub(player.chatRefilled).Seconds()*rate, float64(chatRate))
+	}
+	player.chatRefilled = now
+	if player.chatTokens >= 1 {
+		player.chatTokens--
+		return true
+	}
+
+	if chatViolation(player, now) {
+		log.Printf("Muting %s for %v: over the chat rate %d times within %v",
+			player.ID, chatMuteDuration, len(player.chatViolations), chatViolationWindow)
+		player.chatViolations = nil
+		player.chatMutedUntil = now.Add(chatMuteDuration)
+		sendRetryError(player, "CHAT_MUTED", "you are muted for sending chat too fast", chatMuteDuration)
+		return false
+	}
+	wait := time.Duration((1 - player.chatTokens) / rate * float64(time.Second))
+	sendRetryError(player, "RATE_LIMITED", fmt.Sprintf("at most %d chat messages per %v", chatRate, chatInterval), wait)
+	return false
+}
+
+// resetChatRate gives the player a full chat allowance, as for a new
+// connection. Their violations and any mute are kept, so reconnecting
+// doesn't lift a mute. It must run on the room's goroutine.
+func resetChatRate(player *Player) {
+	player.chatTokens = 0
+	player.chatRefilled = time.Time{}
+}
+
+// chatViolation records a chat message over the player's rate and reports
+// whether they have gone over it chatViolationLimit times within
+// chatViolationWindow. It must run on the room's goroutine.
+func chatViolation(player *Player, now time.Time) bool {
+	recent := player.chatViolations[:0]
+	for _, at := range player.chatViolations {
+		if now.Sub(at) < chatViolationWindow {
+			recent = append(recent, at)
+		}
+	}
+	player.chatViolations = append(recent, now)
+	return len(player.chatViolations) >= chatViolationLimit
+}
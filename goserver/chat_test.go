@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/models"
+	"land/protocol"
+)
+
+// expectError waits for the client's next error and checks its code,
+// returning it.
+func expectError(t *testing.T, client *wstest.Client, code string) ErrorPayload {
+	t.Helper()
+	var e ErrorPayload
+	if err := client.ExpectMessage("error", expectTimeout).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != code {
+		t.Fatalf("error %s (%s), want %s", e.Code, e.Message, code)
+	}
+	return e
+}
+
+// A burst of chat is let through up to the rate, and the rest refused with
+// how long until it would be let through.
+func TestChatBurst(t *testing.T) {
+	setForTest(t, &chatRate, 3)
+	setForTest(t, &chatInterval, 10*time.Second)
+	server := startServer(t)
+	alice := server.join(t, server.createRoom(t, ""), "alice")
+
+	for range 5 {
+		alice.Chat("spam")
+	}
+	for range 3 {
+		expectChat(t, alice, "alice", "spam", "")
+	}
+	for range 2 {
+		e := expectError(t, alice, "RATE_LIMITED")
+		// The wait is rounded up to the millisecond.
+		if e.RetryAfterMs <= 0 || e.RetryAfterMs > (chatInterval/3+time.Millisecond).Milliseconds() {
+			t.Fatalf("retry after %dms, want up to a token's %v", e.RetryAfterMs, chatInterval/3)
+		}
+	}
+}
+
+// Going over the rate chatViolationLimit times mutes the player, and chat
+// sent while muted is refused too.
+func TestChatMute(t *testing.T) {
+	setForTest(t, &chatRate, 1)
+	server := startServer(t)
+	alice := server.join(t, server.createRoom(t, ""), "alice")
+	chatUntilMuted(t, alice, "alice")
+
+	alice.Chat("let me talk")
+	if e := expectError(t, alice, "CHAT_MUTED"); e.RetryAfterMs <= 0 || e.RetryAfterMs > chatMuteDuration.Milliseconds() {
+		t.Fatalf("muted for another %dms, want up to %v", e.RetryAfterMs, chatMuteDuration)
+	}
+}
+
+// A player who reconnects starts over with a full chat allowance, but stays
+// muted if they were.
+func TestChatRateResetsOnReconnect(t *testing.T) {
+	setForTest(t, &chatRate, 1)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	chatUntilMuted(t, alice, "alice")
+	expectChat(t, bob, "alice", "spam", "")
+
+	var session SessionPayload
+	if err := alice.ExpectMessage("session", expectTimeout).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	alice.Close()
+	bob.ExpectMessage("playerDisconnected", expectTimeout)
+
+	alice = wstest.Dial(t, server.URL+"/ws")
+	alice.Send("reconnect", ReconnectPayload{PlayerID: session.PlayerID, Token: session.Token})
+	alice.ExpectMessage("gameState", expectTimeout)
+	alice.Chat("back again")
+	if e := expectError(t, alice, "CHAT_MUTED"); e.RetryAfterMs <= 0 || e.RetryAfterMs > chatMuteDuration.Milliseconds() {
+		t.Fatalf("muted for another %dms, want up to %v", e.RetryAfterMs, chatMuteDuration)
+	}
+
+	// Once the mute is over, the allowance is full.
+	room.do(func() {
+		for _, player := range room.Players {
+			player.chatMutedUntil = time.Time{}
+		}
+	})
+	alice.Chat("back again")
+	expectChat(t, bob, "alice", "back again", "")
+}
+
+// chatUntilMuted has the client, allowed one chat message at a time, send
+// "spam" until it is muted for going over the rate.
+func chatUntilMuted(t *testing.T, client *wstest.Client, name string) {
+	t.Helper()
+	for range chatViolationLimit + 1 {
+		client.Chat("spam")
+	}
+	expectChat(t, client, name, "spam", "")
+	for range chatViolationLimit - 1 {
+		expectError(t, client, "RATE_LIMITED")
+	}
+	expectError(t, client, "CHAT_MUTED")
+}
+
+// Chat sent while a match is played is logged against the match once it is
+// recorded; chat from before it started isn't.
+func TestChatLogs(t *testing.T) {
+	useTestDB(t)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	bob.Chat("ready?")
+	expectChat(t, alice, "bob", "ready?", "")
+	expectChat(t, bob, "bob", "ready?", "")
+	server.startMatch(t, alice)
+	server.Clock.Advance(time.Second)
+	alice.Chat("gg")
+	expectChat(t, bob, "alice", "gg", "")
+
+	room.do(func() { endGame(room) })
+	match := waitForMatch(t, room)
+	var logs []models.ChatLog
+	if err := db.Where("room_id = ?", room.ID).Order("id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("%d chat messages logged, want 2", len(logs))
+	}
+	for i, want := range []struct {
+		name, text string
+		matchID    uint
+	}{
+		{"bob", "ready?", 0},
+		{"alice", "gg", match.ID},
+	} {
+		if got := logs[i]; got.Name != want.name || got.Text != want.text || got.MatchID != want.matchID {
+			t.Errorf("logged %s: %q in match %d, want %s: %q in match %d", got.Name, got.Text, got.MatchID, want.name, want.text, want.matchID)
+		}
+	}
+}
+
+// A room keeps its latest chatHistorySize lines in order however much is
+// said, and adding one allocates nothing.
+func TestChatHistory(t *testing.T) {
+	var h chatHistory
+	if got := h.list(); len(got) != 0 {
+		t.Fatalf("empty history lists %q", got)
+	}
+	for i := range 3 {
+		h.add(fmt.Sprint(i))
+	}
+	if got := h.list(); !slices.Equal(got, []string{"0", "1", "2"}) {
+		t.Fatalf("history = %q, want 0, 1, 2", got)
+	}
+
+	for i := 3; i < 5*chatHistorySize/2; i++ {
+		h.add(fmt.Sprint(i))
+	}
+	got := h.list()
+	if len(got) != chatHistorySize || got[0] != fmt.Sprint(3*chatHistorySize/2) || got[len(got)-1] != fmt.Sprint(5*chatHistorySize/2-1) {
+		t.Fatalf("history holds %d lines, %s to %s; want the latest %d", len(got), got[0], got[len(got)-1], chatHistorySize)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { h.add("line") }); allocs != 0 {
+		t.Fatalf("adding a line allocates %v times", allocs)
+	}
+}
+
+// A player joining late gets the room's recent chat once, in the snapshot
+// they join with; older chat and later state broadcasts don't carry it.
+func TestChatBacklogOnce(t *testing.T) {
+	setForTest(t, &chatRate, 0)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	const said = chatHistorySize + 5
+	line := func(i int) string { return fmt.Sprintf("line %03d", i) }
+	for i := range said {
+		alice.Chat(line(i))
+		expectChat(t, alice, "alice", line(i), "")
+	}
+
+	bob := server.join(t, room, "bob")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	server.startMatch(t, alice)
+	for range 3 {
+		server.tick(t, room)
+	}
+	bob.Send("ping", protocol.PingPayload{ClientTime: 1})
+	bob.ExpectMessage("pong", expectTimeout)
+
+	messages := bob.Messages()
+	for i := range said {
+		var carrying []string
+		for _, msg := range messages {
+			if strings.Contains(string(msg.Payload), "alice: "+line(i)) {
+				carrying = append(carrying, msg.Type)
+			}
+		}
+		want := 1
+		if i < said-chatHistorySize {
+			want = 0
+		}
+		if len(carrying) != want {
+			t.Fatalf("%s came in %d messages %v, want %d", line(i), len(carrying), carrying, want)
+		}
+	}
+}
+
+func TestCleanChat(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "gg wp", "gg wp"},
+		{"script tag", "<script>alert(1)</script>", "scriptalert(1)/script"},
+		{"img onerror", `<img src=x onerror="alert(1)">`, `img src=x onerror="alert(1)"`},
+		{"entities are left as typed", "&lt;b&gt;", "&lt;b&gt;"},
+		{"newlines", "line one\nline two\r\n\tthree", "line one line two three"},
+		{"leading and trailing space", "  \n hi \t ", "hi"},
+		{"bidi override", "abc\u202edcba\u202c", "abcdcba"},
+		{"zero-width characters", "g\u200bg\u200d\ufeff", "gg"},
+		{"control characters", "a\x00b\x1bc\x7f", "abc"},
+		{"invalid UTF-8", "a\xffb", "ab"},
+		{"other scripts", "héllo 你好 👋", "héllo 你好 👋"},
+		{"only markup", "<><>", ""},
+		{"only invisible", "\u200b\u202e\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanChat(tt.text); got != tt.want {
+				t.Fatalf("cleanChat(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// Chat reaches the room cleaned, so no client can be handed markup, while the
+// chat log keeps what was sent. A message with nothing left once cleaned is
+// refused.
+func TestChatIsInert(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &chatRate, 0)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+
+	sent := []string{
+		`<img src=x onerror="alert(1)">`,
+		"<script>\ndocument.cookie\n</script>",
+		"\u202eevil\u200b",
+	}
+	for _, text := range sent {
+		alice.Chat(text)
+		var chat ChatMessagePayload
+		if err := bob.ExpectMessage("chat", expectTimeout).Decode(&chat); err != nil {
+			t.Fatal(err)
+		}
+		if chat.Message != cleanChat(text) || strings.ContainsAny(chat.Message, "<>\n\u202e\u200b") {
+			t.Fatalf("%q was shown as %q", text, chat.Message)
+		}
+	}
+	alice.Chat("<>\u200b\n")
+	expectError(t, alice, "EMPTY_MESSAGE")
+
+	flushChatLogs()
+	var logs []models.ChatLog
+	if err := db.Where("room_id = ?", room.ID).Order("id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	for _, entry := range logs {
+		logged = append(logged, entry.Text)
+	}
+	if !slices.Equal(logged, sent) {
+		t.Fatalf("logged %q, want what was sent, %q", logged, sent)
+	}
+}
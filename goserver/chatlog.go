@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+const (
+	// chatLogQueue is how many chat messages can wait to be written. Past
+	// it, messages go unlogged rather than hold up their room.
+	chatLogQueue = 4096
+
+	// chatLogBatch is the most chat messages written at once, and
+	// chatLogFlushInterval the longest one waits to be.
+	chatLogBatch         = 100
+	chatLogFlushInterval = time.Second
+
+	// chatLogPruneInterval is how often the janitor deletes expired chat
+	// logs.
+	chatLogPruneInterval = time.Hour
+)
+
+// chatRetention is how long chat logs are kept, set by flag. Zero keeps
+// them forever.
+var chatRetention = 30 * 24 * time.Hour
+
+// chatLogRequest is a chat message to write, or, with flushed set, a
+// request to write everything queued before it and then close flushed.
+type chatLogRequest struct {
+	entry   models.ChatLog
+	flushed chan struct{}
+}
+
+var chatLogs = make(chan chatLogRequest, chatLogQueue)
+
+// logChat queues a chat message to be written to the chat logs. It never
+// blocks: with the queue full, the message is dropped.
+func logChat(room *Room, player *Player, text string) {
+	queueChatLog(room, chatLogEntry(room, player, text))
+}
+
+// logTeamChat is logChat for team chat, logged with the team.
+func logTeamChat(room *Room, player *Player, text string) {
+	entry := chatLogEntry(room, player, text)
+	entry.Team = player.Team
+	queueChatLog(room, entry)
+}
+
+// logWhisper is logChat for a whisper to recipient, logged as private.
+func logWhisper(room *Room, player, recipient *Player, text string) {
+	entry := chatLogEntry(room, player, text)
+	entry.Private = true
+	entry.RecipientID = recipient.ID
+	queueChatLog(room, entry)
+}
+
+func chatLogEntry(room *Room, player *Player, text string) models.ChatLog {
+	return models.ChatLog{
+		RoomID:    room.ID,
+		AccountID: player.AccountID,
+		PlayerID:  player.ID,
+		Name:      player.Name,
+		Text:      text,
+		SentAt:    room.Clock.Now(),
+	}
+}
+
+func queueChatLog(room *Room, entry models.ChatLog) {
+	if db == nil {
+		return
+	}
+	select {
+	case chatLogs <- chatLogRequest{entry: entry}:
+	default:
+		log.Printf("Chat log queue is full; dropping a message from room %s", room.ID)
+	}
+}
+
+// flushChatLogs returns once every chat message queued before it has been
+// written.
+func flushChatLogs() {
+	if db == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	chatLogs <- chatLogRequest{flushed: flushed}
+	<-flushed
+}
+
+// runChatLogWriter writes queued chat messages in batches, so rooms never
+// wait on the database for them. A failed batch is logged and dropped.
+func runChatLogWriter() {
+	ticker := time.NewTicker(chatLogFlushInterval)
+	defer ticker.Stop()
+
+	var batch []models.ChatLog
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := db.CreateInBatches(batch, chatLogBatch).Error; err != nil {
+			log.Printf("Failed to write %d chat logs: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case req := <-chatLogs:
+			if req.flushed != nil {
+				write()
+				close(req.flushed)
+				continue
+			}
+			batch = append(batch, req.entry)
+			if len(batch) >= chatLogBatch {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		}
+	}
+}
+
+// linkChatLogs ties the chat messages sent in a match's room while it was
+// played to the match. Messages still queued aren't linked, so flush them
+// first.
+func linkChatLogs(tx *gorm.DB, match models.Match) error {
+	return tx.Model(&models.ChatLog{}).
+		Where("room_id = ? AND match_id = ? AND sent_at BETWEEN ? AND ?", match.RoomID, 0, match.StartedAt, match.EndedAt).
+		Update("match_id", match.ID).Error
+}
+
+// anonymizeChatLogs takes the account's name off the chat messages it sent.
+func anonymizeChatLogs(tx *gorm.DB, accountID uint) error {
+	return tx.Model(&models.ChatLog{}).Where("account_id = ?", accountID).Update("name", deletedName).Error
+}
+
+// pruneChatLogs deletes the chat logs older than chatRetention.
+func pruneChatLogs(now time.Time) {
+	if db == nil || chatRetention <= 0 {
+		return
+	}
+	result := db.Where("sent_at < ?", now.Add(-chatRetention)).Delete(&models.ChatLog{})
+	if result.Error != nil {
+		log.Printf("Failed to prune chat logs: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Pruned %d expired chat logs", result.RowsAffected)
+	}
+}
+
+// matchChat serves the chat messages sent during a recorded match, oldest
+// first, whispers included, for moderators to review.
+func matchChat(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid match ID"})
+		return
+	}
+	if !requireDB(c) {
+		return
+	}
+
+	var match models.Match
+	if err := db.Select("id").First(&match, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load match"})
+		return
+	}
+	messages := []models.ChatLog{}
+	if err := db.Where("match_id = ?", id).Order("sent_at ASC").Order("id ASC").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load chat"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"matchID": id, "messages": messages})
+}
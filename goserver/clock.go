@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// Clock is where a room gets the time its game runs on: the lobby wait, the
+// countdown, the tick and the game clock. Rooms use realClock; a test can
+// set roomClock to a clock it advances by hand, such as wstest.Clock, so a
+// scenario plays out the same however slow the machine running it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	// Tick is time.NewTicker: a channel ticking every d until stop is
+	// called.
+	Tick(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+// roomClock is the clock new rooms are given.
+var roomClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) Tick(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
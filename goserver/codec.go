@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec is a wire encoding for websocket messages. Clients pick one in their
+// hello; everything after the handshake is written and read with it.
+type Codec interface {
+	Name() string
+	// FrameType is the websocket frame type the encoding is sent in.
+	FrameType() int
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// UnmarshalStrict is Unmarshal for inbound payloads: fields the target
+	// doesn't have are an error rather than ignored.
+	UnmarshalStrict(data []byte, v any) error
+}
+
+var (
+	jsonCodec    Codec = jsonEncoding{}
+	msgpackCodec Codec = msgpackEncoding{}
+)
+
+var codecs = map[string]Codec{
+	jsonCodec.Name():     jsonCodec,
+	msgpackCodec.Name():  msgpackCodec,
+	protobufCodec.Name(): protobufCodec,
+}
+
+// codecFor returns the codec with the given name, falling back to JSON for
+// clients that don't ask for one or ask for one we don't have.
+func codecFor(name string) Codec {
+	if codec, ok := codecs[name]; ok {
+		return codec
+	}
+	return jsonCodec
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) Name() string                       { return "json" }
+func (jsonEncoding) FrameType() int                     { return websocket.TextMessage }
+func (jsonEncoding) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonEncoding) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+func (jsonEncoding) UnmarshalStrict(data []byte, v any) error { return unmarshalStrictJSON(data, v) }
+
+func unmarshalStrictJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after payload")
+	}
+	return nil
+}
+
+// msgpackEncoding encodes MessagePack maps keyed by the same names as the
+// JSON encoding, so the two protocols only differ in framing.
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) Name() string   { return "msgpack" }
+func (msgpackEncoding) FrameType() int { return websocket.BinaryMessage }
+
+// encodeBuffers holds buffers for encoders to write into, so broadcasting
+// every tick doesn't grow a new one each time.
+var encodeBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func (msgpackEncoding) Marshal(v any) ([]byte, error) {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer encodeBuffers.Put(buf)
+
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func (msgpackEncoding) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (msgpackEncoding) UnmarshalStrict(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	return dec.Decode(v)
+}
+
+// RawPayload is a payload in its encoded form. Inbound payloads stay raw
+// until their type is known; outbound, a broadcast encodes its payload once
+// per codec and sends the same bytes to everyone using that codec.
+type RawPayload []byte
+
+func (r RawPayload) MarshalJSON() ([]byte, error) {
+	return r, nil
+}
+
+func (r *RawPayload) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+func (r RawPayload) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(msgpack.RawMessage(r))
+}
+
+func (r *RawPayload) DecodeMsgpack(dec *msgpack.Decoder) error {
+	raw, err := dec.DecodeRaw()
+	*r = RawPayload(raw)
+	return err
+}
+
+// payloadCache hands out a broadcast with its payload encoded for each
+// recipient's codec, encoding it only once per codec. The room encodes the
+// payload, which may refer to its state, and the write pumps of the
+// connections sharing the broadcast build their frames from it, so mu guards
+// the encodings.
+type payloadCache struct {
+	msg      Message
+	mu       sync.Mutex
+	encoded  map[Codec]RawPayload
+	prepared map[preparedKey]*websocket.PreparedMessage
+}
+
+// preparedKey identifies a broadcast frame. Frames differ only by codec and
+// the recipient's AckSeq, so recipients sharing both get the same frame:
+// spectators and clients that don't number their messages always do.
+type preparedKey struct {
+	codec  Codec
+	ackSeq uint64
+}
+
+func newPayloadCache(msg Message) *payloadCache {
+	return &payloadCache{
+		msg:      msg,
+		encoded:  make(map[Codec]RawPayload),
+		prepared: make(map[preparedKey]*websocket.PreparedMessage),
+	}
+}
+
+func (c *payloadCache) For(codec Codec) Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.forCodec(codec)
+}
+
+// Encode encodes the payload for codec ahead of building frames from it.
+func (c *payloadCache) Encode(codec Codec) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.encode(codec)
+	return err
+}
+
+func (c *payloadCache) encode(codec Codec) (RawPayload, error) {
+	if payload, ok := c.encoded[codec]; ok {
+		return payload, nil
+	}
+	payload, err := codec.Marshal(c.msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	c.encoded[codec] = payload
+	return payload, nil
+}
+
+// forCodec is For with c.mu held.
+func (c *payloadCache) forCodec(codec Codec) Message {
+	payload, err := c.encode(codec)
+	if err != nil {
+		log.Printf("Error encoding %s payload as %s: %v", c.msg.Type, codec.Name(), err)
+		return c.msg
+	}
+	msg := c.msg
+	msg.Payload = payload
+	return msg
+}
+
+// Size is the length of the payload encoded for codec.
+func (c *payloadCache) Size(codec Codec) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	payload, _ := c.encode(codec)
+	return len(payload)
+}
+
+// Prepared returns the broadcast as a websocket frame for codec and ackSeq.
+// A PreparedMessage also shares the compression work between connections
+// with the same compression settings.
+func (c *payloadCache) Prepared(codec Codec, ackSeq uint64) (*websocket.PreparedMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := preparedKey{codec: codec, ackSeq: ackSeq}
+	if prepared, ok := c.prepared[key]; ok {
+		return prepared, nil
+	}
+	msg := c.forCodec(codec)
+	msg.AckSeq = ackSeq
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := websocket.NewPreparedMessage(codec.FrameType(), data)
+	if err != nil {
+		return nil, err
+	}
+	c.prepared[key] = prepared
+	return prepared, nil
+}
+
+// writeMessage encodes msg with codec and queues it on conn.
+func writeMessage(conn Transport, codec Codec, msg Message) {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding %s as %s: %v", msg.Type, codec.Name(), err)
+		return
+	}
+	conn.Send(codec.FrameType(), data)
+}
+
+// EncodeMsgpack writes the phase as a string, like its JSON form; msgpack
+// would otherwise send the text as binary.
+func (p Phase) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeString(p.String())
+}
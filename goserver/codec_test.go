@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// benchmarkRoom connects players websocket clients, which negotiate
+// compression as browsers do and read everything they are sent, to
+// server-side Conns. Each client signals received once per message. If slow
+// is above zero, the last client is slow instead: it reads a message every
+// slow and signals nothing.
+func benchmarkRoom(b *testing.B, players int, slow time.Duration) (conns []*Conn, received chan struct{}) {
+	b.Helper()
+	accepted := make(chan *websocket.Conn)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		ws.SetCompressionLevel(compressionLevel)
+		accepted <- ws
+	}))
+	b.Cleanup(server.Close)
+
+	received = make(chan struct{}, players)
+	dialer := websocket.Dialer{EnableCompression: true}
+	for i := range players {
+		slowest := slow > 0 && i == players-1
+		ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { ws.Close() })
+		go func() {
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+				if slowest {
+					time.Sleep(slow)
+					continue
+				}
+				received <- struct{}{}
+			}
+		}()
+		conn := newConn(<-accepted)
+		b.Cleanup(conn.Close)
+		conns = append(conns, conn)
+	}
+	return conns, received
+}
+
+// BenchmarkBroadcast sends a 16-player room's tick snapshot to each of its
+// players and waits for them all to have it. At 10 Hz the room has 100ms
+// per tick for this and everything else. A shared broadcast encodes the
+// payload once and compresses the frame once; encoding it per player, as
+// broadcasts used to, does both sixteen times.
+func BenchmarkBroadcast(b *testing.B) {
+	const players = 16
+	discardLogs(b)
+	msg := Message{Type: "gameState", Payload: midGameState(b, players)}
+
+	tests := []struct {
+		name string
+		send func(conns []*Conn)
+	}{
+		{"shared", func(conns []*Conn) {
+			cache := newPayloadCache(msg)
+			for _, conn := range conns {
+				conn.SendBroadcast(jsonCodec, 0, cache)
+			}
+		}},
+		{"per player", func(conns []*Conn) {
+			for _, conn := range conns {
+				writeMessage(conn, jsonCodec, msg)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			conns, received := benchmarkRoom(b, players, 0)
+			b.ResetTimer()
+			for range b.N {
+				tt.send(conns)
+				for range players {
+					<-received
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTickJitter broadcasts a 16-player room's tick snapshot, as
+// BenchmarkBroadcast does, with one of the players reading a frame only
+// every 50ms, and reports how long the room's part of each tick took: the
+// median, the 99th percentile and the longest. Framing inline builds and
+// compresses every frame on the room goroutine, as broadcasts used to; on
+// the write pump the room only encodes the payload and queues it.
+func BenchmarkTickJitter(b *testing.B) {
+	const players = 16
+	discardLogs(b)
+	msg := Message{Type: "gameState", Payload: midGameState(b, players)}
+
+	tests := []struct {
+		name   string
+		inline bool
+	}{
+		{"framing inline", true},
+		{"framing on the write pump", false},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			conns, received := benchmarkRoom(b, players, 50*time.Millisecond)
+			ticks := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for range b.N {
+				start := time.Now()
+				cache := newPayloadCache(msg)
+				for _, conn := range conns {
+					if tt.inline {
+						if _, err := cache.Prepared(jsonCodec, 0); err != nil {
+							b.Fatal(err)
+						}
+					}
+					conn.SendBroadcast(jsonCodec, 0, cache)
+				}
+				ticks = append(ticks, time.Since(start))
+				for range players - 1 {
+					<-received
+				}
+			}
+			b.StopTimer()
+			slices.Sort(ticks)
+			percentile := func(p int) float64 {
+				return float64(ticks[(len(ticks)-1)*p/100].Microseconds())
+			}
+			b.ReportMetric(percentile(50), "p50-µs/tick")
+			b.ReportMetric(percentile(99), "p99-µs/tick")
+			b.ReportMetric(percentile(100), "max-µs/tick")
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"land/internal/game"
+	"land/protocol"
+)
+
+// midGameState is a snapshot of a room in the middle of a game on the
+// default board: players greedy bots, played until about half of it is
+// claimed.
+func midGameState(tb testing.TB, players int) GameStatePayload {
+	tb.Helper()
+	cfg := game.SimConfig{
+		Mode:        "classic",
+		BoardSize:   boardSize,
+		Interval:    time.Second,
+		Steal:       true,
+		SpawnRadius: 1,
+	}
+	for i := range players {
+		cfg.Players = append(cfg.Players, game.SimPlayer{
+			ID:     fmt.Sprintf("player%d", i),
+			Color:  playerColors[i%len(playerColors)],
+			Driver: game.GreedyBot{},
+		})
+	}
+	cfg.Duration = time.Duration(boardSize*boardSize/2/players) * cfg.Interval
+	result, err := game.Simulate(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	view := &StateView{Board: result.Match.Board}
+	for i, p := range cfg.Players {
+		view.Players = append(view.Players, PlayerState{
+			ID:    p.ID,
+			Name:  fmt.Sprintf("Player %d", i),
+			Color: p.Color,
+			Score: result.Match.Territory(p.Color),
+			X:     i,
+			Y:     i,
+		})
+	}
+	settings := defaultSettings()
+	return GameStatePayload{
+		RoomID:     "benchroom",
+		GameState:  view,
+		Remaining:  90,
+		EndsAt:     time.Now().Add(90 * time.Second).UnixMilli(),
+		Spectators: 1,
+		Phase:      PhaseInProgress.String(),
+		Settings:   (*protocol.RoomSettings)(&settings),
+	}
+}
+
+// Clients that offer permessage-deflate get it while the server has it on;
+// the rest, and everyone while it is off, speak uncompressed as before.
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   bool
+		client   bool
+		deflated bool
+	}{
+		{"both", true, true, true},
+		{"client doesn't offer", true, false, false},
+		{"server has it off", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setForTest(t, &upgrader.EnableCompression, tt.server)
+			server := startServer(t)
+
+			ws, resp := server.dialRaw(t, &websocket.Dialer{EnableCompression: tt.client})
+			if deflated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate"); deflated != tt.deflated {
+				t.Fatalf("permessage-deflate negotiated: %v, want %v", deflated, tt.deflated)
+			}
+
+			hello := Message{Type: "hello", Payload: protocol.HelloPayload{Version: protocol.Version, Client: "test"}}
+			if err := ws.WriteJSON(hello); err != nil {
+				t.Fatal(err)
+			}
+			var welcome Envelope
+			ws.SetReadDeadline(time.Now().Add(expectTimeout))
+			if err := ws.ReadJSON(&welcome); err != nil {
+				t.Fatal(err)
+			}
+			if welcome.Type != "welcome" {
+				t.Fatalf("got %s, want welcome", welcome.Type)
+			}
+		})
+	}
+}
+
+// discardLogs silences the log until the benchmark ends: gorilla/websocket
+// v1.5.1 logs a spurious close error for every compressed message it reads.
+func discardLogs(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// BenchmarkSnapshotCompression sends a four-player mid-game snapshot over a
+// websocket with and without permessage-deflate, reporting the bytes that
+// cross the wire per snapshot alongside the time it takes.
+func BenchmarkSnapshotCompression(b *testing.B) {
+	data, err := json.Marshal(Message{Type: "gameState", Payload: midGameState(b, 4)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Logf("snapshot is %d bytes of JSON", len(data))
+	discardLogs(b)
+
+	for _, level := range []int{0, flate.BestSpeed, 6, flate.BestCompression} {
+		name := "off"
+		if level != 0 {
+			name = fmt.Sprintf("level%d", level)
+		}
+		b.Run(name, func(b *testing.B) {
+			u := upgrader
+			u.EnableCompression = level != 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ws, err := u.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer ws.Close()
+				if level != 0 {
+					ws.SetCompressionLevel(level)
+				}
+				// Wait for the client to start counting.
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+				for range b.N {
+					if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			var read atomic.Int64
+			dialer := websocket.Dialer{
+				EnableCompression: level != 0,
+				NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					return countingConn{conn, &read}, err
+				},
+			}
+			ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer ws.Close()
+
+			read.Store(0)
+			b.ResetTimer()
+			if err := ws.WriteMessage(websocket.TextMessage, []byte("go")); err != nil {
+				b.Fatal(err)
+			}
+			for range b.N {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(read.Load())/float64(b.N), "wire-B/op")
+		})
+	}
+}
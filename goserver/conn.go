@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connection limits, set by flags.
+var (
+	// maxMessageSize is the largest frame read from a client, in bytes. A
+	// larger one fails the read, which closes the connection.
+	maxMessageSize int64 = 4096
+
+	// sendQueueSize is how many outbound frames a connection may have
+	// waiting for its write pump. Past half of it, state updates are
+	// dropped; snapshots and gameOver always get through. See sendQueue.
+	sendQueueSize = 64
+
+	// slowClientGrace is how long a connection's queue may stay saturated
+	// before the client is dropped as too slow.
+	slowClientGrace = 2 * time.Second
+
+	// writeWait is how long the write pump waits on a single frame.
+	writeWait = 10 * time.Second
+
+	// pongWait is how long a connection may go without reading anything,
+	// pongs included, before it is considered dead.
+	pongWait = 30 * time.Second
+
+	// pingInterval is how often the write pump pings. Pongs keep the
+	// connection alive and measure its round trip, so it is well under
+	// pongWait.
+	pingInterval = 5 * time.Second
+
+	// latencyWarning is the round trip above which a connection is logged
+	// as lagging.
+	latencyWarning = 300 * time.Millisecond
+)
+
+// Transport is the connection a client is attached through: a websocket
+// Conn, or a gRPC stream. Sends never block.
+type Transport interface {
+	// Send queues a message already encoded with the client's codec.
+	Send(frameType int, data []byte)
+	// SendBroadcast queues a broadcast encoded with codec for a client whose
+	// latest acknowledged seq is ackSeq, sharing the encoding with other
+	// recipients where the transport can. The payload is encoded before it
+	// returns; the transport may build the frame around it later, on its
+	// own goroutine.
+	SendBroadcast(codec Codec, ackSeq uint64, cache *payloadCache)
+	// CloseWith sends what is queued, then ends the connection with an
+	// application close code.
+	CloseWith(code int, reason string)
+	Close()
+	Latency() time.Duration
+	RemoteAddr() net.Addr
+	// Queued is how many frames are waiting to be written.
+	Queued() int
+	// Stale reports whether a state update was dropped since the last call,
+	// leaving the client in need of a full snapshot.
+	Stale() bool
+}
+
+// Conn is a websocket connection whose writes all go through its write pump.
+// gorilla/websocket allows a single writer at a time, and the game loop, the
+// reader goroutine and the janitors all send, so they queue frames instead of
+// writing them. Reads are left to the connection's reader goroutine.
+type Conn struct {
+	ws      *websocket.Conn
+	queued  *sendQueue[outboundFrame]
+	closing chan struct{}
+	once    sync.Once
+
+	// Set once closing is closed: whether frames already queued are still
+	// written, and the close frame to end with, if any.
+	flush    bool
+	closeMsg []byte
+
+	// rtt is the smoothed round trip in nanoseconds, zero until the first
+	// pong. lagging is only touched by the pong handler.
+	rtt     atomic.Int64
+	lagging bool
+}
+
+// outboundFrame is a queued frame: data of frameType, or a broadcast whose
+// frame the write pump builds for codec and ackSeq.
+type outboundFrame struct {
+	frameType int
+	data      []byte
+
+	broadcast *payloadCache
+	codec     Codec
+	ackSeq    uint64
+}
+
+// newConn wraps ws, arms its read limit and deadline and starts its write
+// pump.
+func newConn(ws *websocket.Conn) *Conn {
+	conn := &Conn{
+		ws:      ws,
+		queued:  newSendQueue[outboundFrame](),
+		closing: make(chan struct{}),
+	}
+	ws.SetReadLimit(maxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(conn.handlePong)
+	go conn.writePump()
+	return conn
+}
+
+// ReadMessage reads the next message. Any message counts as a sign of life
+// and pushes the read deadline back.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.ws.ReadMessage()
+	if err == nil {
+		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	return messageType, data, err
+}
+
+// Read is ReadMessage without the frame type.
+func (c *Conn) Read() ([]byte, error) {
+	_, data, err := c.ReadMessage()
+	return data, err
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+// Latency is the connection's smoothed round trip, or zero if it hasn't been
+// measured yet.
+func (c *Conn) Latency() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// handlePong extends the read deadline and, when the pong echoes one of our
+// pings, folds its round trip into the estimate the way TCP does, moving an
+// eighth of the way towards each sample.
+func (c *Conn) handlePong(data string) error {
+	if len(data) == 8 {
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(data))))
+		sample := time.Since(sent)
+		rtt := sample
+		if old := c.Latency(); old != 0 {
+			rtt = old + (sample-old)/8
+		}
+		c.rtt.Store(int64(rtt))
+
+		if lagging := rtt > latencyWarning; lagging != c.lagging {
+			c.lagging = lagging
+			if lagging {
+				log.Printf("Connection %s is lagging: %v round trip", c.RemoteAddr(), rtt.Round(time.Millisecond))
+			}
+		}
+	}
+	return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+}
+
+// Send queues a frame. It never blocks: while the queue is full frames are
+// dropped, and a client whose queue stays saturated for slowClientGrace is
+// disconnected.
+func (c *Conn) Send(frameType int, data []byte) {
+	c.queue(outboundFrame{frameType: frameType, data: data}, classNormal)
+}
+
+// SendBroadcast encodes the broadcast's payload and queues it for the write
+// pump, which wraps it in a prepared frame shared with other connections.
+// Framing and compressing it happen on the write pump, so a broadcast costs
+// the room one payload encoding per codec and a queued frame per recipient.
+func (c *Conn) SendBroadcast(codec Codec, ackSeq uint64, cache *payloadCache) {
+	if err := cache.Encode(codec); err != nil {
+		log.Printf("Error encoding %s payload as %s: %v", cache.msg.Type, codec.Name(), err)
+		return
+	}
+	c.queue(outboundFrame{broadcast: cache, codec: codec, ackSeq: ackSeq}, classify(cache.msg.Type))
+}
+
+func (c *Conn) queue(frame outboundFrame, class frameClass) {
+	select {
+	case <-c.closing:
+		return
+	default:
+	}
+	if c.queued.push(frame, class) {
+		log.Printf("Send queue for %s saturated for %v, dropping slow client", c.RemoteAddr(), c.queued.saturatedFor().Round(time.Millisecond))
+		c.stop(false, websocket.FormatCloseMessage(closeSlowClient, "slow client"))
+		// The write pump is likely stuck writing to the client; cut the write
+		// short rather than keep the client around until writeWait.
+		c.ws.NetConn().SetWriteDeadline(time.Now())
+	}
+}
+
+func (c *Conn) Queued() int {
+	return c.queued.Len()
+}
+
+func (c *Conn) Stale() bool {
+	return c.queued.Stale()
+}
+
+// CloseWith writes whatever is already queued, then a close frame with an
+// application close code, and closes the connection. The connection's read
+// loop then fails and runs the normal removal path.
+func (c *Conn) CloseWith(code int, reason string) {
+	c.stop(true, websocket.FormatCloseMessage(code, reason))
+}
+
+// Close closes the connection without writing anything still queued.
+func (c *Conn) Close() {
+	c.stop(false, nil)
+}
+
+func (c *Conn) stop(flush bool, closeMsg []byte) {
+	c.once.Do(func() {
+		c.flush = flush
+		c.closeMsg = closeMsg
+		close(c.closing)
+	})
+}
+
+// writePump owns the write side of the connection: it writes queued frames
+// in order, and pings in between, until the connection is closed or a write
+// fails.
+func (c *Conn) writePump() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	defer c.ws.Close()
+	for {
+		select {
+		case <-c.queued.ready:
+			select {
+			case <-c.closing:
+				continue
+			default:
+			}
+			frame, ok := c.queued.pop()
+			if !ok {
+				continue
+			}
+			if err := c.write(frame); err != nil {
+				log.Printf("Error writing message, closing connection: %v", err)
+				c.Close()
+				return
+			}
+		case now := <-ping.C:
+			sent := binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))
+			if err := c.ws.WriteControl(websocket.PingMessage, sent, now.Add(writeWait)); err != nil {
+				log.Printf("Error writing ping, closing connection: %v", err)
+				c.Close()
+				return
+			}
+		case <-c.closing:
+			for c.flush {
+				frame, ok := c.queued.pop()
+				if !ok {
+					break
+				}
+				if err := c.write(frame); err != nil {
+					return
+				}
+			}
+			if c.closeMsg != nil {
+				c.ws.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(time.Second))
+			}
+			return
+		}
+	}
+}
+
+func (c *Conn) write(frame outboundFrame) error {
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	if frame.broadcast != nil {
+		prepared, err := frame.broadcast.Prepared(frame.codec, frame.ackSeq)
+		if err != nil {
+			log.Printf("Error encoding %s as %s: %v", frame.broadcast.msg.Type, frame.codec.Name(), err)
+			return nil
+		}
+		return c.ws.WritePreparedMessage(prepared)
+	}
+	return c.ws.WriteMessage(frame.frameType, frame.data)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendQueue(t *testing.T) {
+	setForTest(t, &sendQueueSize, 4)
+	tests := []struct {
+		name   string
+		queued []frameClass
+		push   frameClass
+		want   []frameClass // the queue once it is pushed
+		stale  bool
+	}{
+		{"normal frame", []frameClass{classNormal}, classNormal, []frameClass{classNormal, classNormal}, false},
+		{"normal frame once full", []frameClass{classNormal, classNormal, classNormal, classNormal}, classNormal, []frameClass{classNormal, classNormal, classNormal, classNormal}, false},
+		{"update", []frameClass{classNormal}, classUpdate, []frameClass{classNormal, classUpdate}, false},
+		{"update past high water", []frameClass{classNormal, classNormal}, classUpdate, []frameClass{classNormal, classNormal}, true},
+		{"snapshot supersedes", []frameClass{classUpdate, classNormal, classSnapshot, classUpdate}, classSnapshot, []frameClass{classNormal, classSnapshot}, false},
+		{"snapshot once full", []frameClass{classNormal, classNormal, classNormal, classNormal}, classSnapshot, []frameClass{classNormal, classNormal, classNormal, classNormal, classSnapshot}, false},
+		{"critical once full", []frameClass{classNormal, classNormal, classNormal, classNormal}, classCritical, []frameClass{classNormal, classNormal, classNormal, classNormal, classCritical}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue[frameClass]()
+			for _, class := range tt.queued {
+				q.push(class, class)
+			}
+			q.Stale()
+			q.push(tt.push, tt.push)
+
+			var got []frameClass
+			for {
+				class, ok := q.pop()
+				if !ok {
+					break
+				}
+				got = append(got, class)
+			}
+			if !equalClasses(got, tt.want) {
+				t.Fatalf("queue = %v, want %v", got, tt.want)
+			}
+			if stale := q.Stale(); stale != tt.stale {
+				t.Fatalf("stale = %v, want %v", stale, tt.stale)
+			}
+		})
+	}
+}
+
+func equalClasses(a, b []frameClass) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A queue is too slow once it has stayed at its high-water mark for
+// slowClientGrace; draining it below the mark starts the grace over.
+func TestSendQueueTooSlow(t *testing.T) {
+	setForTest(t, &sendQueueSize, 4)
+	setForTest(t, &slowClientGrace, 20*time.Millisecond)
+	q := newSendQueue[int]()
+
+	for i := range highWater() {
+		if q.push(i, classNormal) {
+			t.Fatalf("too slow after %d frames", i+1)
+		}
+	}
+	time.Sleep(slowClientGrace)
+	for range highWater() {
+		q.pop()
+	}
+	if q.push(0, classNormal) || q.saturatedFor() != 0 {
+		t.Fatalf("saturated for %v after being drained", q.saturatedFor())
+	}
+	for i := 1; i < highWater(); i++ {
+		if q.push(i, classNormal) {
+			t.Fatal("too slow right after filling up again")
+		}
+	}
+	time.Sleep(slowClientGrace)
+	if !q.push(0, classUpdate) {
+		t.Fatalf("not too slow after %v saturated", q.saturatedFor())
+	}
+}
+
+// stalledClient joins the room over a connection with a tiny receive buffer
+// and then never reads, as a client whose tab froze would.
+func stalledClient(t *testing.T, server *testServer, room *Room, name string) {
+	t.Helper()
+	ws, _ := server.dialRaw(t, &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err == nil {
+				err = conn.(*net.TCPConn).SetReadBuffer(1024)
+			}
+			return conn, err
+		},
+	})
+	joinRaw(t, ws, room, name)
+}
+
+// A client that stops reading is dropped once its queue has been full for
+// slowClientGrace, well before a blocked write would time out, and has its
+// seat held like anyone whose connection drops.
+func TestStalledClientIsDropped(t *testing.T) {
+	setForTest(t, &sendQueueSize, 4)
+	setForTest(t, &slowClientGrace, 100*time.Millisecond)
+	setForTest(t, &chatRate, 0)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	stalledClient(t, server, room, "stalled")
+	var joined PlayerPayload
+	if err := alice.ExpectMessage("playerJoined", expectTimeout).Decode(&joined); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the server's send buffer small too, so that the stall reaches the
+	// write pump after a few frames.
+	room.do(func() {
+		ws := room.Players[joined.PlayerID].Conn.(*Conn).ws
+		if err := ws.NetConn().(*net.TCPConn).SetWriteBuffer(1024); err != nil {
+			t.Error(err)
+		}
+	})
+
+	start := time.Now()
+	for deadline := start.Add(writeWait / 2); ; {
+		if time.Now().After(deadline) {
+			t.Fatalf("stalled client still in the room after %v", time.Since(start))
+		}
+		alice.Chat(strings.Repeat("x", maxChatLength))
+		var disconnected bool
+		for _, msg := range alice.Messages() {
+			disconnected = disconnected || msg.Type == "playerDisconnected"
+		}
+		if disconnected {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var left PlayerPayload
+	if err := alice.ExpectMessage("playerDisconnected", expectTimeout).Decode(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left.PlayerID != joined.PlayerID {
+		t.Fatalf("%s was disconnected, want the stalled client %s", left.Name, joined.Name)
+	}
+	var connected bool
+	room.do(func() { connected = room.Players[joined.PlayerID].Conn != nil })
+	if connected {
+		t.Fatal("the stalled client's seat is held with its connection still attached")
+	}
+}
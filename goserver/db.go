@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// db is the database of accounts and match results. It is nil when the
+// server runs without persistence.
+var db *gorm.DB
+
+// DBConfig says which database to use and how. DSN is a file path for
+// SQLite and a connection string for Postgres. Zero pool settings leave
+// database/sql's defaults; ConnMaxIdleTime closes connections left idle
+// that long. ConnectTimeout is how long to keep retrying a
+// database that isn't up yet at startup. Migrate applies pending migrations
+// once connected; without it the server refuses a database that has any.
+type DBConfig struct {
+	Driver          string
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectTimeout  time.Duration
+	Migrate         bool
+}
+
+// dbConfig is the database configuration, set by flags.
+var dbConfig = DBConfig{
+	Driver:         "sqlite",
+	DSN:            "game.db",
+	ConnectTimeout: time.Minute,
+	Migrate:        true,
+}
+
+// Backoff between attempts to reach the database at startup.
+const (
+	dbRetryMin = 500 * time.Millisecond
+	dbRetryMax = 10 * time.Second
+)
+
+// dbPingTimeout bounds the database check of /healthz.
+const dbPingTimeout = 2 * time.Second
+
+// dialector is the gorm driver for the configured database.
+func (cfg DBConfig) dialector() (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "sqlite":
+		return sqlite.Open(cfg.DSN), nil
+	case "postgres":
+		return postgres.Open(cfg.DSN), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// openDB connects to the database and migrates it, exiting if it can't.
+// A database that can't be reached is retried with backoff until
+// ConnectTimeout runs out, so the server can start alongside it.
+func openDB(cfg DBConfig) {
+	dialector, err := cfg.dialector()
+	if err != nil {
+		log.Fatal("Failed to open database: ", err)
+	}
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	for wait := dbRetryMin; ; wait = min(wait*2, dbRetryMax) {
+		db, err = connectDB(dialector, cfg)
+		if err == nil {
+			break
+		}
+		if time.Now().Add(wait).After(deadline) {
+			log.Fatal("Failed to connect to database: ", err)
+		}
+		log.Printf("Database not ready, retrying in %v: %v", wait, err)
+		time.Sleep(wait)
+	}
+
+	migrateDB(db, cfg.Migrate)
+}
+
+// connectDB opens a connection pool and checks that the database answers.
+func connectDB(dialector gorm.Dialector, cfg DBConfig) (*gorm.DB, error) {
+	conn, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	pool, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+	if err := pool.Ping(); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// pingDB checks that the database answers within dbPingTimeout.
+func pingDB(ctx context.Context) error {
+	pool, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+	return pool.PingContext(ctx)
+}
+
+// closeDB closes the database's connection pool. Nothing may use the
+// database after it.
+func closeDB() {
+	if db == nil {
+		return
+	}
+	pool, err := db.DB()
+	if err == nil {
+		err = pool.Close()
+	}
+	if err != nil {
+		log.Printf("Failed to close database: %v", err)
+		return
+	}
+	log.Printf("Closed database")
+}
+
+// lookupRating returns the persisted rating of an account, or the default
+// rating for guests and accounts that can't be loaded.
+func lookupRating(accountID uint) float64 {
+	if db == nil || accountID == 0 {
+		return models.DefaultRating
+	}
+
+	var account models.Player
+	if err := db.First(&account, accountID).Error; err != nil {
+		log.Printf("Failed to load account %d: %v", accountID, err)
+		return models.DefaultRating
+	}
+	return account.Rating
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDialector(t *testing.T) {
+	tests := []struct {
+		driver string
+		name   string // the dialector's, empty for an error
+	}{
+		{"sqlite", "sqlite"},
+		{"postgres", "postgres"},
+		{"mysql", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			dialector, err := DBConfig{Driver: tt.driver, DSN: "unused"}.dialector()
+			if tt.name == "" {
+				if err == nil {
+					t.Fatalf("driver %q accepted", tt.driver)
+				}
+				return
+			}
+			if err != nil || dialector.Name() != tt.name {
+				t.Fatalf("dialector() = %v, %v; want %s", dialector, err, tt.name)
+			}
+		})
+	}
+}
+
+// The pool is set up as configured, and checked before it is handed out.
+func TestConnectDB(t *testing.T) {
+	cfg := DBConfig{Driver: "sqlite", DSN: "file:TestConnectDB?mode=memory&cache=shared", MaxOpenConns: 3, ConnMaxIdleTime: time.Minute}
+	dialector, err := cfg.dialector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := connectDB(dialector, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if open := pool.Stats().MaxOpenConnections; open != 3 {
+		t.Fatalf("pool allows %d open connections, want 3", open)
+	}
+
+	cfg = DBConfig{Driver: "sqlite", DSN: "file:/nonexistent/dir/game.db?mode=ro"}
+	dialector, _ = cfg.dialector()
+	if conn, err := connectDB(dialector, cfg); err == nil {
+		pool, _ := conn.DB()
+		pool.Close()
+		t.Fatal("connected to a database that can't be opened")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// debugAddr is the address of the debug server, set by a flag. Empty, the
+// default, leaves it off. It serves pprof and per-room timings, so it
+// belongs on a port only operators can reach.
+var debugAddr string
+
+// serveDebug runs the debug server on addr: net/http/pprof under
+// /debug/pprof/, the rooms' game loop measurements at /debug/rooms, session
+// revocation at /debug/accounts/{id}/revoke, closing the current season at
+// /debug/seasons/close and the audit log of those two at /admin/audit. It
+// has a mux of its own, so nothing it serves leaks onto the public router.
+func serveDebug(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/rooms", debugRoomsHandler)
+	mux.HandleFunc("POST /debug/accounts/{id}/revoke", debugRevokeHandler)
+	mux.HandleFunc("POST /debug/seasons/close", debugCloseSeasonHandler)
+	mux.HandleFunc("GET /admin/audit", debugAuditHandler)
+
+	log.Printf("Serving debug endpoints on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal("Failed to serve debug endpoints:", err)
+	}
+}
+
+// DebugRooms is what /debug/rooms serves: the process's goroutine count, how
+// many audit entries failed to be written and every room's game loop
+// measurements, slowest room first.
+type DebugRooms struct {
+	Goroutines    int             `json:"goroutines"`
+	AuditFailures int64           `json:"auditFailures"`
+	Broadcast     BroadcastStatus `json:"broadcast"`
+	Rooms         []DebugRoom     `json:"rooms"`
+}
+
+// DebugRoom is one room's game loop measurements and the depth of its
+// players' send queues. Subscribers counts the room's bus subscribers, each
+// of which has a goroutine.
+type DebugRoom struct {
+	ID          string        `json:"id"`
+	Phase       Phase         `json:"phase"`
+	Players     int           `json:"players"`
+	Spectators  int           `json:"spectators"`
+	Subscribers int           `json:"subscribers"`
+	Ticks       TickStatsView `json:"ticks"`
+	SendQueues  []QueueStatus `json:"sendQueues"`
+}
+
+func debugRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	report := DebugRooms{
+		Goroutines:    runtime.NumGoroutine(),
+		AuditFailures: auditFailures.Load(),
+		Broadcast:     throttle.Status(),
+		Rooms:         []DebugRoom{},
+	}
+	for _, room := range rooms.List() {
+		var view DebugRoom
+		if room.do(func() { view = debugRoom(room) }) {
+			report.Rooms = append(report.Rooms, view)
+		}
+	}
+	sort.Slice(report.Rooms, func(i, j int) bool {
+		return report.Rooms[i].Ticks.MaxTickUs > report.Rooms[j].Ticks.MaxTickUs
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to write /debug/rooms: %v", err)
+	}
+}
+
+// debugRoom gathers the room's measurements. Every connected player is
+// listed under SendQueues, deepest queue first, empty queues included. It
+// must run on the room's goroutine.
+func debugRoom(room *Room) DebugRoom {
+	view := DebugRoom{
+		ID:          room.ID,
+		Phase:       room.Phase,
+		Players:     len(room.Players),
+		Spectators:  len(room.Spectators),
+		Subscribers: len(room.Bus.subscribers),
+		Ticks:       room.TickStats.view(time.Now()),
+		SendQueues:  []QueueStatus{},
+	}
+	for _, player := range room.Players {
+		if player.Conn != nil {
+			view.SendQueues = append(view.SendQueues, QueueStatus{PlayerID: player.ID, Queued: player.Conn.Queued()})
+		}
+	}
+	sort.Slice(view.SendQueues, func(i, j int) bool { return view.SendQueues[i].Queued > view.SendQueues[j].Queued })
+	return view
+}
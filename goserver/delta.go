@@ -0,0 +1,148 @@
+package main
+
+import (
+	"time"
+
+	"land/internal/game"
+	"land/protocol"
+)
+
+// snapshotInterval is how often clients receiving deltas get a full gameState
+// anyway, as a safety net against anything a delta missed.
+var snapshotInterval = 5 * time.Second
+
+// The delta payloads are shared with the WASM client.
+type (
+	CellChange        = protocol.CellChange
+	PlayerDelta       = protocol.PlayerDelta
+	StateDeltaPayload = protocol.StateDeltaPayload
+)
+
+// DeltaState tracks what changed in a room since its last broadcast, beyond
+// the cells the match tracks itself, and when the room last sent snapshots.
+// It belongs to the room's goroutine.
+type DeltaState struct {
+	players      map[string]PlayerDelta
+	lastSnapshot time.Time
+	lastFull     time.Time
+
+	// Buffers reused from tick to tick. A delta's slices are only good
+	// until the next call to collectDelta, by which time the broadcast has
+	// been encoded.
+	changes []game.Position
+	cells   []CellChange
+	moved   []PlayerDelta
+	sent    map[string]PlayerDelta
+}
+
+// collectDelta returns the changes since the previous call and starts
+// tracking afresh. It must run on the room's goroutine.
+func collectDelta(room *Room, remaining time.Duration) StateDeltaPayload {
+	d := &room.Deltas
+	d.changes = room.Match.Changes(d.changes[:0])
+	delta := StateDeltaPayload{
+		Cells:      d.cells[:0],
+		Players:    d.moved[:0],
+		Remaining:  int(remaining.Seconds()),
+		EndsAt:     room.endsAt(),
+		Spectators: len(room.Spectators),
+		Phase:      room.Phase.String(),
+	}
+	for _, cell := range d.changes {
+		delta.Cells = append(delta.Cells, CellChange{X: cell.X, Y: cell.Y, Color: room.Match.Board.Owner(cell)})
+	}
+
+	if d.sent == nil {
+		d.sent = make(map[string]PlayerDelta, len(room.Players))
+	}
+	sent := d.sent
+	clear(sent)
+	for _, player := range room.roster() {
+		current := PlayerDelta{
+			PlayerID:  player.ID,
+			X:         player.Position.X,
+			Y:         player.Position.Y,
+			Score:     player.Score,
+			LatencyMs: player.LatencyMs,
+		}
+		if d.players[player.ID] != current {
+			delta.Players = append(delta.Players, current)
+		}
+		sent[player.ID] = current
+	}
+	d.players, d.sent = sent, d.players
+	d.cells, d.moved = delta.Cells, delta.Players
+
+	// Empty lists still go out as [] rather than null.
+	if delta.Cells == nil {
+		delta.Cells = []CellChange{}
+	}
+	if delta.Players == nil {
+		delta.Players = []PlayerDelta{}
+	}
+	return delta
+}
+
+// broadcastGameState sends the tick's state: a stateDelta to players who
+// negotiated deltas, and a full gameState to everyone else and, every
+// snapshotInterval, to everyone. While the throttle holds snapshots back,
+// players without deltas and spectators only get one once its gap has
+// passed. Players whose connections dropped updates get a snapshot to catch
+// up, throttle or not. It returns how many bytes it queued. It must run on
+// the room's goroutine.
+func broadcastGameState(room *Room, remaining time.Duration) int {
+	start := time.Now()
+	bytes := 0
+
+	for _, player := range room.Players {
+		if player.Conn != nil {
+			player.LatencyMs = int(player.Conn.Latency().Milliseconds())
+		}
+	}
+
+	snapshots := make(map[bool]*payloadCache)
+	full := func(compact bool) *payloadCache {
+		if snapshots[compact] == nil {
+			snapshots[compact] = newPayloadCache(Message{Type: "gameState", Payload: tickSnapshot(room, remaining, compact)})
+		}
+		return snapshots[compact]
+	}
+	delta := newPayloadCache(Message{Type: "stateDelta", Payload: collectDelta(room, remaining)})
+
+	resync := time.Since(room.Deltas.lastSnapshot) >= snapshotInterval
+	if resync {
+		room.Deltas.lastSnapshot = start
+	}
+	due := resync || time.Since(room.Deltas.lastFull) >= throttle.Gap()
+	if due {
+		room.Deltas.lastFull = start
+	}
+
+	for _, player := range room.Players {
+		if player.Conn == nil {
+			continue
+		}
+		stale := player.Conn.Stale()
+		var cache *payloadCache
+		switch {
+		case player.Deltas && !resync && !stale:
+			cache = delta
+		case due || stale:
+			cache = full(player.CompactBoard)
+		default:
+			continue
+		}
+		sendBroadcast(player, cache)
+		bytes += cache.Size(player.Codec)
+	}
+	if due {
+		for _, spectator := range room.Spectators {
+			spectator.Deliver(full(false))
+			// Counted as JSON, whatever the spectator's encoding.
+			bytes += full(false).Size(jsonCodec)
+		}
+	}
+
+	throttle.Record(time.Since(start), bytes)
+	return bytes
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"land/internal/game"
+)
+
+// Chat history goes out in the snapshot a client gets on joining, and not in
+// the tick's broadcasts, which only carry the game.
+func TestTickSnapshotsLeaveOutChat(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	alice.Chat("hello")
+	expectChat(t, alice, "alice", "hello", "")
+
+	bob := server.join(t, room, "bob")
+	state := lastState(t, bob)
+	if len(state.GameState.ChatMessages) != 1 {
+		t.Fatalf("joining snapshot carries chat %q, want alice's hello", state.GameState.ChatMessages)
+	}
+
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	server.startMatch(t, alice)
+	server.tick(t, room)
+	state = lastState(t, bob)
+	if state.GameState.ChatMessages != nil {
+		t.Fatalf("tick snapshot carries chat %q", state.GameState.ChatMessages)
+	}
+}
+
+// discardTransport is a connection that builds each broadcast's frame, as a
+// write pump would, and throws it away.
+type discardTransport struct{}
+
+func (discardTransport) Send(int, []byte) {}
+
+func (discardTransport) SendBroadcast(codec Codec, ackSeq uint64, cache *payloadCache) {
+	if _, err := cache.Prepared(codec, ackSeq); err != nil {
+		panic(err)
+	}
+}
+
+func (discardTransport) CloseWith(int, string)  {}
+func (discardTransport) Close()                 {}
+func (discardTransport) Latency() time.Duration { return 0 }
+func (discardTransport) RemoteAddr() net.Addr   { return &net.TCPAddr{} }
+func (discardTransport) Queued() int            { return 0 }
+func (discardTransport) Stale() bool            { return false }
+
+// BenchmarkTickBroadcast runs the ticks of a room of 8 players moving about,
+// with 50 lines of chat behind them, broadcasting to each as snapshots or
+// deltas in either codec. Run it with -benchmem: the allocations per tick
+// are what it guards.
+func BenchmarkTickBroadcast(b *testing.B) {
+	const players = 8
+	tests := []struct {
+		name   string
+		codec  Codec
+		deltas bool
+	}{
+		{"json snapshots", jsonCodec, false},
+		{"json deltas", jsonCodec, true},
+		{"msgpack snapshots", msgpackCodec, false},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			discardLogs(b)
+			testRooms(b)
+			setForTest(b, &throttle, &BroadcastThrottle{})
+			room := rooms.Create(0)
+			var seated []*Player
+			room.do(func() {
+				for i := range players {
+					player := createPlayer(discardTransport{}, fmt.Sprintf("player%d", i))
+					player.Name = fmt.Sprintf("Player %d", i)
+					player.Codec, player.Deltas = tt.codec, tt.deltas
+					assignColor(room, player)
+					player.seat = room.NextSeat
+					room.NextSeat++
+					room.Players[player.ID] = player
+					spawnPlayer(room, player)
+					seated = append(seated, player)
+				}
+				for i := range 50 {
+					room.GameState.Chat.add(fmt.Sprintf("Player %d: message %d", i%players, i))
+				}
+				room.setPhase(PhaseInProgress)
+				room.StartTime = room.Clock.Now()
+				room.Duration = time.Hour
+			})
+
+			directions := []string{"up", "right", "down", "left"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			running := true
+			room.do(func() {
+				for i := 0; i < b.N && running; i++ {
+					for _, player := range seated {
+						queueInput(room, game.Move{Player: &player.Player, Direction: directions[i/5%len(directions)]})
+					}
+					running = room.tick()
+				}
+			})
+			if !running {
+				b.Fatal("the game ended")
+			}
+		})
+	}
+}
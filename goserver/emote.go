@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"land/protocol"
+)
+
+var (
+	// emoteRate is how many emotes a player may send per emoteInterval, set
+	// by flags. It is counted apart from chat, so emoting doesn't use up a
+	// player's chat.
+	emoteRate     = 3
+	emoteInterval = 5 * time.Second
+)
+
+// sendEmote shows the room a player's emote, unless they are over the emote
+// rate. A locked emote they haven't unlocked gets an error. Emotes are
+// fleeting, so they stay out of the room's event log: a client catching up
+// on what it missed has no use for them.
+func sendEmote(player *Player, id string) {
+	room := player.Room.Load()
+	emote, _ := protocol.LookupEmote(id)
+	unlocked, err := emoteUnlocked(player.AccountID, emote)
+	if err != nil {
+		log.Printf("Failed to look up item %s of account %d: %v", emote.Item, player.AccountID, err)
+		sendError(player, "INTERNAL_ERROR", "failed to load unlocked emotes")
+		return
+	}
+	if !unlocked {
+		sendError(player, "EMOTE_LOCKED", fmt.Sprintf("emote %s is locked", id))
+		return
+	}
+
+	room.do(func() {
+		if !allowEmote(player, time.Now()) {
+			return
+		}
+		cache := newPayloadCache(Message{
+			Type:    "playerEmoted",
+			Payload: PlayerEmotedPayload{PlayerID: player.ID, Emote: emote.ID},
+		})
+		for _, other := range room.Players {
+			if !other.mutes(player) {
+				sendBroadcast(other, cache)
+			}
+		}
+		for _, spectator := range room.Spectators {
+			spectator.Deliver(cache)
+		}
+	})
+}
+
+// emoteUnlocked reports whether the account may show the emote: free
+// emotes anyone may, locked ones only accounts that bought their item.
+func emoteUnlocked(accountID uint, emote protocol.Emote) (bool, error) {
+	if emote.Item == "" {
+		return true, nil
+	}
+	if db == nil || accountID == 0 {
+		return false, nil
+	}
+	return owns(accountID, emote.Item)
+}
+
+// allowEmote takes one of the player's emote tokens, refilled at emoteRate
+// per emoteInterval. Without one it tells the player when they may emote
+// again and reports false. It must run on the room's goroutine.
+func allowEmote(player *Player, now time.Time) bool {
+	if emoteRate <= 0 {
+		return true
+	}
+
+	rate := float64(emoteRate) / emoteInterval.Seconds()
+	if player.emoteRefilled.IsZero() {
+		player.emoteTokens = float64(emoteRate)
+	} else {
+		player.emoteTokens = min(player.emoteTokens+now.Sub(player.emoteRefilled).Seconds()*rate, float64(emoteRate))
+	}
+	player.emoteRefilled = now
+	if player.emoteTokens >= 1 {
+		player.emoteTokens--
+		return true
+	}
+	wait := time.Duration((1 - player.emoteTokens) / rate * float64(time.Second))
+	sendRetryError(player, "RATE_LIMITED", fmt.Sprintf("at most %d emotes per %v", emoteRate, emoteInterval), wait)
+	return false
+}
+
+// listEmotes serves every emote, with the item that unlocks each locked one.
+func listEmotes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"emotes": protocol.Emotes})
+}
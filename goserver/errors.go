@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// JoinError is a structured reason for refusing a connection. Code is the
+// machine-readable value sent in the error message and CloseCode the
+// websocket close code that follows it.
+type JoinError struct {
+	Code      string
+	CloseCode int
+	Message   string
+}
+
+func (e *JoinError) Error() string {
+	return e.Message
+}
+
+var (
+	errRoomFull     = &JoinError{Code: "ROOM_FULL", CloseCode: closeRoomFull, Message: "room is full"}
+	errRoomNotFound = &JoinError{Code: "ROOM_NOT_FOUND", CloseCode: closeRoomNotFound, Message: "room not found"}
+	errGameStarted  = &JoinError{Code: "GAME_STARTED", CloseCode: closeGameStarted, Message: "game already started"}
+	errBanned       = &JoinError{Code: "BANNED", CloseCode: closeBanned, Message: "banned from room"}
+	errServerFull   = &JoinError{Code: "SERVER_FULL", CloseCode: closeServerFull, Message: "server is full"}
+)
+
+// rejectConnection tells the client why it is being turned away and then
+// closes the websocket with the matching application close code.
+func rejectConnection(conn Transport, codec Codec, err *JoinError) {
+	log.Printf("Rejecting connection from %s: %s", conn.RemoteAddr(), err.Message)
+
+	writeError(conn, codec, err.Code, err.Message)
+	conn.CloseWith(err.CloseCode, err.Message)
+}
+
+// sendError tells a player that something they asked for was refused. It
+// is called while handling the message, so the offending message's sequence
+// number is the player's latest.
+func sendError(player *Player, code, message string) {
+	sendMessage(player, Message{
+		Type:    "error",
+		Payload: ErrorPayload{Code: code, Message: message, Seq: player.Seq.Load()},
+	})
+}
+
+// sendRetryError is sendError for a refusal that passes, saying how long
+// until it does.
+func sendRetryError(player *Player, code, message string, wait time.Duration) {
+	sendMessage(player, Message{
+		Type:    "error",
+		Payload: ErrorPayload{Code: code, Message: message, Seq: player.Seq.Load(), RetryAfterMs: (wait + time.Millisecond - 1).Milliseconds()},
+	})
+}
+
+// sendDecodeError tells a player why their message couldn't be decoded.
+func sendDecodeError(player *Player, err *DecodeError) {
+	sendMessage(player, Message{
+		Type:    "error",
+		Payload: ErrorPayload{Code: err.Code, Message: err.Error(), Field: err.Field, Seq: player.Seq.Load()},
+	})
+}
+
+// writeError is sendError for a connection that has no player attached.
+func writeError(conn Transport, codec Codec, code, message string) {
+	writeMessage(conn, codec, Message{
+		Type:    "error",
+		Payload: ErrorPayload{Code: code, Message: message},
+	})
+}
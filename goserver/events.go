@@ -0,0 +1,88 @@
+package main
+
+import "time"
+
+// Event log limits, set by flags. Events past either limit are dropped, and a
+// player reconnecting after one of their missed events was dropped gets a
+// full snapshot instead of a replay.
+var (
+	eventLogSize      = 256
+	eventLogRetention = time.Minute
+)
+
+// RoomEvent is a broadcast remembered for replay to reconnecting players.
+type RoomEvent struct {
+	ID      uint64
+	At      time.Time
+	Message Message
+}
+
+// EventLog is a room's bounded log of recent broadcasts. Event IDs start at
+// 1 and increase by one per event. It belongs to the room's goroutine.
+type EventLog struct {
+	events []RoomEvent
+	lastID uint64
+}
+
+// Append records msg as the next event and returns its ID.
+func (l *EventLog) Append(msg Message) uint64 {
+	l.lastID++
+	msg.EventID = l.lastID
+	l.events = append(l.events, RoomEvent{ID: l.lastID, At: time.Now(), Message: msg})
+	l.trim()
+	return l.lastID
+}
+
+// Since returns the events after id. It reports false when some of them have
+// already been dropped from the log.
+func (l *EventLog) Since(id uint64) ([]RoomEvent, bool) {
+	l.trim()
+	if id >= l.lastID {
+		return nil, true
+	}
+	oldest := l.lastID + 1
+	if len(l.events) > 0 {
+		oldest = l.events[0].ID
+	}
+	if id+1 < oldest {
+		return nil, false
+	}
+	return l.events[id+1-oldest:], true
+}
+
+func (l *EventLog) trim() {
+	drop := max(len(l.events)-eventLogSize, 0)
+	for drop < len(l.events) && time.Since(l.events[drop].At) > eventLogRetention {
+		drop++
+	}
+	if drop > 0 {
+		// Shift what is left down rather than reslicing, so the log keeps
+		// reusing its array instead of growing a new one every few events.
+		n := copy(l.events, l.events[drop:])
+		clear(l.events[n:])
+		l.events = l.events[:n]
+	}
+}
+
+// replayEvents sends a reconnecting player what they missed since lastEventID,
+// leaving out chat from players they muted, as it was left out live. If the
+// log no longer reaches back that far, it sends a full snapshot and a resync
+// message saying so. It must run on the room's goroutine.
+func replayEvents(player *Player, room *Room, lastEventID uint64) {
+	events, ok := room.Events.Since(lastEventID)
+	if !ok {
+		sendMessage(player, Message{
+			Type:    "resync",
+			Payload: ResyncPayload{Reason: "missed events are no longer available"},
+		})
+		sendInitialState(player)
+		return
+	}
+
+	sendSession(player)
+	for _, event := range events {
+		if !player.mutes(chatSender(room, event.Message)) {
+			sendMessage(player, event.Message)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// FriendEntry is one row of a friends listing.
+type FriendEntry struct {
+	AccountID uint   `json:"accountID"`
+	Name      string `json:"name"`
+	Online    bool   `json:"online"`
+}
+
+// listFriends serves the friends of the account the request's token is for,
+// with the requests it has sent and received.
+func listFriends(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	id := sessionAccount(c).ID
+
+	var links []models.FriendLink
+	if err := db.Where("player_id = ? OR friend_id = ?", id, id).Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load friends"})
+		return
+	}
+
+	friends, incoming, outgoing := []FriendEntry{}, []FriendEntry{}, []FriendEntry{}
+	for _, link := range links {
+		other := link.FriendID
+		if other == id {
+			other = link.PlayerID
+		}
+		entry := friendEntry(other)
+		switch {
+		case link.Status == models.FriendAccepted:
+			friends = append(friends, entry)
+		case link.FriendID == id:
+			incoming = append(incoming, entry)
+		default:
+			outgoing = append(outgoing, entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"friends": friends, "incoming": incoming, "outgoing": outgoing})
+}
+
+// requestFriend sends a friend request from the account the request's token
+// is for, or accepts the pending request the other account already sent.
+func requestFriend(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	id := sessionAccount(c).ID
+	var req struct {
+		FriendID uint `json:"friendID" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FriendID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot befriend yourself"})
+		return
+	}
+	if err := db.First(&models.Player{}, req.FriendID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	}
+
+	var link models.FriendLink
+	err := db.Where("(player_id = ? AND friend_id = ?) OR (player_id = ? AND friend_id = ?)",
+		id, req.FriendID, req.FriendID, id).First(&link).Error
+	switch {
+	case err == nil && link.PlayerID == req.FriendID && link.Status == models.FriendPending:
+		link.Status = models.FriendAccepted
+		if err := db.Save(&link).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept friend request"})
+			return
+		}
+		notifyAccount(req.FriendID, Message{Type: "friendAccepted", Payload: FriendPayload{AccountID: id, Name: accountName(id)}})
+		c.JSON(http.StatusOK, link)
+		return
+	case err == nil:
+		c.JSON(http.StatusConflict, gin.H{"error": "Friend request already exists"})
+		return
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load friends"})
+		return
+	}
+
+	link = models.FriendLink{PlayerID: id, FriendID: req.FriendID, Status: models.FriendPending}
+	if err := db.Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create friend request"})
+		return
+	}
+	notifyAccount(req.FriendID, Message{Type: "friendRequest", Payload: FriendPayload{AccountID: id, Name: accountName(id)}})
+	c.JSON(http.StatusCreated, link)
+}
+
+// acceptFriend accepts a friend request sent to the account the request's
+// token is for.
+func acceptFriend(c *gin.Context) {
+	friendID, ok := accountParam(c, "friendID")
+	if !ok || !requireDB(c) {
+		return
+	}
+	id := sessionAccount(c).ID
+
+	var link models.FriendLink
+	err := db.Where("player_id = ? AND friend_id = ? AND status = ?", friendID, id, models.FriendPending).First(&link).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+		return
+	}
+	link.Status = models.FriendAccepted
+	if err := db.Save(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept friend request"})
+		return
+	}
+
+	notifyAccount(friendID, Message{Type: "friendAccepted", Payload: FriendPayload{AccountID: id, Name: accountName(id)}})
+	c.JSON(http.StatusOK, link)
+}
+
+// removeFriend declines a pending request to the account the request's
+// token is for, or ends one of its friendships. The link is hard-deleted so a
+// new request can be sent later.
+func removeFriend(c *gin.Context) {
+	friendID, ok := accountParam(c, "friendID")
+	if !ok || !requireDB(c) {
+		return
+	}
+	id := sessionAccount(c).ID
+
+	result := db.Unscoped().Where("(player_id = ? AND friend_id = ?) OR (player_id = ? AND friend_id = ?)",
+		id, friendID, friendID, id).Delete(&models.FriendLink{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove friend"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Friend not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// inviteFriend asks an online friend to join the player's current room.
+func inviteFriend(player *Player, friendID uint) {
+	if !player.registered() {
+		sendError(player, "NOT_SIGNED_IN", "sign in to invite friends")
+		return
+	}
+	room := player.Room.Load()
+	if room == nil {
+		sendError(player, "NOT_IN_ROOM", "not in a room")
+		return
+	}
+	if !areFriends(player.AccountID, friendID) {
+		sendError(player, "NOT_FRIENDS", "not friends with that player")
+		return
+	}
+	friend := connected.ByAccount(friendID)
+	if friend == nil {
+		sendError(player, "FRIEND_OFFLINE", "friend is offline")
+		return
+	}
+
+	sendMessage(friend, Message{
+		Type: "friendInvite",
+		Payload: RoomInvitePayload{
+			AccountID: player.AccountID,
+			Name:      player.Name,
+			RoomID:    room.ID,
+			JoinCode:  room.JoinCode,
+		},
+	})
+}
+
+// notifyFriends tells every online friend of the player's account about a
+// presence change.
+func notifyFriends(player *Player, msgType string) {
+	for _, id := range friendIDs(player.AccountID) {
+		notifyAccount(id, Message{
+			Type:    msgType,
+			Payload: FriendPayload{AccountID: player.AccountID, Name: player.Name},
+		})
+	}
+}
+
+// notifyAccount sends msg to the account's live connection, if it has one.
+func notifyAccount(accountID uint, msg Message) {
+	if player := connected.ByAccount(accountID); player != nil {
+		sendMessage(player, msg)
+	}
+}
+
+func friendIDs(accountID uint) []uint {
+	if db == nil {
+		return nil
+	}
+
+	var links []models.FriendLink
+	err := db.Where("(player_id = ? OR friend_id = ?) AND status = ?", accountID, accountID, models.FriendAccepted).Find(&links).Error
+	if err != nil {
+		log.Printf("Failed to load friends of account %d: %v", accountID, err)
+		return nil
+	}
+
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		if link.PlayerID == accountID {
+			ids = append(ids, link.FriendID)
+		} else {
+			ids = append(ids, link.PlayerID)
+		}
+	}
+	return ids
+}
+
+func areFriends(a, b uint) bool {
+	for _, id := range friendIDs(a) {
+		if id == b {
+			return true
+		}
+	}
+	return false
+}
+
+func friendEntry(accountID uint) FriendEntry {
+	return FriendEntry{
+		AccountID: accountID,
+		Name:      accountName(accountID),
+		Online:    connected.ByAccount(accountID) != nil,
+	}
+}
+
+func accountName(accountID uint) string {
+	var account models.Player
+	if err := db.First(&account, accountID).Error; err != nil {
+		return ""
+	}
+	return account.Name
+}
+
+// accountParam parses a numeric account ID from the URL, answering 400 if it
+// isn't one.
+func accountParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid player ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// requireDB answers 503 when the server runs without a database.
+func requireDB(c *gin.Context) bool {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Persistence is disabled"})
+		return false
+	}
+	return true
+}
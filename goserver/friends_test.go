@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFriendRoutesNeedASession(t *testing.T) {
+	useTestDB(t)
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/players/me/friends"},
+		{http.MethodPost, "/players/me/friends"},
+		{http.MethodPost, "/players/me/friends/1/accept"},
+		{http.MethodPost, "/players/me/friends/1/decline"},
+		{http.MethodDelete, "/players/me/friends/1"},
+	} {
+		w := serveRequest(t, route.method, route.path, "", "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token: status %d, want 401", route.method, route.path, w.Code)
+		}
+	}
+}
+
+func TestFriendRequestActsForTheSignedInAccount(t *testing.T) {
+	useTestDB(t)
+	alice, aliceToken := newAccount(t, "alice")
+	bob, bobToken := newAccount(t, "bob")
+	_, malloryToken := newAccount(t, "mallory")
+
+	w := serveRequest(t, http.MethodPost, "/players/me/friends", aliceToken, fmt.Sprintf(`{"friendID":%d}`, bob.ID))
+	expectStatus(t, w, http.StatusCreated)
+
+	// Only Bob may accept Alice's request to him.
+	accept := fmt.Sprintf("/players/me/friends/%d/accept", alice.ID)
+	expectStatus(t, serveRequest(t, http.MethodPost, accept, malloryToken, ""), http.StatusNotFound)
+	expectStatus(t, serveRequest(t, http.MethodPost, accept, aliceToken, ""), http.StatusNotFound)
+	expectStatus(t, serveRequest(t, http.MethodPost, accept, bobToken, ""), http.StatusOK)
+
+	var listing struct {
+		Friends []FriendEntry `json:"friends"`
+	}
+	decodeBody(t, serveRequest(t, http.MethodGet, "/players/me/friends", aliceToken, ""), &listing)
+	if len(listing.Friends) != 1 || listing.Friends[0].AccountID != bob.ID {
+		t.Fatalf("alice's friends = %+v, want bob", listing.Friends)
+	}
+
+	// Nor may anyone else end their friendship.
+	remove := fmt.Sprintf("/players/me/friends/%d", bob.ID)
+	expectStatus(t, serveRequest(t, http.MethodDelete, remove, malloryToken, ""), http.StatusNotFound)
+	expectStatus(t, serveRequest(t, http.MethodDelete, remove, aliceToken, ""), http.StatusNoContent)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"land/pb"
+)
+
+// grpcAddr is where the gRPC API listens, set by a flag. Empty disables it.
+var grpcAddr = ":9090"
+
+var errStreamClosed = errors.New("stream closed")
+
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(int(maxMessageSize)))
+	pb.RegisterLandServer(server, landServer{})
+	return server
+}
+
+// serveGRPC serves the Land service on addr until the server is stopped.
+func serveGRPC(server *grpc.Server, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal("Failed to listen for gRPC:", err)
+	}
+	log.Printf("Serving gRPC on %s", addr)
+	if err := server.Serve(listener); err != nil {
+		log.Fatal("Failed to serve gRPC:", err)
+	}
+}
+
+// landServer implements the Land gRPC service on top of the same rooms and
+// session handling as the websocket endpoint.
+type landServer struct {
+	pb.UnimplementedLandServer
+}
+
+// JoinRoom runs a session over the stream. The call stands in for the
+// websocket handshake: the client speaks the current protocol in protobuf,
+// listing its features in "features" metadata, and "room", "code",
+// "spectate" and "token" metadata play the part of the websocket URL's
+// query.
+func (landServer) JoinRoom(stream pb.Land_JoinRoomServer) error {
+	if isShuttingDown() {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	ip := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			ip = addr.IP.String()
+		}
+	}
+	account, joinErr := authenticate(first("token"), ClientInfo{UserAgent: first("user-agent"), IP: ip})
+	if joinErr != nil {
+		return status.Error(codes.Unauthenticated, joinErr.Message)
+	}
+
+	conn := newStreamTransport(stream)
+	hello := &HelloPayload{
+		Version:  maxProtocol,
+		Client:   "grpc",
+		Encoding: protobufCodec.Name(),
+		Features: md.Get("features"),
+	}
+	id := generatePlayerID()
+	sendWelcome(conn, protobufCodec, hello, id, account, first("room"))
+
+	serveSession(Session{
+		Conn:     conn,
+		Read:     conn.Read,
+		Codec:    protobufCodec,
+		Hello:    hello,
+		ID:       id,
+		Account:  account,
+		IP:       ip,
+		RoomID:   first("room"),
+		JoinCode: first("code"),
+		Spectate: first("spectate") == "1",
+	})
+	return conn.finish()
+}
+
+// ListRooms returns the public rooms, as GET /rooms does.
+func (landServer) ListRooms(ctx context.Context, req *pb.ListRoomsRequest) (*pb.ListRoomsResponse, error) {
+	resp := &pb.ListRoomsResponse{}
+	for _, info := range publicRooms() {
+		resp.Rooms = append(resp.Rooms, &pb.RoomInfo{
+			Id:           info.ID,
+			Phase:        info.Phase.String(),
+			Players:      int32(info.Players),
+			MaxPlayers:   int32(info.MaxPlayers),
+			Spectators:   int32(info.Spectators),
+			TickInterval: int32(info.TickInterval),
+		})
+	}
+	return resp, nil
+}
+
+// GetRoomState returns a snapshot of the room, as spectators get it. A
+// private room is only shown given its join code, and is otherwise reported
+// missing, as GET /rooms/:id/state does.
+func (landServer) GetRoomState(ctx context.Context, req *pb.GetRoomStateRequest) (*pb.GameStatePayload, error) {
+	room, ok := rooms.Get(req.GetRoomId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", req.GetRoomId())
+	}
+	var state *pb.GameStatePayload
+	if !room.do(func() {
+		if room.Private && req.GetJoinCode() != room.JoinCode {
+			return
+		}
+		state = gameStateToProto(snapshot(room, room.remaining(), false))
+	}) || state == nil {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", req.GetRoomId())
+	}
+	return state, nil
+}
+
+// streamTransport is a JoinRoom stream as a Transport. As with Conn, every
+// send goes through a write pump, since a stream allows one sender at a
+// time, and the queue has the same overflow policy. Ending the stream is
+// up to JoinRoom, so CloseWith records the close code for the status the
+// call ends with and makes Read fail, which ends the session.
+type streamTransport struct {
+	stream  pb.Land_JoinRoomServer
+	queued  *sendQueue[*pb.Envelope]
+	recv    chan *pb.Envelope
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	// recvErr is why the read pump stopped, set before it closes recv.
+	recvErr error
+
+	// Set once closing is closed: whether queued envelopes are still sent,
+	// and the close code and reason to end the call with, if any.
+	flush  bool
+	code   int
+	reason string
+}
+
+func newStreamTransport(stream pb.Land_JoinRoomServer) *streamTransport {
+	t := &streamTransport{
+		stream:  stream,
+		queued:  newSendQueue[*pb.Envelope](),
+		recv:    make(chan *pb.Envelope),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.readPump()
+	go t.writePump()
+	return t
+}
+
+// Read returns the next envelope from the client, re-encoded so it goes
+// through decodeMessage like a websocket frame would.
+func (t *streamTransport) Read() ([]byte, error) {
+	select {
+	case env, ok := <-t.recv:
+		if !ok {
+			return nil, t.recvErr
+		}
+		return proto.Marshal(env)
+	case <-t.closing:
+		return nil, errStreamClosed
+	}
+}
+
+func (t *streamTransport) RemoteAddr() net.Addr {
+	if p, ok := peer.FromContext(t.stream.Context()); ok {
+		return p.Addr
+	}
+	return nil
+}
+
+// Latency is always zero: gRPC keeps its pings to itself.
+func (t *streamTransport) Latency() time.Duration {
+	return 0
+}
+
+// Send queues a message encoded with protobufCodec, the only codec a stream
+// speaks.
+func (t *streamTransport) Send(frameType int, data []byte) {
+	t.send(frameType, data, classNormal)
+}
+
+func (t *streamTransport) send(frameType int, data []byte, class frameClass) {
+	env := &pb.Envelope{}
+	if err := proto.Unmarshal(data, env); err != nil {
+		log.Printf("Error decoding envelope for %s: %v", t.RemoteAddr(), err)
+		return
+	}
+	t.queue(env, class)
+}
+
+func (t *streamTransport) SendBroadcast(codec Codec, ackSeq uint64, cache *payloadCache) {
+	msg := cache.For(codec)
+	msg.AckSeq = ackSeq
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding %s as %s: %v", msg.Type, codec.Name(), err)
+		return
+	}
+	t.send(codec.FrameType(), data, classify(msg.Type))
+}
+
+func (t *streamTransport) queue(env *pb.Envelope, class frameClass) {
+	select {
+	case <-t.closing:
+		return
+	default:
+	}
+	if t.queued.push(env, class) {
+		log.Printf("Send queue for %s saturated for %v, dropping slow client", t.RemoteAddr(), t.queued.saturatedFor().Round(time.Millisecond))
+		t.stop(false, closeSlowClient, "slow client")
+	}
+}
+
+func (t *streamTransport) Queued() int {
+	return t.queued.Len()
+}
+
+func (t *streamTransport) Stale() bool {
+	return t.queued.Stale()
+}
+
+// CloseWith sends whatever is already queued, then ends the call with the
+// close code in its status.
+func (t *streamTransport) CloseWith(code int, reason string) {
+	t.stop(true, code, reason)
+}
+
+// Close ends the call without sending anything still queued.
+func (t *streamTransport) Close() {
+	t.stop(false, 0, "")
+}
+
+func (t *streamTransport) stop(flush bool, code int, reason string) {
+	t.once.Do(func() {
+		t.flush = flush
+		t.code = code
+		t.reason = reason
+		close(t.closing)
+	})
+}
+
+// finish stops the transport once the session is over, waits up to
+// writeWait for queued envelopes to go out and returns the status to end
+// the call with: Aborted with the close code in the "close-code" trailer
+// if the server closed it with one, OK otherwise.
+func (t *streamTransport) finish() error {
+	t.Close()
+	select {
+	case <-t.done:
+	case <-time.After(writeWait):
+	}
+	if t.code == 0 {
+		return nil
+	}
+	t.stream.SetTrailer(metadata.Pairs("close-code", strconv.Itoa(t.code)))
+	return status.Error(codes.Aborted, t.reason)
+}
+
+func (t *streamTransport) readPump() {
+	defer close(t.recv)
+	for {
+		env, err := t.stream.Recv()
+		if err != nil {
+			t.recvErr = err
+			return
+		}
+		select {
+		case t.recv <- env:
+		case <-t.stream.Context().Done():
+			t.recvErr = t.stream.Context().Err()
+			return
+		}
+	}
+}
+
+func (t *streamTransport) writePump() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.queued.ready:
+			env, ok := t.queued.pop()
+			if !ok {
+				continue
+			}
+			if err := t.stream.Send(env); err != nil {
+				log.Printf("Error sending on stream, closing it: %v", err)
+				t.Close()
+				return
+			}
+		case <-t.closing:
+			for t.flush {
+				env, ok := t.queued.pop()
+				if !ok {
+					break
+				}
+				if err := t.stream.Send(env); err != nil {
+					return
+				}
+			}
+			return
+		}
+	}
+}
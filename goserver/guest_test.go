@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// Once the six-digit names are crowded, guests are given longer ones.
+func TestGuestNamesCollide(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &guestNumber, func(int64) int64 { return 42 })
+
+	for _, want := range []string{"Guest000042", "Guest00000042", "Guest0000000042"} {
+		account, err := mintGuest(ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.Name != want {
+			t.Fatalf("guest named %q, want %q", account.Name, want)
+		}
+	}
+	if _, err := mintGuest(ClientInfo{}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("minted a guest with every name taken: %v", err)
+	}
+}
+
+// A client IP making guest accounts too fast plays on without one.
+func TestGuestRateLimit(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &guestLimiter, newRateLimiter(2, time.Hour))
+
+	for i, saved := range []bool{true, true, false} {
+		account, err := authenticate("", ClientInfo{IP: "192.0.2.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !account.Guest || (account.ID != 0) != saved {
+			t.Fatalf("guest %d got account %+v, saved %v", i, account, saved)
+		}
+	}
+	if account, _ := authenticate("", ClientInfo{IP: "192.0.2.2"}); account.ID == 0 {
+		t.Fatal("another IP's guest wasn't given an account")
+	}
+}
+
+func TestPruneGuests(t *testing.T) {
+	useTestDB(t)
+	now := time.Now()
+	stale := now.Add(-guestRetention - time.Hour)
+
+	// guest makes a guest account, made and last used at the given times.
+	guest := func(made, used time.Time) uint {
+		t.Helper()
+		account, err := mintGuest(ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Model(&models.Player{}).Where("id = ?", account.ID).Update("created_at", made)
+		db.Model(&models.Session{}).Where("account_id = ?", account.ID).Update("last_seen_at", used)
+		return account.ID
+	}
+	unused := guest(stale, stale)
+	played := guest(stale, stale)
+	db.Create(&models.MatchResult{MatchID: 1, AccountID: played})
+	returned := guest(stale, now)
+	fresh := guest(now, now)
+	registered, _ := newAccount(t, "registered")
+	db.Model(&registered).Update("created_at", stale)
+
+	pruneGuests(now)
+
+	var kept []uint
+	db.Unscoped().Model(&models.Player{}).Order("id").Pluck("id", &kept)
+	if want := []uint{played, returned, fresh, registered.ID}; !slices.Equal(kept, want) {
+		t.Fatalf("accounts kept %v, want %v", kept, want)
+	}
+	var sessions int64
+	db.Model(&models.Session{}).Where("account_id = ?", unused).Count(&sessions)
+	if sessions != 0 {
+		t.Fatalf("the pruned guest still has %d sessions", sessions)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"land/protocol"
+)
+
+const (
+	serverVersion = "0.2.0"
+
+	// minProtocol and maxProtocol bound the protocol versions a client may
+	// ask for in its hello.
+	minProtocol = 1
+	maxProtocol = protocol.Version
+)
+
+// serverFeatures lists the optional parts of the protocol this server
+// supports, so clients can tell what they may use before relying on it.
+var serverFeatures = []string{"reconnect", "spectate", "parties", "friends", "votekick", "msgpack", "protobuf", "delta", "compactBoard"}
+
+var errHandshakeRequired = &JoinError{Code: "HANDSHAKE_REQUIRED", CloseCode: closeProtocolError, Message: "the first message must be hello"}
+
+// HelloPayload opens every connection; see protocol.HelloPayload.
+type HelloPayload protocol.HelloPayload
+
+// supports reports whether the client listed the feature in its hello.
+func (p *HelloPayload) supports(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HelloPayload) validate() error {
+	if p.Version == 0 {
+		return invalid("version", "version is required")
+	}
+	return required("client", p.Client)
+}
+
+// WelcomePayload answers a hello. AccountID and Name are the account the
+// client signed in as, or the guest account made for it, in which case
+// GuestToken is the token to connect as that guest again or to register it.
+// Room describes the room named in the connection URL, if any.
+type WelcomePayload struct {
+	PlayerID      string    `json:"playerID"`
+	AccountID     uint      `json:"accountID,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Guest         bool      `json:"guest,omitempty"`
+	GuestToken    string    `json:"guestToken,omitempty"`
+	ServerVersion string    `json:"serverVersion"`
+	Protocol      int       `json:"protocol"`
+	Features      []string  `json:"features"`
+	Encoding      string    `json:"encoding"`
+	Room          *RoomInfo `json:"room"`
+}
+
+// readHello reads the client's hello and checks that its protocol version is
+// one this server speaks. It returns a *JoinError if the connection should
+// be rejected.
+func readHello(conn *Conn) (*HelloPayload, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	env, payload, err := decodeMessage(jsonCodec, data)
+	if env.Type != "hello" {
+		return nil, errHandshakeRequired
+	}
+	if err != nil {
+		return nil, &JoinError{Code: "BAD_HELLO", CloseCode: closeProtocolError, Message: err.Error()}
+	}
+
+	hello := payload.(*HelloPayload)
+	if hello.Version < minProtocol || hello.Version > maxProtocol {
+		return nil, &JoinError{
+			Code:      "UNSUPPORTED_VERSION",
+			CloseCode: closeUnsupportedVersion,
+			Message:   fmt.Sprintf("protocol version %d is not supported (%d-%d)", hello.Version, minProtocol, maxProtocol),
+		}
+	}
+	return hello, nil
+}
+
+// sendWelcome accepts the handshake, telling the client the player ID the
+// connection will use. Websocket clients get it as JSON, since the encoding
+// they asked for only applies once they have read it.
+func sendWelcome(conn Transport, codec Codec, hello *HelloPayload, playerID string, account Account, roomID string) {
+	welcome := WelcomePayload{
+		PlayerID:      playerID,
+		AccountID:     account.ID,
+		Name:          account.Name,
+		Guest:         account.Guest,
+		GuestToken:    account.Token,
+		ServerVersion: serverVersion,
+		Protocol:      hello.Version,
+		Features:      serverFeatures,
+		Encoding:      codecFor(hello.Encoding).Name(),
+	}
+	if room, ok := rooms.Get(roomID); ok {
+		var info RoomInfo
+		if room.do(func() { info = roomInfo(room) }) {
+			welcome.Room = &info
+		}
+	}
+	writeMessage(conn, codec, Message{Type: "welcome", Payload: welcome})
+}
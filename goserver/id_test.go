@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// A large batch of player IDs has no duplicates, and every ID is
+// playerIDLength alphanumerics.
+func TestGeneratePlayerID(t *testing.T) {
+	const batch = 100000
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	seen := make(map[string]bool, batch)
+	for range batch {
+		id := generatePlayerID()
+		if len(id) != playerIDLength {
+			t.Fatalf("ID %q is %d characters, want %d", id, len(id), playerIDLength)
+		}
+		if i := strings.IndexFunc(id, func(r rune) bool { return !strings.ContainsRune(charset, r) }); i >= 0 {
+			t.Fatalf("ID %q has %q, outside the charset", id, id[i])
+		}
+		if seen[id] {
+			t.Fatalf("ID %q generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// Every character is drawn as often as any other, give or take chance.
+func TestGenerateRandomStringIsUniform(t *testing.T) {
+	const characters = 62
+	const perCharacter = 2000
+	counts := make(map[rune]int)
+	for _, r := range generateRandomString(characters * perCharacter) {
+		counts[r]++
+	}
+	if len(counts) != characters {
+		t.Fatalf("drew %d different characters, want %d", len(counts), characters)
+	}
+	// A count is binomial, with a standard deviation of about 44; 250 off
+	// is over five of them.
+	for r, n := range counts {
+		if n < perCharacter-250 || n > perCharacter+250 {
+			t.Errorf("%q drawn %d times, want about %d", r, n, perCharacter)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"land/internal/game"
+)
+
+// movesPerSecond is how many moves a player without speed effects makes per
+// second, whatever the room's tick rate. Moves beyond a player's rate are
+// dropped, so a client can't outrun the game loop by sending faster.
+const movesPerSecond = 10
+
+// A player's unused moves carry over for up to moveBurst, or one tick if
+// ticks are longer, so moves bunched together by network jitter still go
+// through as long as the rate over the window is right.
+const moveBurst = 300 * time.Millisecond
+
+// Players who go over their move rate in moveViolationLimit ticks within
+// moveViolationWindow are kicked as cheaters.
+const (
+	moveViolationLimit  = 10
+	moveViolationWindow = time.Minute
+)
+
+// moveRate is how many moves the player may make per second: movesPerSecond
+// at base speed, plus any boost.
+func (p *Player) moveRate() int {
+	return movesPerSecond*playerSpeed + p.SpeedBoost
+}
+
+// queueInput buffers an input for the next tick. Seq of a move is the
+// sequence number of the move message, acknowledged in the positionUpdate it
+// produces. It must run on the room's goroutine.
+func queueInput(room *Room, input game.Input) {
+	room.Inputs = append(room.Inputs, input)
+}
+
+// takeInputs returns the inputs queued since the last tick in the order they
+// arrived, for the match to apply, and empties the queue. Each tick tops
+// every player up with a tick's worth of their move rate, up to moveBurst's
+// worth; moves beyond that are dropped, the player is told, quoting the last
+// dropped move's Seq, and the tick counts as a violation. It must run on the
+// room's goroutine.
+func takeInputs(room *Room) []game.Input {
+	interval := room.Match.Interval
+	for _, player := range room.Players {
+		rate := float64(player.moveRate())
+		player.moveTokens = min(player.moveTokens+rate*interval.Seconds(), rate*max(moveBurst, interval).Seconds())
+	}
+
+	inputs := make([]game.Input, 0, len(room.Inputs))
+	dropped := make(map[*Player]game.Move)
+	for _, input := range room.Inputs {
+		move, ok := input.(game.Move)
+		if !ok {
+			inputs = append(inputs, input)
+			continue
+		}
+		player := room.player(move.Player)
+		if player == nil || player.Evicted {
+			continue
+		}
+		if player.moveTokens < 1 {
+			dropped[player] = move
+			continue
+		}
+		player.moveTokens--
+		inputs = append(inputs, move)
+	}
+	room.Inputs = room.Inputs[:0]
+
+	for player, move := range dropped {
+		log.Printf("Dropping moves from %s over their rate of %d per second", player.ID, player.moveRate())
+		if moveViolation(room, player) {
+			continue
+		}
+		sendMessage(player, Message{
+			Type: "error",
+			Payload: ErrorPayload{
+				Code:    "RATE_LIMITED",
+				Message: fmt.Sprintf("at most %d moves per second; extra moves were dropped", player.moveRate()),
+				Seq:     move.Seq,
+			},
+		})
+	}
+	return inputs
+}
+
+// moveViolation records a tick in which player went over their move rate and
+// kicks them once they have done so moveViolationLimit times within
+// moveViolationWindow. It reports whether they were kicked. It must run on the
+// room's goroutine.
+func moveViolation(room *Room, player *Player) bool {
+	now := time.Now()
+	recent := player.moveViolations[:0]
+	for _, at := range player.moveViolations {
+		if now.Sub(at) < moveViolationWindow {
+			recent = append(recent, at)
+		}
+	}
+	player.moveViolations = append(recent, now)
+	if len(player.moveViolations) < moveViolationLimit {
+		return false
+	}
+
+	log.Printf("Kicking %s from room %s: over the move rate in %d ticks within %v",
+		player.ID, room.ID, len(player.moveViolations), moveViolationWindow)
+	kickPlayer(room, player, closeCheating, "movement rate exceeded")
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"land/internal/game"
+	"land/protocol"
+)
+
+// moveTicks queues moves[i] moves from player before the room's ith tick and
+// returns how many of them each tick let through.
+func moveTicks(room *Room, player *Player, moves []int) []int {
+	accepted := make([]int, len(moves))
+	room.do(func() {
+		for i, n := range moves {
+			for range n {
+				queueInput(room, game.Move{Player: &player.Player, Direction: "up"})
+			}
+			accepted[i] = len(takeInputs(room))
+		}
+	})
+	return accepted
+}
+
+// moveRoom is a room ticking every 100ms, with a single player, who has no
+// connection to be told of dropped moves on.
+func moveRoom(t *testing.T, boost int) (*Room, *Player) {
+	t.Helper()
+	testRooms(t)
+	room := rooms.Create(0)
+	player := &Player{Player: game.Player{ID: "mover"}, SpeedBoost: boost}
+	room.do(func() {
+		room.Match.Interval = 100 * time.Millisecond
+		room.Players[player.ID] = player
+	})
+	return room, player
+}
+
+// Each tick gives a player a tick's worth of their rate, and lets unused
+// moves carry over for moveBurst, so moves bunched up by jitter get through
+// while a client sending faster than the rate does not.
+func TestMoveRate(t *testing.T) {
+	if playerSpeed*movesPerSecond != 10 || moveBurst != 300*time.Millisecond {
+		t.Fatalf("test assumes 10 moves per second and a 300ms burst")
+	}
+	tests := []struct {
+		name       string
+		boost      int
+		moves      []int // per tick
+		want       []int
+		violations int
+	}{
+		{"one per tick", 0, []int{1, 1, 1, 1}, []int{1, 1, 1, 1}, 0},
+		{"bunched up by jitter", 0, []int{0, 0, 3, 0, 2}, []int{0, 0, 3, 0, 2}, 0},
+		{"idle beyond the burst", 0, []int{0, 0, 0, 0, 0, 4}, []int{0, 0, 0, 0, 0, 3}, 1},
+		{"too fast", 0, []int{3, 3, 3}, []int{1, 1, 1}, 3},
+		{"boosted", 10, []int{2, 2, 2}, []int{2, 2, 2}, 0},
+		{"too fast even boosted", 10, []int{3, 3}, []int{2, 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room, player := moveRoom(t, tt.boost)
+			if got := moveTicks(room, player, tt.moves); !slices.Equal(got, tt.want) {
+				t.Fatalf("moves let through = %v, want %v", got, tt.want)
+			}
+			var violations int
+			room.do(func() { violations = len(player.moveViolations) })
+			if violations != tt.violations {
+				t.Fatalf("%d violations, want %d", violations, tt.violations)
+			}
+		})
+	}
+}
+
+// A player over their rate in moveViolationLimit ticks within
+// moveViolationWindow is kicked and banned from the room; older violations
+// don't count.
+func TestMoveViolationsKick(t *testing.T) {
+	room, player := moveRoom(t, 0)
+	flood := make([]int, moveViolationLimit-1)
+	for i := range flood {
+		flood[i] = 5
+	}
+	moveTicks(room, player, flood)
+
+	// Going over once more, with the first violation out of the window by
+	// now, isn't enough.
+	room.do(func() { player.moveViolations[0] = time.Now().Add(-moveViolationWindow) })
+	moveTicks(room, player, []int{5})
+	var evicted bool
+	room.do(func() { evicted = player.Evicted })
+	if evicted {
+		t.Fatal("kicked for a violation out of the window")
+	}
+
+	moveTicks(room, player, []int{5})
+	var banned bool
+	room.do(func() { evicted, banned = player.Evicted, room.isBanned(player) })
+	if !evicted || !banned {
+		t.Fatalf("evicted %v, banned %v after %d violations", evicted, banned, moveViolationLimit)
+	}
+	if got := moveTicks(room, player, []int{1}); got[0] != 0 {
+		t.Fatal("a kicked player's move went through")
+	}
+}
+
+// Message handlers only queue moves; nothing about the match changes until
+// the tick applies them.
+func TestMovesWaitForTheTick(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	id := playerID(t, alice)
+	from := findPlayer(t, server.startMatch(t, alice), id)
+
+	alice.Move(awayFromEdge(from.X))
+	alice.Send("ping", protocol.PingPayload{ClientTime: 1})
+	alice.ExpectMessage("pong", expectTimeout)
+	var position game.Position
+	var queued int
+	room.do(func() { position, queued = room.Players[id].Position, len(room.Inputs) })
+	if position != (game.Position{X: from.X, Y: from.Y}) || queued != 1 {
+		t.Fatalf("before the tick: at %v with %d inputs queued, want %d,%d with 1", position, queued, from.X, from.Y)
+	}
+
+	server.tick(t, room)
+	room.do(func() { position, queued = room.Players[id].Position, len(room.Inputs) })
+	if position.X == from.X || queued != 0 {
+		t.Fatalf("after the tick: at %v with %d inputs queued", position, queued)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"land/internal/game"
+)
+
+// roomsFullRetryAfter is how long a client turned away by the server's room
+// cap is told to wait before creating a room again.
+const roomsFullRetryAfter = 30 * time.Second
+
+// createRoomHandler opens an empty room for players to join by ID, optionally
+// private, in a game mode other than the default or with its own tick
+// interval, and hands back the invite link for it. A private room's join
+// code is only ever given here, to whoever created it, to pass on. Rooms
+// created here count toward the server's room cap like any other.
+func createRoomHandler(c *gin.Context) {
+	var req struct {
+		Private      bool   `json:"private"`
+		Mode         string `json:"mode"`
+		TickInterval int    `json:"tickInterval"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	settings := defaultSettings().merge(RoomSettings{Mode: req.Mode, TickInterval: req.TickInterval})
+	if err := settings.validate(0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var joinCode string
+	if req.Private {
+		joinCode = generateRandomString(8)
+	}
+	room := rooms.Create(queue.MaxRooms)
+	if room == nil {
+		c.Header("Retry-After", strconv.Itoa(int(roomsFullRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The server has no room for another game; try again later"})
+		return
+	}
+	room.do(func() {
+		room.Settings = settings
+		room.Match.Rules, _ = game.NewRules(settings.Mode)
+		room.Match.Interval = settings.tickInterval()
+		room.Private = req.Private
+		room.JoinCode = joinCode
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"roomID":    room.ID,
+		"joinCode":  joinCode,
+		"inviteURL": inviteURL(c, room.ID),
+	})
+}
+
+// inviteHandler resolves an invite link to the information a client needs to
+// join the room over /ws with {"type": "join", "roomID": ...}. A private
+// room also needs its joinCode, which the invite doesn't give away: the
+// player has to get it from whoever created the room. Without it as ?code=,
+// the invite to a private room only says that it is private. Joinable is
+// whether the room would take a player now. Rooms that closed recently
+// answer 410 Gone.
+func inviteHandler(c *gin.Context) {
+	roomID := c.Param("roomID")
+	joinCode := c.Query("code")
+	room, ok := rooms.Get(roomID)
+	if !ok {
+		if rooms.Retired(roomID) {
+			c.JSON(http.StatusGone, gin.H{"error": "Game already ended"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	var invite gin.H
+	ran := room.do(func() {
+		if room.Private && joinCode != room.JoinCode {
+			invite = gin.H{"roomID": room.ID, "private": true}
+			return
+		}
+		players := make([]gin.H, 0, len(room.Players))
+		for _, player := range room.Players {
+			players = append(players, gin.H{"id": player.ID, "name": player.Name})
+		}
+		full := len(room.Players) >= room.Settings.MaxPlayers
+		invite = gin.H{
+			"roomID":   room.ID,
+			"private":  room.Private,
+			"players":  players,
+			"status":   room.Phase,
+			"full":     full,
+			"joinable": room.Phase.Joinable() && !full,
+		}
+	})
+	if !ran {
+		c.JSON(http.StatusGone, gin.H{"error": "Game already ended"})
+		return
+	}
+	c.JSON(http.StatusOK, invite)
+}
+
+func inviteURL(c *gin.Context, roomID string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/invite/%s", scheme, c.Request.Host, roomID)
+}
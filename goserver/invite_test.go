@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestInviteKeepsThePrivateJoinCode(t *testing.T) {
+	w := serveRequest(t, http.MethodPost, "/rooms", "", `{"private":true}`)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID   string `json:"roomID"`
+		JoinCode string `json:"joinCode"`
+	}
+	decodeBody(t, w, &created)
+	if created.JoinCode == "" {
+		t.Fatal("the creator got no join code")
+	}
+	room, _ := rooms.Get(created.RoomID)
+	defer closeRoom(room)
+
+	w = serveRequest(t, http.MethodGet, "/invite/"+created.RoomID, "", "")
+	expectStatus(t, w, http.StatusOK)
+	var invite map[string]any
+	decodeBody(t, w, &invite)
+	if _, ok := invite["joinCode"]; ok {
+		t.Errorf("invite gave away the join code: %v", invite)
+	}
+	if invite["private"] != true {
+		t.Errorf("invite doesn't say the room is private: %v", invite)
+	}
+	for _, field := range []string{"players", "status", "full", "joinable"} {
+		if _, ok := invite[field]; ok {
+			t.Errorf("invite without the code shows the room's %s: %v", field, invite)
+		}
+	}
+
+	// With the code, the invite shows the room, and whether it can be
+	// joined follows its phase.
+	w = serveRequest(t, http.MethodGet, "/invite/"+created.RoomID+"?code="+created.JoinCode, "", "")
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &invite)
+	if _, ok := invite["players"]; !ok || invite["joinable"] != true {
+		t.Errorf("invite with the code = %v, want the players and joinable", invite)
+	}
+	room.do(func() { room.setPhase(PhaseOvertime) })
+	w = serveRequest(t, http.MethodGet, "/invite/"+created.RoomID+"?code="+created.JoinCode, "", "")
+	decodeBody(t, w, &invite)
+	if invite["joinable"] != false {
+		t.Errorf("invite to a game in overtime = %v, want it not joinable", invite)
+	}
+}
+
+func TestInviteToAClosedRoom(t *testing.T) {
+	expectStatus(t, serveRequest(t, http.MethodGet, "/invite/nosuchroom", "", ""), http.StatusNotFound)
+
+	room := rooms.Create(0)
+	closeRoom(room)
+	expectStatus(t, serveRequest(t, http.MethodGet, "/invite/"+room.ID, "", ""), http.StatusGone)
+
+	// A room that has stopped but is still registered is gone too, rather
+	// than left without an answer.
+	stopped := rooms.Create(0)
+	stopped.do(stopped.stop)
+	// With its goroutine gone, retiring it is left to the test.
+	defer stopped.retire()
+	expectStatus(t, serveRequest(t, http.MethodGet, "/invite/"+stopped.ID, "", ""), http.StatusGone)
+}
+
+// Rooms created through POST /rooms count toward the server's room cap, and
+// the client is told when to try again once it is reached.
+func TestCreateRoomAtTheRoomCap(t *testing.T) {
+	startServer(t)
+	setForTest(t, &queue.MaxRooms, len(rooms.List())+1)
+
+	expectStatus(t, serveRequest(t, http.MethodPost, "/rooms", "", ""), http.StatusCreated)
+	w := serveRequest(t, http.MethodPost, "/rooms", "", "")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry <= 0 {
+		t.Errorf("Retry-After %q, want a number of seconds", w.Header().Get("Retry-After"))
+	}
+}
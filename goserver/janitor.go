@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const roomSweepInterval = 30 * time.Second
+
+// runJanitor periodically closes rooms that have seen no inbound messages and
+// no joins or leaves for longer than idle, unless idle is zero. It catches
+// rooms whose occupants' connections hung without ever returning a read
+// error. It also deletes expired chat logs and stale guest accounts, every
+// chatLogPruneInterval.
+func runJanitor(idle time.Duration) {
+	ticker := time.NewTicker(roomSweepInterval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for now := range ticker.C {
+		if idle > 0 {
+			sweepIdleRooms(idle)
+		}
+		if now.Sub(pruned) >= chatLogPruneInterval {
+			pruneChatLogs(now)
+			pruneGuests(now)
+			pruned = now
+		}
+	}
+}
+
+func sweepIdleRooms(idle time.Duration) {
+	var stale []*Room
+	for _, room := range rooms.List() {
+		room.do(func() {
+			if time.Since(room.LastActivity) > idle {
+				stale = append(stale, room)
+			}
+		})
+	}
+
+	for _, room := range stale {
+		log.Printf("Closing idle room %s", room.ID)
+		closeRoom(room)
+	}
+}
+
+// closeRoom stops the room's game loop, drops every connection still attached
+// to it and removes it from the registry. It is safe to call more than once.
+func closeRoom(room *Room) {
+	room.do(func() {
+		if room.Closed {
+			return
+		}
+		room.stop()
+
+		if room.Vote != nil {
+			room.Vote.timer.Stop()
+			room.Vote = nil
+		}
+		for _, player := range room.Players {
+			if player.Conn != nil {
+				player.Conn.Close()
+			}
+		}
+		closeSpectators(room)
+		room.retire()
+	})
+}
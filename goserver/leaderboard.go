@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// Leaderboard page sizes: what a request gets without a limit, and the most
+// it may ask for.
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+)
+
+// LeaderboardEntry is one account on the leaderboard. Rank counts from 1 at
+// the top of the whole board, not the page.
+type LeaderboardEntry struct {
+	Rank      int     `json:"rank"`
+	AccountID uint    `json:"accountID"`
+	Name      string  `json:"name"`
+	Guest     bool    `json:"guest"`
+	Color     string  `json:"color"`
+	Score     float64 `json:"score"`
+	Rating    float64 `json:"rating"`
+}
+
+// leaderboardHandler serves a page of accounts by score, highest first, the
+// older account first on a tie. Total is how many accounts there are in
+// all, for paging. Guest accounts are flagged, or left out with
+// guests=false. With season, it serves that season's leaderboard instead.
+func leaderboardHandler(c *gin.Context) {
+	limit, ok := queryInt(c, "limit", defaultLeaderboardLimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok {
+		return
+	}
+	guests, ok := queryBool(c, "guests", true)
+	if !ok || !requireDB(c) {
+		return
+	}
+	limit = min(max(limit, 1), maxLeaderboardLimit)
+	if season := c.Query("season"); season != "" {
+		seasonLeaderboard(c, season, limit, offset, guests)
+		return
+	}
+
+	board := db.Model(&models.Player{})
+	if !guests {
+		board = board.Where("guest = ?", false)
+	}
+	var total int64
+	if err := board.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	var accounts []models.Player
+	err := board.Order("score DESC").Order("created_at ASC").Order("id ASC").
+		Limit(limit).Offset(offset).Find(&accounts).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+
+	entries := make([]LeaderboardEntry, len(accounts))
+	for i, account := range accounts {
+		entries[i] = LeaderboardEntry{
+			Rank:      offset + i + 1,
+			AccountID: account.ID,
+			Name:      account.Name,
+			Guest:     account.Guest,
+			Color:     account.Color,
+			Score:     account.Score,
+			Rating:    account.Rating,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"players": entries, "total": total, "limit": limit, "offset": offset})
+}
+
+// seasonLeaderboard serves a page of a season's leaderboard, by score with
+// the rating the accounts had after their last match of the season. param
+// is a season's ID or "current". A season that has been snapshotted is
+// served from its final standings, ranked as they were then.
+func seasonLeaderboard(c *gin.Context, param string, limit, offset int, guests bool) {
+	var season models.Season
+	var err error
+	if param == "current" {
+		season, err = latestSeason(db)
+	} else {
+		id, parseErr := strconv.ParseUint(param, 10, 64)
+		if parseErr != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid season"})
+			return
+		}
+		err = db.First(&season, id).Error
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Season not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+
+	table, rank, order := "season_scores", "0", "season_scores.score DESC"
+	if season.Final {
+		table, rank, order = "season_results", "season_results.rank", "season_results.rank ASC"
+	}
+	board := db.Table(table).
+		Joins("JOIN players ON players.id = "+table+".account_id AND players.deleted_at IS NULL").
+		Where(table+".season_id = ?", season.ID)
+	if !guests {
+		board = board.Where("players.guest = ?", false)
+	}
+	var total int64
+	if err := board.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+	var rows []struct {
+		Rank      int
+		AccountID uint
+		Name      string
+		Guest     bool
+		Color     string
+		Score     int
+		Rating    float64
+	}
+	err = board.Select(rank + " AS rank, " + table + ".account_id, players.name, players.guest, players.color, " + table + ".score, " + table + ".rating").
+		Order(order).Order(table + ".account_id ASC").Limit(limit).Offset(offset).Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load leaderboard"})
+		return
+	}
+
+	entries := make([]LeaderboardEntry, len(rows))
+	for i, row := range rows {
+		if !season.Final {
+			row.Rank = offset + i + 1
+		}
+		entries[i] = LeaderboardEntry{
+			Rank:      row.Rank,
+			AccountID: row.AccountID,
+			Name:      row.Name,
+			Guest:     row.Guest,
+			Color:     row.Color,
+			Score:     float64(row.Score),
+			Rating:    row.Rating,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"season": season, "players": entries, "total": total, "limit": limit, "offset": offset})
+}
+
+// queryInt reads a non-negative integer query parameter, or def if it is
+// absent, answering 400 if it isn't one.
+func queryInt(c *gin.Context, name string, def int) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return n, true
+}
+
+// queryBool reads a boolean query parameter, or def if it is absent,
+// answering 400 if it isn't one.
+func queryBool(c *gin.Context, name string, def bool) (bool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return def, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return false, false
+	}
+	return b, true
+}
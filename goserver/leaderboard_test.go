@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"land/models"
+)
+
+// leaderboardPage is a page of GET /leaderboard.
+type leaderboardPage struct {
+	Players []LeaderboardEntry `json:"players"`
+	Total   int64              `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+}
+
+func getLeaderboard(t *testing.T, query string) leaderboardPage {
+	t.Helper()
+	w := serveRequest(t, http.MethodGet, "/leaderboard"+query, "", "")
+	expectStatus(t, w, http.StatusOK)
+	var page leaderboardPage
+	decodeBody(t, w, &page)
+	return page
+}
+
+func TestLeaderboardEmpty(t *testing.T) {
+	useTestDB(t)
+	page := getLeaderboard(t, "")
+	if page.Players == nil || len(page.Players) != 0 || page.Total != 0 || page.Limit != defaultLeaderboardLimit {
+		t.Fatalf("empty leaderboard = %+v, want no players out of 0, %d to a page", page, defaultLeaderboardLimit)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	useTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	for i, account := range []struct {
+		name  string
+		score float64
+		guest bool
+	}{
+		{"carol", 50, false},
+		{"alice", 120, false},
+		{"bob", 50, false},
+		{"guest", 80, true},
+		{"dave", 10, false},
+	} {
+		player := models.Player{Name: account.name, Score: account.score, Guest: account.guest, Rating: models.DefaultRating}
+		player.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := db.Create(&player).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		names  []string
+		first  int
+		total  int64
+		limit  int
+		offset int
+	}{
+		// Carol and Bob tie, and Carol's account is the older.
+		{"", []string{"alice", "guest", "carol", "bob", "dave"}, 1, 5, defaultLeaderboardLimit, 0},
+		{"?limit=2&offset=1", []string{"guest", "carol"}, 2, 5, 2, 1},
+		{"?offset=10", []string{}, 11, 5, defaultLeaderboardLimit, 10},
+		{"?limit=1000", []string{"alice", "guest", "carol", "bob", "dave"}, 1, 5, maxLeaderboardLimit, 0},
+		{"?limit=0", []string{"alice"}, 1, 5, 1, 0},
+		{"?guests=false", []string{"alice", "carol", "bob", "dave"}, 1, 4, defaultLeaderboardLimit, 0},
+	}
+	for _, tt := range tests {
+		name := tt.query
+		if name == "" {
+			name = "defaults"
+		}
+		t.Run(name, func(t *testing.T) {
+			page := getLeaderboard(t, tt.query)
+			names := []string{}
+			for i, entry := range page.Players {
+				names = append(names, entry.Name)
+				if entry.Rank != tt.first+i {
+					t.Errorf("%s is ranked %d, want %d", entry.Name, entry.Rank, tt.first+i)
+				}
+			}
+			if !slices.Equal(names, tt.names) {
+				t.Fatalf("players = %v, want %v", names, tt.names)
+			}
+			if page.Total != tt.total || page.Limit != tt.limit || page.Offset != tt.offset {
+				t.Fatalf("total %d, limit %d, offset %d; want %d, %d, %d", page.Total, page.Limit, page.Offset, tt.total, tt.limit, tt.offset)
+			}
+		})
+	}
+}
+
+// Entries carry the account's public fields and nothing else.
+func TestLeaderboardFields(t *testing.T) {
+	useTestDB(t)
+	newAccount(t, "alice")
+	w := serveRequest(t, http.MethodGet, "/leaderboard", "", "")
+	expectStatus(t, w, http.StatusOK)
+	var page struct {
+		Players []map[string]json.RawMessage `json:"players"`
+	}
+	decodeBody(t, w, &page)
+	if len(page.Players) != 1 {
+		t.Fatalf("%d players, want alice", len(page.Players))
+	}
+	var fields []string
+	for field := range page.Players[0] {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	if want := []string{"accountID", "color", "guest", "name", "rank", "rating", "score"}; !slices.Equal(fields, want) {
+		t.Fatalf("entry has fields %v, want %v", fields, want)
+	}
+}
+
+func TestLeaderboardBadQuery(t *testing.T) {
+	useTestDB(t)
+	for _, query := range []string{"?limit=-1", "?limit=ten", "?offset=-5", "?guests=maybe", "?season=first"} {
+		if w := serveRequest(t, http.MethodGet, "/leaderboard"+query, "", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+	expectStatus(t, serveRequest(t, http.MethodGet, "/leaderboard?season=99", "", ""), http.StatusNotFound)
+}
@@ -0,0 +1,125 @@
+//go:build !race
+
+// The load test measures latency, which the race detector slows down several
+// times over, so it only runs without it.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// With 200 rooms in play, ticking in real time, the server still answers
+// pings and the status endpoint promptly and every room keeps ticking.
+func TestResponsiveAt200Rooms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const (
+		roomCount = 200
+		ticks     = 30
+		maxRTT    = 500 * time.Millisecond
+	)
+	setForTest(t, &snapshotInterval, time.Hour)
+	setForTest(t, &throttle, &BroadcastThrottle{})
+	server := startServer(t)
+
+	roomList := make([]*Room, roomCount)
+	hosts := make([]*wstest.Client, roomCount)
+	for i := range hosts {
+		// Half the hosts take deltas, as browsers do, and half full
+		// snapshots, as older clients do.
+		var features []string
+		if i%2 == 0 {
+			features = append(features, "delta")
+		}
+		roomList[i] = server.createRoom(t, "")
+		hosts[i] = server.join(t, roomList[i], fmt.Sprintf("host%d", i), features...)
+	}
+	for _, host := range hosts {
+		host.Send("start", struct{}{})
+		host.ExpectMessage("gameStarting", expectTimeout)
+	}
+	if !server.Clock.WaitForTimers(2*roomCount, expectTimeout) {
+		t.Fatal("the countdowns never started")
+	}
+	server.Clock.Advance(countdownDuration)
+	if !server.Clock.WaitForTimers(2*roomCount, expectTimeout) {
+		t.Fatal("the games never started ticking")
+	}
+
+	// Tick every room at the real rate, with the throttle reconsidering
+	// every window as it does in production, while probing the server.
+	done := make(chan struct{})
+	var ticking sync.WaitGroup
+	ticking.Add(1)
+	go func() {
+		defer ticking.Done()
+		defer close(done)
+		ticker := time.NewTicker(gameInterval)
+		defer ticker.Stop()
+		for i := 1; i <= ticks; i++ {
+			server.Clock.Advance(gameInterval)
+			<-ticker.C
+			if i%int(throttleWindow/gameInterval) == 0 {
+				throttle.adjust(throttleWindow)
+			}
+		}
+	}()
+
+	var pings, statuses []time.Duration
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+		default:
+			host := hosts[i%roomCount]
+			start := time.Now()
+			host.Send("ping", protocol.PingPayload{ClientTime: start.UnixMilli()})
+			host.ExpectMessage("pong", expectTimeout)
+			pings = append(pings, time.Since(start))
+
+			start = time.Now()
+			resp, err := http.Get(server.URL + "/status")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			statuses = append(statuses, time.Since(start))
+			time.Sleep(gameInterval / 4)
+			continue
+		}
+		break
+	}
+	ticking.Wait()
+
+	for _, probe := range []struct {
+		name  string
+		times []time.Duration
+	}{{"ping", pings}, {"status", statuses}} {
+		slices.Sort(probe.times)
+		slowest := probe.times[len(probe.times)-1]
+		t.Logf("%d %s probes, median %v, slowest %v", len(probe.times), probe.name, probe.times[len(probe.times)/2], slowest)
+		if slowest > maxRTT {
+			t.Errorf("a %s took %v under load, want at most %v", probe.name, slowest, maxRTT)
+		}
+	}
+	t.Logf("broadcast status at the end: %+v", throttle.Status())
+
+	// A room that falls behind misses ticks, so each should be close to the
+	// clock.
+	for i, room := range roomList {
+		var elapsed time.Duration
+		room.do(func() { elapsed = room.Match.Elapsed() })
+		if elapsed < ticks/2*gameInterval {
+			t.Errorf("room %d only got to %v of %v", i, elapsed, ticks*gameInterval)
+		}
+	}
+}
@@ -1,115 +1,520 @@
 package main
 
 import (
-	"encoding/json"
+	"cmp"
+	"compress/flate"
+	"context"
+	crand "crypto/rand"
+	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
-	"strings"
-	"sync"
+	"os"
+	"os/signal"
+	"slices"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+
+	"land/internal/game"
 )
 
 const (
 	boardSize    = 40
 	playerSpeed  = 1
-	gameInterval = 100 * time.Millisecond
+	gameInterval = 100 * time.Millisecond // default tick interval
 	gameDuration = 3 * time.Minute
 	maxPlayers   = 4
+
+	// lobbyDuration is how long a room waits for its host to start the game
+	// before starting it anyway.
+	lobbyDuration = 30 * time.Second
+
+	// countdownDuration is the warning players get between the end of the
+	// lobby and the first tick.
+	countdownDuration = 3 * time.Second
+
+	// startingTerritory is the radius of the square of cells claimed around a
+	// player's spawn point.
+	startingTerritory = 1
+)
+
+// Websocket close codes in the private 4000-4999 range, sent when the server
+// ends a connection on purpose so clients can tell why they were dropped.
+const (
+	closeKicked       = 4001
+	closeRoomFull     = 4002
+	closeRoomNotFound = 4003
+	closeGameStarted  = 4004
+	closeBanned       = 4005
+	closeServerFull   = 4006
+	closeAFK          = 4007
+	closeNoSession    = 4008
+
+	closeProtocolError      = 4009
+	closeUnsupportedVersion = 4010
+	closeSlowClient         = 4011
+	closeCheating           = 4012
+	closeUnauthorized       = 4013
+	closeAccountDeleted     = 4014
+	closeSessionRevoked     = 4015
 )
 
+// Player is a connected player: their state in the game, which the engine
+// owns, and everything the server tracks about them besides. It is never
+// sent to clients as it is; see PlayerState.
 type Player struct {
-	ID             string          `json:"id"`
-	Name           string          `json:"name"`
-	Color          string          `json:"color"`
-	Score          int             `json:"score"`
-	Position       Position        `json:"position"`
-	TargetPosition Position        `json:"targetPosition"`
-	MoveStartTime  time.Time       `json:"moveStartTime"`
-	Conn           *websocket.Conn `json:"-"`
-	Room           *Room           `json:"-"`
-}
+	game.Player
+	Name         string
+	LatencyMs    int
+	SpeedBoost   int
+	AccountID    uint
+	Guest        bool
+	SessionID    uint
+	Character    string
+	ColorPref    string
+	Team         string
+	Rating       float64
+	Party        *Party
+	IP           string
+	LastActivity time.Time
+	AFKWarnedAt  time.Time
+	Protocol     int
+	Codec        Codec
+	Deltas       bool
+	CompactBoard bool
+	Token        string
+	Evicted      bool
+	Conn         Transport
+
+	// Room is the room the player is seated in, or nil. The room's goroutine
+	// sets it as they join and leave, while their connection, timers and the
+	// queue read it, so it is atomic.
+	Room atomic.Pointer[Room]
+
+	// Seq is the sequence number of the last message processed from the
+	// player. Their connection's goroutine sets it, and whatever goroutine
+	// sends to them acknowledges it, so it is atomic.
+	Seq atomic.Uint64
+
+	reconnectTimer *time.Timer
+
+	// seat orders the room's roster: players are listed in the order they
+	// joined. spawned is set once the player is on the match's board. Both
+	// are owned by the room's goroutine.
+	seat    uint64
+	spawned bool
+
+	// Movement rate enforcement, owned by the room's goroutine.
+	moveTokens     float64
+	moveViolations []time.Time
+
+	// Chat rate enforcement, owned by the room's goroutine. A reconnect
+	// starts it over; see resetChatRate.
+	chatTokens     float64
+	chatRefilled   time.Time
+	chatViolations []time.Time
+	chatMutedUntil time.Time
+
+	// Emote rate enforcement, owned by the room's goroutine.
+	emoteTokens   float64
+	emoteRefilled time.Time
 
-type Position struct {
-	X int `json:"x"`
-	Y int `json:"y"`
+	// Who the player muted: players in the room by ID, and accounts, loaded
+	// as they connect. Owned by the room's goroutine, and kept across
+	// reconnects. See mutes.
+	muted         map[string]bool
+	mutedAccounts map[uint]bool
 }
 
+type Position = game.Position
+
 type Room struct {
-	ID        string
-	Players   map[string]*Player
-	GameState *GameState
-	Duration  time.Duration
-	StartTime time.Time
-	Mutex     sync.Mutex
-}
-
-type Message struct {
-	Type        string     `json:"type"`
-	RoomID      string     `json:"roomID"`
-	PlayerID    string     `json:"playerID"`
-	GameState   *GameState `json:"gameState"`
-	Winner      *Player    `json:"winner"`
-	Remaining   int        `json:"remaining"`
-	Action      string     `json:"action"`
-	Direction   string     `json:"direction"`
-	Name        string     `json:"name"`
-	ChatMessage string     `json:"message"`
-	X           int        `json:"x"`
-	Y           int        `json:"y"`
+	ID            string
+	Private       bool
+	JoinCode      string
+	HostID        string
+	Settings      RoomSettings
+	Players       map[string]*Player
+	GameState     *GameState
+	Duration      time.Duration
+	Phase         Phase
+	StartTime     time.Time
+	Pause         *Pause
+	PausedTotal   time.Duration
+	Spectators    map[string]Subscriber
+	Match         *game.Match
+	Vote          *KickVote
+	VoteCooldowns map[string]time.Time
+	Bans          map[string]time.Time
+	Muted         map[string]bool
+	Inputs        []game.Input
+	Events        EventLog
+	Bus           EventBus
+	Deltas        DeltaState
+	TickStats     TickStats
+	LastActivity  time.Time
+	Closed        bool
+	NextSeat      uint64
+	Start         chan struct{}
+	Done          chan struct{}
+
+	// Seed seeds rand, the room's random source. It is logged with the
+	// room's results so a game can be replayed.
+	Seed int64
+	rand *rand.Rand
+
+	// Clock times the room's game. See roomClock.
+	Clock Clock
+
+	// commands carries work to the room's goroutine, which owns everything
+	// above. See do.
+	commands chan func()
 }
 
+// GameState is the room's board and recent chat. Board is the match's
+// board. Clients see it, with the roster, through StateView. TeamChat is
+// the game's team chat, latest chatHistorySize messages, kept for
+// spectators to see once it is over.
 type GameState struct {
-	Board        [][]string `json:"board"`
-	Players      []*Player  `json:"players"`
-	ChatMessages []string   `json:"chatMessages"`
+	Board    game.Board
+	Chat     chatHistory
+	TeamChat []ChatMessagePayload
 }
 
-var rooms = make(map[string]*Room)
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	// A mid-game snapshot of a half-claimed 40x40 board with four players is
+	// about 11 KB of JSON, so the write buffer holds one in a single frame.
+	ReadBufferSize:    1024,
+	WriteBufferSize:   16 * 1024,
+	EnableCompression: true,
 }
 
+var (
+	leaverTerritory = game.TerritoryKeep
+	roomIdleTimeout time.Duration
+	afkTimeout      time.Duration
+	spectatorAFK    time.Duration
+	queue           = &AdmissionQueue{}
+
+	// Permessage-deflate settings. Snapshots are mostly repeated color
+	// strings: the 11 KB snapshot above deflates to 1.7 KB at BestSpeed and
+	// 1.0 KB at BestCompression, so the fastest level gets most of the win.
+	compression      = true
+	compressionLevel = flate.BestSpeed
+)
+
 func main() {
-	router := gin.Default()
+	flag.Var(&leaverTerritory, "leaver-territory", "what happens to a leaving player's cells: keep, neutral or decay")
+	flag.DurationVar(&roomIdleTimeout, "room-idle-timeout", 5*time.Minute, "close rooms with no activity for this long (0 disables)")
+	flag.IntVar(&queue.MaxRooms, "max-rooms", 250, "maximum number of concurrent rooms (0 is unlimited)")
+	flag.IntVar(&queue.MaxPlayers, "max-players", 1000, "maximum number of connected players (0 is unlimited)")
+	flag.DurationVar(&afkTimeout, "afk-timeout", time.Minute, "warn and then disconnect players who send nothing for this long")
+	flag.DurationVar(&spectatorAFK, "spectator-afk-timeout", 30*time.Minute, "warn and then disconnect spectators who send nothing for this long")
+	flag.IntVar(&eventLogSize, "event-log-size", eventLogSize, "number of recent events each room keeps for reconnecting players")
+	flag.DurationVar(&eventLogRetention, "event-log-retention", eventLogRetention, "how long each room keeps events for reconnecting players")
+	flag.BoolVar(&compression, "compression", compression, "compress messages for clients that negotiate permessage-deflate")
+	flag.IntVar(&compressionLevel, "compression-level", compressionLevel, "deflate level from 1 (fastest) to 9 (smallest)")
+	flag.Int64Var(&maxMessageSize, "max-message-size", maxMessageSize, "largest message accepted from a client, in bytes")
+	flag.IntVar(&sendQueueSize, "send-queue-size", sendQueueSize, "outbound messages buffered per connection")
+	flag.DurationVar(&slowClientGrace, "slow-client-grace", slowClientGrace, "disconnect clients whose send queue stays full for this long")
+	flag.DurationVar(&writeWait, "write-timeout", writeWait, "give up on a connection when a single write takes this long")
+	flag.DurationVar(&pongWait, "pong-timeout", pongWait, "give up on a connection that sends nothing, pongs included, for this long")
+	flag.DurationVar(&pingInterval, "ping-interval", pingInterval, "how often to ping connections to keep them alive and measure latency")
+	flag.DurationVar(&latencyWarning, "latency-warning", latencyWarning, "log connections whose round trip exceeds this")
+	flag.StringVar(&grpcAddr, "grpc-addr", grpcAddr, "address to serve the gRPC API on (empty disables)")
+	flag.DurationVar(&shutdownGrace, "shutdown-grace", shutdownGrace, "how long players are warned before a shutdown ends their games")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "give up on a clean shutdown after this long")
+	flag.DurationVar(&broadcastBudget, "broadcast-budget", broadcastBudget, "send full snapshots less often while a room's broadcast takes longer than this")
+	flag.Int64Var(&broadcastBandwidth, "broadcast-bandwidth", 0, "send full snapshots less often while state broadcasts exceed this many bytes per second (0 is unlimited)")
+	flag.Int64Var(&roomSeed, "room-seed", 0, "seed every room's random source with this value, to replay a logged room (0 picks a random seed per room)")
+	flag.StringVar(&debugAddr, "debug-addr", "", "address to serve pprof and /debug/rooms on, for operators only (empty disables)")
+	flag.StringVar(&dbConfig.Driver, "db-driver", dbConfig.Driver, "database driver: sqlite or postgres")
+	flag.StringVar(&dbConfig.DSN, "db", dbConfig.DSN, "SQLite database path or Postgres connection string for accounts and matches (empty disables)")
+	flag.IntVar(&dbConfig.MaxOpenConns, "db-max-open-conns", 0, "most open database connections (0 is unlimited)")
+	flag.IntVar(&dbConfig.MaxIdleConns, "db-max-idle-conns", 0, "most idle database connections kept (0 keeps the default)")
+	flag.DurationVar(&dbConfig.ConnMaxLifetime, "db-conn-max-lifetime", 0, "close database connections older than this (0 never does)")
+	flag.DurationVar(&dbConfig.ConnMaxIdleTime, "db-conn-max-idle-time", 0, "close database connections idle for this long (0 never does)")
+	flag.DurationVar(&dbConfig.ConnectTimeout, "db-connect-timeout", dbConfig.ConnectTimeout, "how long to keep retrying an unreachable database at startup")
+	flag.BoolVar(&dbConfig.Migrate, "migrate", dbConfig.Migrate, "apply pending database migrations at startup (false refuses to start with any pending)")
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending database migrations and exit")
+	authSecretFlag := flag.String("auth-secret", "", "secret that signs account tokens (empty makes one up, invalidating tokens on restart)")
+	flag.DurationVar(&tokenTTL, "token-ttl", tokenTTL, "how long account tokens stay valid")
+	flag.BoolVar(&allowGuests, "allow-guests", allowGuests, "let players connect without an account token")
+	flag.IntVar(&registerRate, "register-rate", registerRate, "registrations allowed per client IP per hour (0 is unlimited)")
+	flag.IntVar(&guestRate, "guest-rate", guestRate, "guest accounts created per client IP per hour; past it guests play without one (0 is unlimited)")
+	flag.DurationVar(&guestRetention, "guest-retention", guestRetention, "delete guest accounts that never finished a match once unused for this long (0 keeps them)")
+	flag.IntVar(&loginRate, "login-rate", loginRate, "logins allowed per client IP per minute (0 is unlimited)")
+	flag.IntVar(&loginNameRate, "login-name-rate", loginNameRate, "logins allowed per account name per minute (0 is unlimited)")
+	flag.DurationVar(&nameChangeCooldown, "name-change-cooldown", nameChangeCooldown, "how long players must wait between changing their account name")
+	flag.IntVar(&chatRate, "chat-rate", chatRate, "chat messages a player may send per -chat-interval")
+	flag.DurationVar(&chatInterval, "chat-interval", chatInterval, "the window -chat-rate counts chat messages over")
+	flag.IntVar(&emoteRate, "emote-rate", emoteRate, "emotes a player may send per -emote-interval")
+	flag.DurationVar(&emoteInterval, "emote-interval", emoteInterval, "the window -emote-rate counts emotes over")
+	flag.StringVar(&wordListPath, "word-list", "", "file of words to filter from chat and names, one per line, instead of the built-in list")
+	flag.DurationVar(&chatRetention, "chat-retention", chatRetention, "how long chat logs are kept (0 keeps them forever)")
+	flag.DurationVar(&seasonLength, "season-length", seasonLength, "how long each leaderboard season runs")
+	flag.StringVar(&oauthConfig.RedirectBase, "oauth-redirect-base", "http://localhost:8080", "public URL of this server, which OAuth providers redirect back to")
+	flag.StringVar(&oauthConfig.GoogleClientID, "google-client-id", "", "OAuth client ID for signing in with Google (empty disables)")
+	flag.StringVar(&oauthConfig.GoogleClientSecret, "google-client-secret", "", "OAuth client secret for signing in with Google")
+	flag.StringVar(&oauthConfig.GitHubClientID, "github-client-id", "", "OAuth client ID for signing in with GitHub (empty disables)")
+	flag.StringVar(&oauthConfig.GitHubClientSecret, "github-client-secret", "", "OAuth client secret for signing in with GitHub")
+	flag.Parse()
+	upgrader.EnableCompression = compression
+	initAuth(*authSecretFlag)
+	initOAuth(oauthConfig)
+	initRateLimits()
+	if err := initWordFilter(); err != nil {
+		log.Fatal("Failed to load word list: ", err)
+	}
 
-	router.GET("/ws", wsHandler)
+	if *migrateOnly {
+		if dbConfig.DSN == "" {
+			log.Fatal("-migrate-only needs a database")
+		}
+		dbConfig.Migrate = true
+		openDB(dbConfig)
+		log.Printf("Database is up to date")
+		return
+	}
+	if dbConfig.DSN != "" {
+		openDB(dbConfig)
+		if err := syncAchievements(); err != nil {
+			log.Fatal("Failed to update achievements: ", err)
+		}
+		go runSessionSweeper()
+		go runSeasons()
+		go runChatLogWriter()
+	}
 
-	if err := router.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go runJanitor(roomIdleTimeout)
+	go queue.Run()
+	go runAFKChecker()
+	go runBroadcastThrottle()
+	var grpcServer *grpc.Server
+	if grpcAddr != "" {
+		grpcServer = newGRPCServer()
+		go serveGRPC(grpcServer, grpcAddr)
 	}
+	if debugAddr != "" {
+		go serveDebug(debugAddr)
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: newRouter()}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	shutdown(server, grpcServer)
+}
+
+// newRouter routes the server's HTTP and websocket endpoints. Tests serve it
+// with httptest.
+func newRouter() *gin.Engine {
+	router := gin.Default()
+	router.Use(rejectWhileShuttingDown)
+
+	router.GET("/ws", wsHandler)
+	router.GET("/healthz", healthz)
+	router.POST("/register", limitByIP(registerLimiter), registerPlayer)
+	router.POST("/login", limitByIP(loginLimiter), loginPlayer)
+	router.POST("/logout", requireSession, logoutHandler)
+	router.GET("/auth/:provider", oauthLogin)
+	router.GET("/auth/:provider/callback", limitByIP(loginLimiter), oauthCallback)
+	router.GET("/players", listPlayers)
+	router.GET("/players/me/inventory", requireSession, listInventory)
+	router.GET("/shop", listShopItems)
+	router.GET("/palette", listPalette)
+	router.GET("/emotes", listEmotes)
+	router.POST("/shop/:item/buy", requireSession, buyShopItem)
+	router.PUT("/players/me", requireSession, updateProfile)
+	router.PUT("/players/me/preferences", requireSession, updatePreferences)
+	router.DELETE("/players/me", requireSession, deleteAccount)
+	router.GET("/players/me/friends", requireSession, listFriends)
+	router.POST("/players/me/friends", requireSession, requestFriend)
+	router.POST("/players/me/friends/:friendID/accept", requireSession, acceptFriend)
+	router.POST("/players/me/friends/:friendID/decline", requireSession, removeFriend)
+	router.DELETE("/players/me/friends/:friendID", requireSession, removeFriend)
+	router.POST("/parties/:code/join", requireSession, joinPartyHandler)
+	router.GET("/status", statusHandler)
+	router.GET("/rooms", listRooms)
+	router.GET("/rooms/:id/state", roomStateHandler)
+	router.GET("/rooms/:id/events", streamEvents)
+	router.POST("/rooms", createRoomHandler)
+	router.GET("/invite/:roomID", inviteHandler)
+	router.GET("/leaderboard", leaderboardHandler)
+	router.GET("/matches/:id", getMatch)
+	router.GET("/matches/:id/chat", matchChat)
+	router.GET("/players/:id/matches", listPlayerMatches)
+	router.GET("/players/:id/stats", playerStatsHandler)
+	router.GET("/players/:id/achievements", playerAchievementsHandler)
+	router.StaticFile("/wasm_exec.js", "./wasm/wasm_exec.js")
+	router.StaticFile("/game.wasm", "./wasm/game.wasm")
+	router.StaticFile("/", "./index.html")
+	return router
 }
 
 func wsHandler(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade to websocket: %v", err)
 		return
 	}
-	defer func(conn *websocket.Conn) {
-		err := conn.Close()
+	if err := ws.SetCompressionLevel(compressionLevel); err != nil {
+		log.Printf("Invalid compression level %d: %v", compressionLevel, err)
+	}
+	conn := newConn(ws)
+	defer conn.Close()
+
+	hello, err := readHello(conn)
+	if joinErr, ok := err.(*JoinError); ok {
+		rejectConnection(conn, jsonCodec, joinErr)
+		return
+	} else if err != nil {
+		log.Printf("Error reading hello: %v", err)
+		return
+	}
+	token := requestToken(c)
+	if token == "" {
+		token = hello.Token
+	}
+	account, joinErr := authenticate(token, requestClient(c))
+	if joinErr != nil {
+		rejectConnection(conn, jsonCodec, joinErr)
+		return
+	}
+	id := generatePlayerID()
+	sendWelcome(conn, jsonCodec, hello, id, account, c.Query("room"))
+
+	serveSession(Session{
+		Conn:     conn,
+		Read:     conn.Read,
+		Codec:    codecFor(hello.Encoding),
+		Hello:    hello,
+		ID:       id,
+		Account:  account,
+		IP:       c.ClientIP(),
+		RoomID:   c.Query("room"),
+		JoinCode: c.Query("code"),
+		Spectate: c.Query("spectate") == "1",
+	})
+}
+
+// Session is a client that has completed the handshake, whichever transport
+// it came in on. Account is who they signed in as, a zero Account for a
+// guest. RoomID, JoinCode and Spectate are what the client asked for when
+// connecting, before sending anything.
+type Session struct {
+	Conn     Transport
+	Read     func() ([]byte, error)
+	Codec    Codec
+	Hello    *HelloPayload
+	ID       string
+	Account  Account
+	IP       string
+	RoomID   string
+	JoinCode string
+	Spectate bool
+}
+
+// serveSession places the client as a spectator or a player and handles
+// their messages until the connection drops.
+func serveSession(s Session) {
+	conn, codec, hello := s.Conn, s.Codec, s.Hello
+	if s.Spectate {
+		spectate(conn, s.Read, codec, s.ID, s.RoomID, s.JoinCode)
+		return
+	}
+
+	// The message after the handshake says what the client wants: to
+	// spectate, resume a held seat, join a room or party, or be matched.
+	first, err := s.Read()
+	if err != nil {
+		log.Printf("Error reading message: %v", err)
+		return
+	}
+	env, intro, err := decodeMessage(codec, first)
+	introType := env.Type
+	if err != nil {
+		log.Printf("Error decoding message: %v", err)
+		writeError(conn, codec, err.(*DecodeError).Code, err.Error())
+	}
+	if intro, ok := intro.(*SpectatePayload); ok {
+		spectate(conn, s.Read, codec, s.ID, intro.RoomID, intro.JoinCode)
+		return
+	}
+
+	var player *Player
+	if resume, ok := intro.(*ReconnectPayload); ok {
+		player, err = resumePlayer(conn, resume.PlayerID, resume.Token, resume.LastEventID)
 		if err != nil {
-			log.Printf("Error closing connection: %v", err)
-		} else {
-			log.Println("Connection closed successfully")
+			rejectConnection(conn, codec, err.(*JoinError))
+			return
+		}
+		player.Protocol = hello.Version
+		player.Codec = codec
+		player.Deltas = hello.supports("delta")
+		player.CompactBoard = hello.supports("compactBoard")
+		player.Seq.Store(env.Seq) // a resumed connection may restart its numbering
+		connected.Add(player)
+		defer connected.Remove(player)
+	} else {
+		player = createPlayer(conn, s.ID)
+		player.AccountID = s.Account.ID
+		player.Guest = s.Account.Guest
+		player.SessionID = s.Account.SessionID
+		player.Character = s.Account.Character
+		player.ColorPref = s.Account.Color
+		if s.Account.Name != "" {
+			player.Name = s.Account.Name
+		}
+		player.Protocol = hello.Version
+		player.Codec = codec
+		player.Deltas = hello.supports("delta")
+		player.CompactBoard = hello.supports("compactBoard")
+		player.Seq.Store(env.Seq)
+		player.IP = s.IP
+		player.Rating = lookupRating(player.AccountID)
+		player.mutedAccounts = lookupMutes(player.AccountID)
+		connected.Add(player)
+		defer connected.Remove(player)
+		if intro != nil {
+			handleMessage(player, introType, intro)
 		}
-	}(conn)
-
-	player := createPlayer(conn)
-	room := findOrCreateRoom()
-	joinRoom(player, room)
 
-	defer removePlayer(player, room) // Add this line
+		if !placePlayer(player, introType, intro, s.RoomID, s.JoinCode) {
+			return
+		}
+	}
 
-	sendInitialState(player)
+	defer func() {
+		partyMemberDisconnected(player)
+		if queue.Remove(player) {
+			return
+		}
+		room := player.Room.Load()
+		if room == nil || holdForReconnect(player, room, conn) {
+			return
+		}
+		removePlayer(player, room)
+		queue.Release()
+	}()
 
 	for {
-		_, message, err := conn.ReadMessage()
+		message, err := s.Read()
 		if err != nil {
 			log.Printf("Error reading message: %v", err)
 			return // Return from the function when an error occurs
@@ -118,279 +523,757 @@ func wsHandler(c *gin.Context) {
 	}
 }
 
+// placePlayer sends a new player to the room they asked for, in their join
+// message or else when connecting, the party lobby or the admission queue. It
+// reports false if the connection was rejected.
+func placePlayer(player *Player, introType string, intro Payload, roomID, joinCode string) bool {
+	if join, ok := intro.(*JoinPayload); ok && join.RoomID != "" {
+		roomID, joinCode = join.RoomID, join.JoinCode
+	}
+
+	switch {
+	case roomID != "":
+		if err := admitByID(player, roomID, joinCode); err != nil {
+			rejectConnection(player.Conn, player.Codec, err.(*JoinError))
+			return false
+		}
+	case introType == "createParty" || introType == "joinParty":
+		// Party members stay in the lobby until their leader queues.
+	default:
+		queue.Enqueue(player)
+	}
+	return true
+}
+
 func removePlayer(player *Player, room *Room) {
-	room.Mutex.Lock()
-	defer room.Mutex.Unlock()
+	room.do(func() {
+		delete(room.Players, player.ID)
+		player.Room.Store(nil)
+		room.LastActivity = time.Now()
 
-	delete(room.Players, player.ID)
-	player.Room = nil
+		if room.Phase.Playing() {
+			queueInput(room, game.Leave{Player: &player.Player})
+		}
 
-	if len(room.Players) == 0 {
-		delete(rooms, room.ID)
-	}
+		if room.Vote != nil && room.Vote.TargetID == player.ID {
+			endKickVote(room, "cancelled")
+		}
 
-	log.Printf("Player %s removed from room %s", player.ID, room.ID)
+		if room.HostID == player.ID {
+			room.HostID = ""
+			for id := range room.Players {
+				room.HostID = id
+				break
+			}
+			if room.HostID != "" {
+				broadcastMessage(room, Message{Type: "hostChanged", Payload: HostChangedPayload{PlayerID: room.HostID}})
+			}
+		}
+
+		publish(room, PlayerLeft{Player: player})
+
+		if len(room.Players) == 0 {
+			closeSpectators(room)
+			room.retire()
+			room.stop()
+		}
+
+		log.Printf("Player %s removed from room %s", player.ID, room.ID)
+	})
 }
 
-func createPlayer(conn *websocket.Conn) *Player {
+func createPlayer(conn Transport, id string) *Player {
 	return &Player{
-		ID:       generatePlayerID(),
-		Conn:     conn,
-		Color:    getRandomColor(),
-		Position: getRandomPosition(),
+		Player: game.Player{
+			ID:    id,
+			Color: getRandomColor(),
+		},
+		Token:        generateRandomString(32),
+		LastActivity: time.Now(),
+		Conn:         conn,
+		Codec:        jsonCodec,
 	}
 }
 
-func findOrCreateRoom() *Room {
-	for _, room := range rooms {
-		if len(room.Players) < maxPlayers {
-			return room
-		}
+// admitByID seats a player who asked for a specific room, bypassing the
+// queue but not the server's player cap. A private room only admits players
+// with its join code, and a wrong code is reported the same way as a missing
+// room.
+func admitByID(player *Player, roomID, joinCode string) error {
+	room, ok := rooms.Get(roomID)
+	if !ok {
+		return errRoomNotFound
+	}
+	if !queue.TryAdmit() {
+		return errServerFull
 	}
-	return createRoom()
+	if err := admitPlayer(room, joinCode, player); err != nil {
+		queue.Release()
+		return err
+	}
+	return nil
 }
 
-func createRoom() *Room {
-	roomID := generateRoomID()
-	gameState := &GameState{
-		Board:   createBoard(),
-		Players: make([]*Player, 0),
+// joinError is why the room won't take the players, or nil if it will. It
+// must run on the room's goroutine.
+func joinError(room *Room, joinCode string, players []*Player) error {
+	switch {
+	case room.Private && joinCode != room.JoinCode:
+		return errRoomNotFound
+	case !room.Phase.Joinable():
+		return errGameStarted
+	case anyBanned(room, players):
+		return errBanned
+	case len(room.Players)+len(players) > room.Settings.MaxPlayers:
+		return errRoomFull
 	}
+	return nil
+}
+
+// newRoom builds an empty room. Rooms are created through RoomManager.Create,
+// which registers them.
+func newRoom(roomID string) *Room {
+	settings := defaultSettings()
+	rules, _ := game.NewRules(settings.Mode)
+	match := game.NewMatch(boardSize, settings.tickInterval(), rules, leaverTerritory)
+	gameState := &GameState{Board: match.Board}
+	seed := newRoomSeed()
 	room := &Room{
-		ID:        roomID,
-		Players:   make(map[string]*Player),
-		GameState: gameState,
-		Duration:  gameDuration,
+		ID:            roomID,
+		Players:       make(map[string]*Player),
+		GameState:     gameState,
+		Duration:      gameDuration,
+		Settings:      settings,
+		Spectators:    make(map[string]Subscriber),
+		Match:         match,
+		LastActivity:  time.Now(),
+		Start:         make(chan struct{}),
+		Done:          make(chan struct{}),
+		VoteCooldowns: make(map[string]time.Time),
+		Bans:          make(map[string]time.Time),
+		Muted:         make(map[string]bool),
+		Seed:          seed,
+		rand:          newRoomRand(seed),
+		Clock:         roomClock,
+		commands:      make(chan func()),
+	}
+	stats := &MatchStats{roomID: roomID, seed: seed}
+	room.Bus.Subscribe("stats", stats.handle)
+	if db != nil {
+		room.Bus.Subscribe("matches", recordMatches(roomID))
+		room.Bus.Subscribe("achievements", awardAchievements(roomID))
 	}
-	rooms[roomID] = room
+	go room.run()
 	return room
 }
 
-func joinRoom(player *Player, room *Room) {
-	room.Mutex.Lock()
-	defer room.Mutex.Unlock()
+// run is the room's goroutine. Every change to the room's state, from a
+// player's message to a game tick, is a command it runs in turn, so nothing
+// else touches the room and commands never race.
+func (room *Room) run() {
+	for {
+		select {
+		case command := <-room.commands:
+			command()
+		case <-room.Done:
+			return
+		}
+	}
+}
+
+// do runs fn on the room's goroutine and waits for it to finish. It reports
+// false, without running fn, once the room has stopped. fn must not call do
+// on the same room.
+func (room *Room) do(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case room.commands <- func() { defer close(done); fn() }:
+	case <-room.Done:
+		return false
+	}
+	<-done
+	return true
+}
+
+// stop ends the room's goroutine and its game loop. It must run on the
+// room's goroutine.
+func (room *Room) stop() {
+	if !room.Closed {
+		room.Closed = true
+		close(room.Done)
+	}
+}
+
+// retire unregisters the room and ends its event subscriptions. It must run on
+// the room's goroutine.
+func (room *Room) retire() {
+	room.Bus.Close()
+	rooms.Delete(room)
+}
 
-	player.Room = room
+// joinRoom seats the players in the room together, if it will have them. The
+// room checks and seats them in one command, so nobody can take their places
+// in between; it returns the *JoinError it turned them away with.
+func joinRoom(room *Room, joinCode string, players ...*Player) error {
+	var err error
+	ran := room.do(func() {
+		if err = joinError(room, joinCode, players); err != nil {
+			return
+		}
+		for _, player := range players {
+			seatPlayer(room, player)
+		}
+	})
+	if !ran {
+		return errRoomNotFound
+	}
+	return err
+}
+
+// seatPlayer adds the player to the room. It must run on the room's
+// goroutine.
+func seatPlayer(room *Room, player *Player) {
+	assignColor(room, player)
+	assignTeam(room, player)
+	player.Room.Store(room)
+	player.seat = room.NextSeat
+	room.NextSeat++
 	room.Players[player.ID] = player
+	room.LastActivity = time.Now()
+	if room.HostID == "" {
+		room.HostID = player.ID
+	}
+	if len(room.Players) >= room.Settings.MaxPlayers {
+		requestStart(room)
+	}
 
 	if len(room.Players) == 1 {
 		go startGame(room)
-	} else {
-		player.Position = getRandomPosition()
-		player.TargetPosition = player.Position
-		broadcastMessage(room, Message{
-			Type: "playerJoined",
-			Name: player.Name,
-		})
+		return
+	}
+
+	// When the lobby ends startGame spawns everyone in the room; after that
+	// a late joiner is spawned by the next tick.
+	if room.Phase.Playing() {
+		queueInput(room, game.Join{Player: &player.Player, Position: room.randomPosition(), Radius: startingTerritory})
+		return
 	}
+	publish(room, PlayerJoined{Player: player})
+}
+
+// spawnPlayer places the player on the board with a small starting
+// territory. It must run on the room's goroutine.
+func spawnPlayer(room *Room, player *Player) {
+	room.Match.Spawn(&player.Player, room.randomPosition(), startingTerritory)
+	player.spawned = true
 }
 
 func leaveRoom(player *Player) {
-	room := player.Room
+	room := player.Room.Load()
 	if room == nil {
 		return
 	}
 
-	room.Mutex.Lock()
-	defer room.Mutex.Unlock()
+	room.do(func() {
+		delete(room.Players, player.ID)
+		player.Room.Store(nil)
 
-	delete(room.Players, player.ID)
-	player.Room = nil
+		if len(room.Players) == 0 {
+			room.retire()
+			room.stop()
+		}
+	})
+}
 
-	if len(room.Players) == 0 {
-		delete(rooms, room.ID)
-	}
+// lobbyMessageTypes are the messages a player may send before being placed
+// in a room.
+var lobbyMessageTypes = map[string]bool{
+	"join":        true,
+	"createParty": true,
+	"joinParty":   true,
+	"leaveParty":  true,
+	"queue":       true,
 }
 
 func processMessage(player *Player, message []byte) {
-	var msg Message
-	if err := json.Unmarshal(message, &msg); err != nil {
-		log.Printf("Error unmarshalling message: %v", err)
+	env, payload, err := decodeMessage(player.Codec, message)
+	if env.Seq != 0 {
+		if processed := player.Seq.Load(); env.Seq <= processed {
+			log.Printf("Dropping message %d from %s: already processed %d", env.Seq, player.ID, processed)
+			return
+		}
+		player.Seq.Store(env.Seq)
+	}
+	if err != nil {
+		log.Printf("Error decoding message from %s: %v", player.ID, err)
+		sendDecodeError(player, err.(*DecodeError))
 		return
 	}
+	handleMessage(player, env.Type, payload)
+}
 
-	room := player.Room
+func handleMessage(player *Player, msgType string, payload Payload) {
+	if player.Protocol == 0 || msgType == "hello" {
+		sendError(player, "HANDSHAKE_REQUIRED", "send hello once, before anything else")
+		return
+	}
 
-	switch msg.Type {
+	// Pings and clock syncs are answered anywhere and don't count as
+	// activity, so a client measuring latency can still be found AFK.
+	switch msg := payload.(type) {
+	case *PingPayload:
+		sendMessage(player, pong(msg))
+		return
+	case *TimeSyncPayload:
+		sendMessage(player, timeSync(msg))
+		return
+	}
+
+	room := player.Room.Load()
+	if room == nil && !lobbyMessageTypes[msgType] {
+		sendError(player, "NOT_IN_ROOM", msgType+" needs a room, and you are not in one yet")
+		return
+	}
+
+	if room != nil {
+		var phase Phase
+		room.do(func() {
+			room.LastActivity = time.Now()
+			player.LastActivity = room.LastActivity
+			player.AFKWarnedAt = time.Time{}
+			phase = room.Phase
+		})
+
+		if !phase.Accepts(msgType) {
+			sendError(player, "WRONG_PHASE", fmt.Sprintf("%s is not allowed while the game is %s", msgType, phase))
+			return
+		}
+	}
+
+	switch msgType {
 	case "join":
-		player.Name = msg.Name
-		player.Color = getRandomColor()
-		log.Printf("%s joined the game", player.Name)
+		msg := payload.(*JoinPayload)
+		if !player.registered() {
+			renamePlayer(player, msg.Name)
+		}
+		log.Printf("%s joined the game", player.ID)
 
 	case "move":
-		updatePlayerPosition(player, msg.Direction)
-		broadcastMessage(room, Message{
-			Type:     "positionUpdate",
-			PlayerID: player.ID,
-			X:        player.Position.X,
-			Y:        player.Position.Y,
+		msg := payload.(*MovePayload)
+		room.do(func() {
+			if room.Pause != nil {
+				sendError(player, "GAME_PAUSED", "the game is paused")
+				return
+			}
+			if !room.Phase.Accepts(msgType) {
+				sendError(player, "WRONG_PHASE", fmt.Sprintf("%s is not allowed while the game is %s", msgType, room.Phase))
+				return
+			}
+			queueInput(room, game.Move{Player: &player.Player, Direction: msg.Direction, Seq: player.Seq.Load()})
 		})
-		log.Printf("%s moved to %d, %d", player.Name, player.Position.X, player.Position.Y)
 
 	case "chat":
-		room.GameState.ChatMessages = append(room.GameState.ChatMessages, player.Name+": "+msg.ChatMessage)
-		log.Printf("%s: %s", player.Name, msg.ChatMessage)
-		broadcastMessage(room, Message{
-			Type:        "chat",
-			PlayerID:    player.ID,
-			Name:        player.Name,
-			ChatMessage: msg.ChatMessage,
-		})
+		msg := payload.(*ChatPayload)
+		if msg.Channel == ChannelTeam {
+			postTeamChat(player, msg.Message)
+		} else {
+			postChat(player, msg.Message)
+		}
+
+	case "whisper":
+		msg := payload.(*WhisperPayload)
+		whisper(player, msg.To, msg.Message)
+
+	case "emote":
+		sendEmote(player, payload.(*EmotePayload).Emote)
+
+	case "mute", "unmute":
+		msg := payload.(*MutePayload)
+		if msg.Room {
+			roomMute(player, msg.TargetID, msgType == "mute")
+		} else {
+			mutePlayer(player, msg.TargetID, msgType == "mute")
+		}
+
+	case "votekick":
+		startKickVote(player, payload.(*VoteKickPayload).TargetID)
+
+	case "vote":
+		msg := payload.(*VotePayload)
+		castKickVote(player, msg.TargetID, msg.Vote == "yes")
+
+	case "createParty":
+		createParty(player, payload.(*CreatePartyPayload).Name)
 
+	case "joinParty":
+		msg := payload.(*JoinPartyPayload)
+		joinParty(player, msg.Name, msg.PartyCode, msg.MemberID)
+
+	case "friendInvite":
+		inviteFriend(player, payload.(*InviteFriendPayload).AccountID)
+
+	case "configure":
+		configureRoom(player, *payload.(*ConfigurePayload).Settings)
+
+	case "leaveParty":
+		leaveParty(player)
+
+	case "queue":
+		queueParty(player)
+
+	case "start":
+		startRoom(player)
+
+	case "chooseColor":
+		chooseColor(player, payload.(*ChooseColorPayload).Color)
+
+	case "pause":
+		pauseGame(player)
+
+	case "resume":
+		resumeGame(player)
+
+	default:
+		sendError(player, "UNKNOWN_TYPE", msgType+" is not allowed here")
 	}
 }
 
+// startGame is the room's clock. It waits out the lobby, until the host
+// starts the game, the room fills up or lobbyDuration passes, then has the
+// room spawn everyone with its final settings, counts down and sends the
+// room a tick every gameInterval.
 func startGame(room *Room) {
-	room.Mutex.Lock()
-	defer room.Mutex.Unlock()
+	select {
+	case <-room.Start:
+	case <-room.Clock.After(lobbyDuration):
+	case <-room.Done:
+		return
+	}
 
-	room.StartTime = time.Now()
+	startsAt := room.Clock.Now().Add(countdownDuration)
+	room.do(func() {
+		if size := room.Settings.BoardSize; size != room.size() {
+			room.Match = game.NewMatch(size, room.Match.Interval, room.Match.Rules, room.Match.Leavers)
+			room.GameState.Board = room.Match.Board
+		}
+		room.Match.Steal = room.Settings.StealRule == StealAllowed
+		room.Match.Interval = room.Settings.tickInterval()
+		room.Duration = time.Duration(room.Settings.Duration) * time.Second
+		for _, player := range room.roster() {
+			spawnPlayer(room, player)
+		}
+		room.setPhase(PhaseCountdown)
+		broadcastMessage(room, Message{
+			Type: "gameStarting",
+			Payload: GameStartingPayload{
+				GameState: stateView(room),
+				Remaining: int(countdownDuration.Seconds()),
+				StartsAt:  startsAt.UnixMilli(),
+			},
+		})
+	})
 
-	for _, player := range room.Players {
-		player.Position = getRandomPosition()
-		player.TargetPosition = player.Position
-		room.GameState.Players = append(room.GameState.Players, player)
+	select {
+	case <-room.Clock.After(startsAt.Sub(room.Clock.Now())):
+	case <-room.Done:
+		return
 	}
 
-	ticker := time.NewTicker(gameInterval)
-	defer ticker.Stop()
+	room.do(func() {
+		room.StartTime = room.Clock.Now()
+		room.setPhase(PhaseInProgress)
+	})
+
+	ticks, stop := room.Clock.Tick(room.Match.Interval)
+	defer stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			room.Mutex.Lock()
-			updateGame(room)
-			remainingTime := room.Duration - time.Since(room.StartTime)
-			if remainingTime <= 0 {
-				endGame(room)
-				room.Mutex.Unlock()
+		case <-ticks:
+			running := false
+			room.do(func() { running = room.tick() })
+			if !running {
 				return
 			}
-			broadcastGameState(room, remainingTime)
-			room.Mutex.Unlock()
+		case <-room.Done:
+			return
 		}
 	}
 }
 
-func updateGame(room *Room) {
-	for _, player := range room.Players {
-		player.Score = countPlayerSquares(room.GameState.Board, player.Color)
+// tick advances the game by one step and broadcasts the result, or ends the
+// game once time is up and the lead isn't tied for overtime, timing the step
+// and broadcast for the room's TickStats. It reports whether the game is
+// still running. A paused room doesn't advance, and resumes once its pause
+// allowance has run out. It must run on the room's goroutine.
+func (room *Room) tick() bool {
+	if room.Pause != nil {
+		if room.Clock.Now().Before(room.Pause.Expires) {
+			return true
+		}
+		endPause(room, "")
+	}
+	start := time.Now()
+	over := updateGame(room)
+	if over || (room.remaining() <= 0 || room.Phase == PhaseOvertime) && !room.overtime() {
+		endGame(room)
+		return false
 	}
+	bytes := broadcastGameState(room, room.remaining())
+	room.TickStats.record(start, time.Since(start), bytes)
+	return true
 }
 
-func endGame(room *Room) {
-	var winner *Player
-	maxScore := 0
-
-	for _, player := range room.Players {
-		if player.Score > maxScore {
-			maxScore = player.Score
-			winner = player
+// updateGame steps the match with the inputs queued since the last tick and
+// publishes what came of them. It reports whether the rules ended the game.
+// Players whose seat is held for a reconnect sit the step out and keep their
+// last score. It must run on the room's goroutine.
+//
+// Only the tick changes the match: message handlers queue their inputs, and
+// Match.Step applies them in a fixed order, so the same inputs always play
+// out the same way. Chat, settings and the rest of the room's business don't
+// touch the match and take effect at once.
+func updateGame(room *Room) bool {
+	inputs := takeInputs(room)
+	var connected []*game.Player
+	for _, player := range room.roster() {
+		if player.Conn != nil {
+			connected = append(connected, &player.Player)
 		}
 	}
+	events, over := room.Match.Step(inputs, connected)
+	publishMatchEvents(room, events)
+	return over
+}
 
-	broadcastMessage(room, Message{
-		Type:   "gameOver",
-		Winner: winner,
+// endGame announces the winner and retires the room. It must run on the room's
+// goroutine.
+func endGame(room *Room) {
+	roster := room.roster()
+	players := make([]*game.Player, len(roster))
+	for i, player := range roster {
+		players[i] = &player.Player
+	}
+	result := room.Match.End(players)
+	var winner *Player
+	if result.Winner != nil {
+		winner = room.Players[result.Winner.ID]
+	}
+	endedAt := room.Clock.Now()
+	var played time.Duration
+	if !room.StartTime.IsZero() {
+		played = endedAt.Sub(room.StartTime) - room.PausedTotal
+	}
+	publish(room, GameEnded{
+		Winner:    winner,
+		Scores:    result.Scores,
+		Standings: standings(room.Match, roster, result.Scores),
+		Mode:      room.Settings.Mode,
+		BoardSize: room.size(),
+		Seed:      room.Seed,
+		StartedAt: room.StartTime,
+		EndedAt:   endedAt,
+		Played:    played,
 	})
 
-	delete(rooms, room.ID)
+	revealTeamChat(room)
+	room.setPhase(PhaseFinished)
+	room.retire()
 }
 
-func broadcastGameState(room *Room, remainingTime time.Duration) {
-	chatMessages := formatChatMessages(room.GameState.ChatMessages)
-	msg := Message{
-		Type:        "gameState",
-		GameState:   room.GameState,
-		Remaining:   int(remainingTime.Seconds()),
-		ChatMessage: chatMessages,
+// standings ranks the roster by score, best first, keeping roster order on
+// a tie.
+func standings(match *game.Match, roster []*Player, scores map[string]int) []Standing {
+	list := make([]Standing, len(roster))
+	for i, player := range roster {
+		list[i] = Standing{
+			PlayerID:  player.ID,
+			AccountID: player.AccountID,
+			Guest:     player.Guest,
+			Name:      player.Name,
+			Color:     player.Color,
+			Team:      player.Team,
+			Score:     scores[player.ID],
+			Territory: match.Territory(player.Color),
+		}
+	}
+	slices.SortStableFunc(list, func(a, b Standing) int { return cmp.Compare(b.Score, a.Score) })
+	for i := range list {
+		list[i].Placement = i + 1
+		if i > 0 && list[i].Score == list[i-1].Score {
+			list[i].Placement = list[i-1].Placement
+		}
 	}
-	broadcastMessage(room, msg)
+	return list
 }
 
-func sendInitialState(player *Player) {
-	room := player.Room
-	msg := Message{
-		Type:      "gameState",
-		GameState: room.GameState,
-		Remaining: int(room.Duration.Seconds()),
+// admitPlayer puts admitted players into a room together, as joinRoom does,
+// and sends them the current state.
+func admitPlayer(room *Room, joinCode string, players ...*Player) error {
+	if err := joinRoom(room, joinCode, players...); err != nil {
+		return err
 	}
-	sendMessage(player, msg)
+	room.do(func() {
+		for _, player := range players {
+			sendInitialState(player)
+		}
+	})
+	return nil
+}
+
+// sendInitialState sends a newly placed player their session and the full
+// game state. It must run on the room's goroutine.
+func sendInitialState(player *Player) {
+	room := player.Room.Load()
+	sendSession(player)
+	sendMessage(player, Message{
+		Type:    "gameState",
+		Payload: snapshot(room, room.remaining(), player.CompactBoard),
+	})
+}
+
+func sendSession(player *Player) {
+	sendMessage(player, Message{
+		Type:    "session",
+		Payload: SessionPayload{PlayerID: player.ID, Token: player.Token},
+	})
 }
 
+// broadcastMessage publishes msg, a message with no event of its own, on the
+// room's bus as an Announced event, which delivers it to the room and logs it
+// for replay through deliverMessage. It must run on the room's goroutine.
 func broadcastMessage(room *Room, msg Message) {
+	publish(room, Announced{Message: msg})
+}
+
+// deliverMessage sends a broadcast to the room's players, and to its
+// spectators if they get that type, logging it for replay. It must run on the
+// room's goroutine.
+func deliverMessage(room *Room, msg Message) {
+	if msg.Type != "gameState" {
+		msg.EventID = room.Events.Append(msg)
+	}
+	sender := chatSender(room, msg)
+	cache := newPayloadCache(msg)
 	for _, player := range room.Players {
-		sendMessage(player, msg)
+		if !player.mutes(sender) {
+			sendBroadcast(player, cache)
+		}
+	}
+	if spectatorMessageTypes[msg.Type] {
+		for _, spectator := range room.Spectators {
+			spectator.Deliver(cache)
+		}
 	}
 }
 
-func sendMessage(player *Player, msg Message) {
-	player.Conn.WriteJSON(msg)
+func pong(ping *PingPayload) Message {
+	return Message{
+		Type:    "pong",
+		Payload: PongPayload{ClientTime: ping.ClientTime, ServerTime: time.Now().UnixMilli()},
+	}
 }
 
-// Helper functions
-func createBoard() [][]string {
-	board := make([][]string, boardSize)
-	for i := range board {
-		board[i] = make([]string, boardSize)
+func timeSync(sync *TimeSyncPayload) Message {
+	return Message{
+		Type:    "timeSync",
+		Payload: TimeSyncReplyPayload{ClientTime: sync.ClientTime, ServerTime: time.Now().UnixMilli()},
 	}
-	return board
 }
 
-func getRandomPosition() Position {
-	x := rand.Intn(boardSize)
-	y := rand.Intn(boardSize)
-	return Position{X: x, Y: y}
+func sendMessage(player *Player, msg Message) {
+	if player.Conn == nil {
+		return
+	}
+	msg.AckSeq = player.Seq.Load()
+	writeMessage(player.Conn, player.Codec, msg)
 }
 
-func updatePlayerPosition(player *Player, direction string) {
-	switch direction {
-	case "up":
-		player.TargetPosition.Y -= playerSpeed
-	case "down":
-		player.TargetPosition.Y += playerSpeed
-	case "left":
-		player.TargetPosition.X -= playerSpeed
-	case "right":
-		player.TargetPosition.X += playerSpeed
+// sendBroadcast writes a cached broadcast to player, sharing the encoded
+// frame with everyone else it fits.
+func sendBroadcast(player *Player, cache *payloadCache) {
+	if player.Conn == nil {
+		return
 	}
-	player.Position = player.TargetPosition
+	player.Conn.SendBroadcast(player.Codec, player.Seq.Load(), cache)
 }
 
-func countPlayerSquares(board [][]string, color string) int {
-	count := 0
-	for _, row := range board {
-		for _, cell := range row {
-			if cell == color {
-				count++
-			}
+// roster is the room's players in the order they joined, as the match and
+// the broadcasts see them. While a match is under way, players who joined it
+// late are left out until the tick that spawns them. It must run on the
+// room's goroutine.
+func (room *Room) roster() []*Player {
+	roster := make([]*Player, 0, len(room.Players))
+	playing := room.Phase.Playing()
+	for _, player := range room.Players {
+		if !playing || player.spawned {
+			roster = append(roster, player)
 		}
 	}
-	return count
+	slices.SortFunc(roster, func(a, b *Player) int { return cmp.Compare(a.seat, b.seat) })
+	return roster
+}
+
+// player is the room's player behind a match player, or nil if they have
+// left. It must run on the room's goroutine.
+func (room *Room) player(p *game.Player) *Player {
+	if player := room.Players[p.ID]; player != nil && &player.Player == p {
+		return player
+	}
+	return nil
+}
+
+func (room *Room) size() int {
+	return room.Match.Board.Size()
 }
 
+// playerIDLength makes player IDs, about 95 bits, infeasible to guess. An ID
+// is half of what resumes a held seat, names the party seat a player takes
+// back and addresses a whisper, none of which should be open to guessing.
+const playerIDLength = 16
+
+// generatePlayerID picks an ID no connected player has.
 func generatePlayerID() string {
-	return generateRandomString(8)
+	for {
+		id := generateRandomString(playerIDLength)
+		if connected.Get(id) == nil {
+			return id
+		}
+	}
 }
 
 func generateRoomID() string {
 	return generateRandomString(6)
 }
 
+// generateRandomString draws length characters from crypto/rand, each
+// uniformly from the alphanumerics. It never repeats a sequence across
+// restarts, unlike math/rand, but it doesn't check for collisions either;
+// callers check against their own registry.
 func generateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// Bytes at or above limit are discarded so every character is as likely.
+	const limit = 256 - 256%len(charset)
+
 	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
+	buf := make([]byte, length+length/4)
+	for i := 0; i < length; {
+		if _, err := crand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, r := range buf {
+			if int(r) >= limit {
+				continue
+			}
+			b[i] = charset[int(r)%len(charset)]
+			if i++; i == length {
+				break
+			}
+		}
 	}
 	return string(b)
 }
 
 func getRandomColor() string {
-	colors := []string{"#f44336", "#e91e63", "#9c27b0", "#673ab7", "#3f51b5", "#2196f3", "#03a9f4", "#00bcd4", "#009688", "#4caf50", "#8bc34a", "#cddc39", "#ffeb3b", "#ffc107", "#ff9800", "#ff5722"}
-	return colors[rand.Intn(len(colors))]
-}
-
-func formatChatMessages(messages []string) string {
-	return strings.Join(messages, "\n")
+	return playerColors[rand.Intn(len(playerColors))]
 }
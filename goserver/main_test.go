@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"land/models"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	initAuth("test secret")
+	// Chat logs are written to whichever database the running test uses.
+	go runChatLogWriter()
+	os.Exit(m.Run())
+}
+
+// testPostgresEnv names the environment variable that, set to a Postgres
+// connection string, runs the tests against Postgres instead of SQLite.
+const testPostgresEnv = "LAND_TEST_POSTGRES"
+
+// useTestDB gives the test a database of its own, migrated, in place of the
+// server's, until it ends: an in-memory SQLite database, or a fresh schema
+// in the Postgres database testPostgresEnv names. Accounts come with rate
+// limits and login failures of their own, so those start fresh as well,
+// and passwords are hashed at bcrypt's least cost to keep logins quick.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	setForTest(t, &passwordCost, bcrypt.MinCost)
+	setForTest(t, &registerLimiter, newRateLimiter(registerRate, time.Hour))
+	setForTest(t, &guestLimiter, newRateLimiter(guestRate, time.Hour))
+	setForTest(t, &loginLimiter, newRateLimiter(loginRate, time.Minute))
+	setForTest(t, &loginNameLimiter, newRateLimiter(loginNameRate, time.Minute))
+	setForTest(t, &loginFailures, newLoginGuard())
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	cfg := DBConfig{Driver: "sqlite", DSN: "file:" + name + "?mode=memory&cache=shared", Migrate: true}
+	if dsn := os.Getenv(testPostgresEnv); dsn != "" {
+		cfg = DBConfig{Driver: "postgres", DSN: postgresSchema(t, dsn, name), Migrate: true}
+	}
+	openDB(cfg)
+	t.Cleanup(func() {
+		// As at shutdown, what closed rooms and chat have left to write
+		// goes in before the database closes.
+		ctx, cancel := context.WithTimeout(context.Background(), expectTimeout)
+		defer cancel()
+		waitForSubscribers(ctx)
+		flushChatLogs()
+		closeDB()
+		db = nil
+	})
+}
+
+// postgresSchema creates an empty schema for the test in the Postgres
+// database at dsn, dropped when the test ends, and returns dsn with the
+// schema as its search path.
+func postgresSchema(t *testing.T, dsn, name string) string {
+	t.Helper()
+	schema := "test_" + strings.ToLower(regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(name, "_"))
+	schema = schema[:min(len(schema), 63)]
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop := "DROP SCHEMA IF EXISTS " + schema + " CASCADE"
+	if err := admin.Exec(drop).Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec(drop).Error; err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		if pool, err := admin.DB(); err == nil {
+			pool.Close()
+		}
+	})
+
+	// Connection strings come as URLs or as keyword=value pairs.
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// newAccount creates a registered account and signs it in, returning the
+// account and its token.
+func newAccount(t *testing.T, name string) (models.Player, string) {
+	t.Helper()
+	account := models.Player{Name: name, Rating: models.DefaultRating}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("create account %s: %v", name, err)
+	}
+	token, _, err := startSession(account, ClientInfo{})
+	if err != nil {
+		t.Fatalf("sign in %s: %v", name, err)
+	}
+	return account, token
+}
+
+// serveRequest sends a request to the server's router, signed in with token
+// unless it is empty, and returns the response.
+func serveRequest(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+	return w
+}
+
+// decodeBody reads a JSON response into v, failing the test if it can't.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test unless the response has the status.
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d %s, want %d %s: %s", w.Code, http.StatusText(w.Code), status, http.StatusText(status), w.Body.String())
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// Page sizes for a player's match history.
+const (
+	defaultMatchesLimit = 20
+	maxMatchesLimit     = 100
+)
+
+// recordAttempts is how many times recording a match is tried before giving
+// up, waiting recordRetryDelay after the first failure and twice as long
+// after each one since.
+const recordAttempts = 4
+
+var recordRetryDelay = 250 * time.Millisecond
+
+// recordMatches saves each game the room finishes, with every player's
+// result, and updates the players' ratings, score totals, stats, season
+// scores and coins and links the game's chat logs in the same transaction.
+// It runs as a bus subscriber, so a slow database holds up nothing but the
+// subscriber, and the room is cleaned up without waiting for it. A failed
+// transaction is retried; one that fails every time is logged with the
+// whole record, for backfilling by hand. It is the only writer of match
+// results, scores and stats.
+func recordMatches(roomID string) func(Event) {
+	claimed := make(map[string]int)
+	return func(event Event) {
+		switch e := event.(type) {
+		case CellClaimed:
+			claimed[e.Player.ID]++
+		case GameEnded:
+			if db == nil {
+				return
+			}
+			record := matchRecord(roomID, e, claimed)
+			clear(claimed)
+			flushChatLogs()
+			var match models.Match
+			attempt := 0
+			err := retry(recordAttempts, recordRetryDelay, func() error {
+				attempt++
+				match = record
+				match.Results = slices.Clone(record.Results)
+				err := db.Transaction(func(tx *gorm.DB) error { return saveMatch(tx, &match, e.Standings) })
+				if err != nil && attempt < recordAttempts {
+					log.Printf("Failed to record match of room %s, attempt %d of %d: %v", roomID, attempt, recordAttempts, err)
+				}
+				return err
+			})
+			if err != nil {
+				record, _ := json.Marshal(match)
+				log.Printf("Failed to record match of room %s: %v; record: %s", roomID, err, record)
+			}
+		}
+	}
+}
+
+// saveMatch writes a finished game and everything that follows from it.
+func saveMatch(tx *gorm.DB, match *models.Match, standings []Standing) error {
+	if err := rateMatch(tx, match, standings); err != nil {
+		return err
+	}
+	season, err := seasonAt(tx, match.StartedAt)
+	if err != nil {
+		return err
+	}
+	match.SeasonID = season
+	if err := tx.Create(match).Error; err != nil {
+		return err
+	}
+	if err := addScores(tx, *match); err != nil {
+		return err
+	}
+	if err := addStats(tx, *match); err != nil {
+		return err
+	}
+	if err := awardCoins(tx, *match); err != nil {
+		return err
+	}
+	if err := linkChatLogs(tx, *match); err != nil {
+		return err
+	}
+	return addSeasonScores(tx, *match)
+}
+
+// addScores adds a recorded match to the score, games and wins of every
+// registered account in it. Guest accounts' totals aren't kept.
+func addScores(tx *gorm.DB, match models.Match) error {
+	for _, result := range match.Results {
+		if result.AccountID == 0 {
+			continue
+		}
+		wins := 0
+		if result.Winner {
+			wins = 1
+		}
+		err := tx.Model(&models.Player{}).Where("id = ? AND guest = ?", result.AccountID, false).Updates(map[string]any{
+			"score": gorm.Expr("score + ?", result.Score),
+			"games": gorm.Expr("games + ?", 1),
+			"wins":  gorm.Expr("wins + ?", wins),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retry calls fn up to attempts times until it succeeds, waiting delay
+// after the first failure and doubling the wait after each one since. It
+// returns fn's last error.
+func retry(attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// matchRecord is the row a finished game is saved as, results included.
+// Claimed counts the cells each player took, by player ID.
+func matchRecord(roomID string, ended GameEnded, claimed map[string]int) models.Match {
+	match := models.Match{
+		RoomID:     roomID,
+		Mode:       ended.Mode,
+		BoardSize:  ended.BoardSize,
+		Seed:       ended.Seed,
+		StartedAt:  ended.StartedAt,
+		EndedAt:    ended.EndedAt,
+		DurationMs: ended.Played.Milliseconds(),
+		Results:    make([]models.MatchResult, len(ended.Standings)),
+	}
+	for i, standing := range ended.Standings {
+		match.Results[i] = models.MatchResult{
+			AccountID: standing.AccountID,
+			PlayerID:  standing.PlayerID,
+			Name:      standing.Name,
+			Score:     standing.Score,
+			Placement: standing.Placement,
+			Team:      standing.Team,
+			Winner:    ended.Winner != nil && ended.Winner.ID == standing.PlayerID,
+			Claimed:   claimed[standing.PlayerID],
+			Coins:     coinsEarned(standing),
+		}
+	}
+	return match
+}
+
+// getMatch serves a recorded match with its results, best first.
+func getMatch(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid match ID"})
+		return
+	}
+	if !requireDB(c) {
+		return
+	}
+
+	var match models.Match
+	err = db.Preload("Results", func(tx *gorm.DB) *gorm.DB { return tx.Order("placement, id") }).
+		First(&match, id).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load match"})
+	default:
+		c.JSON(http.StatusOK, match)
+	}
+}
+
+// listPlayerMatches serves a page of the matches an account played, newest
+// first, each with every player's results.
+func listPlayerMatches(c *gin.Context) {
+	id, ok := accountParam(c, "id")
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultMatchesLimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok || !requireDB(c) {
+		return
+	}
+	limit = min(max(limit, 1), maxMatchesLimit)
+
+	played := db.Model(&models.MatchResult{}).Select("match_id").Where("account_id = ?", id)
+	var total int64
+	if err := db.Model(&models.Match{}).Where("id IN (?)", played).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load matches"})
+		return
+	}
+	matches := []models.Match{}
+	err := db.Where("id IN (?)", played).
+		Preload("Results", func(tx *gorm.DB) *gorm.DB { return tx.Order("placement, id") }).
+		Order("ended_at DESC").Order("id DESC").Limit(limit).Offset(offset).Find(&matches).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load matches"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"matches": matches, "total": total, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"land/internal/game"
+	"land/models"
+)
+
+// endMatch plays a game in a room of its own to the end, each player
+// finishing with their territory in cells, and waits for it to be
+// recorded.
+func endMatch(t *testing.T, players []*Player, territory []int) {
+	t.Helper()
+	room := rooms.Create(0)
+	room.do(func() {
+		for i, player := range players {
+			assignColor(room, player)
+			player.seat = room.NextSeat
+			room.NextSeat++
+			player.spawned = true
+			room.Players[player.ID] = player
+			for x := range territory[i] {
+				room.Match.SetCell(game.Position{X: x, Y: i}, player.Color)
+			}
+		}
+		room.setPhase(PhaseInProgress)
+		room.StartTime = room.Clock.Now()
+		endGame(room)
+	})
+	waitForMatch(t, room)
+}
+
+// waitForMatch waits for the game the room ended to be recorded, and
+// returns its record, results and all. A shared in-memory SQLite database
+// refuses reads while the match is being written, so errors are only
+// failures once time runs out.
+func waitForMatch(t *testing.T, room *Room) models.Match {
+	t.Helper()
+	for deadline := time.Now().Add(expectTimeout); ; time.Sleep(time.Millisecond) {
+		var matches []models.Match
+		err := db.Preload("Results").Where("room_id = ?", room.ID).Find(&matches).Error
+		if err == nil && len(matches) > 0 {
+			return matches[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("match of room %s not recorded after %v: %v", room.ID, expectTimeout, err)
+		}
+	}
+}
+
+// Each match adds to the score, games and wins of the registered accounts
+// that played it, and leaves guests' and everyone else's alone.
+func TestMatchTotals(t *testing.T) {
+	useTestDB(t)
+	testRooms(t)
+	alice, _ := newAccount(t, "alice")
+	if err := db.Model(&alice).Updates(map[string]any{"score": 10, "games": 2, "wins": 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	bob, _ := newAccount(t, "bob")
+	carol, _ := newAccount(t, "carol")
+	guest := models.Player{Name: "Guest000001", Guest: true, Rating: models.DefaultRating}
+	if err := db.Create(&guest).Error; err != nil {
+		t.Fatal(err)
+	}
+	seat := func(id string, account models.Player) *Player {
+		player := createPlayer(nil, id)
+		player.Name, player.AccountID, player.Guest = account.Name, account.ID, account.Guest
+		return player
+	}
+
+	endMatch(t, []*Player{seat("a", alice), seat("b", bob), seat("g", guest), seat("n", models.Player{Name: "nobody"})}, []int{5, 3, 6, 2})
+	endMatch(t, []*Player{seat("a", alice), seat("b", bob)}, []int{1, 4})
+
+	for _, want := range []struct {
+		id                 uint
+		score, games, wins int
+	}{
+		{alice.ID, 10 + 5 + 1, 2 + 2, 1},
+		{bob.ID, 3 + 4, 2, 1},
+		{carol.ID, 0, 0, 0},
+		{guest.ID, 0, 0, 0},
+	} {
+		var account models.Player
+		if err := db.First(&account, want.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if account.Score != float64(want.score) || account.Games != want.games || account.Wins != want.wins {
+			t.Errorf("%s has score %v over %d games with %d wins, want %d over %d with %d",
+				account.Name, account.Score, account.Games, account.Wins, want.score, want.games, want.wins)
+		}
+	}
+	var matches int64
+	db.Model(&models.Match{}).Count(&matches)
+	if matches != 2 {
+		t.Fatalf("%d matches recorded, want 2", matches)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTransient := errors.New("transient")
+	tests := []struct {
+		name     string
+		failures int
+		calls    int
+		err      error
+	}{
+		{"first time", 0, 1, nil},
+		{"after failures", 2, 3, nil},
+		{"never", 10, 4, errTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			start := time.Now()
+			err := retry(4, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errTransient
+				}
+				return nil
+			})
+			if calls != tt.calls || err != tt.err {
+				t.Fatalf("%d calls returning %v, want %d returning %v", calls, err, tt.calls, tt.err)
+			}
+			// The waits between calls double: 1ms, 2ms, 4ms.
+			if waited, least := time.Since(start), time.Duration(1<<(tt.calls-1)-1)*time.Millisecond; waited < least {
+				t.Fatalf("retried within %v, want at least %v of waiting", waited, least)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// ratingBand is how far a room's average rating may be from a player's
+	// rating when they start waiting. It widens by ratingBandGrowth for
+	// every second spent in the queue.
+	ratingBand       = 100.0
+	ratingBandGrowth = 20.0
+
+	// matchmakingTimeout is how long a player waits for a room in their band
+	// before being placed in whichever open room is closest.
+	matchmakingTimeout = 30 * time.Second
+
+	// widestRatingBand is the band a player has widened to by the time they
+	// stop waiting for one.
+	widestRatingBand = ratingBand + ratingBandGrowth*float64(matchmakingTimeout/time.Second)
+)
+
+// FindOpenRoom picks a public room for a solo player or a party that has
+// been waiting for the given time. Only rooms with space for the whole group
+// are considered, and it prefers the one whose average rating is closest to
+// the group's, as long as it falls inside their band. Rooms outside the band
+// are only used once the group has waited matchmakingTimeout. A new room is
+// created when there are no open rooms at all, for a party that found no
+// suitable room, or for a player no open room would ever be in the band of,
+// as long as maxRooms allows it. It returns nil if the group should keep
+// waiting.
+func (m *RoomManager) FindOpenRoom(group []*Player, waited time.Duration, maxRooms int) *Room {
+	band := ratingBand + ratingBandGrowth*waited.Seconds()
+	rating := averageRating(group)
+
+	var best *Room
+	bestDistance := math.Inf(1)
+	for _, room := range m.List() {
+		open, distance := false, 0.0
+		room.do(func() {
+			open = !room.Private && room.Phase.Joinable() && len(room.Players)+len(group) <= room.Settings.MaxPlayers && !anyBanned(room, group)
+			// An empty room matches anyone.
+			if open && len(room.Players) > 0 {
+				distance = math.Abs(roomRating(room) - rating)
+			}
+		})
+		if !open {
+			continue
+		}
+		// Break ties on the room ID so the fallback is deterministic.
+		if distance < bestDistance || distance == bestDistance && room.ID < best.ID {
+			best, bestDistance = room, distance
+		}
+	}
+
+	if best != nil && (bestDistance <= band || waited >= matchmakingTimeout) {
+		return best
+	}
+	if best == nil || len(group) > 1 || bestDistance > widestRatingBand {
+		return m.Create(maxRooms)
+	}
+	return nil
+}
+
+func anyBanned(room *Room, group []*Player) bool {
+	for _, player := range group {
+		if room.isBanned(player) {
+			return true
+		}
+	}
+	return false
+}
+
+// roomRating is the mean rating of the players in a non-empty room.
+func roomRating(room *Room) float64 {
+	total := 0.0
+	for _, player := range room.Players {
+		total += player.Rating
+	}
+	return total / float64(len(room.Players))
+}
+
+func averageRating(group []*Player) float64 {
+	total := 0.0
+	for _, player := range group {
+		total += player.Rating
+	}
+	return total / float64(len(group))
+}
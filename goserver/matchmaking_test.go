@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// ratedPlayers are count players with the given rating, named from prefix.
+func ratedPlayers(prefix string, count int, rating float64) []*Player {
+	players := make([]*Player, count)
+	for i := range players {
+		players[i] = &Player{Name: fmt.Sprintf("%s %d", prefix, i), Rating: rating}
+		players[i].ID = players[i].Name
+	}
+	return players
+}
+
+// A group is matched with a room once their band, widening the longer they
+// wait, takes in the room's rating, or at the timeout whatever its rating.
+// Rather than wait for a room no band will ever take in, they get their own.
+func TestFindOpenRoomBands(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance float64 // between the group's rating and the room's
+		party    int
+		waited   time.Duration
+		maxRooms int
+		want     string // "room", "new" or "" to keep waiting
+	}{
+		{"inside the band", ratingBand / 2, 1, 0, 0, "room"},
+		{"outside the band", ratingBand + 50, 1, 0, 0, ""},
+		{"band widened", ratingBand + 50, 1, 5 * time.Second, 0, "room"},
+		{"not widened enough", 500, 1, 10 * time.Second, 0, ""},
+		{"timed out", 500, 1, matchmakingTimeout, 0, "room"},
+		{"party outside the band", ratingBand + 50, 2, 0, 0, "new"},
+		{"beyond every band", widestRatingBand + 100, 1, 0, 0, "new"},
+		{"beyond every band with no room to spare", widestRatingBand + 100, 1, 0, 1, ""},
+		{"beyond every band, timed out", widestRatingBand + 100, 1, matchmakingTimeout, 1, "room"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRooms(t)
+			room := rooms.Create(0)
+			if err := joinRoom(room, "", ratedPlayers("seated", 2, 1000)...); err != nil {
+				t.Fatal(err)
+			}
+
+			got := rooms.FindOpenRoom(ratedPlayers("queued", tt.party, 1000+tt.distance), tt.waited, tt.maxRooms)
+			switch {
+			case got == nil:
+				if tt.want != "" {
+					t.Fatalf("kept waiting, want %s", tt.want)
+				}
+			case got == room:
+				if tt.want != "room" {
+					t.Fatalf("matched with the room, want %q", tt.want)
+				}
+			default:
+				if tt.want != "new" {
+					t.Fatalf("given a new room, want %q", tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is one change to the database schema or its data. Migrations
+// are applied in order, each in a transaction that also records it, and an
+// applied migration is never changed: later changes get a migration of
+// their own. They work on their own copies of the models, as they were
+// when the migration was written, rather than on land/models.
+type migration struct {
+	ID      string
+	Migrate func(tx *gorm.DB) error
+}
+
+// schemaMigration records an applied migration.
+type schemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// migrations are all the migrations, oldest first.
+var migrations = []migration{
+	{ID: "0001_initial", Migrate: migrateInitial},
+	{ID: "0002_player_rating", Migrate: migratePlayerRating},
+	{ID: "0003_sessions", Migrate: migrateSessions},
+	{ID: "0004_oauth", Migrate: migrateOAuth},
+	{ID: "0005_player_name_search", Migrate: migratePlayerNameSearch},
+	{ID: "0006_player_renamed_at", Migrate: migratePlayerRenamedAt},
+	{ID: "0007_seasons", Migrate: migrateSeasons},
+	{ID: "0008_achievements", Migrate: migrateAchievements},
+	{ID: "0009_coins", Migrate: migrateCoins},
+	{ID: "0010_chat_logs", Migrate: migrateChatLogs},
+	{ID: "0011_audit_log", Migrate: migrateAuditLog},
+	{ID: "0012_player_totals", Migrate: migratePlayerTotals},
+	{ID: "0013_chat_log_whispers", Migrate: migrateChatLogWhispers},
+	{ID: "0014_chat_log_teams", Migrate: migrateChatLogTeams},
+	{ID: "0015_player_mutes", Migrate: migratePlayerMutes},
+	{ID: "0016_player_email_verified", Migrate: migratePlayerEmailVerified},
+}
+
+// migrateDB brings the database up to date, or with apply false only checks
+// that it is, exiting if it can't.
+func migrateDB(db *gorm.DB, apply bool) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		log.Fatal("Failed to create migrations table: ", err)
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		log.Fatal("Failed to read applied migrations: ", err)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if !apply {
+		log.Fatalf("Database has %d pending migrations, starting with %s; run with -migrate or -migrate-only", len(pending), pending[0].ID)
+	}
+	for _, m := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			log.Fatalf("Failed to apply migration %s: %v", m.ID, err)
+		}
+		log.Printf("Applied migration %s", m.ID)
+	}
+}
+
+// pendingMigrations are the migrations not yet applied, in order.
+func pendingMigrations(db *gorm.DB) ([]migration, error) {
+	var applied []schemaMigration
+	if err := db.Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, m := range applied {
+		done[m.ID] = true
+		if !knownMigration(m.ID) {
+			return nil, fmt.Errorf("database has migration %s, which this server doesn't know; is it older than the database?", m.ID)
+		}
+	}
+	var pending []migration
+	for _, m := range migrations {
+		if !done[m.ID] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func knownMigration(id string) bool {
+	for _, m := range migrations {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// The schema as it was before migrations, less the rating column, which
+// 0002 adds. Databases made by AutoMigrate before then already have all of
+// it, and creating it again leaves them alone.
+
+type playerV1 struct {
+	gorm.Model
+	Name         string `gorm:"uniqueIndex"`
+	PasswordHash string
+	Guest        bool `gorm:"index"`
+	Character    string
+	Score        float64 `gorm:"index"`
+	Color        string
+}
+
+func (playerV1) TableName() string { return "players" }
+
+type friendLinkV1 struct {
+	gorm.Model
+	PlayerID uint `gorm:"uniqueIndex:idx_friend_pair"`
+	FriendID uint `gorm:"uniqueIndex:idx_friend_pair"`
+	Status   string
+}
+
+func (friendLinkV1) TableName() string { return "friend_links" }
+
+type matchV1 struct {
+	gorm.Model
+	RoomID     string `gorm:"index"`
+	Mode       string
+	BoardSize  int
+	Seed       int64
+	StartedAt  time.Time
+	EndedAt    time.Time
+	DurationMs int64
+	Results    []matchResultV1 `gorm:"foreignKey:MatchID"`
+}
+
+func (matchV1) TableName() string { return "matches" }
+
+type matchResultV1 struct {
+	ID          uint `gorm:"primarykey"`
+	MatchID     uint `gorm:"index"`
+	AccountID   uint `gorm:"index"`
+	PlayerID    string
+	Name        string
+	Score       int
+	Placement   int
+	Team        string
+	Winner      bool
+	Claimed     int
+	Rating      float64
+	RatingDelta float64
+}
+
+func (matchResultV1) TableName() string { return "match_results" }
+
+type playerStatsV1 struct {
+	AccountID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Mode         string `gorm:"primaryKey"`
+	Games        int
+	Wins         int
+	TotalScore   int
+	BestScore    int
+	CellsClaimed int
+}
+
+func (playerStatsV1) TableName() string { return "player_stats" }
+
+func migrateInitial(tx *gorm.DB) error {
+	return tx.AutoMigrate(&playerV1{}, &friendLinkV1{}, &matchV1{}, &matchResultV1{}, &playerStatsV1{})
+}
+
+// playerV2 adds the rating, starting every account at the default.
+type playerV2 struct {
+	Rating float64 `gorm:"default:1000"`
+}
+
+func (playerV2) TableName() string { return "players" }
+
+func migratePlayerRating(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&playerV2{}, "Rating") {
+		if err := tx.Migrator().AddColumn(&playerV2{}, "Rating"); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&playerV2{}).Where("rating IS NULL").Update("rating", 1000).Error
+}
+
+// sessionV1 is the session store.
+type sessionV1 struct {
+	ID         uint   `gorm:"primarykey"`
+	TokenHash  string `gorm:"uniqueIndex"`
+	AccountID  uint   `gorm:"index"`
+	CreatedAt  time.Time
+	ExpiresAt  time.Time `gorm:"index"`
+	LastSeenAt time.Time
+	UserAgent  string
+	IP         string
+}
+
+func (sessionV1) TableName() string { return "sessions" }
+
+func migrateSessions(tx *gorm.DB) error {
+	return tx.AutoMigrate(&sessionV1{})
+}
+
+// playerV3 adds the email, which OAuth logins are linked by.
+type playerV3 struct {
+	Email string `gorm:"index"`
+}
+
+func (playerV3) TableName() string { return "players" }
+
+// oauthIdentityV1 links accounts to identities at OAuth providers.
+type oauthIdentityV1 struct {
+	gorm.Model
+	Provider  string `gorm:"uniqueIndex:idx_oauth_identity"`
+	Subject   string `gorm:"uniqueIndex:idx_oauth_identity"`
+	AccountID uint   `gorm:"index"`
+}
+
+func (oauthIdentityV1) TableName() string { return "oauth_identities" }
+
+func migrateOAuth(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&playerV3{}, "Email") {
+		if err := tx.Migrator().AddColumn(&playerV3{}, "Email"); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasIndex(&playerV3{}, "Email") {
+		if err := tx.Migrator().CreateIndex(&playerV3{}, "Email"); err != nil {
+			return err
+		}
+	}
+	return tx.AutoMigrate(&oauthIdentityV1{})
+}
+
+// migratePlayerNameSearch indexes lowercased names for GET /players, which
+// searches them by prefix. Postgres only uses the index for LIKE with
+// pattern ops.
+func migratePlayerNameSearch(tx *gorm.DB) error {
+	ops := ""
+	if tx.Dialector.Name() == "postgres" {
+		ops = " text_pattern_ops"
+	}
+	return tx.Exec("CREATE INDEX IF NOT EXISTS idx_players_name_lower ON players (LOWER(name)" + ops + ")").Error
+}
+
+// playerV4 adds when the player last changed their name.
+type playerV4 struct {
+	RenamedAt *time.Time
+}
+
+func (playerV4) TableName() string { return "players" }
+
+func migratePlayerRenamedAt(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&playerV4{}, "RenamedAt") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&playerV4{}, "RenamedAt")
+}
+
+// matchV2 adds the season a match started in.
+type matchV2 struct {
+	SeasonID uint `gorm:"index"`
+}
+
+func (matchV2) TableName() string { return "matches" }
+
+type seasonV1 struct {
+	ID      uint `gorm:"primarykey"`
+	Name    string
+	StartAt time.Time `gorm:"index"`
+	EndAt   time.Time `gorm:"index"`
+	Final   bool
+}
+
+func (seasonV1) TableName() string { return "seasons" }
+
+type seasonScoreV1 struct {
+	SeasonID  uint `gorm:"primaryKey;autoIncrement:false"`
+	AccountID uint `gorm:"primaryKey;autoIncrement:false"`
+	Score     int  `gorm:"index"`
+	Games     int
+	Wins      int
+	Rating    float64
+}
+
+func (seasonScoreV1) TableName() string { return "season_scores" }
+
+type seasonResultV1 struct {
+	SeasonID  uint `gorm:"primaryKey;autoIncrement:false"`
+	AccountID uint `gorm:"primaryKey;autoIncrement:false"`
+	Rank      int
+	Score     int
+	Games     int
+	Wins      int
+	Rating    float64
+}
+
+func (seasonResultV1) TableName() string { return "season_results" }
+
+func migrateSeasons(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&matchV2{}, "SeasonID") {
+		if err := tx.Migrator().AddColumn(&matchV2{}, "SeasonID"); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasIndex(&matchV2{}, "SeasonID") {
+		if err := tx.Migrator().CreateIndex(&matchV2{}, "SeasonID"); err != nil {
+			return err
+		}
+	}
+	return tx.AutoMigrate(&seasonV1{}, &seasonScoreV1{}, &seasonResultV1{})
+}
+
+type achievementV1 struct {
+	ID          string `gorm:"primaryKey"`
+	Name        string
+	Description string
+}
+
+func (achievementV1) TableName() string { return "achievements" }
+
+type playerAchievementV1 struct {
+	AccountID     uint   `gorm:"primaryKey;autoIncrement:false"`
+	AchievementID string `gorm:"primaryKey"`
+	UnlockedAt    time.Time
+}
+
+func (playerAchievementV1) TableName() string { return "player_achievements" }
+
+func migrateAchievements(tx *gorm.DB) error {
+	return tx.AutoMigrate(&achievementV1{}, &playerAchievementV1{})
+}
+
+// playerV5 adds the coin balance.
+type playerV5 struct {
+	Coins int `gorm:"not null;default:0"`
+}
+
+func (playerV5) TableName() string { return "players" }
+
+// matchResultV2 adds the coins each player earned.
+type matchResultV2 struct {
+	Coins int `gorm:"not null;default:0"`
+}
+
+func (matchResultV2) TableName() string { return "match_results" }
+
+type inventoryItemV1 struct {
+	AccountID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	ItemID      string `gorm:"primaryKey"`
+	Price       int
+	PurchasedAt time.Time
+}
+
+func (inventoryItemV1) TableName() string { return "inventory_items" }
+
+func migrateCoins(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&playerV5{}, "Coins") {
+		if err := tx.Migrator().AddColumn(&playerV5{}, "Coins"); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasColumn(&matchResultV2{}, "Coins") {
+		if err := tx.Migrator().AddColumn(&matchResultV2{}, "Coins"); err != nil {
+			return err
+		}
+	}
+	return tx.AutoMigrate(&inventoryItemV1{})
+}
+
+type chatLogV1 struct {
+	ID        uint   `gorm:"primarykey"`
+	RoomID    string `gorm:"index"`
+	MatchID   uint   `gorm:"index"`
+	AccountID uint   `gorm:"index"`
+	PlayerID  string
+	Name      string
+	Text      string
+	SentAt    time.Time `gorm:"index"`
+}
+
+func (chatLogV1) TableName() string { return "chat_logs" }
+
+func migrateChatLogs(tx *gorm.DB) error {
+	return tx.AutoMigrate(&chatLogV1{})
+}
+
+type auditEntryV1 struct {
+	ID        uint   `gorm:"primarykey"`
+	Actor     string `gorm:"index"`
+	Action    string `gorm:"index"`
+	Target    string
+	Reason    string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (auditEntryV1) TableName() string { return "audit_entries" }
+
+func migrateAuditLog(tx *gorm.DB) error {
+	return tx.AutoMigrate(&auditEntryV1{})
+}
+
+// playerV6 adds the games and wins totals.
+type playerV6 struct {
+	Games int `gorm:"not null;default:0"`
+	Wins  int `gorm:"not null;default:0"`
+}
+
+func (playerV6) TableName() string { return "players" }
+
+func migratePlayerTotals(tx *gorm.DB) error {
+	for _, column := range []string{"Games", "Wins"} {
+		if tx.Migrator().HasColumn(&playerV6{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&playerV6{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chatLogV2 adds whispers.
+type chatLogV2 struct {
+	Private     bool `gorm:"not null;default:false"`
+	RecipientID string
+}
+
+func (chatLogV2) TableName() string { return "chat_logs" }
+
+func migrateChatLogWhispers(tx *gorm.DB) error {
+	for _, column := range []string{"Private", "RecipientID"} {
+		if tx.Migrator().HasColumn(&chatLogV2{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&chatLogV2{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chatLogV3 adds team chat.
+type chatLogV3 struct {
+	Team string
+}
+
+func (chatLogV3) TableName() string { return "chat_logs" }
+
+func migrateChatLogTeams(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&chatLogV3{}, "Team") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&chatLogV3{}, "Team")
+}
+
+type playerMuteV1 struct {
+	AccountID      uint `gorm:"primaryKey;autoIncrement:false"`
+	MutedAccountID uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt      time.Time
+}
+
+func (playerMuteV1) TableName() string { return "player_mutes" }
+
+func migratePlayerMutes(tx *gorm.DB) error {
+	return tx.AutoMigrate(&playerMuteV1{})
+}
+
+// playerV7 records whether a provider vouched for the account's email.
+type playerV7 struct {
+	EmailVerified bool `gorm:"not null;default:false"`
+}
+
+func (playerV7) TableName() string { return "players" }
+
+func migratePlayerEmailVerified(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&playerV7{}, "EmailVerified") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&playerV7{}, "EmailVerified")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"land/models"
+)
+
+// mutes reports whether the player muted sender, by player ID or by account,
+// so sender's chat, whispers and emotes aren't delivered to them. A nil
+// sender is nobody's. It must run on the room's goroutine.
+func (p *Player) mutes(sender *Player) bool {
+	if sender == nil {
+		return false
+	}
+	return p.muted[sender.ID] || (sender.AccountID != 0 && p.mutedAccounts[sender.AccountID])
+}
+
+// chatSender is the player in the room who sent a chat broadcast, or nil if
+// msg isn't chat. It must run on the room's goroutine.
+func chatSender(room *Room, msg Message) *Player {
+	if chat, ok := msg.Payload.(ChatMessagePayload); ok {
+		return room.Players[chat.PlayerID]
+	}
+	return nil
+}
+
+// lookupMutes is the accounts the account muted. Players without an account
+// start with none.
+func lookupMutes(accountID uint) map[uint]bool {
+	muted := make(map[uint]bool)
+	if db == nil || accountID == 0 {
+		return muted
+	}
+	var ids []uint
+	err := db.Model(&models.PlayerMute{}).Where("account_id = ?", accountID).Pluck("muted_account_id", &ids).Error
+	if err != nil {
+		log.Printf("Failed to load mutes of account %d: %v", accountID, err)
+	}
+	for _, id := range ids {
+		muted[id] = true
+	}
+	return muted
+}
+
+// mutePlayer mutes or unmutes another player in the room for the player, who
+// is told it took. Muting lasts the session, or between two accounts until
+// it is lifted, across reconnects and games. Only chat, whispers and emotes
+// are held back; the muted player isn't told.
+func mutePlayer(player *Player, targetID string, mute bool) {
+	room := player.Room.Load()
+	var accountID, targetAccountID uint
+
+	room.do(func() {
+		target, ok := room.Players[targetID]
+		switch {
+		case !ok:
+			sendError(player, "UNKNOWN_PLAYER", fmt.Sprintf("no player %s in the room", targetID))
+			return
+		case target == player:
+			sendError(player, "INVALID_TARGET", "you can't mute yourself")
+			return
+		}
+		if player.muted == nil {
+			player.muted = make(map[string]bool)
+		}
+		if mute {
+			player.muted[target.ID] = true
+		} else {
+			delete(player.muted, target.ID)
+			delete(player.mutedAccounts, target.AccountID)
+		}
+		if player.AccountID != 0 && target.AccountID != 0 {
+			accountID, targetAccountID = player.AccountID, target.AccountID
+		}
+		sendMessage(player, Message{Type: "muted", Payload: MutedPayload{PlayerID: target.ID, Muted: mute}})
+	})
+
+	if db == nil || targetAccountID == 0 {
+		return
+	}
+	var err error
+	if mute {
+		err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PlayerMute{
+			AccountID: accountID, MutedAccountID: targetAccountID, CreatedAt: time.Now(),
+		}).Error
+	} else {
+		err = db.Where("account_id = ? AND muted_account_id = ?", accountID, targetAccountID).Delete(&models.PlayerMute{}).Error
+	}
+	if err != nil {
+		log.Printf("Failed to save mute of account %d by account %d: %v", targetAccountID, accountID, err)
+	}
+}
+
+// roomMute lets the room's host mute or unmute a player's chat for the whole
+// room, telling everyone. It lasts until the host lifts it or the room
+// closes, and is audited.
+func roomMute(player *Player, targetID string, mute bool) {
+	room := player.Room.Load()
+	var actor, target string
+
+	room.do(func() {
+		switch {
+		case room.HostID != player.ID:
+			sendError(player, "NOT_HOST", "only the host can mute players for the room")
+			return
+		case room.Players[targetID] == nil:
+			sendError(player, "UNKNOWN_PLAYER", fmt.Sprintf("no player %s in the room", targetID))
+			return
+		case targetID == player.ID:
+			sendError(player, "INVALID_TARGET", "you can't mute yourself")
+			return
+		case room.Muted[targetID] == mute:
+			return
+		}
+		if mute {
+			room.Muted[targetID] = true
+		} else {
+			delete(room.Muted, targetID)
+		}
+		actor, target = auditPlayer(player), auditPlayer(room.Players[targetID])
+		log.Printf("Room %s: host %s set room mute of %s to %v", room.ID, player.ID, targetID, mute)
+		broadcastMessage(room, Message{Type: "muted", Payload: MutedPayload{PlayerID: targetID, Muted: mute, Room: true}})
+	})
+
+	if target == "" {
+		return
+	}
+	action := "roomMute"
+	if !mute {
+		action = "roomUnmute"
+	}
+	audit(actor, action, target, "room "+room.ID)
+}
+
+// auditPlayer names a player in the audit log: by account if they have
+// one, by player ID otherwise.
+func auditPlayer(player *Player) string {
+	if player.AccountID != 0 {
+		return fmt.Sprintf("account:%d", player.AccountID)
+	}
+	return "player:" + player.ID
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"land/internal/wstest"
+)
+
+// Chat from a player someone muted stays out of what they are sent when they
+// reconnect and catch up on the events they missed.
+func TestMuteHoldsAcrossAReconnect(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	carol := server.join(t, room, "carol")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	alice.ExpectMessage("playerJoined", expectTimeout)
+
+	alice.Send("mute", MutePayload{TargetID: playerID(t, bob)})
+	alice.ExpectMessage("muted", expectTimeout)
+	var session SessionPayload
+	if err := alice.ExpectMessage("session", expectTimeout).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	var lastEventID uint64
+	for _, msg := range alice.Messages() {
+		lastEventID = max(lastEventID, msg.EventID)
+	}
+	alice.Close()
+	bob.ExpectMessage("playerDisconnected", expectTimeout)
+
+	bob.Chat("hi from bob")
+	expectChat(t, carol, "bob", "hi from bob", "")
+	carol.Chat("hi from carol")
+	expectChat(t, carol, "carol", "hi from carol", "")
+
+	alice = wstest.Dial(t, server.URL+"/ws")
+	alice.Send("reconnect", ReconnectPayload{PlayerID: session.PlayerID, Token: session.Token, LastEventID: lastEventID})
+	expectChat(t, alice, "carol", "hi from carol", "")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+const (
+	// oauthStateCookie carries the state of a login in progress, checked
+	// against the one the provider sends back.
+	oauthStateCookie = "oauth_state"
+
+	// oauthLoginTimeout is how long a player has to finish logging in with
+	// a provider.
+	oauthLoginTimeout = 10 * time.Minute
+)
+
+// OAuthConfig is how the server signs players in with the providers, set by
+// flags. A provider without a client ID is disabled. RedirectBase is the
+// server's public URL, which callbacks come back to.
+type OAuthConfig struct {
+	RedirectBase       string
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+}
+
+var oauthConfig OAuthConfig
+
+// oauthProvider is an OAuth2 provider players can sign in with. Profile
+// fetches who signed in, with a client that carries their access token.
+type oauthProvider struct {
+	Config  oauth2.Config
+	Profile func(ctx context.Context, client *http.Client) (OAuthProfile, error)
+}
+
+// OAuthProfile is who a provider says signed in. Subject is their ID at the
+// provider. Email is empty unless the provider has verified it.
+type OAuthProfile struct {
+	Subject string
+	Name    string
+	Email   string
+}
+
+// oauthProviders are the enabled providers, by the name used in their URLs.
+var oauthProviders = map[string]*oauthProvider{}
+
+// initOAuth enables the providers that have a client ID.
+func initOAuth(cfg OAuthConfig) {
+	redirect := func(name string) string {
+		return strings.TrimSuffix(cfg.RedirectBase, "/") + "/auth/" + name + "/callback"
+	}
+	if cfg.GoogleClientID != "" {
+		oauthProviders["google"] = &oauthProvider{
+			Config: oauth2.Config{
+				ClientID:     cfg.GoogleClientID,
+				ClientSecret: cfg.GoogleClientSecret,
+				Endpoint:     endpoints.Google,
+				RedirectURL:  redirect("google"),
+				Scopes:       []string{"openid", "email", "profile"},
+			},
+			Profile: googleProfile,
+		}
+	}
+	if cfg.GitHubClientID != "" {
+		oauthProviders["github"] = &oauthProvider{
+			Config: oauth2.Config{
+				ClientID:     cfg.GitHubClientID,
+				ClientSecret: cfg.GitHubClientSecret,
+				Endpoint:     endpoints.GitHub,
+				RedirectURL:  redirect("github"),
+				Scopes:       []string{"read:user", "user:email"},
+			},
+			Profile: githubProfile,
+		}
+	}
+}
+
+// oauthLogin sends the player to the provider to sign in.
+func oauthLogin(c *gin.Context) {
+	provider, ok := oauthProviders[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+	state := generateRandomString(32)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, int(oauthLoginTimeout.Seconds()), "/auth/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, provider.Config.AuthCodeURL(state))
+}
+
+// oauthCallback finishes signing in with a provider: it checks the state,
+// trades the code for a token, looks up who signed in and answers as
+// POST /login does.
+func oauthCallback(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := oauthProviders[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+	if !requireDB(c) {
+		return
+	}
+	state, err := c.Cookie(oauthStateCookie)
+	if err != nil || state == "" || c.Query("state") != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired or was not started here"})
+		return
+	}
+	c.SetCookie(oauthStateCookie, "", -1, "/auth/", "", c.Request.TLS != nil, true)
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was refused: " + reason})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := provider.Config.Exchange(ctx, c.Query("code"))
+	if err != nil {
+		log.Printf("Failed to exchange %s login code: %v", name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
+		return
+	}
+	profile, err := provider.Profile(ctx, provider.Config.Client(ctx, token))
+	if err != nil || profile.Subject == "" {
+		log.Printf("Failed to load %s profile: %v", name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load profile"})
+		return
+	}
+
+	player, err := oauthAccount(name, profile)
+	if err != nil {
+		log.Printf("Failed to sign in %s user %s: %v", name, profile.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	respondWithToken(c, player)
+}
+
+// oauthAccount is the account for someone who signed in with a provider.
+// It is the account already linked to their identity there; failing that,
+// the one account whose email another provider vouched for and this one
+// verified for them too, which gets linked; failing that, a new account
+// named after them. Emails given at registration aren't verified, so they
+// never link: anyone could register with someone else's.
+func oauthAccount(provider string, profile OAuthProfile) (models.Player, error) {
+	var player models.Player
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var identity models.OAuthIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&player, identity.AccountID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var matches []models.Player
+		if profile.Email != "" {
+			err := tx.Where("email = ? AND email_verified = ? AND guest = ?", profile.Email, true, false).Limit(2).Find(&matches).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(matches) == 1 {
+			player = matches[0]
+		} else if player, err = createOAuthPlayer(tx, profile); err != nil {
+			return err
+		}
+		identity = models.OAuthIdentity{Provider: provider, Subject: profile.Subject, AccountID: player.ID}
+		return tx.Create(&identity).Error
+	})
+	return player, err
+}
+
+// createOAuthPlayer creates an account for someone who signed in with a
+// provider, under their name there, numbered if it is taken, or as Player
+// if checkName wouldn't let them register it. The email the provider
+// verified is kept as verified.
+func createOAuthPlayer(tx *gorm.DB, profile OAuthProfile) (models.Player, error) {
+	base := profile.Name
+	if len([]rune(base)) > maxNameLength-4 {
+		base = strings.TrimSpace(string([]rune(base)[:maxNameLength-4]))
+	}
+	if checkName(base) != "" {
+		base = "Player"
+	}
+	for n := 1; n <= 100; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		var taken int64
+		if err := tx.Unscoped().Model(&models.Player{}).Where("name = ?", name).Count(&taken).Error; err != nil {
+			return models.Player{}, err
+		}
+		if taken > 0 {
+			continue
+		}
+		player := models.Player{Name: name, Email: profile.Email, EmailVerified: profile.Email != ""}
+		return player, tx.Create(&player).Error
+	}
+	return models.Player{}, fmt.Errorf("no free name like %q", base)
+}
+
+// googleProfile loads who signed in with Google.
+func googleProfile(ctx context.Context, client *http.Client) (OAuthProfile, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Name          string `json:"name"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return OAuthProfile{}, err
+	}
+	profile := OAuthProfile{Subject: info.Sub, Name: info.Name}
+	if info.EmailVerified {
+		profile.Email = info.Email
+	}
+	return profile, nil
+}
+
+// githubProfile loads who signed in with GitHub.
+func githubProfile(ctx context.Context, client *http.Client) (OAuthProfile, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return OAuthProfile{}, err
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return OAuthProfile{}, err
+	}
+	profile := OAuthProfile{Subject: strconv.FormatInt(user.ID, 10), Name: user.Login}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			profile.Email = email.Email
+		}
+	}
+	return profile, nil
+}
+
+// getJSON fetches url with client and decodes the JSON answer into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
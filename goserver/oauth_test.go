@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"land/models"
+)
+
+// fakeProvider enables a provider named "fake" for the test, whose token
+// endpoint is a local server and whose users are always profile. Callbacks
+// aren't rate limited while it is.
+func fakeProvider(t *testing.T, profile *OAuthProfile) {
+	t.Helper()
+	setForTest(t, &loginLimiter, nil)
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fake token","token_type":"bearer"}`))
+	}))
+	t.Cleanup(tokens.Close)
+	oauthProviders["fake"] = &oauthProvider{
+		Config: oauth2.Config{
+			ClientID: "fake client",
+			Endpoint: oauth2.Endpoint{AuthURL: tokens.URL + "/auth", TokenURL: tokens.URL + "/token"},
+		},
+		Profile: func(context.Context, *http.Client) (OAuthProfile, error) { return *profile, nil },
+	}
+	t.Cleanup(func() { delete(oauthProviders, "fake") })
+}
+
+// oauthSignIn finishes a sign-in with the fake provider and returns the
+// account it answered with.
+func oauthSignIn(t *testing.T) models.Player {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?state=s&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: "s"})
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusOK)
+	var body struct {
+		Player models.Player `json:"player"`
+		Token  string        `json:"token"`
+	}
+	decodeBody(t, w, &body)
+	if body.Token == "" {
+		t.Fatal("no token in the answer")
+	}
+	return body.Player
+}
+
+func TestOAuthCallbackChecksState(t *testing.T) {
+	useTestDB(t)
+	fakeProvider(t, &OAuthProfile{Subject: "1", Name: "someone"})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?state=forged&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: "s"})
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestOAuthSignInKeepsTheLinkedAccount(t *testing.T) {
+	useTestDB(t)
+	profile := OAuthProfile{Subject: "42", Name: "Grace", Email: "grace@example.com"}
+	fakeProvider(t, &profile)
+
+	first := oauthSignIn(t)
+	if first.Name != "Grace" {
+		t.Errorf("new account is named %q, want Grace", first.Name)
+	}
+	profile.Name = "Grace Hopper"
+	if again := oauthSignIn(t); again.ID != first.ID {
+		t.Errorf("signing in again gave account %d, want %d", again.ID, first.ID)
+	}
+}
+
+func TestOAuthLinksOnlyVerifiedEmails(t *testing.T) {
+	useTestDB(t)
+	// Someone registers with the victim's email before the victim ever
+	// signs in: registration doesn't verify emails.
+	squatter := models.Player{Name: "squatter", Email: "victim@example.com"}
+	db.Create(&squatter)
+	verified := models.Player{Name: "owner", Email: "owner@example.com", EmailVerified: true}
+	db.Create(&verified)
+	for _, name := range []string{"twin1", "twin2"} {
+		db.Create(&models.Player{Name: name, Email: "twins@example.com", EmailVerified: true})
+	}
+
+	tests := []struct {
+		name    string
+		email   string
+		linksTo uint
+	}{
+		{"unverified email", "victim@example.com", 0},
+		{"verified email", "owner@example.com", verified.ID},
+		{"email on several accounts", "twins@example.com", 0},
+		{"no email", "", 0},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeProvider(t, &OAuthProfile{Subject: string(rune('a' + i)), Name: "newcomer", Email: tt.email})
+			player := oauthSignIn(t)
+			switch {
+			case tt.linksTo != 0 && player.ID != tt.linksTo:
+				t.Errorf("signed in to account %d, want %d", player.ID, tt.linksTo)
+			case tt.linksTo == 0 && player.ID <= 4:
+				t.Errorf("signed in to existing account %d (%s), want a new one", player.ID, player.Name)
+			}
+		})
+	}
+}
+
+func TestOAuthNewAccountNames(t *testing.T) {
+	useTestDB(t)
+	db.Create(&models.Player{Name: "taken"})
+
+	tests := []struct{ provider, want string }{
+		{"ada", "ada"},
+		{"taken", "taken2"},
+		{"<img src=x onerror=alert(1)>", "Player"},
+		{"x", "Player2"},
+		{"", "Player3"},
+		{"two  spaces", "Player4"},
+		{"a name that is much too long to keep", "a name that is much"},
+	}
+	for i, tt := range tests {
+		fakeProvider(t, &OAuthProfile{Subject: string(rune('a' + i)), Name: tt.provider})
+		if got := oauthSignIn(t).Name; got != tt.want {
+			t.Errorf("provider name %q: account named %q, want %q", tt.provider, got, tt.want)
+		}
+	}
+}
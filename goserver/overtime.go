@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// overtimeLimit is the longest a game tied for the lead plays on past its
+// time, after which it ends as a tie would.
+const overtimeLimit = 30 * time.Second
+
+// overtime reports whether a game whose time is up plays on: while two or
+// more players share the lead, for up to overtimeLimit past its time. The
+// first time, it moves the room into PhaseOvertime, which puts endTime back
+// by overtimeLimit, and has the tick's broadcast send everyone a full
+// gameState with the new EndsAt. It must run on the room's goroutine.
+func (room *Room) overtime() bool {
+	if !leadTied(room) {
+		return false
+	}
+	if room.Phase != PhaseOvertime {
+		room.setPhase(PhaseOvertime)
+		room.Deltas.lastSnapshot = time.Time{}
+		room.Deltas.lastFull = time.Time{}
+	}
+	return room.remaining() > 0
+}
+
+// leadTied reports whether the highest score in the match is shared. Nobody
+// leads a match nobody has scored in. It must run on the room's goroutine.
+func leadTied(room *Room) bool {
+	best, leaders := 0, 0
+	for _, player := range room.roster() {
+		switch score := room.Match.Rules.ScoreOf(room.Match, &player.Player); {
+		case score > best:
+			best, leaders = score, 1
+		case score == best && score > 0:
+			leaders++
+		}
+	}
+	return leaders > 1
+}
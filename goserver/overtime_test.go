@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"land/internal/game"
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// waitForPhase waits for the room to reach the phase.
+func waitForPhase(t *testing.T, room *Room, phase Phase) {
+	t.Helper()
+	for deadline := time.Now().Add(expectTimeout); ; time.Sleep(time.Millisecond) {
+		var current Phase
+		room.do(func() { current = room.Phase })
+		if current == phase {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("room %s is %s, not %s", room.ID, current, phase)
+		}
+	}
+}
+
+// setTerritory leaves the players in the room, by ID, with as many cells as
+// given: the one they stand on and then the first free ones, row by row.
+// Everyone else is left with none.
+func setTerritory(room *Room, cells map[string]int) {
+	room.do(func() {
+		taken := make(map[game.Position]bool)
+		for _, player := range room.Players {
+			for _, cell := range room.Match.Board.Cells(player.Color) {
+				room.Match.SetCell(cell, "")
+			}
+			taken[player.Position] = true
+		}
+		for id, n := range cells {
+			player := room.Players[id]
+			room.Match.SetCell(player.Position, player.Color)
+			for i := 0; n > 1 && i < room.size()*room.size(); i++ {
+				cell := game.Position{X: i % room.size(), Y: i / room.size()}
+				if !taken[cell] && room.Match.Board.Owner(cell) == "" {
+					room.Match.SetCell(cell, player.Color)
+					n--
+				}
+			}
+		}
+	})
+}
+
+// tiedMatch starts a 30 second match between alice and bob, tied on a cell
+// each, and runs it out of time into overtime.
+func tiedMatch(t *testing.T, server *testServer) (*Room, *wstest.Client, *wstest.Client, *protocol.StateView) {
+	t.Helper()
+	room := server.createRoom(t, "")
+	room.do(func() { room.Settings.Duration = 30 })
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	state := server.startMatch(t, alice)
+	setTerritory(room, map[string]int{playerID(t, alice): 1, playerID(t, bob): 1})
+
+	server.Clock.Advance(30 * time.Second)
+	waitForPhase(t, room, PhaseOvertime)
+	return room, alice, bob, state
+}
+
+// expectWinner waits for the game to end on every client and checks who won.
+func expectWinner(t *testing.T, winnerID string, clients ...*wstest.Client) {
+	t.Helper()
+	for _, client := range clients {
+		var over protocol.GameOverPayload
+		if err := client.ExpectMessage("gameOver", expectTimeout).Decode(&over); err != nil {
+			t.Fatal(err)
+		}
+		if over.Winner == nil || over.Winner.ID != winnerID {
+			t.Fatalf("winner = %+v, want %s", over.Winner, winnerID)
+		}
+	}
+}
+
+// A game tied for the lead when time is up goes on until someone leads.
+func TestOvertimeEndsOnceTheTieIsBroken(t *testing.T) {
+	server := startServer(t)
+	room, alice, bob, state := tiedMatch(t, server)
+	carol := wstest.Dial(t, server.URL+"/ws")
+	carol.JoinRoom("carol", room.ID)
+	expectError(t, carol, errGameStarted.Code)
+
+	from := findPlayer(t, state, playerID(t, alice))
+	alice.Move(awayFromEdge(from.X))
+	alice.Send("ping", protocol.PingPayload{ClientTime: 1})
+	alice.ExpectMessage("pong", expectTimeout)
+	server.Clock.Advance(gameInterval)
+	expectWinner(t, from.ID, alice, bob)
+}
+
+// A tie that isn't broken within overtimeLimit ends the game anyway, with
+// the tie settled as at the end of any game.
+func TestOvertimeRunsOut(t *testing.T) {
+	server := startServer(t)
+	_, alice, bob, _ := tiedMatch(t, server)
+
+	server.Clock.Advance(overtimeLimit)
+	expectWinner(t, playerID(t, alice), alice, bob)
+}
+
+// Going into overtime moves the deadline back by overtimeLimit, and everyone,
+// clients taking deltas included, is sent a full gameState with it.
+func TestOvertimeMovesTheDeadline(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	room.do(func() { room.Settings.Duration = 30 })
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob", "delta")
+	server.startMatch(t, alice)
+	setTerritory(room, map[string]int{playerID(t, alice): 1, playerID(t, bob): 1})
+
+	server.Clock.Advance(30 * time.Second)
+	waitForPhase(t, room, PhaseOvertime)
+	var want int64
+	room.do(func() { want = room.StartTime.Add(30*time.Second + overtimeLimit).UnixMilli() })
+	for {
+		var state protocol.GameStatePayload
+		if err := bob.ExpectMessage("gameState", expectTimeout).Decode(&state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Phase != PhaseOvertime.String() {
+			continue
+		}
+		if state.EndsAt != want || state.Remaining <= 0 {
+			t.Fatalf("overtime ends at %d with %ds remaining, want %d with time left", state.EndsAt, state.Remaining, want)
+		}
+		return
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"land/models"
+)
+
+// paletteJSON is the palette players' colors come from.
+//
+//go:embed palette.json
+var paletteJSON []byte
+
+// PaletteColor is a color players can have. The board knows a player by
+// Hex, which no two colors share; clients may draw a color with a Pattern
+// over it. A color with neither Achievement nor Item is free; the others
+// are unlocked by that achievement or by buying that shop item.
+type PaletteColor struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Hex         string `json:"hex"`
+	Pattern     string `json:"pattern,omitempty"`
+	Achievement string `json:"achievement,omitempty"`
+	Item        string `json:"item,omitempty"`
+}
+
+// Free reports whether every player may have the color.
+func (c PaletteColor) Free() bool {
+	return c.Achievement == "" && c.Item == ""
+}
+
+var (
+	palette      []PaletteColor
+	paletteByRef = make(map[string]PaletteColor)
+
+	// playerColors are the free colors, handed out to players without a
+	// preference.
+	playerColors []string
+)
+
+func init() {
+	if err := loadPalette(paletteJSON); err != nil {
+		panic("palette.json: " + err.Error())
+	}
+}
+
+// loadPalette reads the palette, indexing it by ID and by hex.
+func loadPalette(data []byte) error {
+	if err := json.Unmarshal(data, &palette); err != nil {
+		return err
+	}
+	for i, color := range palette {
+		color.Hex = strings.ToLower(color.Hex)
+		palette[i] = color
+		if !colorPattern.MatchString(color.Hex) {
+			return fmt.Errorf("color %s: hex %q isn't #rrggbb", color.ID, color.Hex)
+		}
+		for _, ref := range []string{color.ID, color.Hex} {
+			if _, dup := paletteByRef[ref]; dup {
+				return fmt.Errorf("color %s: %s is used twice", color.ID, ref)
+			}
+			paletteByRef[ref] = color
+		}
+		if color.Free() {
+			playerColors = append(playerColors, color.Hex)
+		}
+	}
+	if len(playerColors) == 0 {
+		return fmt.Errorf("no free colors")
+	}
+	return nil
+}
+
+// paletteColor is the palette color ref names, by ID or hex.
+func paletteColor(ref string) (PaletteColor, bool) {
+	color, ok := paletteByRef[strings.ToLower(ref)]
+	return color, ok
+}
+
+// colorHex is the board color for a color preference: a palette color's
+// hex, or the preference itself if it is a plain #rrggbb.
+func colorHex(ref string) string {
+	if color, ok := paletteColor(ref); ok {
+		return color.Hex
+	}
+	return ref
+}
+
+// skinOf is the palette ID of a board color, for clients to draw it by, or
+// empty for a plain color.
+func skinOf(hex string) string {
+	if color, ok := paletteByRef[hex]; ok {
+		return color.ID
+	}
+	return ""
+}
+
+// unlockedColors is the locked palette colors the account has unlocked, by
+// ID.
+func unlockedColors(accountID uint) (map[string]bool, error) {
+	unlocked := make(map[string]bool)
+	if db == nil || accountID == 0 {
+		return unlocked, nil
+	}
+	var achievements, items []string
+	err := db.Model(&models.PlayerAchievement{}).Where("account_id = ?", accountID).Pluck("achievement_id", &achievements).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Model(&models.InventoryItem{}).Where("account_id = ?", accountID).Pluck("item_id", &items).Error
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool)
+	for _, id := range append(achievements, items...) {
+		have[id] = true
+	}
+	for _, color := range palette {
+		if (color.Achievement != "" && have[color.Achievement]) || (color.Item != "" && have[color.Item]) {
+			unlocked[color.ID] = true
+		}
+	}
+	return unlocked, nil
+}
+
+// colorAllowed reports whether a player with the unlocked colors may have
+// the color ref names. Colors outside the palette are free.
+func colorAllowed(ref string, unlocked map[string]bool) bool {
+	color, ok := paletteColor(ref)
+	return !ok || color.Free() || unlocked[color.ID]
+}
+
+// chooseColor gives a player in the lobby the color they asked for, telling
+// the room. A locked color they haven't unlocked gets an error, and they
+// keep the color they had. What they've unlocked is looked up as they ask,
+// so colors unlocked since they joined count.
+func chooseColor(player *Player, ref string) {
+	room := player.Room.Load()
+	unlocked, err := unlockedColors(player.AccountID)
+	if err != nil {
+		log.Printf("Failed to load unlocked colors of account %d: %v", player.AccountID, err)
+		sendError(player, "INTERNAL_ERROR", "failed to load unlocked colors")
+		return
+	}
+
+	room.do(func() {
+		if room.Phase != PhaseWaiting {
+			sendError(player, "COLOR_LOCKED_IN", "colors can only be chosen before the game starts")
+			return
+		}
+		if !colorAllowed(ref, unlocked) {
+			sendError(player, "COLOR_LOCKED", fmt.Sprintf("color %s is locked", ref))
+			return
+		}
+		if color, ok := paletteColor(ref); ok {
+			ref = color.ID
+		}
+		before := player.Color
+		player.ColorPref = ref
+		assignColor(room, player)
+		if player.Color == before {
+			return
+		}
+		log.Printf("Room %s: %s changed color to %s", room.ID, player.ID, player.Color)
+		broadcastMessage(room, Message{
+			Type:    "playerColor",
+			Payload: PlayerColorPayload{PlayerID: player.ID, Color: player.Color, Skin: skinOf(player.Color)},
+		})
+	})
+}
+
+// listPalette serves every color in the palette, with how each locked one
+// is unlocked.
+func listPalette(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"colors": palette})
+}
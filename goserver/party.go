@@ -0,0 +1,320 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// partyReconnectGrace is how long a disconnected member keeps their place in
+// a party before being dropped from it.
+const partyReconnectGrace = 30 * time.Second
+
+// Party is a group of friends who want to be matched into the same room. Its
+// members wait outside the admission queue until the leader queues the whole
+// party as one unit.
+type Party struct {
+	Code     string
+	LeaderID string
+	Members  []*PartyMember
+}
+
+// PartyMember is a seat in a party. The seat outlives the member's
+// connection for partyReconnectGrace so a brief disconnect doesn't cost them
+// their place; Player is nil while they're away. AccountID is the account
+// the member signed in with, zero if none, which is what lets them back in
+// on a new connection.
+type PartyMember struct {
+	ID        string
+	Name      string
+	AccountID uint
+	Player    *Player
+	timer     *time.Timer
+}
+
+// PartyState is the party membership sent to members in partyUpdate messages.
+type PartyState struct {
+	Code     string        `json:"code"`
+	LeaderID string        `json:"leaderID"`
+	Members  []PartyStatus `json:"members"`
+}
+
+type PartyStatus struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Online bool   `json:"online"`
+}
+
+var (
+	partiesMutex sync.Mutex
+	parties      = make(map[string]*Party)
+)
+
+// createParty makes the player the leader of a new party, under name unless
+// they have registered one.
+func createParty(player *Player, name string) {
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+
+	if !canJoinParty(player) {
+		return
+	}
+	if name != "" && !player.registered() {
+		player.Name = playerName(player, name)
+	}
+
+	party := &Party{
+		Code:     generatePartyCode(),
+		LeaderID: player.ID,
+		Members:  []*PartyMember{{ID: player.ID, Name: player.Name, AccountID: player.AccountID, Player: player}},
+	}
+	parties[party.Code] = party
+	player.Party = party
+
+	log.Printf("%s created party %s", player.ID, party.Code)
+	broadcastParty(party)
+}
+
+// joinParty adds the player to the party with the given code, under name
+// unless they have registered one. A player who names the seat they held
+// before a disconnect (memberID) takes it back, provided it is theirs: the
+// same player, or signed in to the same account. Anyone else naming a seat
+// joins as usual.
+func joinParty(player *Player, name, code, memberID string) {
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+
+	if !canJoinParty(player) {
+		return
+	}
+	if name != "" && !player.registered() {
+		player.Name = playerName(player, name)
+	}
+	party, ok := parties[code]
+	if !ok {
+		sendError(player, "PARTY_NOT_FOUND", "party not found")
+		return
+	}
+
+	for _, member := range party.Members {
+		if member.ID == memberID && member.Player == nil && ownsSeat(player, member) {
+			member.timer.Stop()
+			member.Player = player
+			player.Party = party
+			log.Printf("%s rejoined party %s", memberID, party.Code)
+			broadcastParty(party)
+			return
+		}
+	}
+
+	if len(party.Members) >= maxPlayers {
+		sendError(player, "PARTY_FULL", "party is full")
+		return
+	}
+	party.Members = append(party.Members, &PartyMember{ID: player.ID, Name: player.Name, AccountID: player.AccountID, Player: player})
+	player.Party = party
+
+	log.Printf("%s joined party %s", player.ID, party.Code)
+	broadcastParty(party)
+}
+
+// ownsSeat reports whether the player may take back the member's seat: they
+// are the player who held it or signed in to the same account. Seat IDs are
+// shown to the whole party, so they don't prove anything on their own.
+func ownsSeat(player *Player, member *PartyMember) bool {
+	return player.ID == member.ID || member.AccountID != 0 && member.AccountID == player.AccountID
+}
+
+// canJoinParty checks that the player is still in the lobby: parties are
+// formed before anyone is queued or placed in a room. partiesMutex must be
+// held. While it is, nothing else can place a player who passes, so their
+// name is theirs to change.
+func canJoinParty(player *Player) bool {
+	if player.Party != nil {
+		sendError(player, "ALREADY_IN_PARTY", "already in a party")
+		return false
+	}
+	if player.Room.Load() != nil || queue.Contains(player) {
+		sendError(player, "ALREADY_IN_ROOM", "parties must be formed before queueing")
+		return false
+	}
+	return true
+}
+
+// queueParty puts the whole party into the admission queue as one unit. Only
+// the leader may do this, and only while every member is connected.
+func queueParty(player *Player) {
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+
+	party := player.Party
+	if party == nil || party.LeaderID != memberID(party, player) {
+		sendError(player, "NOT_PARTY_LEADER", "only the party leader can queue")
+		return
+	}
+
+	players := make([]*Player, 0, len(party.Members))
+	for _, member := range party.Members {
+		if member.Player == nil {
+			sendError(player, "PARTY_MEMBER_AWAY", member.Name+" is disconnected")
+			return
+		}
+		if member.Player.Room.Load() != nil || queue.Contains(member.Player) {
+			sendError(player, "ALREADY_IN_ROOM", member.Name+" is already playing")
+			return
+		}
+		players = append(players, member.Player)
+	}
+
+	log.Printf("Party %s queued with %d players", party.Code, len(players))
+	queue.Enqueue(players...)
+}
+
+// leaveParty removes the player from their party. The party is disbanded when
+// its leader leaves.
+func leaveParty(player *Player) {
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+
+	party := player.Party
+	if party == nil {
+		return
+	}
+	removePartyMember(party, memberID(party, player))
+}
+
+// partyMemberDisconnected holds a disconnected player's seat open for
+// partyReconnectGrace before removing them.
+func partyMemberDisconnected(player *Player) {
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+
+	party := player.Party
+	if party == nil {
+		return
+	}
+	for _, member := range party.Members {
+		if member.Player != player {
+			continue
+		}
+		member.Player = nil
+		member.timer = time.AfterFunc(partyReconnectGrace, func() {
+			partiesMutex.Lock()
+			defer partiesMutex.Unlock()
+
+			if member.Player == nil {
+				removePartyMember(party, member.ID)
+			}
+		})
+	}
+	broadcastParty(party)
+}
+
+// removePartyMember drops a seat from the party, disbanding it if the seat
+// was the leader's. partiesMutex must be held.
+func removePartyMember(party *Party, id string) {
+	if parties[party.Code] != party {
+		return
+	}
+
+	if id == party.LeaderID {
+		log.Printf("Party %s disbanded", party.Code)
+		for _, member := range party.Members {
+			if member.timer != nil {
+				member.timer.Stop()
+			}
+			if member.Player != nil {
+				member.Player.Party = nil
+				sendMessage(member.Player, Message{Type: "partyDisbanded", Payload: PartyDisbandedPayload{PartyCode: party.Code}})
+			}
+		}
+		delete(parties, party.Code)
+		return
+	}
+
+	for i, member := range party.Members {
+		if member.ID == id {
+			if member.Player != nil {
+				member.Player.Party = nil
+			}
+			party.Members = append(party.Members[:i], party.Members[i+1:]...)
+			break
+		}
+	}
+	broadcastParty(party)
+}
+
+// memberID returns the seat ID the player holds in the party.
+func memberID(party *Party, player *Player) string {
+	for _, member := range party.Members {
+		if member.Player == player {
+			return member.ID
+		}
+	}
+	return ""
+}
+
+// broadcastParty sends the current membership to every connected member.
+// partiesMutex must be held.
+func broadcastParty(party *Party) {
+	state := &PartyState{
+		Code:     party.Code,
+		LeaderID: party.LeaderID,
+		Members:  make([]PartyStatus, 0, len(party.Members)),
+	}
+	for _, member := range party.Members {
+		state.Members = append(state.Members, PartyStatus{
+			ID:     member.ID,
+			Name:   member.Name,
+			Online: member.Player != nil,
+		})
+	}
+
+	for _, member := range party.Members {
+		if member.Player != nil {
+			sendMessage(member.Player, Message{Type: "partyUpdate", Payload: state})
+		}
+	}
+}
+
+func generatePartyCode() string {
+	for {
+		code := generateRandomString(6)
+		if _, taken := parties[code]; !taken {
+			return code
+		}
+	}
+}
+
+// joinPartyHandler is the REST counterpart of the joinParty message: it adds
+// the caller's own connected player, the one signed in to the session's
+// account, to a party.
+func joinPartyHandler(c *gin.Context) {
+	var req struct {
+		MemberID string `json:"memberID"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	player := connected.ByAccount(sessionAccount(c).ID)
+	if player == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not connected"})
+		return
+	}
+
+	joinParty(player, "", c.Param("code"), req.MemberID)
+
+	partiesMutex.Lock()
+	defer partiesMutex.Unlock()
+	if player.Party == nil || player.Party.Code != c.Param("code") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to join party"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": player.Party.Code})
+}
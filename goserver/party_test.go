@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"land/internal/wstest"
+)
+
+// POST /parties/:code/join only ever moves the caller's own player, the one
+// signed in with the request's session.
+func TestJoinPartyOverREST(t *testing.T) {
+	useTestDB(t)
+	server := startServer(t)
+	_, aliceToken := newAccount(t, "alice")
+	_, bobToken := newAccount(t, "bob")
+	_, malloryToken := newAccount(t, "mallory")
+
+	alice := wstest.Dial(t, server.URL+"/ws?token="+aliceToken)
+	alice.Send("createParty", CreatePartyPayload{})
+	var party PartyState
+	if err := alice.ExpectMessage("partyUpdate", expectTimeout).Decode(&party); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob waits in the lobby, having asked for a party that doesn't exist.
+	bob := wstest.Dial(t, server.URL+"/ws?token="+bobToken)
+	bob.Send("joinParty", JoinPartyPayload{PartyCode: "nosuchparty"})
+	expectError(t, bob, "PARTY_NOT_FOUND")
+
+	path := "/parties/" + party.Code + "/join"
+	bobID := playerID(t, bob)
+	expectStatus(t, serveRequest(t, http.MethodPost, path, "", `{"playerID":"`+bobID+`"}`), http.StatusUnauthorized)
+	// Mallory isn't connected, and naming Bob's player doesn't make him hers.
+	expectStatus(t, serveRequest(t, http.MethodPost, path, malloryToken, `{"playerID":"`+bobID+`"}`), http.StatusNotFound)
+
+	expectStatus(t, serveRequest(t, http.MethodPost, path, bobToken, ""), http.StatusOK)
+	if err := bob.ExpectMessage("partyUpdate", expectTimeout).Decode(&party); err != nil {
+		t.Fatal(err)
+	}
+	if len(party.Members) != 2 {
+		t.Fatalf("party has members %+v, want alice and bob", party.Members)
+	}
+}
+
+// A disconnected leader's seat is only taken back by the leader, signed in
+// to the same account. A stranger who names it joins as anyone would.
+func TestStrangerCantTakeALeadersSeat(t *testing.T) {
+	useTestDB(t)
+	server := startServer(t)
+	_, aliceToken := newAccount(t, "alice")
+
+	alice := wstest.Dial(t, server.URL+"/ws?token="+aliceToken)
+	alice.Send("createParty", CreatePartyPayload{})
+	var party PartyState
+	if err := alice.ExpectMessage("partyUpdate", expectTimeout).Decode(&party); err != nil {
+		t.Fatal(err)
+	}
+	leaderID := party.LeaderID
+	bob := wstest.Dial(t, server.URL+"/ws")
+	bob.Send("joinParty", JoinPartyPayload{Name: "bob", PartyCode: party.Code})
+	bob.ExpectMessage("partyUpdate", expectTimeout)
+
+	alice.Close()
+	bob.ExpectMessage("partyUpdate", expectTimeout)
+
+	mallory := wstest.Dial(t, server.URL+"/ws")
+	mallory.Send("joinParty", JoinPartyPayload{Name: "mallory", PartyCode: party.Code, MemberID: leaderID})
+	if err := mallory.ExpectMessage("partyUpdate", expectTimeout).Decode(&party); err != nil {
+		t.Fatal(err)
+	}
+	if party.LeaderID != leaderID || len(party.Members) != 3 {
+		t.Fatalf("party after the stranger joined = %+v, want alice's seat kept and a new one", party)
+	}
+	for _, member := range party.Members {
+		if member.ID == leaderID && member.Online {
+			t.Fatalf("the stranger took alice's seat: %+v", party)
+		}
+	}
+	mallory.Send("queue", struct{}{})
+	expectError(t, mallory, "NOT_PARTY_LEADER")
+
+	// Alice, back on a new connection, takes her seat back.
+	alice = wstest.Dial(t, server.URL+"/ws?token="+aliceToken)
+	alice.Send("joinParty", JoinPartyPayload{PartyCode: party.Code, MemberID: leaderID})
+	if err := alice.ExpectMessage("partyUpdate", expectTimeout).Decode(&party); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range party.Members {
+		if member.ID == leaderID && !member.Online {
+			t.Fatalf("alice didn't get her seat back: %+v", party)
+		}
+	}
+}
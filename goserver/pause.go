@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// maxPauseTotal caps how long a game can spend paused in total, so a host
+// can't hold the room hostage. Each pause auto-resumes on the first tick
+// after the remaining allowance runs out.
+const maxPauseTotal = 90 * time.Second
+
+// Pause is a pause in progress. Started and Expires are on the room's clock.
+type Pause struct {
+	PlayerID string
+	Started  time.Time
+	Expires  time.Time
+}
+
+// endTime is when the game ends if it isn't paused again: the start plus the
+// duration plus the time already spent paused, and in overtime plus
+// overtimeLimit. It must run on the room's goroutine.
+func (room *Room) endTime() time.Time {
+	end := room.StartTime.Add(room.Duration + room.PausedTotal)
+	if room.Phase == PhaseOvertime {
+		end = end.Add(overtimeLimit)
+	}
+	return end
+}
+
+// remaining is the game time left, derived from endTime. Before the game
+// starts it is the full duration, and during a pause it stands still. It must
+// run on the room's goroutine.
+func (room *Room) remaining() time.Duration {
+	switch {
+	case room.StartTime.IsZero():
+		return room.Duration
+	case room.Pause != nil:
+		return room.endTime().Sub(room.Pause.Started)
+	}
+	return room.endTime().Sub(room.Clock.Now())
+}
+
+// endsAt is endTime in Unix milliseconds, or zero while the game clock is
+// stopped. It must run on the room's goroutine.
+func (room *Room) endsAt() int64 {
+	if room.StartTime.IsZero() || room.Pause != nil {
+		return 0
+	}
+	return room.endTime().UnixMilli()
+}
+
+func pauseGame(player *Player) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		switch {
+		case room.HostID != player.ID:
+			sendError(player, "NOT_HOST", "only the host can pause the game")
+			return
+		case room.Phase != PhaseInProgress && room.Phase != PhaseOvertime:
+			sendError(player, "NOT_IN_PROGRESS", "the game is not running")
+			return
+		case room.Pause != nil:
+			sendError(player, "GAME_PAUSED", "the game is already paused")
+			return
+		case room.PausedTotal >= maxPauseTotal:
+			sendError(player, "PAUSE_LIMIT", "no pause time left in this game")
+			return
+		}
+
+		now := room.Clock.Now()
+		pause := &Pause{PlayerID: player.ID, Started: now, Expires: now.Add(maxPauseTotal - room.PausedTotal)}
+		room.Pause = pause
+
+		log.Printf("Room %s paused by %s", room.ID, player.ID)
+
+		broadcastMessage(room, Message{
+			Type: "gamePaused",
+			Payload: GamePausedPayload{
+				PlayerID:  player.ID,
+				ExpiresAt: pause.Expires.UnixMilli(),
+				Remaining: int(room.remaining().Seconds()),
+			},
+		})
+	})
+}
+
+func resumeGame(player *Player) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		if room.HostID != player.ID {
+			sendError(player, "NOT_HOST", "only the host can resume the game")
+			return
+		}
+		if room.Pause == nil {
+			sendError(player, "NOT_PAUSED", "the game is not paused")
+			return
+		}
+		endPause(room, player.ID)
+	})
+}
+
+// endPause resumes the game, adding the pause to the room's total. playerID is
+// empty when the pause ran out on its own. It must run on the room's
+// goroutine.
+func endPause(room *Room, playerID string) {
+	pause := room.Pause
+	// A pause that ran out ends when its allowance did, not on the tick
+	// that noticed.
+	now := room.Clock.Now()
+	if now.After(pause.Expires) {
+		now = pause.Expires
+	}
+	paused := now.Sub(pause.Started)
+	room.PausedTotal += paused
+	room.Pause = nil
+
+	log.Printf("Room %s resumed after %s", room.ID, paused)
+
+	broadcastMessage(room, Message{
+		Type:    "gameResumed",
+		Payload: GameResumedPayload{PlayerID: playerID, Remaining: int(room.remaining().Seconds()), EndsAt: room.endsAt()},
+	})
+}
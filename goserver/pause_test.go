@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A pause runs out on the room's clock, and counts for exactly the
+// allowance it had.
+func TestPauseRunsOut(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	room.do(func() { room.Settings.Duration = 300 })
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	server.startMatch(t, alice)
+
+	alice.Send("pause", struct{}{})
+	var paused GamePausedPayload
+	if err := bob.ExpectMessage("gamePaused", expectTimeout).Decode(&paused); err != nil {
+		t.Fatal(err)
+	}
+	if want := server.Clock.Now().Add(maxPauseTotal).UnixMilli(); paused.ExpiresAt != want {
+		t.Fatalf("pause expires at %d, want %d", paused.ExpiresAt, want)
+	}
+
+	server.Clock.Advance(maxPauseTotal + time.Second)
+	var resumed GameResumedPayload
+	if err := bob.ExpectMessage("gameResumed", expectTimeout).Decode(&resumed); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.PlayerID != "" {
+		t.Errorf("resumed by %q, want the pause to have run out", resumed.PlayerID)
+	}
+	room.do(func() {
+		if room.PausedTotal != maxPauseTotal {
+			t.Errorf("paused for %v in total, want %v", room.PausedTotal, maxPauseTotal)
+		}
+	})
+
+	alice.Send("pause", struct{}{})
+	expectError(t, alice, "PAUSE_LIMIT")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Phase is where a room is in its lifecycle. Rooms move forward through the
+// phases in order and only ever change phase through setPhase.
+type Phase int
+
+const (
+	PhaseWaiting Phase = iota
+	PhaseCountdown
+	PhaseInProgress
+	PhaseOvertime
+	PhaseFinished
+)
+
+var phaseNames = map[Phase]string{
+	PhaseWaiting:    "waiting",
+	PhaseCountdown:  "countdown",
+	PhaseInProgress: "inProgress",
+	PhaseOvertime:   "overtime",
+	PhaseFinished:   "finished",
+}
+
+func (p Phase) String() string {
+	return phaseNames[p]
+}
+
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Joinable reports whether new players may enter a room in this phase.
+// Players joining an in-progress game are spawned straight into it, but a
+// game in overtime is too close to its end to be worth joining.
+func (p Phase) Joinable() bool {
+	return p <= PhaseInProgress
+}
+
+// Playing reports whether a room in this phase has a match under way, from
+// the countdown to the end of overtime.
+func (p Phase) Playing() bool {
+	return p >= PhaseCountdown && p <= PhaseOvertime
+}
+
+// messagePhases is the room state machine as seen by clients: the phases in
+// which each in-room message is accepted. Messages not listed are accepted in
+// every phase.
+var messagePhases = map[string][]Phase{
+	"move":        {PhaseInProgress, PhaseOvertime},
+	"emote":       {PhaseInProgress, PhaseOvertime},
+	"configure":   {PhaseWaiting},
+	"chooseColor": {PhaseWaiting},
+	"start":       {PhaseWaiting},
+	"pause":       {PhaseInProgress, PhaseOvertime},
+	"resume":      {PhaseInProgress, PhaseOvertime},
+	"votekick":    {PhaseWaiting, PhaseCountdown, PhaseInProgress, PhaseOvertime},
+	"vote":        {PhaseWaiting, PhaseCountdown, PhaseInProgress, PhaseOvertime},
+}
+
+// Accepts reports whether a message of the given type may be sent to a room
+// in this phase.
+func (p Phase) Accepts(msgType string) bool {
+	phases, ok := messagePhases[msgType]
+	if !ok {
+		return true
+	}
+	for _, phase := range phases {
+		if phase == p {
+			return true
+		}
+	}
+	return false
+}
+
+// setPhase moves the room to a new phase. It must run on the room's goroutine.
+func (room *Room) setPhase(phase Phase) {
+	if room.Phase == phase {
+		return
+	}
+	log.Printf("Room %s: %s -> %s", room.ID, room.Phase, phase)
+	room.Phase = phase
+}
+
+// listRooms returns the public rooms with their phase and occupancy.
+func listRooms(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rooms": publicRooms()})
+}
+
+// publicRooms summarizes every room that isn't private.
+func publicRooms() []RoomInfo {
+	list := make([]RoomInfo, 0)
+	for _, room := range rooms.List() {
+		room.do(func() {
+			if !room.Private {
+				list = append(list, roomInfo(room))
+			}
+		})
+	}
+	return list
+}
+
+// RoomInfo summarizes a room for room listings and the welcome message.
+type RoomInfo struct {
+	ID         string `json:"id"`
+	Phase      Phase  `json:"phase"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"maxPlayers"`
+	Spectators int    `json:"spectators"`
+
+	// TickInterval is the time between the room's game ticks, in
+	// milliseconds, for clients to size their interpolation window.
+	TickInterval int `json:"tickInterval"`
+}
+
+// roomInfo summarizes the room. It must run on the room's goroutine.
+func roomInfo(room *Room) RoomInfo {
+	return RoomInfo{
+		ID:           room.ID,
+		Phase:        room.Phase,
+		Players:      len(room.Players),
+		MaxPlayers:   room.Settings.MaxPlayers,
+		TickInterval: room.Settings.TickInterval,
+		Spectators:   len(room.Spectators),
+	}
+}
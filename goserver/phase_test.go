@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+func TestPhaseAccepts(t *testing.T) {
+	tests := []struct {
+		msgType string
+		phase   Phase
+		want    bool
+	}{
+		{"move", PhaseWaiting, false},
+		{"move", PhaseCountdown, false},
+		{"move", PhaseInProgress, true},
+		{"move", PhaseOvertime, true},
+		{"move", PhaseFinished, false},
+		{"emote", PhaseWaiting, false},
+		{"configure", PhaseWaiting, true},
+		{"configure", PhaseCountdown, false},
+		{"chooseColor", PhaseInProgress, false},
+		{"start", PhaseWaiting, true},
+		{"start", PhaseInProgress, false},
+		{"pause", PhaseWaiting, false},
+		{"resume", PhaseOvertime, true},
+		{"votekick", PhaseCountdown, true},
+		{"vote", PhaseFinished, false},
+		// Messages without phases of their own are taken in any.
+		{"chat", PhaseFinished, true},
+		{"mute", PhaseWaiting, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msgType+" "+tt.phase.String(), func(t *testing.T) {
+			if got := tt.phase.Accepts(tt.msgType); got != tt.want {
+				t.Fatalf("Accepts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Messages sent in a phase that doesn't take them are refused, and nothing
+// of them is applied.
+func TestOutOfPhaseMessages(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+
+	for _, msg := range []struct {
+		msgType string
+		payload any
+	}{
+		{"move", protocol.MovePayload{Direction: "up"}},
+		{"emote", protocol.EmotePayload{Emote: "wave"}},
+		{"pause", struct{}{}},
+		{"resume", struct{}{}},
+	} {
+		alice.Send(msg.msgType, msg.payload)
+		expectError(t, alice, "WRONG_PHASE")
+	}
+
+	server.startMatch(t, alice)
+	for _, msg := range []struct {
+		msgType string
+		payload any
+	}{
+		{"start", struct{}{}},
+		{"configure", ConfigurePayload{Settings: &RoomSettings{Duration: 60}}},
+		{"chooseColor", ChooseColorPayload{Color: "#FF0000"}},
+	} {
+		alice.Send(msg.msgType, msg.payload)
+		expectError(t, alice, "WRONG_PHASE")
+	}
+	var duration int
+	room.do(func() { duration = room.Settings.Duration })
+	if duration == 60 {
+		t.Fatal("settings changed after the game started")
+	}
+}
+
+func TestMessageOutsideARoom(t *testing.T) {
+	server := startServer(t)
+	alice := wstest.Dial(t, server.URL+"/ws")
+	alice.Move("up")
+	expectError(t, alice, "NOT_IN_ROOM")
+}
+
+// A message type the client may send, but not once it is in a room, is
+// refused as unknown there.
+func TestMessageOfTheWrongKind(t *testing.T) {
+	server := startServer(t)
+	alice := server.join(t, server.createRoom(t, ""), "alice")
+	alice.Send("spectate", SpectatePayload{RoomID: "elsewhere"})
+	expectError(t, alice, "UNKNOWN_TYPE")
+}
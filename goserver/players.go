@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// Player listing page sizes: what a request gets without a limit, and the
+// most it may ask for.
+const (
+	defaultPlayerListLimit = 50
+	maxPlayerListLimit     = 100
+)
+
+// playerSorts are the orders GET /players can list in, by the sort
+// parameter, with the column each sorts on and its direction when the
+// request doesn't give one.
+var playerSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	"name":    {"LOWER(name)", false},
+	"score":   {"score", true},
+	"rating":  {"rating", true},
+	"created": {"created_at", true},
+}
+
+// PlayerSummary is what anyone may see of an account.
+type PlayerSummary struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Guest     bool      `json:"guest"`
+	Character string    `json:"character"`
+	Color     string    `json:"color"`
+	Score     float64   `json:"score"`
+	Rating    float64   `json:"rating"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// listPlayers serves a page of accounts. q keeps those whose names start
+// with it, ignoring case; sort orders them by name, score, rating or
+// created, and order is asc or desc, by default ascending for names and
+// descending otherwise. Guest accounts are left out with guests=false.
+// Total is how many accounts match in all, for paging.
+func listPlayers(c *gin.Context) {
+	limit, ok := queryInt(c, "limit", defaultPlayerListLimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok {
+		return
+	}
+	guests, ok := queryBool(c, "guests", true)
+	if !ok {
+		return
+	}
+	sort, found := playerSorts[c.DefaultQuery("sort", "name")]
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort"})
+		return
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		sort.desc = false
+	case "desc":
+		sort.desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order"})
+		return
+	}
+	q := c.Query("q")
+	if utf8.RuneCountInString(q) > maxNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid q"})
+		return
+	}
+	if !requireDB(c) {
+		return
+	}
+	limit = min(max(limit, 1), maxPlayerListLimit)
+
+	players := db.Model(&models.Player{})
+	if q != "" {
+		players = players.Where(`LOWER(name) LIKE ? ESCAPE '\'`, likePrefix(strings.ToLower(q)))
+	}
+	if !guests {
+		players = players.Where("guest = ?", false)
+	}
+	var total int64
+	if err := players.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list players"})
+		return
+	}
+	direction := " ASC"
+	if sort.desc {
+		direction = " DESC"
+	}
+	var accounts []models.Player
+	err := players.Order(sort.column + direction).Order("id ASC").
+		Limit(limit).Offset(offset).Find(&accounts).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list players"})
+		return
+	}
+
+	summaries := make([]PlayerSummary, len(accounts))
+	for i, account := range accounts {
+		summaries[i] = playerSummary(account)
+	}
+	c.JSON(http.StatusOK, gin.H{"players": summaries, "total": total, "limit": limit, "offset": offset})
+}
+
+func playerSummary(account models.Player) PlayerSummary {
+	return PlayerSummary{
+		ID:        account.ID,
+		Name:      account.Name,
+		Guest:     account.Guest,
+		Character: account.Character,
+		Color:     account.Color,
+		Score:     account.Score,
+		Rating:    account.Rating,
+		CreatedAt: account.CreatedAt,
+	}
+}
+
+// likePrefix is a LIKE pattern matching strings that start with s, escaping
+// with backslashes.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"land/models"
+)
+
+// playerPage is a page of GET /players.
+type playerPage struct {
+	Players []PlayerSummary `json:"players"`
+	Total   int64           `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+func TestListPlayers(t *testing.T) {
+	useTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	for i, account := range []struct {
+		name   string
+		score  float64
+		rating float64
+		guest  bool
+	}{
+		{"alice", 10, 1400, false},
+		{"Alicia", 30, 1600, true},
+		{"bob", 20, 1500, false},
+		{"a_b", 5, 1450, false},
+		{"axb", 40, 1300, false},
+	} {
+		player := models.Player{Name: account.name, Score: account.score, Rating: account.rating, Guest: account.guest}
+		player.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := db.Create(&player).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query  string
+		names  []string
+		total  int64
+		limit  int
+		offset int
+	}{
+		{"", []string{"a_b", "alice", "Alicia", "axb", "bob"}, 5, defaultPlayerListLimit, 0},
+		{"?order=desc", []string{"bob", "axb", "Alicia", "alice", "a_b"}, 5, defaultPlayerListLimit, 0},
+		{"?sort=score", []string{"axb", "Alicia", "bob", "alice", "a_b"}, 5, defaultPlayerListLimit, 0},
+		{"?sort=score&order=asc", []string{"a_b", "alice", "bob", "Alicia", "axb"}, 5, defaultPlayerListLimit, 0},
+		{"?sort=rating", []string{"Alicia", "bob", "a_b", "alice", "axb"}, 5, defaultPlayerListLimit, 0},
+		{"?sort=created", []string{"axb", "a_b", "bob", "Alicia", "alice"}, 5, defaultPlayerListLimit, 0},
+		{"?sort=created&order=asc", []string{"alice", "Alicia", "bob", "a_b", "axb"}, 5, defaultPlayerListLimit, 0},
+		{"?q=ALI", []string{"alice", "Alicia"}, 2, defaultPlayerListLimit, 0},
+		// LIKE's wildcards in q match only themselves.
+		{"?q=a_", []string{"a_b"}, 1, defaultPlayerListLimit, 0},
+		{"?q=%25", []string{}, 0, defaultPlayerListLimit, 0},
+		{"?q=lice", []string{}, 0, defaultPlayerListLimit, 0},
+		{"?guests=false", []string{"a_b", "alice", "axb", "bob"}, 4, defaultPlayerListLimit, 0},
+		{"?q=ali&guests=false", []string{"alice"}, 1, defaultPlayerListLimit, 0},
+		{"?q=a&sort=score&limit=2&offset=1", []string{"Alicia", "alice"}, 4, 2, 1},
+		{"?offset=10", []string{}, 5, defaultPlayerListLimit, 10},
+		{"?limit=1000", []string{"a_b", "alice", "Alicia", "axb", "bob"}, 5, maxPlayerListLimit, 0},
+		{"?limit=0", []string{"a_b"}, 5, 1, 0},
+	}
+	for _, tt := range tests {
+		name := tt.query
+		if name == "" {
+			name = "defaults"
+		}
+		t.Run(name, func(t *testing.T) {
+			w := serveRequest(t, http.MethodGet, "/players"+tt.query, "", "")
+			expectStatus(t, w, http.StatusOK)
+			var page playerPage
+			decodeBody(t, w, &page)
+			names := []string{}
+			for _, player := range page.Players {
+				names = append(names, player.Name)
+			}
+			if !slices.Equal(names, tt.names) {
+				t.Fatalf("players = %v, want %v", names, tt.names)
+			}
+			if page.Total != tt.total || page.Limit != tt.limit || page.Offset != tt.offset {
+				t.Fatalf("total %d, limit %d, offset %d; want %d, %d, %d", page.Total, page.Limit, page.Offset, tt.total, tt.limit, tt.offset)
+			}
+		})
+	}
+}
+
+// Players that tie on the sort come in the order their accounts were made,
+// so paging through them neither skips nor repeats anyone.
+func TestListPlayersTies(t *testing.T) {
+	useTestDB(t)
+	var want []string
+	for _, name := range []string{"dave", "carol", "erin", "bob"} {
+		newAccount(t, name)
+		want = append(want, name)
+	}
+	var names []string
+	for offset := 0; offset < len(want); offset += 3 {
+		w := serveRequest(t, http.MethodGet, "/players?sort=score&limit=3&offset="+strconv.Itoa(offset), "", "")
+		expectStatus(t, w, http.StatusOK)
+		var page playerPage
+		decodeBody(t, w, &page)
+		for _, player := range page.Players {
+			names = append(names, player.Name)
+		}
+	}
+	if !slices.Equal(names, want) {
+		t.Fatalf("paged through %v, want %v", names, want)
+	}
+}
+
+// Listed players carry the account's public fields and nothing else.
+func TestListPlayersFields(t *testing.T) {
+	useTestDB(t)
+	newAccount(t, "alice")
+	w := serveRequest(t, http.MethodGet, "/players", "", "")
+	expectStatus(t, w, http.StatusOK)
+	var page struct {
+		Players []map[string]json.RawMessage `json:"players"`
+	}
+	decodeBody(t, w, &page)
+	if len(page.Players) != 1 {
+		t.Fatalf("%d players, want alice", len(page.Players))
+	}
+	var fields []string
+	for field := range page.Players[0] {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	if want := []string{"character", "color", "createdAt", "guest", "id", "name", "rating", "score"}; !slices.Equal(fields, want) {
+		t.Fatalf("player has fields %v, want %v", fields, want)
+	}
+}
+
+func TestListPlayersBadQuery(t *testing.T) {
+	useTestDB(t)
+	for _, query := range []string{
+		"?limit=-1", "?limit=ten", "?offset=-5", "?guests=maybe",
+		"?sort=password_hash", "?sort=", "?order=up",
+		"?q=" + strings.Repeat("a", maxNameLength+1),
+	} {
+		if w := serveRequest(t, http.MethodGet, "/players"+query, "", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+// The name search has an index on lowercased names to use.
+func TestPlayerNameIndex(t *testing.T) {
+	useTestDB(t)
+	if !db.Migrator().HasIndex(&models.Player{}, "idx_players_name_lower") {
+		t.Fatal("no index on lowercased player names")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// maxCharacterLength is the longest character name accepted, in runes.
+const maxCharacterLength = 32
+
+// colorPattern is the form a preferred color must take.
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// PreferencesRequest is the body of PUT /players/me/preferences. Fields left
+// out keep their value; an empty string clears one.
+type PreferencesRequest struct {
+	Color     *string `json:"color"`
+	Character *string `json:"character"`
+}
+
+// assignColor gives a player joining the room their preferred color, or
+// keeps the one they were dealt, as long as nobody in the room has it
+// already; otherwise they get a free color, and a colorTaken notice if it
+// was their preference that was taken. Colors own the board's cells, so two
+// players sharing one would share territory. It must run on the room's
+// goroutine.
+func assignColor(room *Room, player *Player) {
+	taken := func(color string) bool {
+		for _, other := range room.Players {
+			if other != player && other.Color == color {
+				return true
+			}
+		}
+		return false
+	}
+
+	if player.ColorPref != "" {
+		if preferred := colorHex(player.ColorPref); !taken(preferred) {
+			player.Color = preferred
+			return
+		}
+		defer func() {
+			sendMessage(player, Message{Type: "colorTaken", Payload: ColorTakenPayload{Preferred: player.ColorPref, Color: player.Color}})
+		}()
+	}
+	if !taken(player.Color) {
+		return
+	}
+	for _, i := range rand.Perm(len(playerColors)) {
+		if !taken(playerColors[i]) {
+			player.Color = playerColors[i]
+			return
+		}
+	}
+}
+
+// updatePreferences changes the color and character of the account the
+// request's token is for. They apply from the account's next connection.
+func updatePreferences(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+
+	var req PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updates := map[string]any{}
+	if !preferenceUpdates(c, account.ID, req, updates) {
+		return
+	}
+
+	var player models.Player
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&player, account.ID).Error; err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&player).Updates(updates).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+	default:
+		c.JSON(http.StatusOK, player)
+	}
+}
+
+// preferenceUpdates adds the column updates req asks for to updates,
+// answering 400 and reporting false if it asks for something invalid, or
+// 403 for a locked palette color or a character the shop sells that the
+// account hasn't unlocked. Palette colors are stored by ID.
+func preferenceUpdates(c *gin.Context, accountID uint, req PreferencesRequest, updates map[string]any) bool {
+	if req.Color != nil {
+		color := *req.Color
+		if entry, ok := paletteColor(color); ok {
+			color = entry.ID
+		} else if color != "" && !colorPattern.MatchString(color) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be a palette color or look like #rrggbb"})
+			return false
+		}
+		unlocked, err := unlockedColors(accountID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load unlocked colors"})
+			return false
+		}
+		if !colorAllowed(color, unlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Color is locked"})
+			return false
+		}
+		updates["color"] = color
+	}
+	if req.Character != nil {
+		if utf8.RuneCountInString(*req.Character) > maxCharacterLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Character name is too long"})
+			return false
+		}
+		if !characterOwned(c, accountID, *req.Character) {
+			return false
+		}
+		updates["character"] = *req.Character
+	}
+	return true
+}
+
+// characterOwned reports whether the account may choose the character,
+// answering 403 if it is sold in the shop and the account hasn't bought it.
+func characterOwned(c *gin.Context, accountID uint, character string) bool {
+	item, forSale := shopItemFor("character", character)
+	if !forSale {
+		return true
+	}
+	owned, err := owns(accountID, item.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load inventory"})
+		return false
+	}
+	if !owned {
+		c.JSON(http.StatusForbidden, gin.H{"error": item.Name + " must be bought in the shop first"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// nameChangeCooldown is how long a player must wait between name changes,
+// so a name can't be flipped to dodge reports. Set by flag.
+var nameChangeCooldown = 24 * time.Hour
+
+// errRenamedRecently rejects a name change within the cooldown.
+var errRenamedRecently = errors.New("name changed recently")
+
+// ProfileRequest is the body of PUT /players/me: a new name as well as the
+// preferences. Fields left out keep their value.
+type ProfileRequest struct {
+	Name *string `json:"name"`
+	PreferencesRequest
+}
+
+// updateProfile changes the name, color and character of the account the
+// request's token is for. A name that is taken gets a 409, and a name
+// change within nameChangeCooldown of the last a 429. A new name applies at
+// once in the room the player is in, which is told with a playerRenamed;
+// color and character apply from the next connection, as with
+// PUT /players/me/preferences.
+func updateProfile(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+
+	var req ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updates := map[string]any{}
+	if req.Name != nil {
+		if problem := checkName(*req.Name); problem != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+			return
+		}
+	}
+	if !preferenceUpdates(c, account.ID, req.PreferencesRequest, updates) {
+		return
+	}
+
+	var player models.Player
+	var renamed bool
+	var wait time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&player, account.ID).Error; err != nil {
+			return err
+		}
+		if req.Name != nil && *req.Name != player.Name {
+			if player.RenamedAt != nil {
+				if wait = time.Until(player.RenamedAt.Add(nameChangeCooldown)); wait > 0 {
+					return errRenamedRecently
+				}
+			}
+			updates["name"] = *req.Name
+			updates["renamed_at"] = time.Now()
+			renamed = true
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&player).Updates(updates).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "Name is already taken"})
+		return
+	case errors.Is(err, errRenamedRecently):
+		tooManyRequests(c, wait, "Name was changed too recently")
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if renamed {
+		renamePlayers(account.ID, player.Name)
+	}
+	c.JSON(http.StatusOK, player)
+}
+
+// renamePlayers renames the account's player in the room they are in, if
+// any, and tells the room. A player waiting for a room gets the name when
+// they next connect.
+func renamePlayers(accountID uint, name string) {
+	for _, room := range rooms.List() {
+		room.do(func() {
+			for _, player := range room.Players {
+				if player.AccountID != accountID {
+					continue
+				}
+				player.Name = name
+				broadcastMessage(room, Message{Type: "playerRenamed", Payload: PlayerRenamedPayload{PlayerID: player.ID, Name: name}})
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"land/pb"
+)
+
+var protobufCodec Codec = protobufEncoding{}
+
+// protoPayloadFields maps the message types with their own protobuf payload
+// to the Envelope field holding it. Every other payload goes in the json
+// field.
+var protoPayloadFields = map[string]protowire.Number{
+	"gameState":      10,
+	"positionUpdate": 11,
+}
+
+const protoJSONField protowire.Number = 15
+
+// protobufEncoding encodes messages as pb.Envelope. Marshal accepts a Message
+// or a bare payload; Unmarshal fills an Envelope from a pb.Envelope, and
+// inbound payloads, which always travel as JSON, from their JSON encoding.
+type protobufEncoding struct{}
+
+func (protobufEncoding) Name() string   { return "protobuf" }
+func (protobufEncoding) FrameType() int { return websocket.BinaryMessage }
+
+func (protobufEncoding) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(Message)
+	if !ok {
+		return marshalProtoPayload(v)
+	}
+
+	payload, ok := msg.Payload.(RawPayload)
+	if !ok {
+		var err error
+		if payload, err = marshalProtoPayload(msg.Payload); err != nil {
+			return nil, err
+		}
+	}
+	field, ok := protoPayloadFields[msg.Type]
+	if !ok {
+		field = protoJSONField
+	}
+
+	// The payload was encoded on its own so that a broadcast encodes it once;
+	// appending it as the oneof field gives the same bytes as marshaling the
+	// whole envelope.
+	data, err := proto.Marshal(&pb.Envelope{
+		Type:    msg.Type,
+		AckSeq:  msg.AckSeq,
+		EventId: msg.EventID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	data = protowire.AppendTag(data, field, protowire.BytesType)
+	return protowire.AppendBytes(data, payload), nil
+}
+
+func (protobufEncoding) Unmarshal(data []byte, v any) error {
+	env, ok := v.(*Envelope)
+	if !ok {
+		return json.Unmarshal(data, v)
+	}
+
+	var msg pb.Envelope
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	env.Type = msg.Type
+	env.Seq = msg.Seq
+	env.Payload = RawPayload("{}")
+	if payload := msg.GetJson(); len(payload) > 0 {
+		env.Payload = RawPayload(payload)
+	}
+	return nil
+}
+
+// UnmarshalStrict decodes an inbound payload, which is JSON.
+func (protobufEncoding) UnmarshalStrict(data []byte, v any) error {
+	return unmarshalStrictJSON(data, v)
+}
+
+// marshalProtoPayload encodes a payload the way it travels inside a
+// pb.Envelope: as its own message if it has one, as JSON otherwise.
+func marshalProtoPayload(payload any) ([]byte, error) {
+	switch payload := payload.(type) {
+	case GameStatePayload:
+		return proto.Marshal(gameStateToProto(payload))
+	case PositionPayload:
+		return proto.Marshal(&pb.PositionPayload{
+			PlayerId: payload.PlayerID,
+			X:        int32(payload.X),
+			Y:        int32(payload.Y),
+			Seq:      payload.Seq,
+		})
+	}
+	return json.Marshal(payload)
+}
+
+func gameStateToProto(payload GameStatePayload) *pb.GameStatePayload {
+	msg := &pb.GameStatePayload{
+		RoomId:      payload.RoomID,
+		Remaining:   int32(payload.Remaining),
+		EndsAt:      payload.EndsAt,
+		Spectators:  int32(payload.Spectators),
+		Phase:       payload.Phase,
+		LastEventId: payload.LastEventID,
+	}
+	if state := payload.GameState; state != nil {
+		msg.GameState = &pb.GameState{
+			Board:        make([]*pb.BoardRow, len(state.Board)),
+			Players:      make([]*pb.Player, len(state.Players)),
+			ChatMessages: state.ChatMessages,
+		}
+		for i, row := range state.Board {
+			msg.GameState.Board[i] = &pb.BoardRow{Cells: row}
+		}
+		for i, player := range state.Players {
+			msg.GameState.Players[i] = playerToProto(player)
+		}
+	}
+	if board := payload.CompactBoard; board != nil {
+		msg.CompactBoard = &pb.CompactBoard{
+			Size:    int32(board.Size),
+			Palette: board.Palette,
+			Runs:    make([]int32, len(board.Runs)),
+		}
+		for i, n := range board.Runs {
+			msg.CompactBoard.Runs[i] = int32(n)
+		}
+	}
+	if settings := payload.Settings; settings != nil {
+		msg.Settings = &pb.RoomSettings{
+			Duration:     int32(settings.Duration),
+			BoardSize:    int32(settings.BoardSize),
+			MaxPlayers:   int32(settings.MaxPlayers),
+			StealRule:    settings.StealRule,
+			Mode:         settings.Mode,
+			TickInterval: int32(settings.TickInterval),
+			ChatFilter:   settings.ChatFilter,
+			TeamMode:     settings.TeamMode,
+
+			SpectatorTeamChat: settings.SpectatorTeamChat,
+		}
+	}
+	return msg
+}
+
+func playerToProto(player PlayerState) *pb.Player {
+	return &pb.Player{
+		Id:        player.ID,
+		Name:      player.Name,
+		Color:     player.Color,
+		Skin:      player.Skin,
+		Character: player.Character,
+		Score:     int32(player.Score),
+		Position:  &pb.Position{X: int32(player.X), Y: int32(player.Y)},
+		Team:      player.Team,
+		Effects:   player.Effects,
+		LatencyMs: int32(player.LatencyMs),
+	}
+}
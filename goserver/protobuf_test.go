@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"land/pb"
+)
+
+// fill sets every field reachable from v, which must be a pointer, to a
+// distinct non-zero value, so that a field a conversion forgets shows up as
+// missing rather than as a zero that happens to match.
+func fill(t *testing.T, v reflect.Value, next *int) {
+	t.Helper()
+	*next++
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(t, v.Elem(), next)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			fill(t, v.Field(i), next)
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := range v.Len() {
+			fill(t, v.Index(i), next)
+		}
+	case reflect.String:
+		v.SetString(fmt.Sprintf("s%d", *next))
+	case reflect.Int, reflect.Int64:
+		v.SetInt(int64(*next))
+	case reflect.Uint64:
+		v.SetUint(uint64(*next))
+	case reflect.Bool:
+		v.SetBool(true)
+	default:
+		t.Fatalf("can't fill a %s", v.Type())
+	}
+}
+
+// decodeLoosely decodes JSON with its keys lowercased and stripped of
+// underscores, so that the JSON encoding's roomID and the protobuf
+// encoding's room_id compare equal, and its numbers kept as written, since
+// protojson writes 64-bit integers as strings.
+func decodeLoosely(t *testing.T, data []byte) any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var normalize func(any) any
+	normalize = func(v any) any {
+		switch v := v.(type) {
+		case map[string]any:
+			m := make(map[string]any, len(v))
+			for key, value := range v {
+				m[strings.ToLower(strings.ReplaceAll(key, "_", ""))] = normalize(value)
+			}
+			return m
+		case []any:
+			for i := range v {
+				v[i] = normalize(v[i])
+			}
+			return v
+		}
+		return fmt.Sprint(v)
+	}
+	return normalize(v)
+}
+
+// checkPopulated fails for every field of msg, and of the messages in it,
+// that is left unset.
+func checkPopulated(t *testing.T, msg protoreflect.Message) {
+	t.Helper()
+	fields := msg.Descriptor().Fields()
+	for i := range fields.Len() {
+		field := fields.Get(i)
+		if field.ContainingOneof() != nil {
+			continue
+		}
+		if !msg.Has(field) {
+			t.Errorf("%s is never set", field.FullName())
+			continue
+		}
+		switch {
+		case field.IsList() && field.Message() != nil:
+			list := msg.Get(field).List()
+			for j := range list.Len() {
+				checkPopulated(t, list.Get(j).Message())
+			}
+		case field.Message() != nil && !field.IsMap():
+			checkPopulated(t, msg.Get(field).Message())
+		}
+	}
+}
+
+// The protobuf encoding of a snapshot carries everything its JSON encoding
+// does, and sets every field the protobuf messages have: a field added to
+// one side only fails here until the other side and the conversion catch up.
+func TestGameStateToProto(t *testing.T) {
+	var payload GameStatePayload
+	fill(t, reflect.ValueOf(&payload).Elem(), new(int))
+
+	data, err := marshalProtoPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg pb.GameStatePayload
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	checkPopulated(t, msg.ProtoReflect())
+
+	want, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFields := decodeLoosely(t, want).(map[string]any)
+	// The protobuf encoding nests the board's rows and each player's
+	// coordinates in messages of their own.
+	state := wantFields["gamestate"].(map[string]any)
+	for i, row := range state["board"].([]any) {
+		state["board"].([]any)[i] = map[string]any{"cells": row}
+	}
+	for _, player := range state["players"].([]any) {
+		player := player.(map[string]any)
+		player["position"] = map[string]any{"x": player["x"], "y": player["y"]}
+		delete(player, "x")
+		delete(player, "y")
+	}
+
+	got, err := protojson.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotFields := decodeLoosely(t, got); !reflect.DeepEqual(gotFields, wantFields) {
+		t.Fatalf("protobuf encoding\n%v\nwant, from the JSON encoding,\n%v", gotFields, wantFields)
+	}
+}
+
+func TestPositionToProto(t *testing.T) {
+	var payload PositionPayload
+	fill(t, reflect.ValueOf(&payload).Elem(), new(int))
+
+	data, err := marshalProtoPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg pb.PositionPayload
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	checkPopulated(t, msg.ProtoReflect())
+
+	want, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := protojson.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotFields, wantFields := decodeLoosely(t, got), decodeLoosely(t, want); !reflect.DeepEqual(gotFields, wantFields) {
+		t.Fatalf("protobuf encoding %v, want %v", gotFields, wantFields)
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"land/protocol"
+)
+
+// Message is the envelope of everything the server sends: a type and a
+// payload struct whose shape depends on the type. AckSeq is the highest
+// sequence number processed from the recipient, filled in by sendMessage.
+//
+// EventID numbers broadcasts kept in the room's event log; it is zero for
+// everything else.
+type Message struct {
+	Type    string `json:"type"`
+	AckSeq  uint64 `json:"ackSeq"`
+	EventID uint64 `json:"eventID"`
+	Payload any    `json:"payload"`
+}
+
+// Envelope is an inbound message before its payload has been decoded. Seq is
+// assigned by the client and increases with every message it sends; zero
+// means the client doesn't number its messages.
+type Envelope struct {
+	Type    string     `json:"type"`
+	Seq     uint64     `json:"seq"`
+	Payload RawPayload `json:"payload"`
+}
+
+// Payload is the body of an inbound message. validate rejects payloads that
+// are missing required fields.
+type Payload interface {
+	validate() error
+}
+
+// DecodeError is why an inbound message was rejected. Code is the error code
+// sent back to the client, and Field the payload field at fault, if it was
+// down to one.
+type DecodeError struct {
+	Code  string
+	Field string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// inboundPayloads maps each message type a client may send to a constructor
+// for its payload.
+var inboundPayloads = map[string]func() Payload{
+	"hello":        func() Payload { return &HelloPayload{} },
+	"join":         func() Payload { return &JoinPayload{} },
+	"spectate":     func() Payload { return &SpectatePayload{} },
+	"reconnect":    func() Payload { return &ReconnectPayload{} },
+	"move":         func() Payload { return &MovePayload{} },
+	"chat":         func() Payload { return &ChatPayload{} },
+	"whisper":      func() Payload { return &WhisperPayload{} },
+	"emote":        func() Payload { return &EmotePayload{} },
+	"mute":         func() Payload { return &MutePayload{} },
+	"unmute":       func() Payload { return &MutePayload{} },
+	"votekick":     func() Payload { return &VoteKickPayload{} },
+	"vote":         func() Payload { return &VotePayload{} },
+	"createParty":  func() Payload { return &CreatePartyPayload{} },
+	"joinParty":    func() Payload { return &JoinPartyPayload{} },
+	"leaveParty":   func() Payload { return &EmptyPayload{} },
+	"queue":        func() Payload { return &EmptyPayload{} },
+	"friendInvite": func() Payload { return &InviteFriendPayload{} },
+	"configure":    func() Payload { return &ConfigurePayload{} },
+	"start":        func() Payload { return &EmptyPayload{} },
+	"chooseColor":  func() Payload { return &ChooseColorPayload{} },
+	"pause":        func() Payload { return &EmptyPayload{} },
+	"resume":       func() Payload { return &EmptyPayload{} },
+	"ping":         func() Payload { return &PingPayload{} },
+	"timeSync":     func() Payload { return &TimeSyncPayload{} },
+}
+
+// decodeMessage parses an inbound message and its payload. Messages without
+// a "payload" key are read in the old flat format, where the payload fields
+// sit next to "type". Errors are always a *DecodeError.
+//
+// TODO: drop the flat format one release after the envelope shipped.
+func decodeMessage(codec Codec, data []byte) (Envelope, Payload, error) {
+	badInput := "BAD_" + strings.ToUpper(codec.Name())
+	var env Envelope
+	if err := codec.Unmarshal(data, &env); err != nil {
+		return env, nil, &DecodeError{Code: badInput, Err: err}
+	}
+	newPayload, ok := inboundPayloads[env.Type]
+	if !ok {
+		return env, nil, &DecodeError{Code: "UNKNOWN_TYPE", Err: fmt.Errorf("unknown message type %q", env.Type)}
+	}
+
+	payload := newPayload()
+	var err error
+	if env.Payload != nil {
+		err = codec.UnmarshalStrict(env.Payload, payload)
+	} else {
+		err = decodeLegacy(codec, data, payload)
+	}
+	if err != nil {
+		return env, nil, payloadError(badInput, err)
+	}
+
+	if err := payload.validate(); err != nil {
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			return env, nil, decodeErr
+		}
+		return env, nil, &DecodeError{Code: "INVALID_PAYLOAD", Err: fmt.Errorf("invalid %s: %w", env.Type, err)}
+	}
+	return env, payload, nil
+}
+
+// payloadError explains why a payload failed to decode, picking out the field
+// responsible when the decoder says which it was.
+func payloadError(badInput string, err error) *DecodeError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &DecodeError{
+			Code:  badInput,
+			Field: typeErr.Field,
+			Err:   fmt.Errorf("%s must be a %s, not a %s", typeErr.Field, typeErr.Type, typeErr.Value),
+		}
+	}
+	for _, prefix := range []string{"json: unknown field ", "msgpack: unknown field "} {
+		if quoted, ok := strings.CutPrefix(err.Error(), prefix); ok {
+			field, _ := strconv.Unquote(quoted)
+			return &DecodeError{Code: "UNKNOWN_FIELD", Field: field, Err: fmt.Errorf("unknown field %s", quoted)}
+		}
+	}
+	return &DecodeError{Code: badInput, Err: err}
+}
+
+// decodeLegacy reads a payload from a flat message. Flat messages carry the
+// envelope's fields too, so unknown fields are ignored. The payloads kept the
+// flat field names, except that a vote used to be sent as "action".
+func decodeLegacy(codec Codec, data []byte, payload Payload) error {
+	if err := codec.Unmarshal(data, payload); err != nil {
+		return err
+	}
+	if vote, ok := payload.(*VotePayload); ok && vote.Vote == "" {
+		var flat struct {
+			Action string `json:"action"`
+		}
+		codec.Unmarshal(data, &flat)
+		vote.Vote = flat.Action
+	}
+	return nil
+}
+
+func required(field, value string) error {
+	if value == "" {
+		return invalid(field, "%s is required", field)
+	}
+	return nil
+}
+
+// invalid rejects a payload because of the value of one of its fields.
+func invalid(field, format string, args ...any) error {
+	return &DecodeError{Code: "INVALID_PAYLOAD", Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+// Longest names and chat messages accepted, in runes.
+const (
+	maxNameLength = 24
+	maxChatLength = 280
+)
+
+// maxLength rejects a value longer than limit runes.
+func maxLength(field, value string, limit int) error {
+	if utf8.RuneCountInString(value) > limit {
+		return &DecodeError{Code: "TOO_LONG", Field: field, Err: fmt.Errorf("%s is longer than %d characters", field, limit)}
+	}
+	return nil
+}
+
+// Inbound payloads.
+
+type EmptyPayload struct{}
+
+func (p *EmptyPayload) validate() error { return nil }
+
+// The payloads clients send most are shared with the clients in package
+// protocol. They are defined types here rather than aliases so the server
+// can validate them.
+type (
+	JoinPayload  protocol.JoinPayload
+	MovePayload  protocol.MovePayload
+	ChatPayload  protocol.ChatPayload
+	EmotePayload protocol.EmotePayload
+	PingPayload  protocol.PingPayload
+)
+
+func (p *JoinPayload) validate() error {
+	if err := required("name", p.Name); err != nil {
+		return err
+	}
+	return maxLength("name", p.Name, maxNameLength)
+}
+
+type SpectatePayload struct {
+	RoomID   string `json:"roomID"`
+	JoinCode string `json:"joinCode"`
+}
+
+func (p *SpectatePayload) validate() error { return required("roomID", p.RoomID) }
+
+// ReconnectPayload resumes a held seat. LastEventID is the last event the
+// client saw; the events after it are replayed. Zero asks for a snapshot.
+type ReconnectPayload struct {
+	PlayerID    string `json:"playerID"`
+	Token       string `json:"token"`
+	LastEventID uint64 `json:"lastEventID"`
+}
+
+func (p *ReconnectPayload) validate() error {
+	if err := required("playerID", p.PlayerID); err != nil {
+		return err
+	}
+	return required("token", p.Token)
+}
+
+// directions maps every accepted spelling of a direction, including the
+// WASD and arrow keys that produce it, to its canonical name.
+var directions = map[string]string{
+	"up": "up", "w": "up", "ArrowUp": "up",
+	"down": "down", "s": "down", "ArrowDown": "down",
+	"left": "left", "a": "left", "ArrowLeft": "left",
+	"right": "right", "d": "right", "ArrowRight": "right",
+}
+
+// validate also replaces an alias with the canonical direction.
+func (p *MovePayload) validate() error {
+	if direction, ok := directions[p.Direction]; ok {
+		p.Direction = direction
+		return nil
+	}
+	return &DecodeError{Code: "INVALID_DIRECTION", Field: "direction", Err: fmt.Errorf("unknown direction %q", p.Direction)}
+}
+
+// Chat channels: everyone in the room, or the sender's team.
+const (
+	ChannelAll  = "all"
+	ChannelTeam = "team"
+)
+
+func (p *ChatPayload) validate() error {
+	if err := required("message", p.Message); err != nil {
+		return err
+	}
+	if p.Channel != "" && p.Channel != ChannelAll && p.Channel != ChannelTeam {
+		return invalid("channel", `channel must be "all" or "team"`)
+	}
+	return maxLength("message", p.Message, maxChatLength)
+}
+
+// WhisperPayload is a chat message for one player in the room, named by To:
+// their player ID or their name.
+type WhisperPayload struct {
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+func (p *WhisperPayload) validate() error {
+	if err := required("to", p.To); err != nil {
+		return err
+	}
+	if err := required("message", p.Message); err != nil {
+		return err
+	}
+	return maxLength("message", p.Message, maxChatLength)
+}
+
+// MutePayload mutes or unmutes a player in the room for the sender, or with
+// Room set, for the whole room; only the host may do that.
+type MutePayload struct {
+	TargetID string `json:"targetID"`
+	Room     bool   `json:"room,omitempty"`
+}
+
+func (p *MutePayload) validate() error { return required("targetID", p.TargetID) }
+
+type VoteKickPayload struct {
+	TargetID string `json:"targetID"`
+}
+
+func (p *VoteKickPayload) validate() error { return required("targetID", p.TargetID) }
+
+// VotePayload is a ballot in a running kick vote: Vote is "yes" or "no".
+type VotePayload struct {
+	TargetID string `json:"targetID"`
+	Vote     string `json:"vote"`
+}
+
+func (p *VotePayload) validate() error {
+	if err := required("targetID", p.TargetID); err != nil {
+		return err
+	}
+	if p.Vote != "yes" && p.Vote != "no" {
+		return invalid("vote", `vote must be "yes" or "no"`)
+	}
+	return nil
+}
+
+type CreatePartyPayload struct {
+	Name string `json:"name"`
+}
+
+func (p *CreatePartyPayload) validate() error { return maxLength("name", p.Name, maxNameLength) }
+
+// JoinPartyPayload joins the party with PartyCode. MemberID reclaims the seat
+// held before a disconnect, by a player signed in to the same account.
+type JoinPartyPayload struct {
+	Name      string `json:"name"`
+	PartyCode string `json:"partyCode"`
+	MemberID  string `json:"memberID"`
+}
+
+func (p *JoinPartyPayload) validate() error {
+	if err := required("partyCode", p.PartyCode); err != nil {
+		return err
+	}
+	return maxLength("name", p.Name, maxNameLength)
+}
+
+type InviteFriendPayload struct {
+	AccountID uint `json:"accountID"`
+}
+
+func (p *InviteFriendPayload) validate() error {
+	if p.AccountID == 0 {
+		return invalid("accountID", "accountID is required")
+	}
+	return nil
+}
+
+type ConfigurePayload struct {
+	Settings *RoomSettings `json:"settings"`
+}
+
+func (p *ConfigurePayload) validate() error {
+	if p.Settings == nil {
+		return invalid("settings", "settings are required")
+	}
+	return nil
+}
+
+// ChooseColorPayload asks for a color in the lobby, by palette ID or as
+// #rrggbb.
+type ChooseColorPayload struct {
+	Color string `json:"color"`
+}
+
+func (p *ChooseColorPayload) validate() error {
+	if err := required("color", p.Color); err != nil {
+		return err
+	}
+	if _, ok := paletteColor(p.Color); !ok && !colorPattern.MatchString(p.Color) {
+		return invalid("color", "color %q is neither in the palette nor #rrggbb", p.Color)
+	}
+	return nil
+}
+
+func (p *EmotePayload) validate() error {
+	if err := required("emote", p.Emote); err != nil {
+		return err
+	}
+	if _, ok := protocol.LookupEmote(p.Emote); !ok {
+		return &DecodeError{Code: "UNKNOWN_EMOTE", Field: "emote", Err: fmt.Errorf("unknown emote %q", p.Emote)}
+	}
+	return nil
+}
+
+func (p *PingPayload) validate() error { return nil }
+
+// TimeSyncPayload starts a clock sync exchange. ClientTime is the client's
+// clock when it sent the message, in Unix milliseconds.
+type TimeSyncPayload struct {
+	ClientTime int64 `json:"clientTime"`
+}
+
+func (p *TimeSyncPayload) validate() error {
+	if p.ClientTime <= 0 {
+		return invalid("clientTime", "clientTime is required")
+	}
+	return nil
+}
+
+// Outbound payloads.
+
+// The direct replies to a client are shared with the clients too.
+type (
+	ErrorPayload   = protocol.ErrorPayload
+	SessionPayload = protocol.SessionPayload
+	PongPayload    = protocol.PongPayload
+)
+
+// The payloads describing a room's game are shared with the WASM client.
+type (
+	StateView           = protocol.StateView
+	PlayerState         = protocol.PlayerState
+	GameStatePayload    = protocol.GameStatePayload
+	GameStartingPayload = protocol.GameStartingPayload
+	GameOverPayload     = protocol.GameOverPayload
+	PlayerJoinedPayload = protocol.PlayerJoinedPayload
+	PlayerPayload       = protocol.PlayerPayload
+	PositionPayload     = protocol.PositionPayload
+	PlayerEmotedPayload = protocol.PlayerEmotedPayload
+)
+
+// playerState is the player as broadcast. Broadcasts are built from
+// PlayerState rather than from Player, so nothing the server tracks about a
+// player reaches clients unless it is added there.
+func playerState(player *Player) PlayerState {
+	state := PlayerState{
+		ID:        player.ID,
+		Name:      player.Name,
+		Color:     player.Color,
+		Skin:      skinOf(player.Color),
+		Character: player.Character,
+		Team:      player.Team,
+		Score:     player.Score,
+		X:         player.Position.X,
+		Y:         player.Position.Y,
+		LatencyMs: player.LatencyMs,
+	}
+	if player.SpeedBoost > 0 {
+		state.Effects = []string{"speedBoost"}
+	}
+	return state
+}
+
+// stateView is the room's board and roster as broadcast, without the chat
+// history. It must run on the room's goroutine.
+func stateView(room *Room) *StateView {
+	roster := room.roster()
+	view := &StateView{
+		Board:   room.GameState.Board,
+		Players: make([]PlayerState, len(roster)),
+	}
+	for i, player := range roster {
+		view.Players[i] = playerState(player)
+	}
+	return view
+}
+
+type HostChangedPayload struct {
+	PlayerID string `json:"playerID"`
+}
+
+// ChatMessagePayload is a chat message as players see it. Channel is
+// "team" for team chat, and Team then the team it went to; both are empty
+// for chat to everyone.
+type ChatMessagePayload struct {
+	PlayerID string `json:"playerID"`
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+	Channel  string `json:"channel,omitempty"`
+	Team     string `json:"team,omitempty"`
+}
+
+// TeamChatLogPayload shows spectators the game's team chat once it is over,
+// oldest first.
+type TeamChatLogPayload struct {
+	Messages []ChatMessagePayload `json:"messages"`
+}
+
+// WhisperMessagePayload is a whisper, sent to the player who whispered it
+// and the one it is for.
+type WhisperMessagePayload struct {
+	FromID   string `json:"fromID"`
+	FromName string `json:"fromName"`
+	ToID     string `json:"toID"`
+	ToName   string `json:"toName"`
+	Message  string `json:"message"`
+}
+
+type SettingsChangedPayload struct {
+	PlayerID string       `json:"playerID"`
+	Settings RoomSettings `json:"settings"`
+}
+
+// GamePausedPayload stops the game clock; Remaining is the time left when it
+// stopped. GameResumedPayload restarts it with a new EndsAt.
+type GamePausedPayload struct {
+	PlayerID  string `json:"playerID"`
+	ExpiresAt int64  `json:"expiresAt"`
+	Remaining int    `json:"remaining"`
+}
+
+type GameResumedPayload struct {
+	PlayerID  string `json:"playerID"`
+	Remaining int    `json:"remaining"`
+	EndsAt    int64  `json:"endsAt"`
+}
+
+// TimeSyncReplyPayload answers a timeSync with the client's timestamp and the
+// server's clock when it replied, both Unix milliseconds. With its own clock
+// at arrival the client has the round trip and its offset from the server:
+// offset = ServerTime + rtt/2 - arrival.
+type TimeSyncReplyPayload struct {
+	ClientTime int64 `json:"clientTime"`
+	ServerTime int64 `json:"serverTime"`
+}
+
+type ResyncPayload struct {
+	Reason string `json:"reason"`
+}
+
+// ColorTakenPayload tells a player that someone in the room already has
+// their preferred color, and which color they got instead.
+type ColorTakenPayload struct {
+	Preferred string `json:"preferred"`
+	Color     string `json:"color"`
+}
+
+// PlayerRenamedPayload tells a room that a player in it changed their name.
+type PlayerRenamedPayload struct {
+	PlayerID string `json:"playerID"`
+	Name     string `json:"name"`
+}
+
+// AchievementUnlockedPayload tells a player they unlocked an achievement.
+type AchievementUnlockedPayload struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// MutedPayload tells a player they muted or unmuted PlayerID, or with Room
+// set, tells the room its host did.
+type MutedPayload struct {
+	PlayerID string `json:"playerID"`
+	Muted    bool   `json:"muted"`
+	Room     bool   `json:"room,omitempty"`
+}
+
+// PlayerColorPayload tells a room a player's color changed, and the
+// palette ID to draw it by, if it has one.
+type PlayerColorPayload struct {
+	PlayerID string `json:"playerID"`
+	Color    string `json:"color"`
+	Skin     string `json:"skin,omitempty"`
+}
+
+type AFKWarningPayload struct {
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// ServerShutdownPayload warns that the server is going down at ShutdownAt,
+// in Unix milliseconds. Games still running then are ended.
+type ServerShutdownPayload struct {
+	ShutdownAt int64 `json:"shutdownAt"`
+}
+
+type QueuedPayload struct {
+	Position int `json:"position"`
+}
+
+type VoteKickStartedPayload struct {
+	PlayerID  string `json:"playerID"`
+	TargetID  string `json:"targetID"`
+	Name      string `json:"name"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type VoteKickUpdatePayload struct {
+	TargetID  string `json:"targetID"`
+	Yes       int    `json:"yes"`
+	No        int    `json:"no"`
+	Needed    int    `json:"needed"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type VoteKickEndedPayload struct {
+	TargetID string `json:"targetID"`
+	Outcome  string `json:"outcome"`
+}
+
+type KickedPayload struct {
+	RoomID string `json:"roomID"`
+	Reason string `json:"reason"`
+}
+
+type PartyDisbandedPayload struct {
+	PartyCode string `json:"partyCode"`
+}
+
+// FriendPayload names the account behind a friendRequest, friendAccepted,
+// friendOnline or friendOffline notification.
+type FriendPayload struct {
+	AccountID uint   `json:"accountID"`
+	Name      string `json:"name"`
+}
+
+type RoomInvitePayload struct {
+	AccountID uint   `json:"accountID"`
+	Name      string `json:"name"`
+	RoomID    string `json:"roomID"`
+	JoinCode  string `json:"joinCode"`
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"land/internal/wstest"
+)
+
+// Names and chat messages are limited in runes, not bytes: a limit's worth
+// of two-byte runes is let through, one more is not.
+func TestFieldLengths(t *testing.T) {
+	long := func(n int) string { return strings.Repeat("é", n) }
+	tests := []struct {
+		name    string
+		payload interface{ validate() error }
+		tooLong bool
+	}{
+		{"name at the limit", &JoinPayload{Name: long(maxNameLength)}, false},
+		{"name over the limit", &JoinPayload{Name: long(maxNameLength + 1)}, true},
+		{"chat at the limit", &ChatPayload{Message: long(maxChatLength)}, false},
+		{"chat over the limit", &ChatPayload{Message: long(maxChatLength + 1)}, true},
+		{"party name over the limit", &CreatePartyPayload{Name: long(maxNameLength + 1)}, true},
+		{"party member name over the limit", &JoinPartyPayload{Name: long(maxNameLength + 1), PartyCode: "ABCDEF"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.validate()
+			var decodeErr *DecodeError
+			if tooLong := errors.As(err, &decodeErr) && decodeErr.Code == "TOO_LONG"; tooLong != tt.tooLong {
+				t.Fatalf("validate() = %v, want too long: %v", err, tt.tooLong)
+			}
+		})
+	}
+}
+
+// Over-long names and chat messages are refused with an error, and nothing
+// is broadcast.
+func TestTooLongOverTheWire(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+
+	alice.Chat(strings.Repeat("x", maxChatLength+1))
+	expectError(t, alice, "TOO_LONG")
+	alice.Chat("short")
+	expectChat(t, alice, "alice", "short", "")
+
+	bob := wstest.Dial(t, server.URL+"/ws")
+	bob.JoinRoom(strings.Repeat("b", maxNameLength+1), room.ID)
+	expectError(t, bob, "TOO_LONG")
+}
+
+// A frame over maxMessageSize closes its connection, without the server
+// reading it in; the rest of the room carries on.
+func TestOversizedFrame(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	ws, _ := server.dialRaw(t, websocket.DefaultDialer)
+	joinRaw(t, ws, room, "mallory")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+
+	// The server hangs up long before the write is done. Its close frame,
+	// 1009, may be lost to the reset of the unread data.
+	go ws.WriteMessage(websocket.TextMessage, make([]byte, 10<<20))
+	ws.SetReadDeadline(time.Now().Add(expectTimeout))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatalf("connection still open after %v", expectTimeout)
+		}
+		break
+	}
+
+	alice.ExpectMessage("playerDisconnected", expectTimeout)
+	alice.Chat("still here")
+	expectChat(t, alice, "alice", "still here", "")
+}
+
+func TestDecodeMessageErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		code  string
+		field string
+	}{
+		{"typo in a field", `{"type":"move","payload":{"direcion":"up"}}`, "UNKNOWN_FIELD", "direcion"},
+		{"wrong type", `{"type":"move","payload":{"direction":7}}`, "BAD_JSON", "direction"},
+		{"unknown direction", `{"type":"move","payload":{"direction":"sideways"}}`, "INVALID_DIRECTION", "direction"},
+		{"missing name", `{"type":"join","payload":{}}`, "INVALID_PAYLOAD", "name"},
+		{"unknown type", `{"type":"teleport","payload":{}}`, "UNKNOWN_TYPE", ""},
+		{"not JSON", `{"type":`, "BAD_JSON", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, payload, err := decodeMessage(jsonCodec, []byte(tt.data))
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("decodeMessage() = %v, %v; want a DecodeError", payload, err)
+			}
+			if decodeErr.Code != tt.code || decodeErr.Field != tt.field {
+				t.Fatalf("error %s on %q (%v), want %s on %q", decodeErr.Code, decodeErr.Field, err, tt.code, tt.field)
+			}
+		})
+	}
+}
+
+// Whatever a client sends, decodeMessage doesn't panic, and either returns a
+// payload that is valid in full or an error and nothing to apply.
+func FuzzDecodeMessage(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"hello","payload":{"version":1,"client":"fuzz","features":["delta"]}}`,
+		`{"type":"join","seq":1,"payload":{"name":"alice","roomID":"ABC123"}}`,
+		`{"type":"move","seq":2,"payload":{"direction":"up"}}`,
+		`{"type":"chat","seq":3,"payload":{"message":"hi","channel":"team"}}`,
+		`{"type":"vote","payload":{"vote":"yes"}}`,
+		`{"type":"configure","payload":{"settings":{"duration":60,"boardSize":20}}}`,
+		`{"type":"timeSync","payload":{"clientTime":1}}`,
+		`{"type":"move","direction":"left"}`,
+		`{"type":"move","payload":{"direcion":"up"}}`,
+		`{"type":"join","payload":null}`,
+		`[]`,
+	} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+	f.Fuzz(func(t *testing.T, data string, msgpack bool) {
+		codec := jsonCodec
+		if msgpack {
+			codec = msgpackCodec
+		}
+		env, payload, err := decodeMessage(codec, []byte(data))
+		if err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Code == "" {
+				t.Fatalf("error %v isn't a DecodeError with a code", err)
+			}
+			if payload != nil {
+				t.Fatalf("payload %+v returned along with error %v", payload, err)
+			}
+			return
+		}
+		newPayload, ok := inboundPayloads[env.Type]
+		if !ok {
+			t.Fatalf("decoded a message of unknown type %q", env.Type)
+		}
+		if want, got := fmt.Sprintf("%T", newPayload()), fmt.Sprintf("%T", payload); got != want {
+			t.Fatalf("%s decoded into a %s, want a %s", env.Type, got, want)
+		}
+		if err := payload.validate(); err != nil {
+			t.Fatalf("decoded %s payload %+v is invalid: %v", env.Type, payload, err)
+		}
+	})
+}
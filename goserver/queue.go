@@ -0,0 +1,188 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	queueRetryInterval  = time.Second
+	queueNotifyInterval = 5 * time.Second
+)
+
+// AdmissionQueue caps the number of concurrent rooms and connected players.
+// Players who arrive while the server is full wait in FIFO order and are let
+// in automatically as capacity frees up. A zero limit means unlimited.
+//
+// Placing players means waiting on rooms, which is never done holding mu:
+// admitting is held instead, for a whole admission run, so runs don't
+// overlap and a player is never seen between the queue and their room.
+type AdmissionQueue struct {
+	MaxRooms   int
+	MaxPlayers int
+
+	admitting sync.Mutex
+
+	mu       sync.Mutex
+	admitted int
+	waiting  []*queueEntry
+}
+
+// queueEntry is a solo player or a whole party waiting to be placed together.
+// Its players only change with both of the queue's locks held, so an
+// admission run can read them without q.mu.
+type queueEntry struct {
+	players  []*Player
+	queuedAt time.Time
+}
+
+// Enqueue adds the players to the back of the queue as one unit and admits
+// them straight away if there is capacity.
+func (q *AdmissionQueue) Enqueue(players ...*Player) {
+	q.mu.Lock()
+	q.waiting = append(q.waiting, &queueEntry{players: players, queuedAt: time.Now()})
+	q.mu.Unlock()
+
+	q.admitWaiting()
+	q.notifyWaiting()
+}
+
+// TryAdmit reserves a player slot for someone joining a specific room, who
+// bypasses the queue. It reports false if the server is at its player cap.
+func (q *AdmissionQueue) TryAdmit() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.MaxPlayers > 0 && q.admitted >= q.MaxPlayers {
+		return false
+	}
+	q.admitted++
+	return true
+}
+
+// Remove takes a player who disconnected while waiting out of the queue. The
+// rest of their party stays queued. It reports false if the player was not
+// waiting, having been placed in a room if the queue was placing them.
+func (q *AdmissionQueue) Remove(player *Player) bool {
+	q.admitting.Lock()
+	defer q.admitting.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, entry := range q.waiting {
+		for j, p := range entry.players {
+			if p != player {
+				continue
+			}
+			entry.players = append(entry.players[:j], entry.players[j+1:]...)
+			if len(entry.players) == 0 {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the player is waiting in the queue. A player
+// the queue is placing is waited for, and isn't in it any more.
+func (q *AdmissionQueue) Contains(player *Player) bool {
+	q.admitting.Lock()
+	defer q.admitting.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, entry := range q.waiting {
+		for _, p := range entry.players {
+			if p == player {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Release frees the slot of an admitted player who has left and lets the
+// next waiting players in. It must not be called from a room's goroutine.
+func (q *AdmissionQueue) Release() {
+	q.mu.Lock()
+	q.admitted--
+	q.mu.Unlock()
+
+	q.admitWaiting()
+}
+
+// Run retries admission every second, so the matchmaking band of waiting
+// players keeps widening, and tells every waiting player their position at a
+// slower interval.
+func (q *AdmissionQueue) Run() {
+	retry := time.NewTicker(queueRetryInterval)
+	defer retry.Stop()
+	notify := time.NewTicker(queueNotifyInterval)
+	defer notify.Stop()
+
+	for {
+		select {
+		case <-retry.C:
+			q.admitWaiting()
+		case <-notify.C:
+			q.notifyWaiting()
+		}
+	}
+}
+
+// admitWaiting moves waiting entries into rooms in queue order for as long as
+// there is capacity. An entry the matchmaker has no room for yet, or whose
+// room filled up before it got there, is skipped so it doesn't hold up
+// everyone behind it. Entries are matched and placed without holding q.mu,
+// as both wait on rooms; their slots are reserved first so nobody joining
+// by ID takes them meanwhile.
+func (q *AdmissionQueue) admitWaiting() {
+	q.admitting.Lock()
+	defer q.admitting.Unlock()
+
+	q.mu.Lock()
+	entries := slices.Clone(q.waiting)
+	q.mu.Unlock()
+
+	for _, entry := range entries {
+		q.mu.Lock()
+		full := q.MaxPlayers > 0 && q.admitted+len(entry.players) > q.MaxPlayers
+		if !full {
+			q.admitted += len(entry.players)
+		}
+		q.mu.Unlock()
+		if full {
+			break
+		}
+
+		placed := false
+		if room := rooms.FindOpenRoom(entry.players, time.Since(entry.queuedAt), q.MaxRooms); room != nil {
+			placed = admitPlayer(room, "", entry.players...) == nil
+		}
+
+		q.mu.Lock()
+		if placed {
+			q.waiting = slices.DeleteFunc(q.waiting, func(e *queueEntry) bool { return e == entry })
+		} else {
+			q.admitted -= len(entry.players)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// notifyWaiting sends every waiting player their 1-based queue position.
+func (q *AdmissionQueue) notifyWaiting() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, entry := range q.waiting {
+		for _, player := range entry.players {
+			sendMessage(player, Message{
+				Type:    "queued",
+				Payload: QueuedPayload{Position: i + 1},
+			})
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	"land/internal/wstest"
+)
+
+// testQueue replaces the room manager with an empty one and returns the
+// queue, limited to maxRooms and maxPlayers, with players to put in it. The
+// players have no connection; what they'd be sent is dropped.
+func testQueue(t *testing.T, maxRooms, maxPlayers, players int) (*AdmissionQueue, []*Player) {
+	t.Helper()
+	testRooms(t)
+	q := &AdmissionQueue{MaxRooms: maxRooms, MaxPlayers: maxPlayers}
+	setForTest(t, &queue, q)
+	return q, ratedPlayers("player", players, 0)
+}
+
+// checkPlaced checks which of the players are seated and which still wait.
+func checkPlaced(t *testing.T, q *AdmissionQueue, placed []*Player, waiting []*Player) {
+	t.Helper()
+	for _, player := range placed {
+		if player.Room.Load() == nil || q.Contains(player) {
+			t.Errorf("%s isn't placed", player.Name)
+		}
+	}
+	for _, player := range waiting {
+		if player.Room.Load() != nil || !q.Contains(player) {
+			t.Errorf("%s isn't waiting", player.Name)
+		}
+	}
+}
+
+// Freed slots go to whoever has waited longest.
+func TestQueueAdmitsInOrder(t *testing.T) {
+	q, players := testQueue(t, 0, 1, 3)
+	for _, player := range players {
+		q.Enqueue(player)
+	}
+	checkPlaced(t, q, players[:1], players[1:])
+
+	q.Release()
+	checkPlaced(t, q, players[1:2], players[2:])
+	q.Release()
+	checkPlaced(t, q, players[2:], nil)
+}
+
+// A party is let in once there are slots for all of it, and nobody behind
+// it takes a slot first.
+func TestQueueAdmitsPartiesTogether(t *testing.T) {
+	q, players := testQueue(t, 0, 2, 4)
+	solo, party, behind := players[0], players[1:3], players[3]
+	q.Enqueue(solo)
+	q.Enqueue(party...)
+	q.Enqueue(behind)
+	checkPlaced(t, q, []*Player{solo}, append([]*Player{behind}, party...))
+
+	q.Release()
+	checkPlaced(t, q, party, []*Player{behind})
+	if party[0].Room.Load() != party[1].Room.Load() {
+		t.Fatal("the party was split up")
+	}
+}
+
+// An entry the matchmaker has no room for doesn't hold up those behind it
+// who fit.
+func TestQueueSkipsWhoCantBePlaced(t *testing.T) {
+	q, players := testQueue(t, 1, 0, 2+maxPlayers)
+	first, party, last := players[0], players[1:1+maxPlayers], players[1+maxPlayers]
+	q.Enqueue(first)
+	q.Enqueue(party...)
+	q.Enqueue(last)
+	checkPlaced(t, q, []*Player{first, last}, party)
+	if first.Room.Load() != last.Room.Load() {
+		t.Fatal("solo players placed apart with one room allowed")
+	}
+}
+
+// A player who leaves the queue gives up their place to the next.
+func TestQueueRemove(t *testing.T) {
+	q, players := testQueue(t, 0, 1, 3)
+	for _, player := range players {
+		q.Enqueue(player)
+	}
+	if !q.Remove(players[1]) {
+		t.Fatal("a waiting player wasn't removed")
+	}
+	if q.Remove(players[1]) || q.Remove(players[0]) {
+		t.Fatal("removed a player who wasn't waiting")
+	}
+	q.Release()
+	checkPlaced(t, q, players[2:], nil)
+	if players[1].Room.Load() != nil {
+		t.Fatal("a removed player was placed")
+	}
+}
+
+// A queued player is seated by whoever frees the slot they wait for, while
+// their own connection looks up their room for every message they send.
+func TestAdmitWhileThePlayerSends(t *testing.T) {
+	setForTest(t, &chatRate, 0)
+	setForTest(t, &queue, &AdmissionQueue{MaxPlayers: 1})
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	carol := server.join(t, room, "carol")
+
+	alice := wstest.Dial(t, server.URL+"/ws")
+	alice.Join("alice")
+	alice.ExpectMessage("queued", expectTimeout)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 50 {
+			alice.Chat("let me in")
+		}
+	}()
+	room.do(func() {
+		kickPlayer(room, room.Players[playerID(t, carol)], closeKicked, "making room")
+	})
+	alice.ExpectMessage("gameState", expectTimeout)
+	<-done
+}
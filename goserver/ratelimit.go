@@ -0,0 +1,216 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// rateLimitKeys is how many clients or names a limiter tracks at once.
+	// Past it, the least recently seen is forgotten, as if it had been idle.
+	rateLimitKeys = 10000
+
+	// loginLockoutThreshold is how many logins in a row an account name may
+	// fail before it is locked out. Each failure from then on locks it for
+	// twice as long as the last, from loginLockoutBase up to loginLockoutMax.
+	loginLockoutThreshold = 5
+	loginLockoutBase      = 30 * time.Second
+	loginLockoutMax       = time.Hour
+
+	// loginFailureMemory is how long failed logins count against a name.
+	loginFailureMemory = 24 * time.Hour
+)
+
+var (
+	// Limits on accounts, set by flags: registrations and guest accounts
+	// per client IP per hour, and logins per client IP and per account name
+	// per minute. Zero is unlimited.
+	registerRate  = 10
+	guestRate     = 20
+	loginRate     = 30
+	loginNameRate = 10
+
+	registerLimiter  = newRateLimiter(registerRate, time.Hour)
+	guestLimiter     = newRateLimiter(guestRate, time.Hour)
+	loginLimiter     = newRateLimiter(loginRate, time.Minute)
+	loginNameLimiter = newRateLimiter(loginNameRate, time.Minute)
+	loginFailures    = newLoginGuard()
+)
+
+// initRateLimits makes the limiters from the flags.
+func initRateLimits() {
+	registerLimiter = newRateLimiter(registerRate, time.Hour)
+	guestLimiter = newRateLimiter(guestRate, time.Hour)
+	loginLimiter = newRateLimiter(loginRate, time.Minute)
+	loginNameLimiter = newRateLimiter(loginNameRate, time.Minute)
+}
+
+// lru is a map that keeps only its most recently used entries.
+type lru[V any] struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // of *lruEntry[V], most recently used first
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRU[V any](size int) *lru[V] {
+	return &lru[V]{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns the value for key, making one with fresh if there is none.
+func (l *lru[V]) get(key string, fresh func() V) V {
+	if e, ok := l.entries[key]; ok {
+		l.order.MoveToFront(e)
+		return e.Value.(*lruEntry[V]).value
+	}
+	if l.order.Len() >= l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+	value := fresh()
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value})
+	return value
+}
+
+func (l *lru[V]) remove(key string) {
+	if e, ok := l.entries[key]; ok {
+		l.order.Remove(e)
+		delete(l.entries, key)
+	}
+}
+
+// rateLimiter allows each key n requests per interval: a token bucket per
+// key holding up to n tokens, refilled evenly over the interval. A nil
+// rateLimiter allows everything.
+type rateLimiter struct {
+	rate  float64 // tokens a second
+	burst float64
+
+	mu      sync.Mutex
+	buckets *lru[*tokenBucket]
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter allows n requests per interval, or is nil, allowing
+// everything, if n isn't positive.
+func newRateLimiter(n int, interval time.Duration) *rateLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    float64(n) / interval.Seconds(),
+		burst:   float64(n),
+		buckets: newLRU[*tokenBucket](rateLimitKeys),
+	}
+}
+
+// allow takes a token from key's bucket. If it is empty, it returns how long
+// until it won't be.
+func (l *rateLimiter) allow(key string) (retryAfter time.Duration) {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.buckets.get(key, func() *tokenBucket {
+		return &tokenBucket{tokens: l.burst, updated: now}
+	})
+	b.tokens = min(b.tokens+now.Sub(b.updated).Seconds()*l.rate, l.burst)
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// limitByIP rejects requests from client IPs over the limiter's rate.
+func limitByIP(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if wait := limiter.allow(c.ClientIP()); wait > 0 {
+			tooManyRequests(c, wait, "Too many requests; try again later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// tooManyRequests answers 429, saying when to retry.
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// loginGuard locks account names out after repeated failed logins, so a
+// password can't be guessed by spreading attempts across many IPs.
+type loginGuard struct {
+	mu       sync.Mutex
+	failures *lru[*failedLogins]
+}
+
+type failedLogins struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{failures: newLRU[*failedLogins](rateLimitKeys)}
+}
+
+// locked returns how much longer name is locked out for, if it is.
+func (g *loginGuard) locked(name string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	e, ok := g.failures.entries[name]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(e.Value.(*lruEntry[*failedLogins]).value.lockedUntil), 0)
+}
+
+// failed records a failed login for name, locking it out if it has failed
+// too often.
+func (g *loginGuard) failed(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	f := g.failures.get(name, func() *failedLogins { return &failedLogins{} })
+	if now.Sub(f.last) > loginFailureMemory {
+		f.count = 0
+	}
+	f.count++
+	f.last = now
+	if n := f.count - loginLockoutThreshold; n >= 0 {
+		lockout := loginLockoutMax
+		if n < 20 {
+			lockout = min(loginLockoutBase<<n, loginLockoutMax)
+		}
+		f.lockedUntil = now.Add(lockout)
+	}
+}
+
+// succeeded forgets name's failed logins.
+func (g *loginGuard) succeeded(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures.remove(name)
+}
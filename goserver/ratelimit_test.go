@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// A key gets a burst of n requests, then one every interval/n; other keys
+// have buckets of their own.
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(3, time.Minute)
+	for i := range 3 {
+		if wait := limiter.allow("a"); wait != 0 {
+			t.Fatalf("request %d of the burst refused for %v", i+1, wait)
+		}
+	}
+	wait := limiter.allow("a")
+	if wait <= 19*time.Second || wait > 20*time.Second {
+		t.Fatalf("past the burst, wait %v, want about 20s", wait)
+	}
+	if wait := limiter.allow("b"); wait != 0 {
+		t.Fatalf("another key refused for %v", wait)
+	}
+
+	// A third of the interval later, one more request is let through.
+	limiter.buckets.get("a", nil).updated = time.Now().Add(-20 * time.Second)
+	if wait := limiter.allow("a"); wait != 0 {
+		t.Fatalf("refused for %v after refilling a token", wait)
+	}
+	if wait := limiter.allow("a"); wait == 0 {
+		t.Fatal("let through a request past the refill")
+	}
+
+	unlimited := newRateLimiter(0, time.Minute)
+	for range 100 {
+		if wait := unlimited.allow("a"); wait != 0 {
+			t.Fatalf("no limit, but refused for %v", wait)
+		}
+	}
+}
+
+// Limiters remember a bounded number of keys, forgetting the least recently
+// seen first.
+func TestLRU(t *testing.T) {
+	l := newLRU[int](2)
+	n := 0
+	fresh := func() int { n++; return n }
+	l.get("a", fresh)
+	l.get("b", fresh)
+	l.get("a", fresh) // a is now more recent than b
+	l.get("c", fresh)
+	if len(l.entries) != 2 || l.order.Len() != 2 {
+		t.Fatalf("%d entries, %d in order; want 2", len(l.entries), l.order.Len())
+	}
+	if _, ok := l.entries["b"]; ok {
+		t.Fatal("kept b, the least recently seen")
+	}
+	if got := l.get("a", fresh); got != 1 {
+		t.Fatalf("a = %d, want the 1 it was made with", got)
+	}
+}
+
+// expectRetryAfter fails the test unless the response is a 429 saying to
+// retry in between min and max seconds.
+func expectRetryAfter(t *testing.T, code int, header http.Header, min, max int) {
+	t.Helper()
+	retry, err := strconv.Atoi(header.Get("Retry-After"))
+	if code != http.StatusTooManyRequests || err != nil || retry < min || retry > max {
+		t.Fatalf("status %d, Retry-After %q; want 429 with %d to %d seconds", code, header.Get("Retry-After"), min, max)
+	}
+}
+
+// A burst of registrations from one IP is cut off at the limit.
+func TestRegisterRateLimit(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &registerLimiter, newRateLimiter(3, time.Hour))
+	for i := range 3 {
+		w := serveRequest(t, http.MethodPost, "/register", "", fmt.Sprintf(`{"name":"player%d","password":"secret"}`, i))
+		expectStatus(t, w, http.StatusOK)
+	}
+	w := serveRequest(t, http.MethodPost, "/register", "", `{"name":"player3","password":"secret"}`)
+	expectRetryAfter(t, w.Code, w.Header(), 1, 1200)
+}
+
+// Logins are limited per account name as well as per IP, so spreading
+// guesses for one name over many IPs doesn't help.
+func TestLoginNameRateLimit(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &loginLimiter, nil)
+	setForTest(t, &loginNameLimiter, newRateLimiter(2, time.Minute))
+	expectStatus(t, serveRequest(t, http.MethodPost, "/register", "", `{"name":"alice","password":"secret"}`), http.StatusOK)
+
+	for range 2 {
+		expectStatus(t, serveRequest(t, http.MethodPost, "/login", "", `{"name":"alice","password":"secret"}`), http.StatusOK)
+	}
+	w := serveRequest(t, http.MethodPost, "/login", "", `{"name":"alice","password":"secret"}`)
+	expectRetryAfter(t, w.Code, w.Header(), 1, 30)
+	expectStatus(t, serveRequest(t, http.MethodPost, "/login", "", `{"name":"bob","password":"secret"}`), http.StatusUnauthorized)
+}
+
+// A name that keeps failing to log in is locked out, for twice as long with
+// each failure past the threshold, and a good login clears its record.
+func TestLoginLockout(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &loginLimiter, nil)
+	setForTest(t, &loginNameLimiter, nil)
+	expectStatus(t, serveRequest(t, http.MethodPost, "/register", "", `{"name":"alice","password":"secret"}`), http.StatusOK)
+	login := func(password string) *http.Response {
+		w := serveRequest(t, http.MethodPost, "/login", "", fmt.Sprintf(`{"name":"alice","password":%q}`, password))
+		return w.Result()
+	}
+	expire := func() {
+		loginFailures.failures.get("alice", nil).lockedUntil = time.Now()
+	}
+
+	for i := range loginLockoutThreshold - 1 {
+		if resp := login("guess"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	for _, lockout := range []time.Duration{loginLockoutBase, 2 * loginLockoutBase, 4 * loginLockoutBase} {
+		if resp := login("guess"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("status %d, want 401", resp.StatusCode)
+		}
+		// Locked out, the right password is refused too.
+		resp := login("secret")
+		seconds := int(lockout.Seconds())
+		expectRetryAfter(t, resp.StatusCode, resp.Header, seconds-5, seconds)
+		expire()
+	}
+
+	if resp := login("secret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d once the lockout is over, want 200", resp.StatusCode)
+	}
+	if resp := login("guess"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d after a good login, want 401 without a lockout", resp.StatusCode)
+	}
+	if wait := loginFailures.locked("alice"); wait != 0 {
+		t.Fatalf("locked for %v by one failure after a good login", wait)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// ratingK is the most a rating moves in one match. Each player's change is
+// averaged over their opponents, so it doesn't grow with the room size.
+const ratingK = 32.0
+
+// ratingChanges is the multiplayer Elo change for each player from their
+// rating and placement: every pair of players counts as a game, won by the
+// one placed higher or drawn on a shared placement. The changes add up to
+// zero.
+func ratingChanges(ratings []float64, placements []int) []float64 {
+	changes := make([]float64, len(ratings))
+	if len(ratings) < 2 {
+		return changes
+	}
+	for i := range ratings {
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			actual := 0.5
+			switch {
+			case placements[i] < placements[j]:
+				actual = 1
+			case placements[i] > placements[j]:
+				actual = 0
+			}
+			changes[i] += actual - expected
+		}
+	}
+	for i := range changes {
+		changes[i] *= ratingK / float64(len(ratings)-1)
+	}
+	return changes
+}
+
+// rateMatch updates the ratings of the registered accounts in a match, and
+// fills in their results' ratings. Guests and players without an account
+// neither gain nor lose rating, and don't count as opponents, so they can't
+// move anyone else's. Players carry their new rating into matchmaking when
+// they next connect.
+func rateMatch(tx *gorm.DB, match *models.Match, standings []Standing) error {
+	var rated []int
+	var ids []uint
+	for i, standing := range standings {
+		if standing.AccountID != 0 && !standing.Guest {
+			rated = append(rated, i)
+			ids = append(ids, standing.AccountID)
+		}
+	}
+	if len(rated) < 2 {
+		return nil
+	}
+
+	var accounts []models.Player
+	if err := tx.Select("id", "rating").Find(&accounts, ids).Error; err != nil {
+		return err
+	}
+	current := make(map[uint]float64, len(accounts))
+	for _, account := range accounts {
+		current[account.ID] = account.Rating
+	}
+
+	ratings := make([]float64, len(rated))
+	placements := make([]int, len(rated))
+	for k, i := range rated {
+		rating, ok := current[standings[i].AccountID]
+		if !ok {
+			rating = models.DefaultRating
+		}
+		ratings[k] = rating
+		placements[k] = standings[i].Placement
+	}
+	for k, change := range ratingChanges(ratings, placements) {
+		result := &match.Results[rated[k]]
+		result.RatingDelta = change
+		result.Rating = ratings[k] + change
+		err := tx.Model(&models.Player{}).Where("id = ?", result.AccountID).Update("rating", result.Rating).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"land/models"
+)
+
+func TestRatingChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratings    []float64
+		placements []int
+		want       []float64 // nil to only check the changes add up to zero
+	}{
+		{"alone", []float64{1000}, []int{1}, []float64{0}},
+		{"even pair", []float64{1000, 1000}, []int{1, 2}, []float64{16, -16}},
+		{"even draw", []float64{1000, 1000}, []int{1, 1}, []float64{0, 0}},
+		{"favorite wins", []float64{1400, 1000}, []int{1, 2}, []float64{2.9, -2.9}},
+		{"underdog wins", []float64{1000, 1400}, []int{1, 2}, []float64{29.1, -29.1}},
+		{"even four", []float64{1000, 1000, 1000, 1000}, []int{1, 2, 3, 4}, []float64{16, 5.3, -5.3, -16}},
+		{"mixed four with a tie", []float64{1210, 980, 1500, 1000}, []int{2, 1, 4, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := ratingChanges(tt.ratings, tt.placements)
+			var sum float64
+			for _, change := range changes {
+				sum += change
+			}
+			if math.Abs(sum) > 1e-9 {
+				t.Fatalf("changes %v add up to %v, want 0", changes, sum)
+			}
+			for i, want := range tt.want {
+				if math.Abs(changes[i]-want) > 0.05 {
+					t.Fatalf("changes = %v, want %v", changes, tt.want)
+				}
+			}
+			if !slices.Equal(ratingChanges(tt.ratings, tt.placements), changes) {
+				t.Fatal("the same result rated differently the second time")
+			}
+		})
+	}
+}
+
+// The same result over and over moves the ratings less each time: the
+// winner is ever more expected to win.
+func TestRatingsSettle(t *testing.T) {
+	ratings := []float64{1000, 1000, 1000}
+	placements := []int{1, 2, 3}
+	gain := math.Inf(1)
+	for range 50 {
+		changes := ratingChanges(ratings, placements)
+		if changes[0] <= 0 || changes[0] >= gain {
+			t.Fatalf("winner gained %v after gaining %v", changes[0], gain)
+		}
+		gain = changes[0]
+		for i := range ratings {
+			ratings[i] += changes[i]
+		}
+	}
+	if sum := ratings[0] + ratings[1] + ratings[2]; math.Abs(sum-3000) > 1e-6 {
+		t.Fatalf("ratings %v add up to %v, want 3000", ratings, sum)
+	}
+}
+
+// Only registered accounts are rated, and only against each other: a guest
+// or a player without an account in the match changes nothing.
+func TestRateMatch(t *testing.T) {
+	useTestDB(t)
+	alice, _ := newAccount(t, "alice")
+	bob, _ := newAccount(t, "bob")
+	if err := db.Model(&bob).Update("rating", 1200).Error; err != nil {
+		t.Fatal(err)
+	}
+	guest := models.Player{Name: "Guest000001", Guest: true, Rating: models.DefaultRating}
+	if err := db.Create(&guest).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	standings := []Standing{
+		{PlayerID: "g", AccountID: guest.ID, Guest: true, Placement: 1},
+		{PlayerID: "a", AccountID: alice.ID, Placement: 2},
+		{PlayerID: "n", Placement: 3},
+		{PlayerID: "b", AccountID: bob.ID, Placement: 4},
+	}
+	match := models.Match{Results: make([]models.MatchResult, len(standings))}
+	for i, standing := range standings {
+		match.Results[i] = models.MatchResult{AccountID: standing.AccountID, PlayerID: standing.PlayerID, Placement: standing.Placement}
+	}
+	if err := rateMatch(db, &match, standings); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ratingChanges([]float64{models.DefaultRating, 1200}, []int{2, 4})
+	for i, expected := range []struct {
+		delta, rating float64
+	}{
+		{0, 0},
+		{want[0], models.DefaultRating + want[0]},
+		{0, 0},
+		{want[1], 1200 + want[1]},
+	} {
+		if result := match.Results[i]; result.RatingDelta != expected.delta || result.Rating != expected.rating {
+			t.Errorf("%s rated %v by %v, want %v by %v", result.PlayerID, result.Rating, result.RatingDelta, expected.rating, expected.delta)
+		}
+	}
+	for _, account := range []struct {
+		id     uint
+		rating float64
+	}{
+		{alice.ID, models.DefaultRating + want[0]},
+		{bob.ID, 1200 + want[1]},
+		{guest.ID, models.DefaultRating},
+	} {
+		var stored models.Player
+		if err := db.First(&stored, account.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.Rating != account.rating {
+			t.Errorf("%s's stored rating is %v, want %v", stored.Name, stored.Rating, account.rating)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"sync"
+	"time"
+)
+
+// reconnectGrace is how long a disconnected player keeps their seat and
+// territory in a room before being removed for good.
+const reconnectGrace = 45 * time.Second
+
+var errNoSession = &JoinError{Code: "NO_SESSION", CloseCode: closeNoSession, Message: "no session to resume"}
+
+var (
+	awaitingMutex sync.Mutex
+	awaiting      = make(map[string]*Player)
+)
+
+// holdForReconnect keeps a player whose connection dropped in their room for
+// reconnectGrace, so they can resume with the token from their initial state.
+// It reports false when the player should be removed right away instead:
+// they were kicked or disconnected for being AFK, or the room is over.
+func holdForReconnect(player *Player, room *Room, conn Transport) bool {
+	held := false
+	room.do(func() {
+		if player.Evicted || room.Closed || room.Phase == PhaseFinished || player.Conn != conn {
+			return
+		}
+
+		player.Conn = nil
+		player.reconnectTimer = time.AfterFunc(reconnectGrace, func() {
+			expireHold(player)
+		})
+
+		awaitingMutex.Lock()
+		awaiting[player.ID] = player
+		awaitingMutex.Unlock()
+
+		broadcastMessage(room, Message{Type: "playerDisconnected", Payload: PlayerPayload{PlayerID: player.ID, Name: player.Name}})
+		log.Printf("Holding %s's seat in room %s for %v", player.ID, room.ID, reconnectGrace)
+		held = true
+	})
+	return held
+}
+
+// expireHold removes a held player who did not come back in time.
+func expireHold(player *Player) {
+	awaitingMutex.Lock()
+	_, held := awaiting[player.ID]
+	delete(awaiting, player.ID)
+	awaitingMutex.Unlock()
+
+	room := player.Room.Load()
+	if !held || room == nil {
+		return
+	}
+	log.Printf("Reconnection grace for %s expired", player.ID)
+	removePlayer(player, room)
+	queue.Release()
+}
+
+// dropHold ends a held player's grace period early, e.g. when they are kicked
+// while away. It must run on the room's goroutine.
+func dropHold(player *Player) {
+	if player.reconnectTimer != nil && player.reconnectTimer.Stop() {
+		go expireHold(player)
+	}
+}
+
+// resumePlayer reattaches conn to the seat held for playerID, provided the
+// token matches the one issued when the player first joined, and catches the
+// player up on what they missed.
+func resumePlayer(conn Transport, playerID, token string, lastEventID uint64) (*Player, error) {
+	awaitingMutex.Lock()
+	player, ok := awaiting[playerID]
+	if ok && subtle.ConstantTimeCompare([]byte(player.Token), []byte(token)) == 1 {
+		delete(awaiting, playerID)
+	} else {
+		ok = false
+	}
+	awaitingMutex.Unlock()
+
+	if !ok {
+		return nil, errNoSession
+	}
+
+	room := player.Room.Load()
+
+	resumed := room.do(func() {
+		player.reconnectTimer.Stop()
+		player.reconnectTimer = nil
+		player.Conn = conn
+		player.LastActivity = time.Now()
+		player.AFKWarnedAt = time.Time{}
+		resetChatRate(player)
+
+		if lastEventID == 0 {
+			sendInitialState(player)
+		} else {
+			replayEvents(player, room, lastEventID)
+		}
+		broadcastMessage(room, Message{Type: "playerReconnected", Payload: PlayerPayload{PlayerID: player.ID, Name: player.Name}})
+
+		log.Printf("Player %s reconnected to room %s", player.ID, room.ID)
+	})
+	if !resumed {
+		// The room closed while they were away, and the hold taken from
+		// awaiting was all that would have given up their slot.
+		queue.Release()
+		return nil, errNoSession
+	}
+	return player, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// A player coming back to a room that closed while they were away is turned
+// away, and the slot they held goes to the next player.
+func TestResumeToAClosedRoom(t *testing.T) {
+	q, players := testQueue(t, 0, 1, 1)
+	player := players[0]
+	player.Token = "token"
+	q.Enqueue(player)
+	room := player.Room.Load()
+	if room == nil || !holdForReconnect(player, room, nil) {
+		t.Fatal("the player's seat wasn't held")
+	}
+	t.Cleanup(func() { player.reconnectTimer.Stop() })
+	closeRoom(room)
+
+	if _, err := resumePlayer(nil, player.ID, player.Token, 0); err != errNoSession {
+		t.Fatalf("resume = %v, want %v", err, errNoSession)
+	}
+	if !q.TryAdmit() {
+		t.Fatal("the player's slot wasn't given up")
+	}
+	expireHold(player)
+	if q.TryAdmit() {
+		t.Fatal("the player's slot was given up twice")
+	}
+}
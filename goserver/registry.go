@@ -0,0 +1,83 @@
+package main
+
+import "sync"
+
+// PlayerRegistry indexes every connected player by ID, whether they are in
+// a room, queued or still in the lobby, and players signed in to an account
+// by account ID.
+type PlayerRegistry struct {
+	mu        sync.RWMutex
+	byID      map[string]*Player
+	byAccount map[uint]*Player
+}
+
+var connected = &PlayerRegistry{
+	byID:      make(map[string]*Player),
+	byAccount: make(map[uint]*Player),
+}
+
+// Add registers a new connection and tells the account's friends it is
+// online.
+func (r *PlayerRegistry) Add(player *Player) {
+	r.mu.Lock()
+	r.byID[player.ID] = player
+	if player.AccountID != 0 {
+		r.byAccount[player.AccountID] = player
+	}
+	r.mu.Unlock()
+
+	if player.AccountID != 0 {
+		notifyFriends(player, "friendOnline")
+	}
+}
+
+// Remove unregisters a connection and tells the account's friends it went
+// offline, unless the account has already reconnected elsewhere.
+func (r *PlayerRegistry) Remove(player *Player) {
+	r.mu.Lock()
+	if r.byID[player.ID] == player {
+		delete(r.byID, player.ID)
+	}
+	offline := player.AccountID != 0 && r.byAccount[player.AccountID] == player
+	if offline {
+		delete(r.byAccount, player.AccountID)
+	}
+	r.mu.Unlock()
+
+	if offline {
+		notifyFriends(player, "friendOffline")
+	}
+}
+
+func (r *PlayerRegistry) ByAccount(accountID uint) *Player {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.byAccount[accountID]
+}
+
+// List returns the players connected at the time of the call.
+func (r *PlayerRegistry) List() []*Player {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*Player, 0, len(r.byID))
+	for _, player := range r.byID {
+		list = append(list, player)
+	}
+	return list
+}
+
+func (r *PlayerRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.byID)
+}
+
+func (r *PlayerRegistry) Get(id string) *Player {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.byID[id]
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"land/protocol"
+)
+
+// A seated player's join message renames them while the room's goroutine
+// reads every name for its state.
+func TestRenameWhileTheRoomReadsNames(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			alice.Join(fmt.Sprintf("alice %d", i))
+		}
+	}()
+	for range 50 {
+		expectStatus(t, serveRequest(t, http.MethodGet, "/rooms/"+room.ID+"/state", "", ""), http.StatusOK)
+	}
+	<-done
+
+	// The pong comes after every rename has been handled.
+	alice.Send("ping", protocol.PingPayload{ClientTime: 1})
+	alice.ExpectMessage("pong", expectTimeout)
+	var state struct{ Players []PlayerState }
+	decodeBody(t, serveRequest(t, http.MethodGet, "/rooms/"+room.ID+"/state", "", ""), &state)
+	if len(state.Players) != 1 || state.Players[0].Name != "alice 49" {
+		t.Fatalf("players = %+v, want alice 49", state.Players)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+)
+
+// tick advances the test clock by one game tick and waits for the room to
+// have run it.
+func (s *testServer) tick(t *testing.T, room *Room) {
+	t.Helper()
+	elapsed := func() (d time.Duration) {
+		room.do(func() { d = room.Match.Elapsed() })
+		return d
+	}
+	before := elapsed()
+	s.Clock.Advance(gameInterval)
+	for deadline := time.Now().Add(expectTimeout); elapsed() == before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("room %s didn't tick", room.ID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// The game loop, the joiners' connections and the room's goroutine all
+// touch the room while it ticks; only the room's goroutine may change it.
+func TestTicksWhilePlayersJoin(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	server.startMatch(t, alice)
+
+	joiners := make([]*wstest.Client, maxPlayers-1)
+	for i := range joiners {
+		joiners[i] = wstest.Dial(t, server.URL+"/ws")
+	}
+	var wg sync.WaitGroup
+	for i, joiner := range joiners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			joiner.JoinRoom(fmt.Sprintf("joiner %d", i), room.ID)
+		}()
+	}
+	for range 5 {
+		server.tick(t, room)
+	}
+	wg.Wait()
+
+	for _, joiner := range joiners {
+		joiner.ExpectMessage("gameState", expectTimeout)
+	}
+	// Whoever joined after the last tick is spawned by the next.
+	server.tick(t, room)
+	var playing int
+	room.do(func() { playing = len(room.roster()) })
+	if playing != maxPlayers {
+		t.Fatalf("%d players in the match, want %d", playing, maxPlayers)
+	}
+}
+
+// Joiners racing for a room's last places each either get one or are turned
+// away; the room never takes more than it has room for.
+func TestJoinsRaceForTheLastPlaces(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+
+	joiners := make([]*wstest.Client, 2*maxPlayers)
+	for i := range joiners {
+		joiners[i] = wstest.Dial(t, server.URL+"/ws")
+	}
+	var wg sync.WaitGroup
+	for i, joiner := range joiners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			joiner.JoinRoom(fmt.Sprintf("joiner %d", i), room.ID)
+		}()
+	}
+	wg.Wait()
+
+	var seated int
+	for _, joiner := range joiners {
+		switch msg := firstOf(t, joiner, "gameState", "error"); msg.Type {
+		case "gameState":
+			seated++
+		case "error":
+			var e ErrorPayload
+			if err := msg.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			// Filling the room starts its countdown, which may turn away
+			// whoever comes next before it is seen to be full.
+			if e.Code != errRoomFull.Code && e.Code != errGameStarted.Code {
+				t.Fatalf("joiner turned away with %s", e.Code)
+			}
+		}
+	}
+	var players int
+	room.do(func() { players = len(room.Players) })
+	if seated != maxPlayers || players != maxPlayers {
+		t.Fatalf("%d joiners seated and %d players in the room, want %d", seated, players, maxPlayers)
+	}
+}
+
+// firstOf waits for the client's first message of any of the types.
+func firstOf(t *testing.T, client *wstest.Client, types ...string) wstest.Message {
+	t.Helper()
+	for deadline := time.Now().Add(expectTimeout); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, msg := range client.Messages() {
+			if slices.Contains(types, msg.Type) {
+				return msg
+			}
+		}
+	}
+	t.Fatalf("none of %v within %v", types, expectTimeout)
+	return wstest.Message{}
+}
+
+// rosterIDs is the IDs of the players in the client's latest gameState, in
+// the order it lists them.
+func rosterIDs(t *testing.T, client *wstest.Client) []string {
+	t.Helper()
+	var ids []string
+	for _, player := range lastState(t, client).GameState.Players {
+		ids = append(ids, player.ID)
+	}
+	return ids
+}
+
+// The roster broadcast every tick is the room's players as they stand: a
+// player whose seat is held stays on it, one who is gone for good drops off
+// it, and a late joiner is on it from the tick that spawns them.
+func TestBroadcastRoster(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	carol := server.join(t, room, "carol")
+	aliceID, bobID, carolID := playerID(t, alice), playerID(t, bob), playerID(t, carol)
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	server.startMatch(t, alice)
+
+	expectRoster := func(when string, want ...string) {
+		t.Helper()
+		server.tick(t, room)
+		if got := rosterIDs(t, alice); !slices.Equal(got, want) {
+			t.Fatalf("%s the roster is %v, want %v", when, got, want)
+		}
+	}
+	expectRoster("at the start", aliceID, bobID, carolID)
+
+	carol.Close()
+	alice.ExpectMessage("playerDisconnected", expectTimeout)
+	expectRoster("with carol's seat held", aliceID, bobID, carolID)
+
+	room.do(func() { dropHold(room.Players[carolID]) })
+	alice.ExpectMessage("playerLeft", expectTimeout)
+	expectRoster("once carol is gone", aliceID, bobID)
+
+	dave := server.join(t, room, "dave")
+	expectRoster("once dave joins", aliceID, bobID, playerID(t, dave))
+}
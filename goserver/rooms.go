@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// retiredRetention is how long the ID of a room that has closed is
+// remembered, so requests for it can tell a finished room from one that
+// never existed.
+const retiredRetention = 10 * time.Minute
+
+// RoomManager owns the live rooms. Its lock only guards the maps: a room's
+// own state belongs to the room's goroutine, which may call the manager but
+// is never waited on while holding the manager's lock.
+type RoomManager struct {
+	mu      sync.RWMutex
+	rooms   map[string]*Room
+	retired map[string]time.Time
+}
+
+var rooms = &RoomManager{
+	rooms:   make(map[string]*Room),
+	retired: make(map[string]time.Time),
+}
+
+// Create registers a new empty room under an unused ID, unless there are
+// already maxRooms rooms, in which case it returns nil. A maxRooms of 0 is
+// unlimited.
+func (m *RoomManager) Create(maxRooms int) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.create(maxRooms)
+}
+
+// create registers a new room if maxRooms allows it. m.mu must be held.
+func (m *RoomManager) create(maxRooms int) *Room {
+	if maxRooms > 0 && len(m.rooms) >= maxRooms {
+		return nil
+	}
+	id := generateRoomID()
+	for m.rooms[id] != nil {
+		id = generateRoomID()
+	}
+	room := newRoom(id)
+	m.rooms[id] = room
+	delete(m.retired, id)
+	return room
+}
+
+func (m *RoomManager) Get(id string) (*Room, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	return room, ok
+}
+
+// Delete unregisters the room, unless its ID already belongs to another,
+// and remembers it as retired for retiredRetention.
+func (m *RoomManager) Delete(room *Room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rooms[room.ID] != room {
+		return
+	}
+	delete(m.rooms, room.ID)
+
+	now := time.Now()
+	for id, at := range m.retired {
+		if now.Sub(at) >= retiredRetention {
+			delete(m.retired, id)
+		}
+	}
+	m.retired[room.ID] = now
+}
+
+// Retired reports whether a room with this ID closed within the last
+// retiredRetention.
+func (m *RoomManager) Retired(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	at, ok := m.retired[id]
+	return ok && time.Since(at) < retiredRetention
+}
+
+// List returns the rooms registered at the time of the call, so callers can
+// visit each room in turn without holding up the manager.
+func (m *RoomManager) List() []*Room {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		list = append(list, room)
+	}
+	return list
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+)
+
+// testRooms replaces the room manager with an empty one, on a test clock,
+// until the test ends, closing whatever rooms it has then.
+func testRooms(t testing.TB) {
+	t.Helper()
+	setForTest(t, &roomClock, Clock(wstest.NewClock(time.Now())))
+	setForTest(t, &rooms, &RoomManager{rooms: make(map[string]*Room), retired: make(map[string]time.Time)})
+	t.Cleanup(func() {
+		for _, room := range rooms.List() {
+			closeRoom(room)
+		}
+	})
+}
+
+// Connections create, find and list rooms while rooms retire themselves from
+// their own goroutines; the manager's lock keeps its maps consistent.
+func TestRoomManagerConcurrently(t *testing.T) {
+	testRooms(t)
+
+	const workers, rounds = 8, 20
+	var (
+		mu     sync.Mutex
+		seen   = make(map[*Room]bool)
+		closed = make(map[*Room]bool)
+		wg     sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				room := rooms.Create(0)
+				if got, ok := rooms.Get(room.ID); !ok || got != room {
+					t.Errorf("Get(%s) = %v, %v right after Create", room.ID, got, ok)
+				}
+				found := rooms.FindOpenRoom([]*Player{{}}, 0, 0)
+				if found == nil {
+					t.Errorf("FindOpenRoom found nothing, with no room limit")
+					continue
+				}
+				rooms.List()
+
+				mu.Lock()
+				seen[room], seen[found] = true, true
+				mu.Unlock()
+
+				if i%2 == 0 {
+					continue
+				}
+				closeRoom(room)
+				if _, ok := rooms.Get(room.ID); ok {
+					t.Errorf("room %s is still registered once closed", room.ID)
+				}
+				if !rooms.Retired(room.ID) {
+					t.Errorf("room %s isn't retired once closed", room.ID)
+				}
+				mu.Lock()
+				closed[room] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	listed := rooms.List()
+	if want := len(seen) - len(closed); len(listed) != want {
+		t.Fatalf("%d rooms listed, want the %d seen and not closed", len(listed), want)
+	}
+	for _, room := range listed {
+		if !seen[room] || closed[room] || rooms.Retired(room.ID) {
+			t.Errorf("room %s is listed: seen %v, closed %v, retired %v", room.ID, seen[room], closed[room], rooms.Retired(room.ID))
+		}
+	}
+}
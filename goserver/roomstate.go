@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoomState is a room as GET /rooms/:id/state shows it, for debugging and
+// lobby previews. Board is only filled in when asked for with ?board=1.
+type RoomState struct {
+	ID         string        `json:"id"`
+	Phase      Phase         `json:"phase"`
+	Players    []PlayerState `json:"players"`
+	Spectators int           `json:"spectators"`
+	Remaining  int           `json:"remaining"`
+	EndsAt     int64         `json:"endsAt"`
+	Board      [][]string    `json:"board,omitempty"`
+}
+
+// roomStateHandler serves the room's current state. The room is read on its
+// goroutine between ticks; the board, the one large part, is copied there
+// and encoded after. A private room is only shown given its join code as
+// ?code=, and is otherwise reported missing, as it is to players joining.
+func roomStateHandler(c *gin.Context) {
+	id := c.Param("id")
+	room, ok := rooms.Get(id)
+	if !ok {
+		roomGone(c, id)
+		return
+	}
+	withBoard := c.Query("board") == "1"
+	joinCode := c.Query("code")
+
+	var state RoomState
+	hidden := false
+	if !room.do(func() {
+		if room.Private && joinCode != room.JoinCode {
+			hidden = true
+			return
+		}
+		state = RoomState{
+			ID:         room.ID,
+			Phase:      room.Phase,
+			Players:    stateView(room).Players,
+			Spectators: len(room.Spectators),
+			Remaining:  int(room.remaining().Seconds()),
+			EndsAt:     room.endsAt(),
+		}
+		if withBoard {
+			state.Board = make([][]string, len(room.GameState.Board))
+			for y, row := range room.GameState.Board {
+				state.Board[y] = append([]string(nil), row...)
+			}
+		}
+	}) {
+		roomGone(c, id)
+		return
+	}
+	if hidden {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// roomGone answers for a room that isn't running: 410 if it closed
+// recently, 404 otherwise.
+func roomGone(c *gin.Context, id string) {
+	if rooms.Retired(id) {
+		c.JSON(http.StatusGone, gin.H{"error": "Room has closed"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+}
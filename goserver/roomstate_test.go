@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"land/pb"
+)
+
+// A private room's state is only shown to whoever has its join code.
+func TestPrivateRoomState(t *testing.T) {
+	startServer(t)
+	w := serveRequest(t, http.MethodPost, "/rooms", "", `{"private": true}`)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID   string `json:"roomID"`
+		JoinCode string `json:"joinCode"`
+	}
+	decodeBody(t, w, &created)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"without the code", "", http.StatusNotFound},
+		{"with a wrong code", "?code=wrong", http.StatusNotFound},
+		{"with the code", "?code=" + created.JoinCode, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveRequest(t, http.MethodGet, "/rooms/"+created.RoomID+"/state"+tt.query, "", "")
+			expectStatus(t, w, tt.status)
+		})
+	}
+}
+
+// The gRPC API shows a private room's state on the same terms.
+func TestPrivateRoomStateOverGRPC(t *testing.T) {
+	startServer(t)
+	w := serveRequest(t, http.MethodPost, "/rooms", "", `{"private": true}`)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID   string `json:"roomID"`
+		JoinCode string `json:"joinCode"`
+	}
+	decodeBody(t, w, &created)
+
+	tests := []struct {
+		name     string
+		joinCode string
+		code     codes.Code
+	}{
+		{"without the code", "", codes.NotFound},
+		{"with a wrong code", "wrong", codes.NotFound},
+		{"with the code", created.JoinCode, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := landServer{}.GetRoomState(context.Background(), &pb.GetRoomStateRequest{
+				RoomId:   created.RoomID,
+				JoinCode: tt.joinCode,
+			})
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("got %v, want %v", got, tt.code)
+			}
+			if err == nil && state.GetRoomId() != created.RoomID {
+				t.Errorf("got the state of room %q, want %q", state.GetRoomId(), created.RoomID)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// startMatch has the host start the room's game, runs the countdown on the
+// test clock and then the first tick, and returns the state it sent the
+// host. Clients that asked for deltas get one from the next tick on, so the
+// positionUpdates queued ahead of it aren't superseded by a snapshot, as
+// long as the test has put off the deltas' periodic snapshot.
+func (s *testServer) startMatch(t *testing.T, host *wstest.Client) *protocol.StateView {
+	t.Helper()
+	host.Send("start", struct{}{})
+	host.ExpectMessage("gameStarting", expectTimeout)
+	// The room waits on its lobby timer, which it has stopped listening to,
+	// and on the countdown; then on the lobby timer and the tick.
+	if !s.Clock.WaitForTimers(2, expectTimeout) {
+		t.Fatal("the countdown never started")
+	}
+	s.Clock.Advance(countdownDuration)
+	if !s.Clock.WaitForTimers(2, expectTimeout) {
+		t.Fatal("the game never started ticking")
+	}
+	s.Clock.Advance(gameInterval)
+	var state protocol.GameStatePayload
+	if err := host.ExpectMessage("gameState", expectTimeout).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state.GameState
+}
+
+// move has the client move one cell on the next tick, runs the tick and
+// returns where everyone was told the client moved to.
+func (s *testServer) move(t *testing.T, mover *wstest.Client, direction string, everyone ...*wstest.Client) protocol.PositionPayload {
+	t.Helper()
+	mover.Move(direction)
+	// Messages are handled in order, so the move is queued by the time the
+	// pong comes back.
+	mover.Send("ping", protocol.PingPayload{ClientTime: 1})
+	mover.ExpectMessage("pong", expectTimeout)
+	s.Clock.Advance(gameInterval)
+
+	var seen []protocol.PositionPayload
+	for _, client := range everyone {
+		var position protocol.PositionPayload
+		if err := client.ExpectMessage("positionUpdate", expectTimeout).Decode(&position); err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) > 0 && position != seen[0] {
+			t.Fatalf("players saw different moves: %+v and %+v", seen[0], position)
+		}
+		seen = append(seen, position)
+	}
+	return seen[0]
+}
+
+// awayFromEdge is the direction along x with the most room ahead of a
+// player standing at x.
+func awayFromEdge(x int) string {
+	if x < boardSize/2 {
+		return "right"
+	}
+	return "left"
+}
+
+func findPlayer(t *testing.T, state *protocol.StateView, id string) protocol.PlayerState {
+	t.Helper()
+	for _, player := range state.Players {
+		if player.ID == id {
+			return player
+		}
+	}
+	t.Fatalf("player %s isn't in %+v", id, state.Players)
+	return protocol.PlayerState{}
+}
+
+func TestTwoPlayersJoin(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+
+	var joined protocol.PlayerJoinedPayload
+	if err := alice.ExpectMessage("playerJoined", expectTimeout).Decode(&joined); err != nil {
+		t.Fatal(err)
+	}
+	if joined.PlayerID != playerID(t, bob) || joined.Name != "bob" {
+		t.Fatalf("alice saw %+v join, want bob", joined)
+	}
+
+	// Bob's first state, which join waited for, already has alice in it.
+	var state protocol.GameStatePayload
+	for _, msg := range bob.Messages() {
+		if msg.Type == "gameState" {
+			if err := msg.Decode(&state); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if got := findPlayer(t, state.GameState, playerID(t, alice)); got.Name != "alice" {
+		t.Fatalf("bob sees alice as %q", got.Name)
+	}
+}
+
+func TestMovesAreBroadcast(t *testing.T) {
+	setForTest(t, &snapshotInterval, time.Hour)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice", "delta")
+	bob := server.join(t, room, "bob", "delta")
+
+	from := findPlayer(t, server.startMatch(t, alice), playerID(t, alice))
+	direction := awayFromEdge(from.X)
+	step := 1
+	if direction == "left" {
+		step = -1
+	}
+
+	for i := 1; i <= 3; i++ {
+		position := server.move(t, alice, direction, alice, bob)
+		want := protocol.PositionPayload{PlayerID: from.ID, X: from.X + i*step, Y: from.Y, Seq: position.Seq}
+		if position != want {
+			t.Fatalf("move %d: everyone saw %+v, want %+v", i, position, want)
+		}
+	}
+}
+
+func TestChatArrives(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+
+	bob.Chat("good luck")
+	for _, client := range []*wstest.Client{alice, bob} {
+		var chat ChatMessagePayload
+		if err := client.ExpectMessage("chat", expectTimeout).Decode(&chat); err != nil {
+			t.Fatal(err)
+		}
+		if chat.PlayerID != playerID(t, bob) || chat.Name != "bob" || chat.Message != "good luck" {
+			t.Fatalf("got chat %+v, want bob's good luck", chat)
+		}
+	}
+}
+
+func TestGameEndsWithAWinner(t *testing.T) {
+	setForTest(t, &snapshotInterval, time.Hour)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	room.do(func() { room.Settings.Duration = 30 })
+	alice := server.join(t, room, "alice", "delta")
+	bob := server.join(t, room, "bob", "delta")
+
+	// Alice walks out of her starting territory, claiming a cell a tick,
+	// until she has more than the nine cells bob can have at most.
+	from := findPlayer(t, server.startMatch(t, alice), playerID(t, alice))
+	for range 10 {
+		server.move(t, alice, awayFromEdge(from.X), alice, bob)
+	}
+
+	// The next tick finds time is up.
+	server.Clock.Advance(30 * time.Second)
+	for _, client := range []*wstest.Client{alice, bob} {
+		var over protocol.GameOverPayload
+		if err := client.ExpectMessage("gameOver", expectTimeout).Decode(&over); err != nil {
+			t.Fatal(err)
+		}
+		if over.Winner == nil || over.Winner.ID != from.ID {
+			t.Fatalf("winner = %+v, want alice", over.Winner)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"land/models"
+)
+
+const (
+	// seasonCheckInterval is how often seasons are checked for having
+	// ended.
+	seasonCheckInterval = time.Minute
+
+	// seasonSettle is how long after a season ends its standings are
+	// snapshotted. Matches belong to the season they started in, so games
+	// still running when it ends go on counting for it until then.
+	seasonSettle = time.Hour
+)
+
+// seasonLength is how long each season runs, set by flag.
+var seasonLength = 30 * 24 * time.Hour
+
+// runSeasons starts the first season if there is none, then ends seasons as
+// they run out, starting the next, and snapshots the standings of those
+// that have settled.
+func runSeasons() {
+	ticker := time.NewTicker(seasonCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if err := rolloverSeason(now); err != nil {
+			log.Printf("Failed to start the next season: %v", err)
+		}
+		if err := finalizeSeasons(now); err != nil {
+			log.Printf("Failed to snapshot season standings: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// latestSeason is the season started last, which is the current one.
+func latestSeason(tx *gorm.DB) (models.Season, error) {
+	var season models.Season
+	err := tx.Order("start_at DESC").Order("id DESC").First(&season).Error
+	return season, err
+}
+
+// rolloverSeason starts the next season if the current one has ended, or
+// the first if there is none. A server that was down for a whole season or
+// more starts the next one now rather than filling the gap with empty
+// seasons.
+func rolloverSeason(now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		current, err := latestSeason(tx)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return startSeason(tx, now)
+		case err != nil:
+			return err
+		case now.Before(current.EndAt):
+			return nil
+		}
+		start := current.EndAt
+		if now.Sub(start) >= seasonLength {
+			start = now
+		}
+		return startSeason(tx, start)
+	})
+}
+
+// closeSeason ends the current season now and starts the next, returning
+// the season it ended.
+func closeSeason(now time.Time) (models.Season, error) {
+	var closed models.Season
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		closed, err = latestSeason(tx)
+		if err != nil {
+			return err
+		}
+		if now.Before(closed.EndAt) {
+			closed.EndAt = now
+			if err := tx.Model(&closed).Update("end_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return startSeason(tx, now)
+	})
+	return closed, err
+}
+
+// startSeason starts a season of seasonLength at start.
+func startSeason(tx *gorm.DB, start time.Time) error {
+	var count int64
+	if err := tx.Model(&models.Season{}).Count(&count).Error; err != nil {
+		return err
+	}
+	season := models.Season{
+		Name:    fmt.Sprintf("Season %d", count+1),
+		StartAt: start,
+		EndAt:   start.Add(seasonLength),
+	}
+	if err := tx.Create(&season).Error; err != nil {
+		return err
+	}
+	log.Printf("Started %s, until %s", season.Name, season.EndAt.Format(time.RFC3339))
+	return nil
+}
+
+// finalizeSeasons snapshots the standings of the seasons that ended at
+// least seasonSettle ago into SeasonResults.
+func finalizeSeasons(now time.Time) error {
+	var seasons []models.Season
+	if err := db.Where("final = ? AND end_at <= ?", false, now.Add(-seasonSettle)).Find(&seasons).Error; err != nil {
+		return err
+	}
+	for _, season := range seasons {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var scores []models.SeasonScore
+			err := tx.Where("season_id = ?", season.ID).Order("score DESC").Order("account_id ASC").Find(&scores).Error
+			if err != nil {
+				return err
+			}
+			results := make([]models.SeasonResult, len(scores))
+			for i, score := range scores {
+				rank := i + 1
+				if i > 0 && score.Score == scores[i-1].Score {
+					rank = results[i-1].Rank
+				}
+				results[i] = models.SeasonResult{
+					SeasonID:  season.ID,
+					AccountID: score.AccountID,
+					Rank:      rank,
+					Score:     score.Score,
+					Games:     score.Games,
+					Wins:      score.Wins,
+					Rating:    score.Rating,
+				}
+			}
+			if len(results) > 0 {
+				if err := tx.CreateInBatches(results, 500).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&season).Update("final", true).Error
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Snapshotted the standings of %s", season.Name)
+	}
+	return nil
+}
+
+// seasonAt is the ID of the season a match that started at t belongs to,
+// or zero if there was none.
+func seasonAt(tx *gorm.DB, t time.Time) (uint, error) {
+	var season models.Season
+	err := tx.Where("start_at <= ? AND end_at > ?", t, t).Order("start_at DESC").First(&season).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return season.ID, err
+}
+
+// addSeasonScores adds a recorded match to the season scores of every
+// account in it.
+func addSeasonScores(tx *gorm.DB, match models.Match) error {
+	if match.SeasonID == 0 {
+		return nil
+	}
+	for _, result := range match.Results {
+		if result.AccountID == 0 {
+			continue
+		}
+		score := models.SeasonScore{
+			SeasonID:  match.SeasonID,
+			AccountID: result.AccountID,
+			Score:     result.Score,
+			Games:     1,
+			Rating:    result.Rating,
+		}
+		if result.Winner {
+			score.Wins = 1
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "season_id"}, {Name: "account_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "score"}, Value: gorm.Expr("season_scores.score + excluded.score")},
+				{Column: clause.Column{Name: "games"}, Value: gorm.Expr("season_scores.games + excluded.games")},
+				{Column: clause.Column{Name: "wins"}, Value: gorm.Expr("season_scores.wins + excluded.wins")},
+				{Column: clause.Column{Name: "rating"}, Value: gorm.Expr("excluded.rating")},
+			},
+		}).Create(&score).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// debugCloseSeasonHandler ends the current season now and starts the next,
+// for operators, recording why from the reason parameter in the audit log.
+// Its standings are snapshotted once it has settled. It is served by the
+// debug server.
+func debugCloseSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		http.Error(w, "persistence is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	closed, err := closeSeason(time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "no season is running", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Closed %s", closed.Name)
+	audit(auditActor(r), "closeSeason", fmt.Sprintf("season:%d", closed.ID), r.URL.Query().Get("reason"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(closed)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+)
+
+// roomSeed, when set by a flag, seeds every new room with the same value
+// instead of a random one, to replay a room from its logged seed.
+var roomSeed int64
+
+// newRoomSeed picks the seed for a new room's random source.
+func newRoomSeed() int64 {
+	if roomSeed != 0 {
+		return roomSeed
+	}
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+// newRoomRand is the random source for a room seeded with seed. Everything
+// random about a room's games, where players spawn included, is drawn from
+// it, so a room given the same seed and the same inputs plays out the same.
+func newRoomRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// randomPosition picks a cell of the room's board. It must run on the room's
+// goroutine.
+func (room *Room) randomPosition() Position {
+	size := room.size()
+	return Position{X: room.rand.Intn(size), Y: room.rand.Intn(size)}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// frameClass is how a queued frame fares when its connection falls behind.
+type frameClass int
+
+const (
+	// classNormal frames are dropped only once the queue is at
+	// sendQueueSize.
+	classNormal frameClass = iota
+	// classUpdate frames, deltas and position updates, are dropped once the
+	// queue is past its high-water mark; the next snapshot covers them.
+	classUpdate
+	// classSnapshot frames are never dropped. Each one replaces the
+	// snapshots and updates still queued ahead of it, which it supersedes.
+	classSnapshot
+	// classCritical frames are never dropped.
+	classCritical
+)
+
+// classify is the class of a message type.
+func classify(msgType string) frameClass {
+	switch msgType {
+	case "stateDelta", "positionUpdate":
+		return classUpdate
+	case "gameState":
+		return classSnapshot
+	case "gameOver":
+		return classCritical
+	}
+	return classNormal
+}
+
+// highWater is the queue length past which updates are dropped and the
+// connection counts as saturated.
+func highWater() int {
+	return max(sendQueueSize/2, 1)
+}
+
+// sendQueue is a connection's outbound queue, shared by the goroutines that
+// send and drained by the connection's write pump. A connection that stays
+// saturated for slowClientGrace is dropped as too slow.
+type sendQueue[T any] struct {
+	mu        sync.Mutex
+	frames    []queuedFrame[T]
+	fullSince time.Time
+	stale     bool
+
+	// ready has a value in it while frames are queued.
+	ready chan struct{}
+}
+
+type queuedFrame[T any] struct {
+	frame T
+	class frameClass
+}
+
+func newSendQueue[T any]() *sendQueue[T] {
+	return &sendQueue[T]{ready: make(chan struct{}, 1)}
+}
+
+// push queues frame, or drops it as its class says. It reports whether the
+// connection has been saturated for longer than slowClientGrace.
+func (q *sendQueue[T]) push(frame T, class frameClass) (tooSlow bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if class == classSnapshot {
+		kept := q.frames[:0]
+		for _, f := range q.frames {
+			if f.class != classSnapshot && f.class != classUpdate {
+				kept = append(kept, f)
+			}
+		}
+		clear(q.frames[len(kept):])
+		q.frames = kept
+	}
+
+	dropped := false
+	switch {
+	case class == classUpdate && len(q.frames) >= highWater():
+		dropped = true
+		q.stale = true
+	case class == classNormal && len(q.frames) >= sendQueueSize:
+		dropped = true
+	default:
+		q.frames = append(q.frames, queuedFrame[T]{frame: frame, class: class})
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+
+	if !dropped && len(q.frames) < highWater() {
+		q.fullSince = time.Time{}
+		return false
+	}
+	if q.fullSince.IsZero() {
+		q.fullSince = time.Now()
+	}
+	return time.Since(q.fullSince) >= slowClientGrace
+}
+
+// saturatedFor is how long the queue has been saturated, zero if it isn't.
+func (q *sendQueue[T]) saturatedFor() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.fullSince.IsZero() {
+		return 0
+	}
+	return time.Since(q.fullSince)
+}
+
+// pop takes the oldest frame off the queue, if there is one.
+func (q *sendQueue[T]) pop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var frame T
+	if len(q.frames) == 0 {
+		return frame, false
+	}
+	frame = q.frames[0].frame
+	q.frames[0] = queuedFrame[T]{}
+	q.frames = q.frames[1:]
+	if len(q.frames) > 0 {
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+	return frame, true
+}
+
+// Len is how many frames are waiting.
+func (q *sendQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.frames)
+}
+
+// Stale reports whether an update was dropped since the last call.
+func (q *sendQueue[T]) Stale() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stale := q.stale
+	q.stale = false
+	return stale
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"land/protocol"
+)
+
+// A player's messages are numbered on their connection's goroutine while
+// the room's goroutine acknowledges them in everything it sends the player.
+func TestAckSeqWhileTheRoomBroadcasts(t *testing.T) {
+	// Alice is sent a pong and a chat per round, which must all fit in her
+	// send queue.
+	const rounds = 20
+	setForTest(t, &chatRate, 0)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range rounds {
+			bob.Chat("hello")
+		}
+	}()
+	for range rounds {
+		alice.Send("ping", protocol.PingPayload{ClientTime: 1})
+	}
+	<-done
+
+	// Alice's hello and join are messages 1 and 2.
+	for i := range rounds {
+		if ack := alice.ExpectMessage("pong", expectTimeout).AckSeq; ack != uint64(i+3) {
+			t.Fatalf("pong %d acknowledges message %d, want %d", i+1, ack, i+3)
+		}
+	}
+	for range rounds {
+		alice.ExpectMessage("chat", expectTimeout)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// expectTimeout is how long tests wait for a message before giving up.
+const expectTimeout = 5 * time.Second
+
+// testServer is the server's router under httptest, with its rooms running
+// on Clock, which only moves when the test advances it.
+type testServer struct {
+	*httptest.Server
+	Clock *wstest.Clock
+}
+
+// startServer serves the router until the test ends, then closes every room
+// left open and waits for every connection to be done with it, so the next
+// test starts clean.
+func startServer(t *testing.T) *testServer {
+	t.Helper()
+	clock := wstest.NewClock(time.Now())
+	saved := roomClock
+	roomClock = clock
+	router := newRouter()
+	var handlers sync.WaitGroup
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Add(1)
+		defer handlers.Done()
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		for _, room := range rooms.List() {
+			closeRoom(room)
+		}
+		handlers.Wait()
+		roomClock = saved
+	})
+	return &testServer{Server: server, Clock: clock}
+}
+
+// createRoom opens a public room through POST /rooms, with settings as its
+// JSON body, and returns it.
+func (s *testServer) createRoom(t *testing.T, settings string) *Room {
+	t.Helper()
+	w := serveRequest(t, http.MethodPost, "/rooms", "", settings)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID string `json:"roomID"`
+	}
+	decodeBody(t, w, &created)
+	room, ok := rooms.Get(created.RoomID)
+	if !ok {
+		t.Fatalf("room %s isn't registered", created.RoomID)
+	}
+	return room
+}
+
+// join connects a player, listing features in their hello, and seats them in
+// the room under name, returning their client once it has the room's state.
+func (s *testServer) join(t *testing.T, room *Room, name string, features ...string) *wstest.Client {
+	t.Helper()
+	client := wstest.Dial(t, s.URL+"/ws", features...)
+	client.JoinRoom(name, room.ID)
+	client.ExpectMessage("gameState", expectTimeout)
+	return client
+}
+
+// dialRaw opens a bare websocket to the server with dialer, for tests that
+// need more of a hand in the connection than a wstest.Client gives. Nothing
+// is sent on it; it is closed when the test ends.
+func (s *testServer) dialRaw(t *testing.T, dialer *websocket.Dialer) (*websocket.Conn, *http.Response) {
+	t.Helper()
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws, resp
+}
+
+// joinRaw says hello on a bare websocket and asks for a seat in the room
+// under name, without waiting for any reply.
+func joinRaw(t *testing.T, ws *websocket.Conn, room *Room, name string) {
+	t.Helper()
+	for _, msg := range []Message{
+		{Type: "hello", Payload: protocol.HelloPayload{Version: protocol.Version, Client: "test"}},
+		{Type: "join", Payload: protocol.JoinPayload{Name: name, RoomID: room.ID}},
+	} {
+		if err := ws.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// playerID is the ID the server gave the client, from its welcome.
+func playerID(t *testing.T, client *wstest.Client) string {
+	t.Helper()
+	var welcome struct {
+		PlayerID string `json:"playerID"`
+	}
+	if err := client.Welcome.Decode(&welcome); err != nil || welcome.PlayerID == "" {
+		t.Fatalf("no player ID in the welcome %s: %v", client.Welcome.Payload, err)
+	}
+	return welcome.PlayerID
+}
+
+// setForTest sets *v to value until the test ends.
+func setForTest[T any](t testing.TB, v *T, value T) {
+	saved := *v
+	*v = value
+	t.Cleanup(func() { *v = saved })
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"land/models"
+)
+
+const (
+	// sessionSweepInterval is how often expired sessions are deleted.
+	sessionSweepInterval = 10 * time.Minute
+
+	// lastSeenResolution is how stale a session's last-seen time may get
+	// before a request refreshes it, so busy clients don't write on every
+	// request.
+	lastSeenResolution = time.Minute
+)
+
+// ClientInfo describes the client a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// requestClient is the client an HTTP request came from.
+func requestClient(c *gin.Context) ClientInfo {
+	return ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+// hashToken is what a token is stored as.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession signs a token for the account and records its session,
+// returning the token and the session's ID. Without a database there is
+// only the token.
+func startSession(account models.Player, client ClientInfo) (string, uint, error) {
+	token, err := issueToken(account)
+	if err != nil || db == nil {
+		return token, 0, err
+	}
+	now := time.Now()
+	session := models.Session{
+		TokenHash:  hashToken(token),
+		AccountID:  account.ID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(tokenTTL),
+		LastSeenAt: now,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return "", 0, err
+	}
+	return token, session.ID, nil
+}
+
+// touchSession finds the live session a token belongs to and marks it as
+// seen.
+func touchSession(token string) (models.Session, error) {
+	var session models.Session
+	now := time.Now()
+	if err := db.Where("token_hash = ? AND expires_at > ?", hashToken(token), now).First(&session).Error; err != nil {
+		return session, err
+	}
+	if now.Sub(session.LastSeenAt) >= lastSeenResolution {
+		if err := db.Model(&session).Update("last_seen_at", now).Error; err != nil {
+			log.Printf("Failed to update session %d: %v", session.ID, err)
+		}
+	}
+	return session, nil
+}
+
+// runSessionSweeper deletes expired sessions every sessionSweepInterval.
+func runSessionSweeper() {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result := db.Where("expires_at <= ?", time.Now()).Delete(&models.Session{})
+		if result.Error != nil {
+			log.Printf("Failed to delete expired sessions: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired sessions", result.RowsAffected)
+		}
+	}
+}
+
+// revokeSessions deletes sessions and closes the connections signed in with
+// them. sessionID zero revokes all of the account's sessions.
+func revokeSessions(accountID, sessionID uint, reason string) (int64, error) {
+	query := db.Where("account_id = ?", accountID)
+	if sessionID != 0 {
+		query = query.Where("id = ?", sessionID)
+	}
+	result := query.Delete(&models.Session{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	disconnectPlayers(func(p *Player) bool {
+		return p.AccountID == accountID && (sessionID == 0 || p.SessionID == sessionID)
+	}, closeSessionRevoked, reason)
+	return result.RowsAffected, nil
+}
+
+// logoutHandler ends the request's session, or with all=true every session
+// of its account, closing any game connected with them.
+func logoutHandler(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+	all, ok := queryBool(c, "all", false)
+	if !ok {
+		return
+	}
+	sessionID := account.SessionID
+	if all {
+		sessionID = 0
+	}
+	if _, err := revokeSessions(account.ID, sessionID, "logged out"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// debugRevokeHandler revokes every session of an account, for operators
+// dealing with a compromised one, recording why from the reason parameter
+// in the audit log. It is served by the debug server.
+func debugRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "invalid account ID", http.StatusBadRequest)
+		return
+	}
+	if db == nil {
+		http.Error(w, "persistence is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	revoked, err := revokeSessions(uint(id), 0, "session revoked")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Revoked %d sessions of account %d", revoked, id)
+	audit(auditActor(r), "revokeSessions", "account:"+strconv.FormatUint(id, 10), r.URL.Query().Get("reason"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"land/internal/game"
+	"land/protocol"
+)
+
+// Steal rules decide whether players may claim cells owned by someone else.
+const (
+	StealAllowed   = "allowed"
+	StealForbidden = "forbidden"
+)
+
+// Chat filter policies decide what happens to chat messages with filtered
+// words in them: the words are starred out, or the message is refused.
+const (
+	ChatFilterMask   = "mask"
+	ChatFilterReject = "reject"
+)
+
+// Spectator team chat policies decide whether spectators get to see team
+// chat once the game is over, or never do.
+const (
+	SpectatorTeamChatAfterGame = "afterGame"
+	SpectatorTeamChatNever     = "never"
+)
+
+// Team modes decide whether everyone plays for themselves or players are
+// split between teams, each with a team chat of its own.
+const (
+	TeamModeSolo  = "solo"
+	TeamModeTeams = "teams"
+)
+
+// RoomSettings are the room's settings as the server handles them; see
+// protocol.RoomSettings.
+type RoomSettings protocol.RoomSettings
+
+func defaultSettings() RoomSettings {
+	return RoomSettings{
+		Duration:     int(gameDuration.Seconds()),
+		BoardSize:    boardSize,
+		MaxPlayers:   maxPlayers,
+		StealRule:    StealAllowed,
+		Mode:         "classic",
+		TickInterval: int(gameInterval.Milliseconds()),
+		ChatFilter:   ChatFilterMask,
+		TeamMode:     TeamModeSolo,
+
+		SpectatorTeamChat: SpectatorTeamChatAfterGame,
+	}
+}
+
+// tickInterval is the time between the room's game ticks.
+func (s RoomSettings) tickInterval() time.Duration {
+	return time.Duration(s.TickInterval) * time.Millisecond
+}
+
+// merge returns s with every non-zero field of update applied.
+func (s RoomSettings) merge(update RoomSettings) RoomSettings {
+	if update.Duration != 0 {
+		s.Duration = update.Duration
+	}
+	if update.BoardSize != 0 {
+		s.BoardSize = update.BoardSize
+	}
+	if update.MaxPlayers != 0 {
+		s.MaxPlayers = update.MaxPlayers
+	}
+	if update.StealRule != "" {
+		s.StealRule = update.StealRule
+	}
+	if update.Mode != "" {
+		s.Mode = update.Mode
+	}
+	if update.TickInterval != 0 {
+		s.TickInterval = update.TickInterval
+	}
+	if update.ChatFilter != "" {
+		s.ChatFilter = update.ChatFilter
+	}
+	if update.TeamMode != "" {
+		s.TeamMode = update.TeamMode
+	}
+	if update.SpectatorTeamChat != "" {
+		s.SpectatorTeamChat = update.SpectatorTeamChat
+	}
+	return s
+}
+
+// validate checks the settings against the limits the server supports and
+// the number of players already in the room.
+func (s RoomSettings) validate(players int) error {
+	switch {
+	case s.Duration < 30 || s.Duration > 15*60:
+		return fmt.Errorf("duration must be between 30 and 900 seconds")
+	case s.BoardSize < 10 || s.BoardSize > 200:
+		return fmt.Errorf("board size must be between 10 and 200")
+	case s.MaxPlayers < 2 || s.MaxPlayers > 16:
+		return fmt.Errorf("max players must be between 2 and 16")
+	case s.MaxPlayers < players:
+		return fmt.Errorf("room already has %d players", players)
+	case s.StealRule != StealAllowed && s.StealRule != StealForbidden:
+		return fmt.Errorf("unknown steal rule %q", s.StealRule)
+	case !validMode(s.Mode):
+		return fmt.Errorf("unknown game mode %q", s.Mode)
+	case s.TickInterval < 20 || s.TickInterval > 500:
+		return fmt.Errorf("tick interval must be between 20 and 500 milliseconds")
+	case s.ChatFilter != ChatFilterMask && s.ChatFilter != ChatFilterReject:
+		return fmt.Errorf("unknown chat filter %q", s.ChatFilter)
+	case s.TeamMode != TeamModeSolo && s.TeamMode != TeamModeTeams:
+		return fmt.Errorf("unknown team mode %q", s.TeamMode)
+	case s.SpectatorTeamChat != SpectatorTeamChatAfterGame && s.SpectatorTeamChat != SpectatorTeamChatNever:
+		return fmt.Errorf("unknown spectator team chat policy %q", s.SpectatorTeamChat)
+	}
+	return nil
+}
+
+// validMode reports whether mode names a registered game mode.
+func validMode(mode string) bool {
+	_, ok := game.NewRules(mode)
+	return ok
+}
+
+// configureRoom applies a host's settings change to a waiting room and shows
+// everyone in the lobby the resulting configuration. Fields left out of the
+// update keep their current values.
+func configureRoom(player *Player, update RoomSettings) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		if room.HostID != player.ID {
+			sendError(player, "NOT_HOST", "only the host can change settings")
+			return
+		}
+		if room.Phase != PhaseWaiting {
+			sendError(player, "SETTINGS_LOCKED", "settings can only be changed before the game starts")
+			return
+		}
+		settings := room.Settings.merge(update)
+		if err := settings.validate(len(room.Players)); err != nil {
+			sendError(player, "INVALID_SETTINGS", err.Error())
+			return
+		}
+
+		if settings.Mode != room.Settings.Mode {
+			room.Match.Rules, _ = game.NewRules(settings.Mode)
+		}
+		teamsChanged := settings.TeamMode != room.Settings.TeamMode
+		room.Settings = settings
+		if teamsChanged {
+			assignTeams(room)
+		}
+		room.Duration = time.Duration(settings.Duration) * time.Second
+		log.Printf("Room %s settings changed by %s: %+v", room.ID, player.ID, settings)
+
+		broadcastMessage(room, Message{
+			Type:    "settingsChanged",
+			Payload: SettingsChangedPayload{PlayerID: player.ID, Settings: room.Settings},
+		})
+	})
+}
+
+// startRoom lets the host end the lobby early.
+func startRoom(player *Player) {
+	room := player.Room.Load()
+
+	room.do(func() {
+		if room.HostID != player.ID {
+			sendError(player, "NOT_HOST", "only the host can start the game")
+			return
+		}
+		requestStart(room)
+	})
+}
+
+// requestStart ends the lobby wait in startGame. It must run on the room's
+// goroutine.
+func requestStart(room *Room) {
+	select {
+	case <-room.Start:
+	default:
+		close(room.Start)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"land/models"
+)
+
+// Coins a player's account earns for a game: placementCoins for finishing
+// first, second or third and participationCoins otherwise, plus a coin for
+// every coinCells cells they held at the end.
+var placementCoins = []int{50, 30, 20}
+
+const (
+	participationCoins = 10
+	coinCells          = 10
+)
+
+// shopItem is a cosmetic players can buy with coins: a color, which Value
+// names in the palette, or a character, which Value is.
+type shopItem struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Price int    `json:"price"`
+}
+
+// shopItems are everything the shop sells. Characters on sale here can only
+// be chosen by accounts that bought them, as can the palette colors that
+// name these items.
+var shopItems = []shopItem{
+	{ID: "color-gold", Kind: "color", Name: "Gold", Value: "gold", Price: 500},
+	{ID: "color-silver", Kind: "color", Name: "Silver", Value: "silver", Price: 300},
+	{ID: "color-midnight", Kind: "color", Name: "Midnight", Value: "midnight", Price: 200},
+	{ID: "character-knight", Kind: "character", Name: "Knight", Value: "knight", Price: 400},
+	{ID: "character-wizard", Kind: "character", Name: "Wizard", Value: "wizard", Price: 400},
+	{ID: "character-robot", Kind: "character", Name: "Robot", Value: "robot", Price: 250},
+}
+
+// errNotEnoughCoins and errAlreadyOwned reject a purchase.
+var (
+	errNotEnoughCoins = errors.New("not enough coins")
+	errAlreadyOwned   = errors.New("item already owned")
+)
+
+func findShopItem(id string) (shopItem, bool) {
+	for _, item := range shopItems {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return shopItem{}, false
+}
+
+// shopItemFor is the item that sells value as a kind of cosmetic, if one
+// does.
+func shopItemFor(kind, value string) (shopItem, bool) {
+	for _, item := range shopItems {
+		if item.Kind == kind && item.Value == value {
+			return item, true
+		}
+	}
+	return shopItem{}, false
+}
+
+// owns reports whether the account has bought the item.
+func owns(accountID uint, itemID string) (bool, error) {
+	var count int64
+	err := db.Model(&models.InventoryItem{}).Where("account_id = ? AND item_id = ?", accountID, itemID).Count(&count).Error
+	return count > 0, err
+}
+
+// coinsEarned is what a player's account earns for where they finished.
+// Players without an account earn nothing.
+func coinsEarned(standing Standing) int {
+	if standing.AccountID == 0 {
+		return 0
+	}
+	coins := participationCoins
+	if standing.Placement <= len(placementCoins) {
+		coins = placementCoins[standing.Placement-1]
+	}
+	return coins + standing.Territory/coinCells
+}
+
+// coinsByPlayer is what each player with an account earned in a game, by
+// player ID, or nil without a database to keep it in.
+func coinsByPlayer(standings []Standing) map[string]int {
+	if db == nil {
+		return nil
+	}
+	coins := make(map[string]int)
+	for _, standing := range standings {
+		if earned := coinsEarned(standing); earned > 0 {
+			coins[standing.PlayerID] = earned
+		}
+	}
+	return coins
+}
+
+// awardCoins adds what each account in a recorded match earned to its
+// balance.
+func awardCoins(tx *gorm.DB, match models.Match) error {
+	for _, result := range match.Results {
+		if result.AccountID == 0 || result.Coins == 0 {
+			continue
+		}
+		err := tx.Model(&models.Player{}).Where("id = ?", result.AccountID).
+			Update("coins", gorm.Expr("coins + ?", result.Coins)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listShopItems serves everything the shop sells.
+func listShopItems(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": shopItems})
+}
+
+// listInventory serves what the account the request's token is for has
+// bought, oldest first.
+func listInventory(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+
+	items := []models.InventoryItem{}
+	if err := db.Where("account_id = ?", account.ID).Order("purchased_at ASC").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load inventory"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// buyShopItem buys an item for the account the request's token is for,
+// answering with the account's new balance. The balance is only taken from
+// if it covers the price, in the same transaction that records the
+// purchase, so concurrent purchases can't spend the same coins twice or
+// buy the same item twice.
+func buyShopItem(c *gin.Context) {
+	if !requireDB(c) {
+		return
+	}
+	account := sessionAccount(c)
+	item, ok := findShopItem(c.Param("item"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	var player models.Player
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&models.InventoryItem{}).Where("account_id = ? AND item_id = ?", account.ID, item.ID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAlreadyOwned
+		}
+		result := tx.Model(&models.Player{}).Where("id = ? AND coins >= ?", account.ID, item.Price).
+			Update("coins", gorm.Expr("coins - ?", item.Price))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotEnoughCoins
+		}
+		purchase := models.InventoryItem{AccountID: account.ID, ItemID: item.ID, Price: item.Price, PurchasedAt: time.Now()}
+		if err := tx.Create(&purchase).Error; err != nil {
+			return err
+		}
+		return tx.First(&player, account.ID).Error
+	})
+	switch {
+	case errors.Is(err, errAlreadyOwned), errors.Is(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is already owned"})
+	case errors.Is(err, errNotEnoughCoins):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Not enough coins"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to buy item"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"item": item, "coins": player.Coins})
+	}
+}
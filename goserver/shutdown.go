@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+)
+
+var (
+	// shutdownGrace is how long players are warned before their games are
+	// ended and their connections closed, set by a flag.
+	shutdownGrace = 5 * time.Second
+
+	// shutdownTimeout bounds the whole shutdown, so a stuck connection can't
+	// hold up a deploy, set by a flag.
+	shutdownTimeout = 15 * time.Second
+)
+
+// shuttingDown is closed once the server starts shutting down, after which
+// it accepts no new connections.
+var shuttingDown = make(chan struct{})
+
+func isShuttingDown() bool {
+	select {
+	case <-shuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectWhileShuttingDown turns away new requests once shutdown has begun.
+func rejectWhileShuttingDown(c *gin.Context) {
+	if isShuttingDown() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+		return
+	}
+	c.Next()
+}
+
+// shutdown stops the server: it stops taking connections, warns every room,
+// waits out shutdownGrace, ends the games still running, closes every
+// connection as going away and stops the HTTP and gRPC servers. Last, once
+// the ended games are recorded and the chat logs written, it closes the
+// database. It gives up on anything still pending after shutdownTimeout.
+func shutdown(server *http.Server, grpcServer *grpc.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	close(shuttingDown)
+	log.Printf("Shutting down in %v", shutdownGrace)
+
+	shutdownAt := time.Now().Add(shutdownGrace)
+	for _, room := range rooms.List() {
+		room.do(func() {
+			broadcastMessage(room, Message{
+				Type:    "serverShutdown",
+				Payload: ServerShutdownPayload{ShutdownAt: shutdownAt.UnixMilli()},
+			})
+		})
+	}
+
+	select {
+	case <-time.After(shutdownGrace):
+	case <-ctx.Done():
+	}
+
+	for _, room := range rooms.List() {
+		shutdownRoom(room)
+	}
+	// Players still in the lobby or the queue have no room to close them.
+	for _, player := range connected.List() {
+		if player.Conn != nil {
+			player.Conn.CloseWith(websocket.CloseGoingAway, "server shutting down")
+		}
+	}
+
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	waitForDisconnects(ctx)
+	waitForSubscribers(ctx)
+	if db != nil {
+		flushed := make(chan struct{})
+		go func() {
+			flushChatLogs()
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			log.Printf("Gave up waiting for chat logs to be written")
+		}
+		closeDB()
+	}
+	log.Printf("Shutdown complete")
+}
+
+// shutdownRoom ends the room's game if one is running, closes every
+// connection attached to it as going away and stops the room.
+func shutdownRoom(room *Room) {
+	room.do(func() {
+		switch room.Phase {
+		case PhaseCountdown, PhaseInProgress, PhaseOvertime:
+			endGame(room)
+		}
+		if room.Vote != nil {
+			room.Vote.timer.Stop()
+			room.Vote = nil
+		}
+		for _, player := range room.Players {
+			if player.Conn != nil {
+				player.Conn.CloseWith(websocket.CloseGoingAway, "server shutting down")
+			}
+		}
+		for _, subscriber := range room.Spectators {
+			if spectator, ok := subscriber.(*Spectator); ok {
+				spectator.Conn.CloseWith(websocket.CloseGoingAway, "server shutting down")
+			} else {
+				subscriber.Close()
+			}
+		}
+		room.retire()
+		room.stop()
+	})
+}
+
+// waitForDisconnects waits for every player's connection to finish closing,
+// so their close frames get out before the process exits.
+func waitForDisconnects(ctx context.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for connected.Len() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("Gave up waiting for %d connections to close", connected.Len())
+			return
+		}
+	}
+}
+
+// healthz answers 200 while the server is up and its database, if it has
+// one, answers a ping within dbPingTimeout, and 503 otherwise. Games go on
+// without the database, so a 503 for it means persistence is down, not
+// play.
+func healthz(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "db": "disabled"})
+		return
+	}
+	if err := pingDB(c.Request.Context()); err != nil {
+		log.Printf("Health check: database ping failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "db": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "db": "ok"})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"land/models"
+)
+
+// logBuffer holds what is logged while a test runs.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// waitFor waits for a line with s in it to be logged.
+func (b *logBuffer) waitFor(t *testing.T, s string) {
+	t.Helper()
+	for deadline := time.Now().Add(expectTimeout); ; time.Sleep(time.Millisecond) {
+		b.mu.Lock()
+		logged := strings.Contains(b.buf.String(), s)
+		b.mu.Unlock()
+		if logged {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing logged with %q in it after %v", s, expectTimeout)
+		}
+	}
+}
+
+// captureLogs logs to a buffer until the test ends.
+func captureLogs(t *testing.T) *logBuffer {
+	logs := &logBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return logs
+}
+
+// stopDB closes the test's database connections, as an outage would.
+func stopDB(t *testing.T) {
+	t.Helper()
+	pool, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	var health struct {
+		Status string `json:"status"`
+		DB     string `json:"db"`
+	}
+	w := serveRequest(t, http.MethodGet, "/healthz", "", "")
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &health)
+	if health.Status != "ok" || health.DB != "disabled" {
+		t.Fatalf("without a database, health is %+v", health)
+	}
+
+	useTestDB(t)
+	w = serveRequest(t, http.MethodGet, "/healthz", "", "")
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &health)
+	if health.Status != "ok" || health.DB != "ok" {
+		t.Fatalf("with a database, health is %+v", health)
+	}
+
+	stopDB(t)
+	w = serveRequest(t, http.MethodGet, "/healthz", "", "")
+	expectStatus(t, w, http.StatusServiceUnavailable)
+	decodeBody(t, w, &health)
+	if health.Status != "degraded" || health.DB == "" {
+		t.Fatalf("with the database down, health is %+v", health)
+	}
+}
+
+// With the database down, players still connect and play; the match they
+// finish is dropped, with the whole record logged, once every attempt to
+// save it has failed.
+func TestPlayWithDatabaseDown(t *testing.T) {
+	useTestDB(t)
+	setForTest(t, &recordRetryDelay, time.Millisecond)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	logs := captureLogs(t)
+	stopDB(t)
+
+	bob := server.join(t, room, "bob")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	logs.waitFor(t, "Failed to create guest account")
+	server.startMatch(t, alice)
+	bob.Chat("still here")
+	expectChat(t, alice, "bob", "still here", "")
+	server.tick(t, room)
+
+	room.do(func() { endGame(room) })
+	alice.ExpectMessage("gameOver", expectTimeout)
+	bob.ExpectMessage("gameOver", expectTimeout)
+	logs.waitFor(t, "Failed to record match of room "+room.ID+": ")
+	logs.waitFor(t, `"playerID":`)
+	expectStatus(t, serveRequest(t, http.MethodGet, "/healthz", "", ""), http.StatusServiceUnavailable)
+}
+
+// Shutdown ends the games still running and closes the database only once
+// they and the chat logs have been written.
+func TestShutdownWritesBeforeClosingDB(t *testing.T) {
+	setForTest(t, &db, nil)
+	cfg := DBConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "land.db"), Migrate: true}
+	openDB(cfg)
+	setForTest(t, &shuttingDown, make(chan struct{}))
+	setForTest(t, &shutdownGrace, 0)
+	setForTest(t, &shutdownTimeout, expectTimeout)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+	server.startMatch(t, alice)
+	bob.Chat("gg")
+	expectChat(t, alice, "bob", "gg", "")
+
+	shutdown(server.Config, nil)
+	alice.ExpectMessage("gameOver", expectTimeout)
+	if err := pingDB(context.Background()); err == nil {
+		t.Fatal("database still open after shutdown")
+	}
+
+	dialector, err := cfg.dialector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if pool, err := reopened.DB(); err == nil {
+			pool.Close()
+		}
+	})
+	var match models.Match
+	if err := reopened.Preload("Results").Where("room_id = ?", room.ID).First(&match).Error; err != nil {
+		t.Fatalf("match ended by the shutdown wasn't recorded: %v", err)
+	}
+	if len(match.Results) != 2 {
+		t.Fatalf("match recorded with %d results, want alice's and bob's", len(match.Results))
+	}
+	var chat models.ChatLog
+	if err := reopened.Where("room_id = ? AND text = ?", room.ID, "gg").First(&chat).Error; err != nil {
+		t.Fatalf("chat sent before the shutdown wasn't logged: %v", err)
+	}
+	if chat.MatchID != match.ID {
+		t.Fatalf("chat logged against match %v, want %d", chat.MatchID, match.ID)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Subscriber is a read-only consumer of a room's broadcasts: a websocket
+// spectator or an event stream. Subscribers have no place on the board and
+// don't count toward the room's player limit.
+type Subscriber interface {
+	// Deliver sends a broadcast. It is called on the room's goroutine and
+	// must not block.
+	Deliver(cache *payloadCache)
+	Close()
+}
+
+// Spectator is a websocket connection subscribed to a room.
+type Spectator struct {
+	ID           string
+	LastActivity time.Time
+	AFKWarnedAt  time.Time
+	Conn         Transport
+	Codec        Codec
+	Room         *Room
+}
+
+func (s *Spectator) Deliver(cache *payloadCache) {
+	s.Conn.SendBroadcast(s.Codec, 0, cache)
+}
+
+func (s *Spectator) Close() {
+	s.Conn.Close()
+}
+
+// spectatorMessageTypes lists the broadcasts forwarded to subscribers.
+var spectatorMessageTypes = map[string]bool{
+	"gameState":     true,
+	"chat":          true,
+	"gameOver":      true,
+	"playerRenamed": true,
+	"playerColor":   true,
+
+	"serverShutdown": true,
+}
+
+// spectate attaches conn to the room as a spectator and keeps reading until
+// the connection drops. Pings and clock syncs are answered; anything else the
+// spectator sends is answered with an error. A private room is only watched
+// given its join code, and a wrong code is reported as a missing room, as it
+// is to players joining.
+func spectate(conn Transport, read func() ([]byte, error), codec Codec, id, roomID, joinCode string) {
+	room, ok := rooms.Get(roomID)
+	if !ok {
+		log.Printf("Spectator asked for unknown room %s", roomID)
+		rejectConnection(conn, codec, errRoomNotFound)
+		return
+	}
+
+	spectator := &Spectator{
+		ID:           id,
+		LastActivity: time.Now(),
+		Conn:         conn,
+		Codec:        codec,
+		Room:         room,
+	}
+
+	hidden := false
+	attached := room.do(func() {
+		if room.Private && joinCode != room.JoinCode {
+			hidden = true
+			return
+		}
+		room.Spectators[spectator.ID] = spectator
+		writeMessage(conn, codec, Message{
+			Type:    "gameState",
+			Payload: snapshot(room, room.remaining(), false),
+		})
+	})
+	if !attached || hidden {
+		rejectConnection(conn, codec, errRoomNotFound)
+		return
+	}
+
+	defer removeSpectator(spectator)
+
+	log.Printf("Spectator %s attached to room %s", spectator.ID, room.ID)
+
+	for {
+		message, err := read()
+		if err != nil {
+			log.Printf("Error reading message: %v", err)
+			return
+		}
+		// Pings and clock syncs are all a client that is only watching
+		// sends, so they count as activity like anything else.
+		room.do(func() {
+			spectator.LastActivity = time.Now()
+			spectator.AFKWarnedAt = time.Time{}
+		})
+		_, payload, _ := decodeMessage(codec, message)
+		switch msg := payload.(type) {
+		case *PingPayload:
+			writeMessage(conn, codec, pong(msg))
+		case *TimeSyncPayload:
+			writeMessage(conn, codec, timeSync(msg))
+		default:
+			writeError(conn, codec, "SPECTATOR", "spectators can't play")
+		}
+	}
+}
+
+func removeSpectator(spectator *Spectator) {
+	room := spectator.Room
+
+	room.do(func() {
+		delete(room.Spectators, spectator.ID)
+
+		log.Printf("Spectator %s removed from room %s", spectator.ID, room.ID)
+	})
+}
+
+// closeSpectators disconnects every subscriber of a room that is going away.
+// It must run on the room's goroutine.
+func closeSpectators(room *Room) {
+	for _, spectator := range room.Spectators {
+		spectator.Close()
+	}
+}
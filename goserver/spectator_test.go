@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// A private room is only watched by whoever has its join code, whether they
+// ask when connecting or in a spectate message.
+func TestSpectatePrivateRoom(t *testing.T) {
+	server := startServer(t)
+	w := serveRequest(t, http.MethodPost, "/rooms", "", `{"private": true}`)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID   string `json:"roomID"`
+		JoinCode string `json:"joinCode"`
+	}
+	decodeBody(t, w, &created)
+
+	tests := []struct {
+		name     string
+		joinCode string
+		allowed  bool
+	}{
+		{"without the code", "", false},
+		{"with a wrong code", "wrong", false},
+		{"with the code", created.JoinCode, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" when connecting", func(t *testing.T) {
+			query := url.Values{"spectate": {"1"}, "room": {created.RoomID}, "code": {tt.joinCode}}
+			spectator := wstest.Dial(t, server.URL+"/ws?"+query.Encode())
+			expectSpectating(t, spectator, tt.allowed)
+		})
+		t.Run(tt.name+" in a message", func(t *testing.T) {
+			spectator := wstest.Dial(t, server.URL+"/ws")
+			spectator.Send("spectate", SpectatePayload{RoomID: created.RoomID, JoinCode: tt.joinCode})
+			expectSpectating(t, spectator, tt.allowed)
+		})
+	}
+}
+
+// expectSpectating checks that the spectator was sent the room's state if
+// allowed, and was otherwise told the room doesn't exist.
+func expectSpectating(t *testing.T, spectator *wstest.Client, allowed bool) {
+	t.Helper()
+	if allowed {
+		spectator.ExpectMessage("gameState", expectTimeout)
+		return
+	}
+	expectError(t, spectator, "ROOM_NOT_FOUND")
+}
+
+// A spectator who only sends pings is still watching, and isn't warned as
+// AFK.
+func TestSpectatorPingsCountAsActivity(t *testing.T) {
+	setForTest(t, &spectatorAFK, 100*time.Millisecond)
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	spectator := wstest.Dial(t, server.URL+"/ws")
+	spectator.Send("spectate", SpectatePayload{RoomID: room.ID})
+	spectator.ExpectMessage("gameState", expectTimeout)
+
+	for range 3 {
+		time.Sleep(spectatorAFK * 2 / 3)
+		spectator.Send("ping", protocol.PingPayload{ClientTime: 1})
+		spectator.ExpectMessage("pong", expectTimeout)
+		checkAFK(room)
+	}
+	// A warning would have come before the answer to this.
+	spectator.Send("ping", protocol.PingPayload{ClientTime: 2})
+	spectator.ExpectMessage("pong", expectTimeout)
+	for _, msg := range spectator.Messages() {
+		if msg.Type == "afkWarning" {
+			t.Fatal("a spectator sending pings was warned as AFK")
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventStreamBuffer is how many events an event stream may have waiting to
+// be written, on top of room for a full replay of the event log. A reader
+// that falls further behind is disconnected.
+const eventStreamBuffer = 64
+
+// eventStreamKeepAlive is how often an idle event stream gets a comment line,
+// so proxies don't time it out.
+const eventStreamKeepAlive = 15 * time.Second
+
+// eventStream is a Server-Sent Events subscriber: a read-only view of a room
+// for clients that can't open a websocket. Events carry the same JSON
+// messages spectators get, with the room's event IDs so a reconnecting
+// EventSource resumes through Last-Event-ID.
+type eventStream struct {
+	id     string
+	room   *Room
+	events chan []byte
+	done   chan struct{}
+	closed bool
+}
+
+// Deliver formats the broadcast as an SSE event. Logged events use their own
+// ID; snapshots use the ID of the last event they reflect.
+func (s *eventStream) Deliver(cache *payloadCache) {
+	if s.closed {
+		return
+	}
+	msg := cache.For(jsonCodec)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding %s for event stream: %v", msg.Type, err)
+		return
+	}
+	id := msg.EventID
+	if id == 0 {
+		id = s.room.Events.lastID
+	}
+
+	var event bytes.Buffer
+	fmt.Fprintf(&event, "id: %d\nevent: %s\ndata: %s\n\n", id, msg.Type, data)
+	select {
+	case s.events <- event.Bytes():
+	default:
+		log.Printf("Event stream %s in room %s fell behind, closing it", s.id, s.room.ID)
+		s.Close()
+	}
+}
+
+// Close ends the stream. It must run on the room's goroutine.
+func (s *eventStream) Close() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// streamEvents serves a room's broadcasts as Server-Sent Events. A client
+// resuming with Last-Event-ID gets the events it missed if the room still
+// has them, and a snapshot otherwise. A private room is only streamed given
+// its join code as ?code=, and is otherwise reported missing.
+func streamEvents(c *gin.Context) {
+	room, ok := rooms.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	stream := &eventStream{
+		id:     generatePlayerID(),
+		room:   room,
+		events: make(chan []byte, eventStreamBuffer+eventLogSize),
+		done:   make(chan struct{}),
+	}
+
+	joinCode := c.Query("code")
+	hidden := false
+	attached := room.do(func() {
+		if room.Private && joinCode != room.JoinCode {
+			hidden = true
+			return
+		}
+		room.Spectators[stream.id] = stream
+		replayToStream(stream, c.GetHeader("Last-Event-ID"))
+	})
+	if !attached {
+		c.JSON(http.StatusGone, gin.H{"error": "Room is closed"})
+		return
+	}
+	if hidden {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	defer func() {
+		room.do(func() { delete(room.Spectators, stream.id) })
+		log.Printf("Event stream %s detached from room %s", stream.id, room.ID)
+	}()
+
+	log.Printf("Event stream %s attached to room %s", stream.id, room.ID)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-stream.events:
+			if _, err := c.Writer.Write(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-stream.done:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// replayToStream sends a new stream what it missed since lastEventID, or a
+// snapshot if it has no ID or the log no longer reaches back that far. It must
+// run on the room's goroutine.
+func replayToStream(stream *eventStream, lastEventID string) {
+	room := stream.room
+	if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		if events, ok := room.Events.Since(id); ok {
+			for _, event := range events {
+				if spectatorMessageTypes[event.Message.Type] {
+					stream.Deliver(newPayloadCache(event.Message))
+				}
+			}
+			return
+		}
+	}
+	stream.Deliver(newPayloadCache(Message{
+		Type:    "gameState",
+		Payload: snapshot(room, room.remaining(), false),
+	}))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// A private room's event stream is only opened for whoever has its join
+// code.
+func TestPrivateRoomEvents(t *testing.T) {
+	server := startServer(t)
+	w := serveRequest(t, http.MethodPost, "/rooms", "", `{"private": true}`)
+	expectStatus(t, w, http.StatusCreated)
+	var created struct {
+		RoomID   string `json:"roomID"`
+		JoinCode string `json:"joinCode"`
+	}
+	decodeBody(t, w, &created)
+	path := "/rooms/" + created.RoomID + "/events"
+
+	expectStatus(t, serveRequest(t, http.MethodGet, path, "", ""), http.StatusNotFound)
+	expectStatus(t, serveRequest(t, http.MethodGet, path+"?code=wrong", "", ""), http.StatusNotFound)
+
+	// With the code the stream opens with a snapshot, and stays open until
+	// the client goes.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path+"?code="+created.JoinCode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d with the code, want %d", resp.StatusCode, http.StatusOK)
+	}
+	events := bufio.NewScanner(resp.Body)
+	for events.Scan() {
+		if line := events.Text(); strings.HasPrefix(line, "event: ") {
+			if line != "event: gameState" {
+				t.Errorf("stream opened with %q, want a gameState", line)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended before its first event: %v", events.Err())
+}
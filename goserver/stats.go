@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"land/models"
+)
+
+// PlayerStatsView is an account's stats over every match it played.
+// FavoriteMode is the mode it played most, empty before its first match.
+type PlayerStatsView struct {
+	AccountID    uint    `json:"accountID"`
+	GamesPlayed  int     `json:"gamesPlayed"`
+	Wins         int     `json:"wins"`
+	WinRate      float64 `json:"winRate"`
+	AverageScore float64 `json:"averageScore"`
+	BestScore    int     `json:"bestScore"`
+	CellsClaimed int     `json:"cellsClaimed"`
+	FavoriteMode string  `json:"favoriteMode"`
+	Rating       float64 `json:"rating"`
+}
+
+// addStats adds a recorded match to the stats of every account in it.
+func addStats(tx *gorm.DB, match models.Match) error {
+	for _, result := range match.Results {
+		if result.AccountID == 0 {
+			continue
+		}
+		stats := models.PlayerStats{
+			AccountID:    result.AccountID,
+			Mode:         match.Mode,
+			Games:        1,
+			TotalScore:   result.Score,
+			BestScore:    result.Score,
+			CellsClaimed: result.Claimed,
+		}
+		if result.Winner {
+			stats.Wins = 1
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "account_id"}, {Name: "mode"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "games"}, Value: gorm.Expr("player_stats.games + excluded.games")},
+				{Column: clause.Column{Name: "wins"}, Value: gorm.Expr("player_stats.wins + excluded.wins")},
+				{Column: clause.Column{Name: "total_score"}, Value: gorm.Expr("player_stats.total_score + excluded.total_score")},
+				{Column: clause.Column{Name: "best_score"}, Value: gorm.Expr("CASE WHEN excluded.best_score > player_stats.best_score THEN excluded.best_score ELSE player_stats.best_score END")},
+				{Column: clause.Column{Name: "cells_claimed"}, Value: gorm.Expr("player_stats.cells_claimed + excluded.cells_claimed")},
+			},
+		}).Create(&stats).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playerStatsHandler serves an account's stats, all zero if it hasn't
+// played yet.
+func playerStatsHandler(c *gin.Context) {
+	id, ok := accountParam(c, "id")
+	if !ok || !requireDB(c) {
+		return
+	}
+
+	var account models.Player
+	err := db.First(&account, id).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+		return
+	}
+	var modes []models.PlayerStats
+	if err := db.Where("account_id = ?", id).Order("mode").Find(&modes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+		return
+	}
+	c.JSON(http.StatusOK, statsView(account, modes))
+}
+
+// statsView adds up an account's stats across modes.
+func statsView(account models.Player, modes []models.PlayerStats) PlayerStatsView {
+	view := PlayerStatsView{AccountID: account.ID, Rating: account.Rating}
+	totalScore, favorite := 0, 0
+	for _, stats := range modes {
+		view.GamesPlayed += stats.Games
+		view.Wins += stats.Wins
+		view.CellsClaimed += stats.CellsClaimed
+		view.BestScore = max(view.BestScore, stats.BestScore)
+		totalScore += stats.TotalScore
+		if stats.Games > favorite {
+			view.FavoriteMode, favorite = stats.Mode, stats.Games
+		}
+	}
+	if view.GamesPlayed > 0 {
+		view.WinRate = float64(view.Wins) / float64(view.GamesPlayed)
+		view.AverageScore = float64(totalScore) / float64(view.GamesPlayed)
+	}
+	return view
+}
@@ -0,0 +1,38 @@
+package main
+
+// teamNames are the teams of a room in team mode, in the order they fill up.
+var teamNames = []string{"red", "blue"}
+
+// assignTeam puts a player joining a room in team mode on the team with the
+// fewest players, the first of them on a tie. Outside team mode the player
+// is on no team. It must run on the room's goroutine.
+func assignTeam(room *Room, player *Player) {
+	player.Team = ""
+	if room.Settings.TeamMode != TeamModeTeams {
+		return
+	}
+	sizes := make(map[string]int)
+	for _, other := range room.Players {
+		if other != player {
+			sizes[other.Team]++
+		}
+	}
+	player.Team = teamNames[0]
+	for _, team := range teamNames[1:] {
+		if sizes[team] < sizes[player.Team] {
+			player.Team = team
+		}
+	}
+}
+
+// assignTeams deals the room's players out to the teams again, in the order
+// they joined, after the room's team mode changed. It must run on the room's
+// goroutine.
+func assignTeams(room *Room) {
+	for i, player := range room.roster() {
+		player.Team = ""
+		if room.Settings.TeamMode == TeamModeTeams {
+			player.Team = teamNames[i%len(teamNames)]
+		}
+	}
+}
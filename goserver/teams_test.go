@@ -0,0 +1,193 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"land/internal/wstest"
+	"land/protocol"
+)
+
+// teamRoom is a room in team mode, with alice as its host and the others
+// joining after her, dealt out red, blue, red, ...
+func teamRoom(t *testing.T, server *testServer, spectatorTeamChat string, names ...string) (*Room, []*wstest.Client) {
+	t.Helper()
+	room := server.createRoom(t, "")
+	clients := []*wstest.Client{server.join(t, room, "alice")}
+	clients[0].Send("configure", ConfigurePayload{Settings: &RoomSettings{TeamMode: TeamModeTeams, SpectatorTeamChat: spectatorTeamChat}})
+	clients[0].ExpectMessage("settingsChanged", expectTimeout)
+	for _, name := range names {
+		clients = append(clients, server.join(t, room, name))
+	}
+	return room, clients
+}
+
+// teams is the team of each player in the room, by name.
+func teams(room *Room) map[string]string {
+	teams := make(map[string]string)
+	room.do(func() {
+		for _, player := range room.Players {
+			teams[player.Name] = player.Team
+		}
+	})
+	return teams
+}
+
+// expectChat waits for the client's next chat message and checks who sent
+// it to which channel.
+func expectChat(t *testing.T, client *wstest.Client, from, message, channel string) ChatMessagePayload {
+	t.Helper()
+	var chat ChatMessagePayload
+	if err := client.ExpectMessage("chat", expectTimeout).Decode(&chat); err != nil {
+		t.Fatal(err)
+	}
+	if chat.Name != from || chat.Message != message || chat.Channel != channel {
+		t.Fatalf("got chat %+v, want %q from %s on %q", chat, message, from, channel)
+	}
+	return chat
+}
+
+func TestTeamsAreDealtOut(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	server.join(t, room, "bob")
+	if got := teams(room); got["alice"] != "" || got["bob"] != "" {
+		t.Fatalf("teams outside team mode: %v", got)
+	}
+
+	// Turning team mode on deals out the players already in the room...
+	alice.Send("configure", ConfigurePayload{Settings: &RoomSettings{TeamMode: TeamModeTeams, MaxPlayers: 8}})
+	alice.ExpectMessage("settingsChanged", expectTimeout)
+	if got := teams(room); got["alice"] != "red" || got["bob"] != "blue" {
+		t.Fatalf("teams = %v, want alice red and bob blue", got)
+	}
+
+	// ...later joiners go to the smaller team...
+	server.join(t, room, "carol")
+	server.join(t, room, "dave")
+	want := map[string]string{"alice": "red", "bob": "blue", "carol": "red", "dave": "blue"}
+	if got := teams(room); !maps.Equal(got, want) {
+		t.Fatalf("teams = %v, want %v", got, want)
+	}
+
+	// ...and turning it off takes everyone off their team.
+	alice.Send("configure", ConfigurePayload{Settings: &RoomSettings{TeamMode: TeamModeSolo}})
+	alice.ExpectMessage("settingsChanged", expectTimeout)
+	for name, team := range teams(room) {
+		if team != "" {
+			t.Errorf("%s is still on %s", name, team)
+		}
+	}
+}
+
+func TestTeamChatReachesTeammatesOnly(t *testing.T) {
+	server := startServer(t)
+	_, clients := teamRoom(t, server, SpectatorTeamChatAfterGame, "bob", "carol")
+	alice, bob, carol := clients[0], clients[1], clients[2]
+
+	alice.Send("chat", protocol.ChatPayload{Message: "flank left", Channel: ChannelTeam})
+	alice.Chat("good luck all")
+
+	for _, teammate := range []*wstest.Client{alice, carol} {
+		chat := expectChat(t, teammate, "alice", "flank left", ChannelTeam)
+		if chat.Team != "red" {
+			t.Fatalf("team chat tagged %q, want red", chat.Team)
+		}
+		expectChat(t, teammate, "alice", "good luck all", "")
+	}
+	// Bob's first chat is the one for everyone.
+	expectChat(t, bob, "alice", "good luck all", "")
+}
+
+func TestTeamChatNeedsATeam(t *testing.T) {
+	server := startServer(t)
+	alice := server.join(t, server.createRoom(t, ""), "alice")
+
+	alice.Send("chat", protocol.ChatPayload{Message: "anyone?", Channel: ChannelTeam})
+	var e ErrorPayload
+	if err := alice.ExpectMessage("error", expectTimeout).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != "NO_TEAM" {
+		t.Fatalf("error %s, want NO_TEAM", e.Code)
+	}
+}
+
+// A player who has lost every cell is still on their team, and still talks
+// to it.
+func TestTeamChatWithoutCells(t *testing.T) {
+	server := startServer(t)
+	room, clients := teamRoom(t, server, SpectatorTeamChatAfterGame, "bob", "carol")
+	alice, carol := clients[0], clients[2]
+	server.startMatch(t, alice)
+
+	carolID := playerID(t, carol)
+	room.do(func() {
+		color := room.Players[carolID].Color
+		for _, cell := range room.Match.Board.Cells(color) {
+			room.Match.SetCell(cell, "")
+		}
+	})
+	carol.Send("chat", protocol.ChatPayload{Message: "I'm out, cover me", Channel: ChannelTeam})
+	expectChat(t, alice, "carol", "I'm out, cover me", ChannelTeam)
+}
+
+// Spectators never see team chat while the game is on; once it is over
+// they are shown the game's team chat, unless the room's settings say never.
+func TestSpectatorTeamChat(t *testing.T) {
+	tests := []struct {
+		policy string
+		shown  bool
+	}{
+		{SpectatorTeamChatAfterGame, true},
+		{SpectatorTeamChatNever, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			server := startServer(t)
+			room, clients := teamRoom(t, server, tt.policy, "bob")
+			alice := clients[0]
+			room.do(func() { room.Settings.Duration = 30 })
+			spectator := wstest.Dial(t, server.URL+"/ws")
+			spectator.Send("spectate", SpectatePayload{RoomID: room.ID})
+			spectator.ExpectMessage("gameState", expectTimeout)
+			server.startMatch(t, alice)
+
+			alice.Send("chat", protocol.ChatPayload{Message: "go red", Channel: ChannelTeam})
+			expectChat(t, alice, "alice", "go red", ChannelTeam)
+			// Alice leads, so the game ends on time.
+			setTerritory(room, map[string]int{playerID(t, alice): 2, playerID(t, clients[1]): 1})
+			server.Clock.Advance(30 * time.Second)
+			spectator.ExpectMessage("gameOver", expectTimeout)
+
+			// The team chat, if shown, is sent before anything the spectator
+			// is sent after the game.
+			spectator.Send("ping", protocol.PingPayload{ClientTime: 1})
+			spectator.ExpectMessage("pong", expectTimeout)
+			var logs []TeamChatLogPayload
+			for _, msg := range spectator.Messages() {
+				switch msg.Type {
+				case "chat":
+					t.Fatalf("spectator got chat %s", msg.Payload)
+				case "teamChatLog":
+					var log TeamChatLogPayload
+					if err := msg.Decode(&log); err != nil {
+						t.Fatal(err)
+					}
+					logs = append(logs, log)
+				}
+			}
+			if !tt.shown {
+				if len(logs) != 0 {
+					t.Fatalf("spectator was shown team chat: %+v", logs)
+				}
+				return
+			}
+			if len(logs) != 1 || len(logs[0].Messages) != 1 || logs[0].Messages[0].Message != "go red" || logs[0].Messages[0].Team != "red" {
+				t.Fatalf("team chat shown = %+v, want alice's go red", logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	// tickStatsWeight is how much each tick moves the averages in TickStats.
+	// At 0.05 a tick's weight halves about every 14 ticks.
+	tickStatsWeight = 0.05
+
+	// tickStatsWindow is how far back TickStats keeps the slowest tick, in
+	// one-second buckets.
+	tickStatsWindow = 60
+)
+
+// TickStats measures a room's game loop for the debug server: how long its
+// ticks take, stepping and broadcasting together, and how much each
+// broadcast queued. It belongs to the room's goroutine.
+type TickStats struct {
+	ticks     int64
+	avgTick   float64
+	avgBytes  float64
+	lastTick  time.Duration
+	lastBytes int
+
+	// slowest holds the slowest tick of each of the last tickStatsWindow
+	// seconds, indexed by the Unix second modulo tickStatsWindow. A bucket
+	// whose second has gone by is stale.
+	slowest [tickStatsWindow]tickBucket
+}
+
+type tickBucket struct {
+	second int64
+	max    time.Duration
+}
+
+// record notes a tick that took took and whose broadcast queued bytes. It
+// must run on the room's goroutine.
+func (s *TickStats) record(now time.Time, took time.Duration, bytes int) {
+	if s.ticks == 0 {
+		s.avgTick, s.avgBytes = float64(took), float64(bytes)
+	} else {
+		s.avgTick += tickStatsWeight * (float64(took) - s.avgTick)
+		s.avgBytes += tickStatsWeight * (float64(bytes) - s.avgBytes)
+	}
+	s.ticks++
+	s.lastTick, s.lastBytes = took, bytes
+
+	second := now.Unix()
+	bucket := &s.slowest[second%tickStatsWindow]
+	if bucket.second != second {
+		*bucket = tickBucket{second: second}
+	}
+	bucket.max = max(bucket.max, took)
+}
+
+// maxTick is the slowest tick in the tickStatsWindow seconds up to now. It
+// must run on the room's goroutine.
+func (s *TickStats) maxTick(now time.Time) time.Duration {
+	var slowest time.Duration
+	second := now.Unix()
+	for _, bucket := range s.slowest {
+		if second-bucket.second < tickStatsWindow {
+			slowest = max(slowest, bucket.max)
+		}
+	}
+	return slowest
+}
+
+// TickStatsView is a room's TickStats as the debug server shows it.
+type TickStatsView struct {
+	Ticks          int64 `json:"ticks"`
+	LastTickUs     int64 `json:"lastTickUs"`
+	AvgTickUs      int64 `json:"avgTickUs"`
+	MaxTickUs      int64 `json:"maxTickUs"`
+	LastBroadcastB int   `json:"lastBroadcastBytes"`
+	AvgBroadcastB  int   `json:"avgBroadcastBytes"`
+}
+
+// view reports the stats as of now. It must run on the room's goroutine.
+func (s *TickStats) view(now time.Time) TickStatsView {
+	return TickStatsView{
+		Ticks:          s.ticks,
+		LastTickUs:     s.lastTick.Microseconds(),
+		AvgTickUs:      time.Duration(s.avgTick).Microseconds(),
+		MaxTickUs:      s.maxTick(now).Microseconds(),
+		LastBroadcastB: s.lastBytes,
+		AvgBroadcastB:  int(s.avgBytes),
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	voteKickWindow   = 30 * time.Second
+	voteKickCooldown = 2 * time.Minute
+	kickBanDuration  = 10 * time.Minute
+
+	// A votekick can only be started in a room of at least minVoteKickRoom
+	// players, and needs at least minVoteKickVotes yes votes however few
+	// are eligible, so nobody is kicked on their own say-so.
+	minVoteKickRoom  = 3
+	minVoteKickVotes = 2
+)
+
+// KickVote is a vote in progress to remove a player from a room. It belongs to
+// the room rather than to the initiator, so it keeps running if the player who
+// started it disconnects.
+type KickVote struct {
+	InitiatorID string
+	TargetID    string
+	Votes       map[string]bool
+	ExpiresAt   time.Time
+	timer       *time.Timer
+}
+
+func startKickVote(player *Player, targetID string) {
+	room := player.Room.Load()
+	if room == nil {
+		return
+	}
+
+	room.do(func() {
+		target, ok := room.Players[targetID]
+		if !ok || target == player {
+			sendError(player, "UNKNOWN_PLAYER", "no such player to votekick")
+			return
+		}
+		if room.Vote != nil {
+			sendError(player, "VOTE_RUNNING", "a votekick is already running")
+			return
+		}
+		if len(room.Players) < minVoteKickRoom {
+			sendError(player, "TOO_FEW_PLAYERS", fmt.Sprintf("a votekick needs at least %d players in the room", minVoteKickRoom))
+			return
+		}
+		if until, ok := room.VoteCooldowns[targetID]; ok && time.Now().Before(until) {
+			sendError(player, "VOTE_COOLDOWN", "that player was voted on too recently")
+			return
+		}
+
+		vote := &KickVote{
+			InitiatorID: player.ID,
+			TargetID:    targetID,
+			Votes:       map[string]bool{player.ID: true},
+			ExpiresAt:   time.Now().Add(voteKickWindow),
+		}
+		vote.timer = time.AfterFunc(voteKickWindow, func() {
+			room.do(func() {
+				if room.Vote != vote {
+					return
+				}
+				yes, _, needed := tallyKickVote(room, vote)
+				if yes >= needed {
+					endKickVote(room, "passed")
+				} else {
+					endKickVote(room, "failed")
+				}
+			})
+		})
+		room.Vote = vote
+
+		log.Printf("%s started a votekick against %s in room %s", player.ID, targetID, room.ID)
+
+		broadcastMessage(room, Message{
+			Type: "voteKickStarted",
+			Payload: VoteKickStartedPayload{
+				PlayerID:  player.ID,
+				TargetID:  targetID,
+				Name:      target.Name,
+				ExpiresAt: vote.ExpiresAt.UnixMilli(),
+			},
+		})
+		resolveKickVote(room)
+	})
+}
+
+func castKickVote(player *Player, targetID string, yes bool) {
+	room := player.Room.Load()
+	if room == nil {
+		return
+	}
+
+	room.do(func() {
+		vote := room.Vote
+		if vote == nil || vote.TargetID != targetID {
+			sendError(player, "NO_VOTE", "there is no votekick against that player")
+			return
+		}
+		if player.ID == vote.TargetID {
+			sendError(player, "CANNOT_VOTE", "you can't vote on your own votekick")
+			return
+		}
+
+		vote.Votes[player.ID] = yes
+		resolveKickVote(room)
+	})
+}
+
+// tallyKickVote counts the votes of players still in the room. The target is
+// not an eligible voter, and a two-thirds majority of the rest is needed, of
+// at least minVoteKickVotes.
+func tallyKickVote(room *Room, vote *KickVote) (yes, no, needed int) {
+	eligible := 0
+	for id := range room.Players {
+		if id == vote.TargetID {
+			continue
+		}
+		eligible++
+		if v, ok := vote.Votes[id]; ok {
+			if v {
+				yes++
+			} else {
+				no++
+			}
+		}
+	}
+	needed = max((2*eligible+2)/3, minVoteKickVotes)
+	return yes, no, needed
+}
+
+// resolveKickVote broadcasts the current tally and ends the vote early once
+// the outcome can no longer change. It must run on the room's goroutine.
+func resolveKickVote(room *Room) {
+	vote := room.Vote
+	yes, no, needed := tallyKickVote(room, vote)
+
+	broadcastMessage(room, Message{
+		Type: "voteKickUpdate",
+		Payload: VoteKickUpdatePayload{
+			TargetID:  vote.TargetID,
+			Yes:       yes,
+			No:        no,
+			Needed:    needed,
+			ExpiresAt: vote.ExpiresAt.UnixMilli(),
+		},
+	})
+
+	eligible := len(room.Players) - 1
+	switch {
+	case yes >= needed:
+		endKickVote(room, "passed")
+	case no > eligible-needed:
+		endKickVote(room, "failed")
+	}
+}
+
+// endKickVote closes the running vote with the given outcome and, if it
+// passed, removes the target. It must run on the room's goroutine.
+func endKickVote(room *Room, outcome string) {
+	vote := room.Vote
+	if vote == nil {
+		return
+	}
+	vote.timer.Stop()
+	room.Vote = nil
+	room.VoteCooldowns[vote.TargetID] = time.Now().Add(voteKickCooldown)
+
+	log.Printf("Votekick against %s in room %s %s", vote.TargetID, room.ID, outcome)
+
+	broadcastMessage(room, Message{
+		Type:    "voteKickEnded",
+		Payload: VoteKickEndedPayload{TargetID: vote.TargetID, Outcome: outcome},
+	})
+
+	if target, ok := room.Players[vote.TargetID]; outcome == "passed" && ok {
+		kickPlayer(room, target, closeKicked, "votekick")
+	}
+}
+
+// kickPlayer bans the player from the room for a while and closes their
+// connection with closeCode. The read loop then runs the normal removal
+// path; a player who is away is removed straight away.
+func kickPlayer(room *Room, player *Player, closeCode int, reason string) {
+	for _, key := range banKeys(player) {
+		room.Bans[key] = time.Now().Add(kickBanDuration)
+	}
+	player.Evicted = true
+
+	if player.Conn == nil {
+		dropHold(player)
+		return
+	}
+
+	sendMessage(player, Message{
+		Type:    "kicked",
+		Payload: KickedPayload{RoomID: room.ID, Reason: reason},
+	})
+	player.Conn.CloseWith(closeCode, reason)
+}
+
+// banKeys is what a ban on the player is kept under: their address and
+// their account. Connections that have neither, such as gRPC ones without
+// an address, are banned by player ID, rather than under an empty address
+// every such connection shares.
+func banKeys(player *Player) []string {
+	var keys []string
+	if player.IP != "" {
+		keys = append(keys, player.IP)
+	}
+	if player.AccountID != 0 {
+		keys = append(keys, fmt.Sprintf("account:%d", player.AccountID))
+	}
+	if len(keys) == 0 {
+		keys = append(keys, "player:"+player.ID)
+	}
+	return keys
+}
+
+// isBanned reports whether the player is banned from the room under any of
+// their ban keys. It must run on the room's goroutine.
+func (room *Room) isBanned(player *Player) bool {
+	for _, key := range banKeys(player) {
+		if until, ok := room.Bans[key]; ok && time.Now().Before(until) {
+			return true
+		}
+	}
+	return false
+}
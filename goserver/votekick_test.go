@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVoteKickNeedsThreePlayers(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+
+	alice.Send("votekick", VoteKickPayload{TargetID: playerID(t, bob)})
+	expectError(t, alice, "TOO_FEW_PLAYERS")
+}
+
+// The player who starts a votekick is one vote; a second is needed even
+// when they are two thirds of the voters.
+func TestVoteKickNeedsTwoVotes(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	carol := server.join(t, room, "carol")
+	carolID := playerID(t, carol)
+
+	alice.Send("votekick", VoteKickPayload{TargetID: carolID})
+	var update VoteKickUpdatePayload
+	if err := alice.ExpectMessage("voteKickUpdate", expectTimeout).Decode(&update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Yes != 1 || update.Needed != minVoteKickVotes {
+		t.Fatalf("tally %+v, want 1 of %d yes votes", update, minVoteKickVotes)
+	}
+
+	bob.Send("vote", VotePayload{TargetID: carolID, Vote: "yes"})
+	carol.ExpectMessage("kicked", expectTimeout)
+}
+
+func TestBanKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		player *Player
+		want   []string
+	}{
+		{"address", &Player{IP: "192.0.2.1"}, []string{"192.0.2.1"}},
+		{"address and account", &Player{IP: "192.0.2.1", AccountID: 7}, []string{"192.0.2.1", "account:7"}},
+		{"account", &Player{AccountID: 7}, []string{"account:7"}},
+		{"neither", &Player{}, []string{"player:p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.player.ID = "p1"
+			if got := banKeys(tt.player); !slices.Equal(got, tt.want) {
+				t.Fatalf("banKeys = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Banning a player who connected without an address doesn't ban everyone
+// else who did.
+func TestBanWithoutAnAddress(t *testing.T) {
+	testRooms(t)
+	room := rooms.Create(0)
+	kicked, other := &Player{}, &Player{}
+	kicked.ID, other.ID = "kicked", "other"
+	room.do(func() {
+		kickPlayer(room, kicked, closeKicked, "votekick")
+		if !room.isBanned(kicked) || room.isBanned(other) {
+			t.Errorf("banned: kicked %v, other %v", room.isBanned(kicked), room.isBanned(other))
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// defaultWordList is the word list used without -word-list.
+//
+//go:embed wordlist.txt
+var defaultWordList string
+
+// wordListPath is a file of words to filter instead of the default list,
+// set by flag.
+var wordListPath string
+
+// profanity is the filter for chat and player names.
+var profanity = mustWordFilter(strings.NewReader(defaultWordList))
+
+// initWordFilter loads the word list named by -word-list, if any.
+func initWordFilter() error {
+	if wordListPath == "" {
+		return nil
+	}
+	f, err := os.Open(wordListPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	filter, err := newWordFilter(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", wordListPath, err)
+	}
+	profanity = filter
+	return nil
+}
+
+// leetspeak maps the digits and symbols that stand in for letters to them.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// Where a listed word may match, as bits of filterNode.modes: as a whole
+// word, starting a longer word, ending one, or anywhere inside one.
+const (
+	matchWhole uint8 = 1 << iota
+	matchStart
+	matchEnd
+	matchInside
+)
+
+// wordFilter finds listed words in text. The words are compiled into a trie
+// once, so checking a message walks it rather than trying each word.
+type wordFilter struct {
+	root *filterNode
+}
+
+type filterNode struct {
+	children map[rune]*filterNode
+	modes    uint8 // where the word ending here may match; zero if none does
+}
+
+func mustWordFilter(list io.Reader) *wordFilter {
+	f, err := newWordFilter(list)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// newWordFilter compiles a word list: a word per line, blank lines and
+// lines starting with # skipped, with * at either end letting it match
+// inside a longer word on that side.
+func newWordFilter(list io.Reader) (*wordFilter, error) {
+	f := &wordFilter{root: &filterNode{}}
+	scanner := bufio.NewScanner(list)
+	for line := 1; scanner.Scan(); line++ {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		inside := 0
+		if trimmed, ok := strings.CutPrefix(word, "*"); ok {
+			word, inside = trimmed, inside|2
+		}
+		if trimmed, ok := strings.CutSuffix(word, "*"); ok {
+			word, inside = trimmed, inside|1
+		}
+		if word == "" || strings.Contains(word, "*") {
+			return nil, fmt.Errorf("line %d: bad word %q", line, scanner.Text())
+		}
+		node := f.root
+		for _, r := range word {
+			r = normalizeRune(r)
+			if node.children == nil {
+				node.children = make(map[rune]*filterNode)
+			}
+			next, ok := node.children[r]
+			if !ok {
+				next = &filterNode{}
+				node.children[r] = next
+			}
+			node = next
+		}
+		node.modes |= [...]uint8{matchWhole, matchStart, matchEnd, matchInside}[inside]
+	}
+	return f, scanner.Err()
+}
+
+// normalizeRune folds case and leetspeak.
+func normalizeRune(r rune) rune {
+	if letter, ok := leetspeak[r]; ok {
+		return letter
+	}
+	return unicode.ToLower(r)
+}
+
+// accepts reports whether a word ending at this node matches, given
+// whether it started where the text's word does and ended where it does.
+func (n *filterNode) accepts(atStart, atEnd bool) bool {
+	switch {
+	case atStart && atEnd:
+		return n.modes != 0
+	case atStart:
+		return n.modes&(matchStart|matchInside) != 0
+	case atEnd:
+		return n.modes&(matchEnd|matchInside) != 0
+	default:
+		return n.modes&matchInside != 0
+	}
+}
+
+// mask returns text with the letters of every listed word found in it
+// starred out, and whether there were any.
+func (f *wordFilter) mask(text string) (string, bool) {
+	runes := []rune(text)
+	masked := f.scan(runes)
+	if masked == nil {
+		return text, false
+	}
+	for i := range runes {
+		if masked[i] {
+			runes[i] = '*'
+		}
+	}
+	return string(runes), true
+}
+
+// contains reports whether text has a listed word in it.
+func (f *wordFilter) contains(text string) bool {
+	return f.scan([]rune(text)) != nil
+}
+
+// scan finds the listed words in text, returning which runes belong to
+// them, or nil if none do.
+//
+// Text is split into words of letters, digits and the symbols leetspeak
+// uses. @ and $ always count as part of a word; the other symbols only do
+// when a letter or digit follows them, so trailing punctuation doesn't.
+// Runs of one-letter words, as in "f u c k", are joined into one. Each word
+// is then matched after folding case and leetspeak, a letter repeated three
+// times or more matching it once or twice. Doubled letters are left alone,
+// so "shiitake" isn't taken for what it starts with.
+func (f *wordFilter) scan(text []rune) []bool {
+	var masked []bool
+	word := make([]rune, 0, len(text))
+	at := make([]int, 0, len(text)) // where each rune of word is in text
+	flush := func() {
+		for start := 0; start < len(word); {
+			end := f.root.longest(word, start)
+			if end < 0 {
+				start++
+				continue
+			}
+			if masked == nil {
+				masked = make([]bool, len(text))
+			}
+			for _, i := range at[start:end] {
+				masked[i] = true
+			}
+			start = end
+		}
+		word, at = word[:0], at[:0]
+	}
+
+	spelled := false // whether word so far is one-letter words
+	for i := 0; i < len(text); {
+		if !isWordRune(text, i) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(text) && isWordRune(text, j) {
+			j++
+		}
+		single := j-i == 1
+		if !(single && spelled) {
+			flush()
+		}
+		for k := i; k < j; k++ {
+			word = append(word, normalizeRune(text[k]))
+			at = append(at, k)
+		}
+		spelled = single
+		i = j
+	}
+	flush()
+	return masked
+}
+
+// isWordRune reports whether text[i] is part of a word.
+func isWordRune(text []rune, i int) bool {
+	r := text[i]
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '$' {
+		return true
+	}
+	if _, ok := leetspeak[r]; !ok || i+1 == len(text) {
+		return false
+	}
+	next := text[i+1]
+	return unicode.IsLetter(next) || unicode.IsDigit(next)
+}
+
+// longest returns where the longest listed word starting at word[start]
+// ends, or -1 if none does.
+func (n *filterNode) longest(word []rune, start int) int {
+	best := -1
+	var walk func(node *filterNode, i int)
+	walk = func(node *filterNode, i int) {
+		if node.modes != 0 && i > best && node.accepts(start == 0, i == len(word)) {
+			best = i
+		}
+		if i == len(word) {
+			return
+		}
+		if next, ok := node.children[word[i]]; ok {
+			walk(next, i+1)
+		}
+		if node != n && inRun(word, i) {
+			walk(node, i+1)
+		}
+	}
+	walk(n, start)
+	return best
+}
+
+// inRun reports whether word[i] repeats the rune before it, in a run of
+// three or more.
+func inRun(word []rune, i int) bool {
+	if word[i] != word[i-1] {
+		return false
+	}
+	return (i >= 2 && word[i-2] == word[i]) || (i+1 < len(word) && word[i+1] == word[i])
+}
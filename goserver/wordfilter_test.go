@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWordFilterMask(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"clean", "good game everyone", "good game everyone"},
+		{"whole word", "oh shit", "oh ****"},
+		{"case", "SHIT happens", "**** happens"},
+		{"trailing punctuation", "shit!", "****!"},
+		{"leetspeak digits", "sh1t", "****"},
+		{"leetspeak symbols", "a$$ and @ss", "*** and ***"},
+		{"leetspeak inside a word", "sh!t", "****"},
+		{"stretched", "shiiiiit", "********"},
+		{"spelled out", "s h i t", "* * * *"},
+		{"spelled out among words", "you are a s s", "you are * * *"},
+		{"starts a longer word", "shithead", "****head"},
+		{"ends a longer word", "bullshit", "********"},
+		{"anywhere inside", "motherfucking", "mother****ing"},
+		{"two in one message", "shit, a twat", "****, a ****"},
+		{"listed only whole", "cocktail party", "cocktail party"},
+		{"ends a word it may only start", "Scunthorpe", "Scunthorpe"},
+		{"doubled letters aren't a stretch", "shiitake", "shiitake"},
+		{"inside another word", "classic assassin", "classic assassin"},
+		{"digits alone", "1337 5000", "1337 5000"},
+		{"punctuation alone", "!!! $$$ @", "!!! $$$ @"},
+		{"non-Latin text", "привет 你好", "привет 你好"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, filtered := profanity.mask(tt.text)
+			if got != tt.want || filtered != (tt.want != tt.text) {
+				t.Fatalf("mask(%q) = %q, %v; want %q", tt.text, got, filtered, tt.want)
+			}
+			if contains := profanity.contains(tt.text); contains != filtered {
+				t.Fatalf("contains(%q) = %v, but mask filtered %v", tt.text, contains, filtered)
+			}
+		})
+	}
+}
+
+func TestNewWordFilter(t *testing.T) {
+	filter, err := newWordFilter(strings.NewReader("# a comment\n\n  heck  \ndarn*\n*gosh\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, want := range map[string]string{
+		"HECK":    "****",
+		"heckle":  "heckle",
+		"darned":  "****ed",
+		"undarn":  "undarn",
+		"ohmgosh": "ohm****",
+		"goshes":  "goshes",
+		"comment": "comment",
+	} {
+		if got, _ := filter.mask(text); got != want {
+			t.Errorf("mask(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	for _, list := range []string{"ok\n*\n", "ok\nbad*word\n", "**\n"} {
+		if _, err := newWordFilter(strings.NewReader(list)); err == nil {
+			t.Errorf("list %q accepted", list)
+		}
+	}
+}
+
+// Names with filtered words are refused at registration and replaced by a
+// placeholder for players without an account, who still get to play.
+func TestFilteredNames(t *testing.T) {
+	if problem := checkName("Sh1thead"); problem == "" {
+		t.Fatal("registration would accept Sh1thead")
+	}
+	if problem := checkName("Shiitake"); problem != "" {
+		t.Fatalf("registration refuses Shiitake: %s", problem)
+	}
+
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob a$$")
+	var joined PlayerPayload
+	if err := alice.ExpectMessage("playerJoined", expectTimeout).Decode(&joined); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Player " + playerID(t, bob)[:4]; joined.Name != want {
+		t.Fatalf("bob joined as %q, want %q", joined.Name, want)
+	}
+}
+
+// A room masks filtered words by default; with the reject policy the
+// message is refused instead, and nobody else sees it.
+func TestChatFilterPolicy(t *testing.T) {
+	server := startServer(t)
+	room := server.createRoom(t, "")
+	alice := server.join(t, room, "alice")
+	bob := server.join(t, room, "bob")
+	alice.ExpectMessage("playerJoined", expectTimeout)
+
+	bob.Chat("what the fuuuck")
+	expectChat(t, alice, "bob", "what the ******", "")
+
+	alice.Send("configure", ConfigurePayload{Settings: &RoomSettings{ChatFilter: ChatFilterReject}})
+	bob.ExpectMessage("settingsChanged", expectTimeout)
+	bob.Chat("what the fuuuck")
+	expectError(t, bob, "CHAT_FILTERED")
+	bob.Chat("never mind")
+	expectChat(t, alice, "bob", "never mind", "")
+}
+
+func BenchmarkWordFilter(b *testing.B) {
+	message := strings.Repeat("gg everyone, that last round was cl0se! ", 5)
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	for range b.N {
+		profanity.mask(message)
+	}
+}
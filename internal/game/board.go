@@ -0,0 +1,83 @@
+// Package game holds the rules of the game: the board, claiming, scoring,
+// leavers' territory and the end of a match. It knows nothing about
+// connections or wire formats; callers feed it inputs and turn the events it
+// returns into messages.
+package game
+
+// Position is a cell on the board, in board cells from the top left.
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Board holds the color of the player owning each cell, indexed [y][x]. An
+// empty string is a neutral cell.
+type Board [][]string
+
+// NewBoard returns an empty square board.
+func NewBoard(size int) Board {
+	board := make(Board, size)
+	for i := range board {
+		board[i] = make([]string, size)
+	}
+	return board
+}
+
+func (b Board) Size() int {
+	return len(b)
+}
+
+func (b Board) InBounds(pos Position) bool {
+	return pos.X >= 0 && pos.X < b.Size() && pos.Y >= 0 && pos.Y < b.Size()
+}
+
+// Owner is the color owning the cell, or "" for a neutral one.
+func (b Board) Owner(pos Position) string {
+	return b[pos.Y][pos.X]
+}
+
+// Count is how many cells color owns, counted cell by cell. Match.Territory
+// is the same without the scan; Count is for checking it.
+func (b Board) Count(color string) int {
+	count := 0
+	for _, row := range b {
+		for _, cell := range row {
+			if cell == color {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Cells lists the cells color owns, row by row.
+func (b Board) Cells(color string) []Position {
+	var cells []Position
+	for y, row := range b {
+		for x, cell := range row {
+			if cell == color {
+				cells = append(cells, Position{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// Step is the cell one move in direction from pos, kept on a board of the
+// given size. Direction is one of "up", "down", "left" and "right"; anything
+// else stays put.
+func Step(pos Position, direction string, size int) Position {
+	switch direction {
+	case "up":
+		pos.Y--
+	case "down":
+		pos.Y++
+	case "left":
+		pos.X--
+	case "right":
+		pos.X++
+	}
+	pos.X = min(max(pos.X, 0), size-1)
+	pos.Y = min(max(pos.Y, 0), size-1)
+	return pos
+}
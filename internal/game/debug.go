@@ -0,0 +1,33 @@
+//go:build debug
+
+package game
+
+import "fmt"
+
+// debugChecks turns on the engine's self-checks, which recount what the
+// match tracks incrementally and panic on any disagreement. Build with
+// -tags debug to enable them.
+const debugChecks = true
+
+// checkTerritory recounts every color's cells on the board and panics if
+// the match's running territory counts disagree.
+func (m *Match) checkTerritory() {
+	counted := make(map[string]int)
+	for _, row := range m.Board {
+		for _, cell := range row {
+			if cell != "" {
+				counted[cell]++
+			}
+		}
+	}
+	for color, n := range counted {
+		if m.territory[color] != n {
+			panic(fmt.Sprintf("game: territory of %s is %d, board has %d", color, m.territory[color], n))
+		}
+	}
+	for color, n := range m.territory {
+		if counted[color] != n {
+			panic(fmt.Sprintf("game: territory of %s is %d, board has %d", color, n, counted[color]))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package game
+
+import "time"
+
+// Player is a player's state as far as the rules go. Callers embed it in
+// their own player type alongside whatever else they track.
+type Player struct {
+	ID       string   `json:"id"`
+	Color    string   `json:"color"`
+	Score    int      `json:"score"`
+	Position Position `json:"position"`
+}
+
+// Match is the state of one game: the board and the rules it is played by.
+// It advances in fixed steps of Interval, one per call to Step, so its clock
+// is the number of steps taken rather than the wall clock. It is not safe for
+// concurrent use.
+type Match struct {
+	Board    Board
+	Rules    RuleSet
+	Interval time.Duration
+
+	// Steal allows claiming cells another player owns.
+	Steal bool
+
+	// Leavers decides what happens to a leaving player's cells.
+	Leavers TerritoryRule
+
+	ticks   int
+	decays  []*decayingTerritory
+	changed map[Position]bool
+
+	// territory counts the cells each color owns, kept up to date by
+	// SetCell so scoring never has to scan the board.
+	territory map[string]int
+}
+
+// Event is something a call into the match did that players should hear
+// about.
+type Event interface {
+	event()
+}
+
+// Moved is a player moving from one cell to another. Seq is the Seq of the
+// Move that did it.
+type Moved struct {
+	Player   *Player
+	From, To Position
+	Seq      uint64
+}
+
+// Claimed is a cell changing hands as a player moves onto it.
+type Claimed struct {
+	Player *Player
+	Cell   Position
+	From   string
+}
+
+// Spawned is a player who joined mid-match taking their place on the board.
+type Spawned struct {
+	Player *Player
+}
+
+func (Moved) event()   {}
+func (Claimed) event() {}
+func (Spawned) event() {}
+
+// Result is how a match ended. Winner is nil if nobody scored.
+type Result struct {
+	Winner *Player
+	Scores map[string]int
+}
+
+// NewMatch starts a match on an empty board, with stealing allowed, that
+// advances by interval each step.
+func NewMatch(size int, interval time.Duration, rules RuleSet, leavers TerritoryRule) *Match {
+	return &Match{
+		Board:    NewBoard(size),
+		Rules:    rules,
+		Interval: interval,
+		Steal:    true,
+		Leavers:  leavers,
+	}
+}
+
+// Elapsed is the match time: how many steps it has taken, times Interval.
+func (m *Match) Elapsed() time.Duration {
+	return time.Duration(m.ticks) * m.Interval
+}
+
+// SetCell changes the owner of a cell and records the change for Changes.
+// Every change to the board goes through it.
+func (m *Match) SetCell(pos Position, color string) {
+	owner := m.Board.Owner(pos)
+	if owner == color {
+		return
+	}
+	m.Board[pos.Y][pos.X] = color
+	if m.territory == nil {
+		m.territory = make(map[string]int)
+	}
+	if owner != "" {
+		if m.territory[owner]--; m.territory[owner] == 0 {
+			delete(m.territory, owner)
+		}
+	}
+	if color != "" {
+		m.territory[color]++
+	}
+	if m.changed == nil {
+		m.changed = make(map[Position]bool)
+	}
+	m.changed[pos] = true
+}
+
+// Territory is how many cells color owns. It is Board.Count without the
+// scan.
+func (m *Match) Territory(color string) int {
+	return m.territory[color]
+}
+
+// Changes appends the cells that changed owner since the previous call to
+// cells and returns the result.
+func (m *Match) Changes(cells []Position) []Position {
+	for cell := range m.changed {
+		cells = append(cells, cell)
+	}
+	clear(m.changed)
+	return cells
+}
+
+// Claim gives the cell to color, unless it is off the board or stealing is
+// off and someone else owns it. It reports whether the cell is color's now.
+func (m *Match) Claim(pos Position, color string) bool {
+	if !m.Board.InBounds(pos) {
+		return false
+	}
+	if owner := m.Board.Owner(pos); owner != "" && owner != color && !m.Steal {
+		return false
+	}
+	m.SetCell(pos, color)
+	return true
+}
+
+// Spawn places the player at pos with the free cells within radius of it as
+// starting territory.
+func (m *Match) Spawn(player *Player, pos Position, radius int) {
+	player.Position = pos
+	for y := pos.Y - radius; y <= pos.Y+radius; y++ {
+		for x := pos.X - radius; x <= pos.X+radius; x++ {
+			cell := Position{X: x, Y: y}
+			if m.Board.InBounds(cell) && m.Board.Owner(cell) == "" {
+				m.SetCell(cell, player.Color)
+			}
+		}
+	}
+}
+
+// Scores is each player's score by ID, as the rules count it.
+func (m *Match) Scores(players []*Player) map[string]int {
+	scores := make(map[string]int, len(players))
+	for _, player := range players {
+		scores[player.ID] = m.Rules.ScoreOf(m, player)
+	}
+	return scores
+}
+
+// End settles the match: as the rules decided if they ended it early, and
+// otherwise with the player with the highest score as the winner, the
+// earliest in players on a tie.
+func (m *Match) End(players []*Player) Result {
+	if over, result := m.Rules.CheckEnd(m, players); over {
+		return result
+	}
+	result := Result{Scores: m.Scores(players)}
+	best := 0
+	for _, player := range players {
+		if score := result.Scores[player.ID]; score > best {
+			best = score
+			result.Winner = player
+		}
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestMatch is a classic match with one-second steps on a board of the
+// given size.
+func newTestMatch(size int, leavers TerritoryRule) *Match {
+	rules, _ := NewRules("classic")
+	return NewMatch(size, time.Second, rules, leavers)
+}
+
+// paint gives each cell to color.
+func paint(m *Match, color string, cells ...Position) {
+	for _, cell := range cells {
+		m.SetCell(cell, color)
+	}
+}
+
+// checkTerritory fails the test if the match's running territory counts
+// disagree with the board.
+func checkTerritory(t *testing.T, m *Match, colors ...string) {
+	t.Helper()
+	for _, color := range colors {
+		if got, want := m.Territory(color), m.Board.Count(color); got != want {
+			t.Errorf("territory of %s is %d, board has %d", color, got, want)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	tests := []struct {
+		name  string
+		owner string
+		steal bool
+		pos   Position
+		want  bool
+		after string
+	}{
+		{"neutral cell", "", false, Position{X: 1, Y: 1}, true, "red"},
+		{"own cell", "red", false, Position{X: 1, Y: 1}, true, "red"},
+		{"stolen cell", "blue", true, Position{X: 1, Y: 1}, true, "red"},
+		{"guarded cell", "blue", false, Position{X: 1, Y: 1}, false, "blue"},
+		{"off the board", "", true, Position{X: 3, Y: 1}, false, ""},
+		{"before the board", "", true, Position{X: -1, Y: 0}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(3, TerritoryKeep)
+			m.Steal = tt.steal
+			if tt.owner != "" {
+				paint(m, tt.owner, Position{X: 1, Y: 1})
+			}
+			if got := m.Claim(tt.pos, "red"); got != tt.want {
+				t.Fatalf("Claim = %v, want %v", got, tt.want)
+			}
+			if m.Board.InBounds(tt.pos) {
+				if owner := m.Board.Owner(tt.pos); owner != tt.after {
+					t.Fatalf("owner = %q, want %q", owner, tt.after)
+				}
+			}
+			checkTerritory(t, m, "red", "blue")
+		})
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		name   string
+		pos    Position
+		radius int
+		taken  []Position
+		want   int
+	}{
+		{"middle", Position{X: 2, Y: 2}, 1, nil, 9},
+		{"radius zero", Position{X: 2, Y: 2}, 0, nil, 1},
+		{"corner", Position{X: 0, Y: 0}, 1, nil, 4},
+		{"edge", Position{X: 4, Y: 2}, 1, nil, 6},
+		{"next to someone", Position{X: 2, Y: 2}, 1, []Position{{X: 1, Y: 1}, {X: 3, Y: 3}}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(5, TerritoryKeep)
+			paint(m, "blue", tt.taken...)
+			player := &Player{ID: "a", Color: "red"}
+			m.Spawn(player, tt.pos, tt.radius)
+
+			if player.Position != tt.pos {
+				t.Errorf("position = %v, want %v", player.Position, tt.pos)
+			}
+			if got := m.Territory("red"); got != tt.want {
+				t.Errorf("territory = %d, want %d", got, tt.want)
+			}
+			if got := m.Territory("blue"); got != len(tt.taken) {
+				t.Errorf("spawn took %d of blue's cells", len(tt.taken)-got)
+			}
+			checkTerritory(t, m, "red", "blue")
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		cells  []int // cells owned, by player
+		winner int   // index into the players, or -1 for nobody
+	}{
+		{"highest score", []int{2, 5, 3}, 1},
+		{"tie goes to the earliest", []int{4, 4, 1}, 0},
+		{"nobody scored", []int{0, 0, 0}, -1},
+		{"only scorer", []int{0, 0, 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(10, TerritoryKeep)
+			colors := []string{"red", "blue", "green"}
+			players := make([]*Player, len(colors))
+			for i, color := range colors {
+				players[i] = &Player{ID: color, Color: color}
+				for x := range tt.cells[i] {
+					paint(m, color, Position{X: x, Y: i})
+				}
+			}
+
+			result := m.End(players)
+			for i, player := range players {
+				if result.Scores[player.ID] != tt.cells[i] {
+					t.Errorf("score of %s = %d, want %d", player.ID, result.Scores[player.ID], tt.cells[i])
+				}
+			}
+			switch {
+			case tt.winner < 0 && result.Winner != nil:
+				t.Errorf("winner = %s, want nobody", result.Winner.ID)
+			case tt.winner >= 0 && result.Winner != players[tt.winner]:
+				t.Errorf("winner = %v, want %s", result.Winner, players[tt.winner].ID)
+			}
+		})
+	}
+}
+
+// A king of the hill match ends early, as soon as someone holds the hill
+// long enough, with them as the winner whatever the territory.
+func TestEndKingOfTheHill(t *testing.T) {
+	rules, _ := NewRules("kingOfTheHill")
+	m := NewMatch(11, time.Second, rules, TerritoryKeep)
+	king := &Player{ID: "king", Color: "red"}
+	farmer := &Player{ID: "farmer", Color: "blue"}
+	m.Spawn(king, Position{X: 5, Y: 5}, 0)
+	m.Spawn(farmer, Position{X: 0, Y: 0}, 3)
+	players := []*Player{farmer, king}
+
+	for i := 1; i < HillTarget; i++ {
+		if _, over := m.Step(nil, players); over {
+			t.Fatalf("match over after %d steps, want %d", i, HillTarget)
+		}
+	}
+	if _, over := m.Step(nil, players); !over {
+		t.Fatalf("match still on after %d steps on the hill", HillTarget)
+	}
+
+	result := m.End(players)
+	if result.Winner != king {
+		t.Fatalf("winner = %v, want the king", result.Winner)
+	}
+	if result.Scores["king"] != HillTarget || result.Scores["farmer"] != 0 {
+		t.Fatalf("scores = %v", result.Scores)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !debug
+
+package game
+
+const debugChecks = false
+
+func (m *Match) checkTerritory() {}
@@ -0,0 +1,139 @@
+package game
+
+import "sort"
+
+// RuleSet is a game mode: how moving, time and scoring work, and when a
+// match ends early. A RuleSet may keep state of its own, so every match gets
+// a fresh one from NewRules. The match passes itself in; hooks run with the
+// match's state up to date and may change it.
+type RuleSet interface {
+	// OnMove is called in the claims stage of a step for each move the
+	// player made, unless another player got to the cell first that step,
+	// and returns what came of it beyond the move itself.
+	OnMove(m *Match, player *Player, from, to Position) []Event
+
+	// OnTick is called once per step, after leavers' territory has decayed,
+	// with the players still in the match.
+	OnTick(m *Match, players []*Player)
+
+	// CheckEnd reports whether the match is over before its time runs out,
+	// and if so how it ended.
+	CheckEnd(m *Match, players []*Player) (bool, Result)
+
+	// ScoreOf is the player's current score.
+	ScoreOf(m *Match, player *Player) int
+}
+
+// modes maps game mode names to constructors for their rules.
+var modes = map[string]func() RuleSet{}
+
+// Register makes a game mode available to NewRules under name.
+func Register(name string, newRules func() RuleSet) {
+	modes[name] = newRules
+}
+
+// NewRules returns fresh rules for the named game mode, or false if there is
+// no such mode.
+func NewRules(name string) (RuleSet, bool) {
+	newRules, ok := modes[name]
+	if !ok {
+		return nil, false
+	}
+	return newRules(), true
+}
+
+// Modes lists the registered game modes in name order.
+func Modes() []string {
+	names := make([]string, 0, len(modes))
+	for name := range modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("classic", func() RuleSet { return ClassicRules{} })
+	Register("kingOfTheHill", func() RuleSet { return &KingOfTheHillRules{points: make(map[string]int)} })
+}
+
+// ClassicRules is territory control: moving onto a cell claims it, a
+// player's score is the cells they own, and the match runs its full time.
+type ClassicRules struct{}
+
+func (ClassicRules) OnMove(m *Match, player *Player, from, to Position) []Event {
+	owner := m.Board.Owner(to)
+	if m.Claim(to, player.Color) && owner != player.Color {
+		return []Event{Claimed{Player: player, Cell: to, From: owner}}
+	}
+	return nil
+}
+
+func (ClassicRules) OnTick(m *Match, players []*Player) {}
+
+func (ClassicRules) CheckEnd(m *Match, players []*Player) (bool, Result) {
+	return false, Result{}
+}
+
+func (ClassicRules) ScoreOf(m *Match, player *Player) int {
+	return m.Territory(player.Color)
+}
+
+const (
+	// HillRadius is how far from the center of the board the hill reaches.
+	HillRadius = 2
+
+	// HillTarget is the score that wins a king of the hill match outright.
+	HillTarget = 300
+)
+
+// KingOfTheHillRules scores holding the middle of the board. Moving claims
+// cells as in classic, but territory counts for nothing: each tick, a player
+// standing on the hill with nobody else on it scores a point, and the first
+// to HillTarget wins.
+type KingOfTheHillRules struct {
+	ClassicRules
+	points map[string]int
+}
+
+// OnHill reports whether pos is on the hill of a board of the given size.
+func OnHill(pos Position, size int) bool {
+	center := size / 2
+	return abs(pos.X-center) <= HillRadius && abs(pos.Y-center) <= HillRadius
+}
+
+func (r *KingOfTheHillRules) OnTick(m *Match, players []*Player) {
+	var king *Player
+	for _, player := range players {
+		if !OnHill(player.Position, m.Board.Size()) {
+			continue
+		}
+		if king != nil {
+			return
+		}
+		king = player
+	}
+	if king != nil {
+		r.points[king.ID]++
+	}
+}
+
+func (r *KingOfTheHillRules) CheckEnd(m *Match, players []*Player) (bool, Result) {
+	for _, player := range players {
+		if r.points[player.ID] >= HillTarget {
+			return true, Result{Winner: player, Scores: m.Scores(players)}
+		}
+	}
+	return false, Result{}
+}
+
+func (r *KingOfTheHillRules) ScoreOf(m *Match, player *Player) int {
+	return r.points[player.ID]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
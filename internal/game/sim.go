@@ -0,0 +1,171 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Directions are the directions a player can move in.
+var Directions = []string{"up", "down", "left", "right"}
+
+// Driver decides a simulated player's move each step: a direction, or ""
+// to stand still. rand is the simulation's random source, the only one a
+// driver may use, so a seed replays a simulation exactly.
+type Driver interface {
+	Move(m *Match, self *Player, rand *rand.Rand) string
+}
+
+// Script plays back a fixed list of moves, one per step, and then stands
+// still.
+type Script struct {
+	Moves []string
+	next  int
+}
+
+func (s *Script) Move(*Match, *Player, *rand.Rand) string {
+	if s.next >= len(s.Moves) {
+		return ""
+	}
+	s.next++
+	return s.Moves[s.next-1]
+}
+
+// RandomBot moves in a random direction every step.
+type RandomBot struct{}
+
+func (RandomBot) Move(m *Match, self *Player, rand *rand.Rand) string {
+	return Directions[rand.Intn(len(Directions))]
+}
+
+// GreedyBot moves onto a neighbouring cell it doesn't own, preferring
+// neutral cells to other players', and moves at random when it owns all
+// four.
+type GreedyBot struct{}
+
+func (GreedyBot) Move(m *Match, self *Player, rand *rand.Rand) string {
+	size := m.Board.Size()
+	var neutral, taken []string
+	for _, direction := range Directions {
+		to := Step(self.Position, direction, size)
+		switch owner := m.Board.Owner(to); {
+		case to == self.Position, owner == self.Color:
+		case owner == "":
+			neutral = append(neutral, direction)
+		case m.Steal:
+			taken = append(taken, direction)
+		}
+	}
+	switch {
+	case len(neutral) > 0:
+		return neutral[rand.Intn(len(neutral))]
+	case len(taken) > 0:
+		return taken[rand.Intn(len(taken))]
+	}
+	return Directions[rand.Intn(len(Directions))]
+}
+
+// SimConfig describes a simulated match: the room settings the server would
+// play it with, the players and the seed of its random source.
+type SimConfig struct {
+	Mode        string
+	BoardSize   int
+	Interval    time.Duration
+	Duration    time.Duration
+	Steal       bool
+	Leavers     TerritoryRule
+	SpawnRadius int
+	Players     []SimPlayer
+	Seed        int64
+
+	// LogEvents keeps every step's events in the result. Leave it off when
+	// only the outcome matters.
+	LogEvents bool
+}
+
+// SimPlayer is a simulated player. LeaveAt is the step at which they leave
+// the match, zero if they stay to the end.
+type SimPlayer struct {
+	ID      string
+	Color   string
+	Driver  Driver
+	LeaveAt int
+}
+
+// SimEvent is an event of a simulated match and the step it happened in,
+// counting from 1.
+type SimEvent struct {
+	Step  int
+	Event Event
+}
+
+// SimResult is how a simulated match went. Result is settled over the
+// players still in the match at its end.
+type SimResult struct {
+	Result
+	Steps  int
+	Events []SimEvent
+	Match  *Match
+}
+
+// Simulate plays a match from start to finish as the server would, without
+// a clock: the players spawn at random cells in order, then every step each
+// player still in the match makes the move its driver picks, until the
+// rules end the match or Duration has passed. The same config and seed
+// always give the same result.
+func Simulate(cfg SimConfig) (SimResult, error) {
+	rules, ok := NewRules(cfg.Mode)
+	if !ok {
+		return SimResult{}, fmt.Errorf("unknown game mode %q", cfg.Mode)
+	}
+	if cfg.BoardSize <= 0 || cfg.Interval <= 0 {
+		return SimResult{}, fmt.Errorf("board size and interval must be positive")
+	}
+	rand := rand.New(rand.NewSource(cfg.Seed))
+	m := NewMatch(cfg.BoardSize, cfg.Interval, rules, cfg.Leavers)
+	m.Steal = cfg.Steal
+
+	players := make([]*Player, len(cfg.Players))
+	for i, p := range cfg.Players {
+		players[i] = &Player{ID: p.ID, Color: p.Color}
+		pos := Position{X: rand.Intn(cfg.BoardSize), Y: rand.Intn(cfg.BoardSize)}
+		m.Spawn(players[i], pos, cfg.SpawnRadius)
+	}
+
+	var result SimResult
+	steps := int(cfg.Duration / cfg.Interval)
+	active := players
+	for step := 1; step <= steps; step++ {
+		var inputs []Input
+		var remaining []*Player
+		for i, player := range players {
+			p := cfg.Players[i]
+			switch {
+			case p.LeaveAt > 0 && step == p.LeaveAt:
+				inputs = append(inputs, Leave{Player: player})
+			case p.LeaveAt > 0 && step > p.LeaveAt:
+			default:
+				remaining = append(remaining, player)
+				if direction := p.Driver.Move(m, player, rand); direction != "" {
+					inputs = append(inputs, Move{Player: player, Direction: direction, Seq: uint64(step)})
+				}
+			}
+		}
+		active = remaining
+
+		events, over := m.Step(inputs, active)
+		result.Steps = step
+		if cfg.LogEvents {
+			for _, event := range events {
+				result.Events = append(result.Events, SimEvent{Step: step, Event: event})
+			}
+		}
+		if over {
+			break
+		}
+	}
+
+	result.Result = m.End(active)
+	result.Match = m
+	return result, nil
+}
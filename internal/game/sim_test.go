@@ -0,0 +1,136 @@
+package game
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// simConfig is a four-player match with every kind of driver, a leaver and
+// stealing, so that a run exercises most of Step.
+func simConfig(mode string, seed int64) SimConfig {
+	return SimConfig{
+		Mode:        mode,
+		BoardSize:   12,
+		Interval:    time.Second,
+		Duration:    40 * time.Second,
+		Steal:       true,
+		Leavers:     TerritoryDecay,
+		SpawnRadius: 1,
+		Seed:        seed,
+		LogEvents:   true,
+		Players: []SimPlayer{
+			{ID: "a", Color: "red", Driver: GreedyBot{}},
+			{ID: "b", Color: "blue", Driver: RandomBot{}},
+			{ID: "c", Color: "green", Driver: GreedyBot{}, LeaveAt: 15},
+			{ID: "d", Color: "gold", Driver: &Script{Moves: strings.Split(strings.Repeat("right,down,", 10), ",")}},
+		},
+	}
+}
+
+// The same config and seed give the same match, step for step, in every
+// mode.
+func TestSimulateIsDeterministic(t *testing.T) {
+	for _, mode := range Modes() {
+		t.Run(mode, func(t *testing.T) {
+			first, err := Simulate(simConfig(mode, 42))
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := Simulate(simConfig(mode, 42))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Steps != second.Steps || !reflect.DeepEqual(first.Result, second.Result) {
+				t.Fatalf("results differ: %d steps, %+v; then %d steps, %+v", first.Steps, first.Result, second.Steps, second.Result)
+			}
+			if !reflect.DeepEqual(first.Events, second.Events) {
+				t.Fatalf("events differ between runs")
+			}
+			if !reflect.DeepEqual(first.Match.Board, second.Match.Board) {
+				t.Fatalf("boards differ:\n%v\n%v", first.Match.Board, second.Match.Board)
+			}
+
+			other, err := Simulate(simConfig(mode, 43))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(first.Match.Board, other.Match.Board) {
+				t.Fatal("another seed played the same match")
+			}
+		})
+	}
+}
+
+// However a match plays out, the running territory counts match the board.
+func TestSimulatedTerritory(t *testing.T) {
+	for _, mode := range Modes() {
+		t.Run(mode, func(t *testing.T) {
+			result, err := Simulate(simConfig(mode, 7))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTerritory(t, result.Match, "red", "blue", "green", "gold")
+		})
+	}
+}
+
+// render draws the board a row per line, each cell as its owner's initial
+// or . for a neutral cell.
+func render(b Board) string {
+	var s strings.Builder
+	for _, row := range b {
+		for _, owner := range row {
+			if owner == "" {
+				s.WriteByte('.')
+			} else {
+				s.WriteByte(owner[0])
+			}
+		}
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+// A few steps of a scripted match, each checked against the pipeline order
+// Step documents: joins and leaves first, then moves, collisions and claims.
+func TestStepPipeline(t *testing.T) {
+	m := newTestMatch(4, TerritoryNeutral)
+	red := &Player{ID: "a", Color: "red"}
+	blue := &Player{ID: "b", Color: "blue"}
+	m.Spawn(red, Position{X: 0, Y: 0}, 0)
+	m.Spawn(blue, Position{X: 2, Y: 0}, 0)
+	green := &Player{ID: "c", Color: "green"}
+
+	steps := []struct {
+		inputs  []Input
+		players []*Player
+		board   string
+	}{
+		// Both step onto the middle cell; red, first to move, claims it.
+		{[]Input{Move{Player: red, Direction: "right"}, Move{Player: blue, Direction: "left"}}, []*Player{red, blue},
+			"rrb.\n....\n....\n....\n"},
+		// Blue leaves before red's move, so red's move onto blue's old cell
+		// finds it neutral.
+		{[]Input{Move{Player: red, Direction: "right"}, Leave{Player: blue}}, []*Player{red},
+			"rrr.\n....\n....\n....\n"},
+		// Green joins on the cell red is moving to, which is free when green
+		// spawns there; red's move then steals it.
+		{[]Input{Move{Player: red, Direction: "right"}, Join{Player: green, Position: Position{X: 3, Y: 0}}}, []*Player{red, green},
+			"rrrr\n....\n....\n....\n"},
+		// Green moves down and red into the edge, which does nothing.
+		{[]Input{Move{Player: green, Direction: "down"}, Move{Player: red, Direction: "right"}}, []*Player{red, green},
+			"rrrr\n...g\n....\n....\n"},
+	}
+	for i, step := range steps {
+		m.Step(step.inputs, step.players)
+		if got := render(m.Board); got != step.board {
+			t.Fatalf("after step %d the board is\n%swant\n%s", i+1, got, step.board)
+		}
+		checkTerritory(t, m, "red", "blue", "green")
+	}
+	if red.Score != 4 || green.Score != 1 {
+		t.Fatalf("scores red %d, green %d; want 4 and 1", red.Score, green.Score)
+	}
+}
@@ -0,0 +1,111 @@
+package game
+
+// Input is something a player asked of the match, applied at the start of
+// the next step.
+type Input interface {
+	input()
+}
+
+// Move moves the player one cell in Direction. Seq is the caller's sequence
+// number for it, passed back in the Moved event.
+type Move struct {
+	Player    *Player
+	Direction string
+	Seq       uint64
+}
+
+// Join places a player who joined mid-match at Position, with the free cells
+// within Radius of it as starting territory.
+type Join struct {
+	Player   *Player
+	Position Position
+	Radius   int
+}
+
+// Leave takes a player out of the match, applying the leaver rule to their
+// cells.
+type Leave struct {
+	Player *Player
+}
+
+func (Move) input()  {}
+func (Join) input()  {}
+func (Leave) input() {}
+
+// debugCheckInterval is how many steps apart the debug self-checks run.
+const debugCheckInterval = 50
+
+// step is one move made during a step, kept for the claims stage.
+type step struct {
+	player   *Player
+	from, to Position
+}
+
+// Step advances the match by one Interval. Everything that changes the
+// match between its start and its end happens here, in a fixed order, so
+// the same inputs in the same order always give the same match:
+//
+//  1. Inputs: joins and leaves take effect, in the order given.
+//  2. Movement: each Move steps its player one cell, in the order given. A
+//     move into the edge of the board does nothing.
+//  3. Collisions: a cell entered by several players in this step goes to
+//     the first of them to enter it; the others' moves onto it claim nothing.
+//  4. Claims: the rules react to every move that survived stage 3.
+//  5. Effects: leavers' territory decays and the rules run their tick.
+//  6. Scores: every player in players gets their score as the rules count it.
+//  7. End: the rules decide whether the match is over.
+//
+// players are the players taking part in the step; players in the match but
+// away keep their score. Step returns the events of the step in stage order
+// and whether the match is over.
+func (m *Match) Step(inputs []Input, players []*Player) ([]Event, bool) {
+	m.ticks++
+
+	var events []Event
+	var moves []Move
+	for _, input := range inputs {
+		switch input := input.(type) {
+		case Join:
+			m.Spawn(input.Player, input.Position, input.Radius)
+			events = append(events, Spawned{Player: input.Player})
+		case Leave:
+			m.release(input.Player)
+		case Move:
+			moves = append(moves, input)
+		}
+	}
+
+	var steps []step
+	for _, move := range moves {
+		from := move.Player.Position
+		to := Step(from, move.Direction, m.Board.Size())
+		if to == from {
+			continue
+		}
+		move.Player.Position = to
+		steps = append(steps, step{player: move.Player, from: from, to: to})
+		events = append(events, Moved{Player: move.Player, From: from, To: to, Seq: move.Seq})
+	}
+
+	entered := make(map[Position]*Player, len(steps))
+	for _, s := range steps {
+		if first, ok := entered[s.to]; ok && first != s.player {
+			continue
+		}
+		entered[s.to] = s.player
+		events = append(events, m.Rules.OnMove(m, s.player, s.from, s.to)...)
+	}
+
+	m.decay()
+	m.Rules.OnTick(m, players)
+
+	for _, player := range players {
+		player.Score = m.Rules.ScoreOf(m, player)
+	}
+	if debugChecks && m.ticks%debugCheckInterval == 0 {
+		m.checkTerritory()
+	}
+
+	over, _ := m.Rules.CheckEnd(m, players)
+	return events, over
+}
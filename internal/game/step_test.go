@@ -0,0 +1,217 @@
+package game
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStepMovement(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      Position
+		direction string
+		want      Position
+		moved     bool
+	}{
+		{"up", Position{X: 2, Y: 2}, "up", Position{X: 2, Y: 1}, true},
+		{"down", Position{X: 2, Y: 2}, "down", Position{X: 2, Y: 3}, true},
+		{"left", Position{X: 2, Y: 2}, "left", Position{X: 1, Y: 2}, true},
+		{"right", Position{X: 2, Y: 2}, "right", Position{X: 3, Y: 2}, true},
+		{"into the top edge", Position{X: 2, Y: 0}, "up", Position{X: 2, Y: 0}, false},
+		{"into the right edge", Position{X: 4, Y: 2}, "right", Position{X: 4, Y: 2}, false},
+		{"nowhere", Position{X: 2, Y: 2}, "sideways", Position{X: 2, Y: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(5, TerritoryKeep)
+			player := &Player{ID: "a", Color: "red", Position: tt.from}
+			events, over := m.Step([]Input{Move{Player: player, Direction: tt.direction, Seq: 7}}, []*Player{player})
+			if over {
+				t.Fatal("classic match over after a step")
+			}
+			if player.Position != tt.want {
+				t.Fatalf("position = %v, want %v", player.Position, tt.want)
+			}
+
+			var want []Event
+			if tt.moved {
+				want = []Event{
+					Moved{Player: player, From: tt.from, To: tt.want, Seq: 7},
+					Claimed{Player: player, Cell: tt.want},
+				}
+			}
+			if !reflect.DeepEqual(events, want) {
+				t.Fatalf("events = %+v, want %+v", events, want)
+			}
+			if want := len(want) / 2; player.Score != want {
+				t.Fatalf("score = %d, want %d", player.Score, want)
+			}
+		})
+	}
+}
+
+func TestStepClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		owner  string
+		steal  bool
+		claims bool
+	}{
+		{"neutral cell", "", false, true},
+		{"own cell", "red", false, false},
+		{"someone else's cell", "blue", true, true},
+		{"someone else's cell without stealing", "blue", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(5, TerritoryKeep)
+			m.Steal = tt.steal
+			to := Position{X: 3, Y: 2}
+			if tt.owner != "" {
+				paint(m, tt.owner, to)
+			}
+			player := &Player{ID: "a", Color: "red", Position: Position{X: 2, Y: 2}}
+			events, _ := m.Step([]Input{Move{Player: player, Direction: "right"}}, []*Player{player})
+
+			// The player moves either way; only the claim depends on the cell.
+			want := []Event{Moved{Player: player, From: Position{X: 2, Y: 2}, To: to}}
+			if tt.claims {
+				want = append(want, Claimed{Player: player, Cell: to, From: tt.owner})
+			}
+			if !reflect.DeepEqual(events, want) {
+				t.Fatalf("events = %+v, want %+v", events, want)
+			}
+			if owner, want := m.Board.Owner(to), map[bool]string{true: "red", false: tt.owner}[tt.claims]; owner != want {
+				t.Fatalf("owner = %q, want %q", owner, want)
+			}
+			checkTerritory(t, m, "red", "blue")
+		})
+	}
+}
+
+// Two players entering the same cell in one step both move, but only the
+// first to enter it claims it.
+func TestStepCollision(t *testing.T) {
+	tests := []struct {
+		name  string
+		first int // index of the player whose move is given first
+	}{
+		{"left player first", 0},
+		{"right player first", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMatch(5, TerritoryKeep)
+			players := []*Player{
+				{ID: "a", Color: "red", Position: Position{X: 1, Y: 2}},
+				{ID: "b", Color: "blue", Position: Position{X: 3, Y: 2}},
+			}
+			moves := []Input{
+				Move{Player: players[0], Direction: "right"},
+				Move{Player: players[1], Direction: "left"},
+			}
+			if tt.first == 1 {
+				moves[0], moves[1] = moves[1], moves[0]
+			}
+			events, _ := m.Step(moves, players)
+
+			middle := Position{X: 2, Y: 2}
+			for _, player := range players {
+				if player.Position != middle {
+					t.Fatalf("%s is at %v, want %v", player.ID, player.Position, middle)
+				}
+			}
+			winner := players[tt.first]
+			if owner := m.Board.Owner(middle); owner != winner.Color {
+				t.Fatalf("cell went to %q, want %q", owner, winner.Color)
+			}
+			var claims []Event
+			for _, event := range events {
+				if claim, ok := event.(Claimed); ok {
+					claims = append(claims, claim)
+				}
+			}
+			if want := []Event{Claimed{Player: winner, Cell: middle}}; !reflect.DeepEqual(claims, want) {
+				t.Fatalf("claims = %+v, want %+v", claims, want)
+			}
+		})
+	}
+}
+
+// Joins and leaves take effect before anyone moves, in the order given.
+func TestStepJoinAndLeave(t *testing.T) {
+	m := newTestMatch(7, TerritoryNeutral)
+	stayer := &Player{ID: "a", Color: "red"}
+	leaver := &Player{ID: "b", Color: "blue"}
+	m.Spawn(stayer, Position{X: 1, Y: 1}, 1)
+	m.Spawn(leaver, Position{X: 5, Y: 5}, 1)
+
+	joiner := &Player{ID: "c", Color: "green"}
+	events, _ := m.Step([]Input{
+		Move{Player: stayer, Direction: "right"},
+		Leave{Player: leaver},
+		Join{Player: joiner, Position: Position{X: 5, Y: 1}, Radius: 1},
+	}, []*Player{stayer, joiner})
+
+	want := []Event{
+		Spawned{Player: joiner},
+		Moved{Player: stayer, From: Position{X: 1, Y: 1}, To: Position{X: 2, Y: 1}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %+v, want %+v", events, want)
+	}
+	if got := m.Territory("blue"); got != 0 {
+		t.Fatalf("the leaver still has %d cells", got)
+	}
+	for _, tt := range []struct {
+		player *Player
+		score  int
+	}{{stayer, 9}, {joiner, 9}} {
+		if tt.player.Score != tt.score {
+			t.Errorf("score of %s = %d, want %d", tt.player.ID, tt.player.Score, tt.score)
+		}
+	}
+	checkTerritory(t, m, "red", "blue", "green")
+}
+
+// BenchmarkStep steps a classic match of 8 players walking squares, with
+// stealing on, on boards up to the largest allowed. Scoring reads the
+// running territory counts; "recounting" adds a count of each player's cells
+// per step, the cost of scoring by scanning the board as Step used to.
+func BenchmarkStep(b *testing.B) {
+	const players = 8
+	directions := []string{"right", "down", "left", "up"}
+	for _, size := range []int{40, 200} {
+		for _, recount := range []bool{false, true} {
+			name := fmt.Sprintf("%dx%d", size, size)
+			if recount {
+				name += "/recounting"
+			}
+			b.Run(name, func(b *testing.B) {
+				m := newTestMatch(size, TerritoryKeep)
+				m.Steal = true
+				var roster []*Player
+				for i := range players {
+					player := &Player{ID: fmt.Sprint(i), Color: fmt.Sprint("color", i)}
+					m.Spawn(player, Position{X: i * size / players, Y: i * size / players}, 1)
+					roster = append(roster, player)
+				}
+				inputs := make([]Input, players)
+				b.ResetTimer()
+				for i := range b.N {
+					for j, player := range roster {
+						// Squares of different sizes, so the players cross.
+						inputs[j] = Move{Player: player, Direction: directions[i/(j+3)%len(directions)]}
+					}
+					m.Step(inputs, roster)
+					if recount {
+						for _, player := range roster {
+							player.Score = m.Board.Count(player.Color)
+						}
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// TerritoryDecayDuration is how long a leaver's cells take to fade away under
+// the decay rule.
+const TerritoryDecayDuration = 10 * time.Second
+
+// TerritoryRule decides what happens to the cells of a player who leaves a
+// room. It implements flag.Value so it can be chosen at startup.
+type TerritoryRule int
+
+const (
+	TerritoryKeep TerritoryRule = iota
+	TerritoryNeutral
+	TerritoryDecay
+)
+
+func (r TerritoryRule) String() string {
+	switch r {
+	case TerritoryNeutral:
+		return "neutral"
+	case TerritoryDecay:
+		return "decay"
+	default:
+		return "keep"
+	}
+}
+
+func (r *TerritoryRule) Set(value string) error {
+	switch value {
+	case "keep":
+		*r = TerritoryKeep
+	case "neutral":
+		*r = TerritoryNeutral
+	case "decay":
+		*r = TerritoryDecay
+	default:
+		return fmt.Errorf("unknown territory rule %q", value)
+	}
+	return nil
+}
+
+// decayingTerritory tracks the cells of a leaver that are being returned to
+// neutral a few at a time. started is the match time they left at.
+type decayingTerritory struct {
+	color   string
+	cells   []Position
+	total   int
+	started time.Duration
+}
+
+// release applies the match's leaver rule to the cells of a player who left.
+func (m *Match) release(player *Player) {
+	switch m.Leavers {
+	case TerritoryNeutral:
+		for _, cell := range m.Board.Cells(player.Color) {
+			m.SetCell(cell, "")
+		}
+	case TerritoryDecay:
+		cells := m.Board.Cells(player.Color)
+		if len(cells) == 0 {
+			return
+		}
+		m.decays = append(m.decays, &decayingTerritory{
+			color:   player.Color,
+			cells:   cells,
+			total:   len(cells),
+			started: m.Elapsed(),
+		})
+	}
+}
+
+// decay clears enough decaying cells that each leaver's territory shrinks
+// linearly to nothing over TerritoryDecayDuration. Cells that have been
+// claimed by someone else in the meantime are left alone.
+func (m *Match) decay() {
+	remaining := m.decays[:0]
+	for _, decay := range m.decays {
+		left := TerritoryDecayDuration - (m.Elapsed() - decay.started)
+		keep := 0
+		if left > 0 {
+			keep = int(float64(decay.total) * float64(left) / float64(TerritoryDecayDuration))
+		}
+		for len(decay.cells) > keep {
+			cell := decay.cells[len(decay.cells)-1]
+			decay.cells = decay.cells[:len(decay.cells)-1]
+			if m.Board.Owner(cell) == decay.color {
+				m.SetCell(cell, "")
+			}
+		}
+		if len(decay.cells) > 0 {
+			remaining = append(remaining, decay)
+		}
+	}
+	m.decays = remaining
+}
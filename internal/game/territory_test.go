@@ -0,0 +1,92 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		rule TerritoryRule
+		want int // the leaver's cells right after the step they left in
+	}{
+		{TerritoryKeep, 9},
+		{TerritoryNeutral, 0},
+		// Decay starts from everything and takes TerritoryDecayDuration.
+		{TerritoryDecay, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule.String(), func(t *testing.T) {
+			m := newTestMatch(5, tt.rule)
+			leaver := &Player{ID: "a", Color: "red"}
+			m.Spawn(leaver, Position{X: 2, Y: 2}, 1)
+
+			m.Step([]Input{Leave{Player: leaver}}, nil)
+			if got := m.Territory("red"); got != tt.want {
+				t.Fatalf("territory = %d, want %d", got, tt.want)
+			}
+			checkTerritory(t, m, "red")
+		})
+	}
+}
+
+// A leaver's cells fade linearly over TerritoryDecayDuration, one step at a
+// time, leaving alone the cells someone else claimed in the meantime.
+func TestDecay(t *testing.T) {
+	m := newTestMatch(10, TerritoryDecay)
+	leaver := &Player{ID: "a", Color: "red"}
+	for x := range 10 {
+		paint(m, leaver.Color, Position{X: x, Y: 0})
+	}
+	m.Step([]Input{Leave{Player: leaver}}, nil)
+
+	// Steps are a second apart, and the decay takes ten.
+	if steps := int(TerritoryDecayDuration / time.Second); steps != 10 {
+		t.Fatalf("test assumes a 10s decay, not %v", TerritoryDecayDuration)
+	}
+	for left := 9; left > 0; left-- {
+		m.Step(nil, nil)
+		if got := m.Territory("red"); got != left {
+			t.Fatalf("%v after leaving: territory = %d, want %d", m.Elapsed()-time.Second, got, left)
+		}
+	}
+
+	// The last red cell decays last; someone else owns it by then.
+	paint(m, "blue", Position{X: 0, Y: 0})
+	m.Step(nil, nil)
+	if got := m.Territory("red"); got != 0 {
+		t.Fatalf("territory = %d once the decay is over", got)
+	}
+	if owner := m.Board.Owner(Position{X: 0, Y: 0}); owner != "blue" {
+		t.Fatalf("decay cleared a cell blue claimed, now %q", owner)
+	}
+	if len(m.decays) != 0 {
+		t.Fatalf("%d decays still running", len(m.decays))
+	}
+	checkTerritory(t, m, "red", "blue")
+}
+
+func TestTerritoryRuleSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TerritoryRule
+		wantErr bool
+	}{
+		{"keep", TerritoryKeep, false},
+		{"neutral", TerritoryNeutral, false},
+		{"decay", TerritoryDecay, false},
+		{"vanish", TerritoryKeep, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var rule TerritoryRule
+			err := rule.Set(tt.value)
+			if (err != nil) != tt.wantErr || rule != tt.want {
+				t.Fatalf("Set(%q) = %v, %v; want %v, error %v", tt.value, rule, err, tt.want, tt.wantErr)
+			}
+			if err == nil && rule.String() != tt.value {
+				t.Fatalf("String() = %q, want %q", rule.String(), tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Package wstest drives the game server over its websocket endpoint, for
+// tests that want to play through the same layer real clients do. Serve the
+// server's router with httptest, point a Client at it per player and, to
+// keep timing out of the picture, give the rooms a Clock to advance by hand.
+package wstest
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"land/protocol"
+)
+
+// Message is a message the client received, with its payload still encoded.
+type Message struct {
+	Type     string          `json:"type"`
+	AckSeq   uint64          `json:"ackSeq"`
+	EventID  uint64          `json:"eventID"`
+	Payload  json.RawMessage `json:"payload"`
+	Received time.Time       `json:"-"`
+}
+
+// Decode reads the message's payload into v.
+func (m Message) Decode(v any) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Client is one player's websocket connection, speaking JSON. Everything it
+// receives is kept in order, for ExpectMessage to wait on and Messages to
+// return. Its helpers fail the test rather than return errors.
+type Client struct {
+	tb      testing.TB
+	ws      *websocket.Conn
+	seq     uint64
+	Welcome Message
+
+	mu       sync.Mutex
+	log      []Message
+	seen     map[string]int
+	err      error
+	received chan struct{}
+}
+
+// Dial connects to the websocket endpoint at url, an http:// or ws:// URL
+// such as an httptest server's plus "/ws", and completes the handshake,
+// listing features in the hello. The connection is closed when the test
+// ends.
+func Dial(tb testing.TB, url string, features ...string) *Client {
+	tb.Helper()
+	url = "ws" + strings.TrimPrefix(url, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		tb.Fatalf("dial %s: %v", url, err)
+	}
+	c := &Client{tb: tb, ws: ws, seen: make(map[string]int), received: make(chan struct{})}
+	tb.Cleanup(c.Close)
+	go c.readLoop()
+
+	c.Send("hello", protocol.HelloPayload{Version: protocol.Version, Client: "wstest", Features: features})
+	c.Welcome = c.ExpectMessage("welcome", 5*time.Second)
+	return c
+}
+
+// Send sends a message with the next sequence number.
+func (c *Client) Send(msgType string, payload any) {
+	c.tb.Helper()
+	c.seq++
+	msg := struct {
+		Type    string `json:"type"`
+		Seq     uint64 `json:"seq"`
+		Payload any    `json:"payload"`
+	}{msgType, c.seq, payload}
+	if err := c.ws.WriteJSON(msg); err != nil {
+		c.tb.Fatalf("send %s: %v", msgType, err)
+	}
+}
+
+// Join asks to be matched into a room under name.
+func (c *Client) Join(name string) {
+	c.tb.Helper()
+	c.Send("join", protocol.JoinPayload{Name: name})
+}
+
+// JoinRoom asks for a seat in the room with the given ID.
+func (c *Client) JoinRoom(name, roomID string) {
+	c.tb.Helper()
+	c.Send("join", protocol.JoinPayload{Name: name, RoomID: roomID})
+}
+
+func (c *Client) Move(direction string) {
+	c.tb.Helper()
+	c.Send("move", protocol.MovePayload{Direction: direction})
+}
+
+func (c *Client) Chat(text string) {
+	c.tb.Helper()
+	c.Send("chat", protocol.ChatPayload{Message: text})
+}
+
+// ExpectMessage waits up to timeout for the next message of type msgType
+// after the last one it returned, and fails the test if none comes. Each
+// type is followed separately, so expecting one type skips nothing of
+// another.
+func (c *Client) ExpectMessage(msgType string, timeout time.Duration) Message {
+	c.tb.Helper()
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		for i := c.seen[msgType]; i < len(c.log); i++ {
+			if c.log[i].Type == msgType {
+				c.seen[msgType] = i + 1
+				msg := c.log[i]
+				c.mu.Unlock()
+				return msg
+			}
+		}
+		c.seen[msgType] = len(c.log)
+		received, err := c.received, c.err
+		c.mu.Unlock()
+
+		if err != nil {
+			c.tb.Fatalf("waiting for %s: connection closed: %v", msgType, err)
+		}
+		select {
+		case <-received:
+		case <-deadline:
+			c.tb.Fatalf("no %s within %v; received %s", msgType, timeout, c.types())
+		}
+	}
+}
+
+// Messages is everything the client has received so far, in order.
+func (c *Client) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.log...)
+}
+
+// types lists the types of the messages received, for failure messages.
+func (c *Client) types() string {
+	var types []string
+	for _, msg := range c.Messages() {
+		types = append(types, msg.Type)
+	}
+	return strings.Join(types, ", ")
+}
+
+// Close closes the connection as a client leaving normally would.
+func (c *Client) Close() {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.ws.Close()
+}
+
+func (c *Client) readLoop() {
+	for {
+		var msg Message
+		err := c.ws.ReadJSON(&msg)
+		msg.Received = time.Now()
+
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+		} else {
+			c.log = append(c.log, msg)
+		}
+		close(c.received)
+		c.received = make(chan struct{})
+		c.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package wstest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a clock that only moves when Advance is called, for the server's
+// rooms to run on in tests. Its timers and tickers fire as Advance passes
+// their time, in order; like time.Ticker, a ticker whose last tick hasn't
+// been received drops the next one.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*clockTimer
+	changed chan struct{}
+}
+
+type clockTimer struct {
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewClock starts a clock at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After fires once the clock has been advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).c
+}
+
+// Tick ticks every time the clock is advanced past another d, until stop
+// is called.
+func (c *Clock) Tick(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		panic("wstest: non-positive interval for Tick")
+	}
+	t := c.add(d, d)
+	return t.c, func() { c.remove(t) }
+}
+
+func (c *Clock) add(d, period time.Duration) *clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &clockTimer{at: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	c.notify()
+	return t
+}
+
+func (c *Clock) remove(t *clockTimer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			break
+		}
+	}
+	c.notify()
+}
+
+// notify wakes up WaitForTimers. It must be called with mu held.
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers due on
+// the way in the order they fall due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.now = t.at
+		select {
+		case t.c <- t.at:
+		default:
+		}
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+	}
+	c.now = end
+	c.notify()
+}
+
+// WaitForTimers waits until at least n timers and tickers are pending, so a
+// test can be sure a goroutine is waiting on the clock before advancing it.
+// It reports false if that doesn't happen within timeout of real time.
+func (c *Clock) WaitForTimers(n int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		pending, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if pending >= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
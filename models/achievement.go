@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Achievement is something a player can unlock by how they play. The
+// server defines them and keeps this table in step with its definitions.
+type Achievement struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PlayerAchievement is an achievement an account has unlocked. Each is
+// unlocked once.
+type PlayerAchievement struct {
+	AccountID     uint      `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	AchievementID string    `json:"achievementID" gorm:"primaryKey"`
+	UnlockedAt    time.Time `json:"unlockedAt"`
+}
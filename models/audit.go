@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditEntry records a privileged action: who took it, what it was, what it
+// was taken on and why.
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Actor     string    `json:"actor" gorm:"index"`
+	Action    string    `json:"action" gorm:"index"`
+	Target    string    `json:"target"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
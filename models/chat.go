@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ChatLog is a chat message sent in a room. MatchID is the match it was sent
+// during, once the match is recorded, and zero for messages sent outside a
+// game. AccountID is zero for players without an account. Team is the team
+// team chat went to, empty for chat to everyone. A Private message is a
+// whisper to the player in the room with RecipientID.
+type ChatLog struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	RoomID      string    `json:"roomID" gorm:"index"`
+	MatchID     uint      `json:"matchID" gorm:"index"`
+	AccountID   uint      `json:"accountID" gorm:"index"`
+	PlayerID    string    `json:"playerID"`
+	Name        string    `json:"name"`
+	Text        string    `json:"text"`
+	Team        string    `json:"team,omitempty"`
+	Private     bool      `json:"private"`
+	RecipientID string    `json:"recipientID,omitempty"`
+	SentAt      time.Time `json:"sentAt" gorm:"index"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "gorm.io/gorm"
+
+// Friend request states.
+const (
+	FriendPending  = "pending"
+	FriendAccepted = "accepted"
+)
+
+// FriendLink is a friendship between two accounts. PlayerID sent the request
+// and FriendID received it; once accepted the link counts both ways.
+type FriendLink struct {
+	gorm.Model
+	PlayerID uint   `json:"playerID" gorm:"uniqueIndex:idx_friend_pair"`
+	FriendID uint   `json:"friendID" gorm:"uniqueIndex:idx_friend_pair"`
+	Status   string `json:"status"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// InventoryItem is a shop item an account bought, and the Price it paid.
+// Each item is bought once.
+type InventoryItem struct {
+	AccountID   uint      `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	ItemID      string    `json:"itemID" gorm:"primaryKey"`
+	Price       int       `json:"price"`
+	PurchasedAt time.Time `json:"purchasedAt"`
+}
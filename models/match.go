@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Match is a finished game. Seed is the room's random seed, enough with the
+// inputs to replay it. SeasonID is the season the match started in, zero if
+// there was none.
+type Match struct {
+	gorm.Model
+	SeasonID   uint          `json:"seasonID" gorm:"index"`
+	RoomID     string        `json:"roomID" gorm:"index"`
+	Mode       string        `json:"mode"`
+	BoardSize  int           `json:"boardSize"`
+	Seed       int64         `json:"seed"`
+	StartedAt  time.Time     `json:"startedAt"`
+	EndedAt    time.Time     `json:"endedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Results    []MatchResult `json:"results"`
+}
+
+// MatchResult is how one player finished a match. AccountID is zero for
+// players without an account; PlayerID is the session ID the player had in
+// the room. Players on the same score share a Placement. Claimed counts the
+// cells the player took during the match. Rating is the account's rating
+// after the match and RatingDelta what the match changed it by; both are
+// zero for players whose rating the match didn't count for. Coins are what
+// the account earned.
+type MatchResult struct {
+	ID          uint    `json:"id" gorm:"primarykey"`
+	MatchID     uint    `json:"matchID" gorm:"index"`
+	AccountID   uint    `json:"accountID" gorm:"index"`
+	PlayerID    string  `json:"playerID"`
+	Name        string  `json:"name"`
+	Score       int     `json:"score"`
+	Placement   int     `json:"placement"`
+	Team        string  `json:"team,omitempty"`
+	Winner      bool    `json:"winner"`
+	Claimed     int     `json:"claimed"`
+	Rating      float64 `json:"rating"`
+	RatingDelta float64 `json:"ratingDelta"`
+	Coins       int     `json:"coins"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PlayerMute is an account muting another, MutedAccountID: the server
+// delivers it no chat, whispers or emotes from that account.
+type PlayerMute struct {
+	AccountID      uint      `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	MutedAccountID uint      `json:"mutedAccountID" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
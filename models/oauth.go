@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// OAuthIdentity links an account to an identity at an OAuth provider, such
+// as "google" or "github". Subject is the identity's ID there.
+type OAuthIdentity struct {
+	gorm.Model
+	Provider  string `json:"provider" gorm:"uniqueIndex:idx_oauth_identity"`
+	Subject   string `json:"subject" gorm:"uniqueIndex:idx_oauth_identity"`
+	AccountID uint   `json:"accountID" gorm:"index"`
+}
+
+func (OAuthIdentity) TableName() string { return "oauth_identities" }
@@ -0,0 +1,40 @@
+// Package models holds the gorm models persisted by the land servers. The
+// schema is not derived from them at startup: a change to a model needs a
+// migration in the server to go with it.
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultRating is the skill rating given to new accounts.
+const DefaultRating = 1000
+
+// Player is an account. Names are unique. PasswordHash is the bcrypt hash of
+// the account's password and never leaves the server. A Guest account was
+// made for someone who played without registering; it has no password until
+// they register it. Email is optional. EmailVerified is set when a provider
+// vouched for it, on accounts made by signing in with one; only those are
+// reached by signing in with another provider that vouches for the same
+// email. RenamedAt is when the player last changed their name, if they have.
+// Score, Games and Wins are totals over every match a registered account
+// played, and are only ever written by match recording; guest accounts'
+// stay zero. Coins are earned in matches and spent in the shop.
+type Player struct {
+	gorm.Model
+	Name          string     `json:"name" gorm:"uniqueIndex"`
+	Email         string     `json:"-" gorm:"index"`
+	EmailVerified bool       `json:"-"`
+	PasswordHash  string     `json:"-"`
+	Guest         bool       `json:"guest" gorm:"index"`
+	Character     string     `json:"character"`
+	Score         float64    `json:"score" gorm:"index"`
+	Games         int        `json:"games"`
+	Wins          int        `json:"wins"`
+	Color         string     `json:"color"`
+	Rating        float64    `json:"rating" gorm:"default:1000"`
+	RenamedAt     *time.Time `json:"-"`
+	Coins         int        `json:"coins"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Season is a stretch of play with a leaderboard of its own. It runs from
+// StartAt until EndAt; Final is set once its standings have been
+// snapshotted into SeasonResults.
+type Season struct {
+	ID      uint      `json:"id" gorm:"primarykey"`
+	Name    string    `json:"name"`
+	StartAt time.Time `json:"startAt" gorm:"index"`
+	EndAt   time.Time `json:"endAt" gorm:"index"`
+	Final   bool      `json:"final"`
+}
+
+// SeasonScore is an account's running totals in a season, kept up to date
+// as matches are recorded. Rating is the account's rating after its last
+// match of the season.
+type SeasonScore struct {
+	SeasonID  uint    `json:"seasonID" gorm:"primaryKey;autoIncrement:false"`
+	AccountID uint    `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	Score     int     `json:"score" gorm:"index"`
+	Games     int     `json:"games"`
+	Wins      int     `json:"wins"`
+	Rating    float64 `json:"rating"`
+}
+
+// SeasonResult is where an account finished a season: its SeasonScore when
+// the season was closed, ranked by score.
+type SeasonResult struct {
+	SeasonID  uint    `json:"seasonID" gorm:"primaryKey;autoIncrement:false"`
+	AccountID uint    `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	Rank      int     `json:"rank"`
+	Score     int     `json:"score"`
+	Games     int     `json:"games"`
+	Wins      int     `json:"wins"`
+	Rating    float64 `json:"rating"`
+}
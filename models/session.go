@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a signed-in client. The client holds a token and the server
+// keeps only its hash, so the table can't be used to sign in. Deleting a
+// session revokes its token.
+type Session struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	TokenHash  string    `json:"-" gorm:"uniqueIndex"`
+	AccountID  uint      `json:"accountID" gorm:"index"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt" gorm:"index"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+}
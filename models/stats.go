@@ -0,0 +1,14 @@
+package models
+
+// PlayerStats are an account's running totals in one game mode, kept up to
+// date as matches are recorded so stats don't have to be added up from
+// every match each time they are asked for.
+type PlayerStats struct {
+	AccountID    uint   `json:"accountID" gorm:"primaryKey;autoIncrement:false"`
+	Mode         string `json:"mode" gorm:"primaryKey"`
+	Games        int    `json:"games"`
+	Wins         int    `json:"wins"`
+	TotalScore   int    `json:"totalScore"`
+	BestScore    int    `json:"bestScore"`
+	CellsClaimed int    `json:"cellsClaimed"`
+}
@@ -0,0 +1,239 @@
+// Protobuf encoding of the websocket protocol, for clients that negotiate
+// "encoding": "protobuf" in their hello. Field names follow the JSON
+// encoding. The Land service carries the same protocol over gRPC. Regenerate
+// game.pb.go and game_grpc.pb.go with:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative pb/game.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: pb/game.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Land_JoinRoom_FullMethodName     = "/land.Land/JoinRoom"
+	Land_ListRooms_FullMethodName    = "/land.Land/ListRooms"
+	Land_GetRoomState_FullMethodName = "/land.Land/GetRoomState"
+)
+
+// LandClient is the client API for Land service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Land is the gRPC API for bots and other non-browser clients. JoinRoom
+// speaks the websocket protocol as Envelopes, with the handshake taken from
+// the call: the server sends welcome first, and the client then sends join,
+// reconnect or createParty as it would over a websocket. Room, code and
+// spectate metadata stand in for the websocket URL's query parameters.
+type LandClient interface {
+	JoinRoom(ctx context.Context, opts ...grpc.CallOption) (Land_JoinRoomClient, error)
+	ListRooms(ctx context.Context, in *ListRoomsRequest, opts ...grpc.CallOption) (*ListRoomsResponse, error)
+	GetRoomState(ctx context.Context, in *GetRoomStateRequest, opts ...grpc.CallOption) (*GameStatePayload, error)
+}
+
+type landClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLandClient(cc grpc.ClientConnInterface) LandClient {
+	return &landClient{cc}
+}
+
+func (c *landClient) JoinRoom(ctx context.Context, opts ...grpc.CallOption) (Land_JoinRoomClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Land_ServiceDesc.Streams[0], Land_JoinRoom_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &landJoinRoomClient{ClientStream: stream}
+	return x, nil
+}
+
+type Land_JoinRoomClient interface {
+	Send(*Envelope) error
+	Recv() (*Envelope, error)
+	grpc.ClientStream
+}
+
+type landJoinRoomClient struct {
+	grpc.ClientStream
+}
+
+func (x *landJoinRoomClient) Send(m *Envelope) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *landJoinRoomClient) Recv() (*Envelope, error) {
+	m := new(Envelope)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *landClient) ListRooms(ctx context.Context, in *ListRoomsRequest, opts ...grpc.CallOption) (*ListRoomsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRoomsResponse)
+	err := c.cc.Invoke(ctx, Land_ListRooms_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *landClient) GetRoomState(ctx context.Context, in *GetRoomStateRequest, opts ...grpc.CallOption) (*GameStatePayload, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GameStatePayload)
+	err := c.cc.Invoke(ctx, Land_GetRoomState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LandServer is the server API for Land service.
+// All implementations must embed UnimplementedLandServer
+// for forward compatibility
+//
+// Land is the gRPC API for bots and other non-browser clients. JoinRoom
+// speaks the websocket protocol as Envelopes, with the handshake taken from
+// the call: the server sends welcome first, and the client then sends join,
+// reconnect or createParty as it would over a websocket. Room, code and
+// spectate metadata stand in for the websocket URL's query parameters.
+type LandServer interface {
+	JoinRoom(Land_JoinRoomServer) error
+	ListRooms(context.Context, *ListRoomsRequest) (*ListRoomsResponse, error)
+	GetRoomState(context.Context, *GetRoomStateRequest) (*GameStatePayload, error)
+	mustEmbedUnimplementedLandServer()
+}
+
+// UnimplementedLandServer must be embedded to have forward compatible implementations.
+type UnimplementedLandServer struct {
+}
+
+func (UnimplementedLandServer) JoinRoom(Land_JoinRoomServer) error {
+	return status.Errorf(codes.Unimplemented, "method JoinRoom not implemented")
+}
+func (UnimplementedLandServer) ListRooms(context.Context, *ListRoomsRequest) (*ListRoomsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRooms not implemented")
+}
+func (UnimplementedLandServer) GetRoomState(context.Context, *GetRoomStateRequest) (*GameStatePayload, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRoomState not implemented")
+}
+func (UnimplementedLandServer) mustEmbedUnimplementedLandServer() {}
+
+// UnsafeLandServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LandServer will
+// result in compilation errors.
+type UnsafeLandServer interface {
+	mustEmbedUnimplementedLandServer()
+}
+
+func RegisterLandServer(s grpc.ServiceRegistrar, srv LandServer) {
+	s.RegisterService(&Land_ServiceDesc, srv)
+}
+
+func _Land_JoinRoom_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LandServer).JoinRoom(&landJoinRoomServer{ServerStream: stream})
+}
+
+type Land_JoinRoomServer interface {
+	Send(*Envelope) error
+	Recv() (*Envelope, error)
+	grpc.ServerStream
+}
+
+type landJoinRoomServer struct {
+	grpc.ServerStream
+}
+
+func (x *landJoinRoomServer) Send(m *Envelope) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *landJoinRoomServer) Recv() (*Envelope, error) {
+	m := new(Envelope)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Land_ListRooms_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRoomsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LandServer).ListRooms(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Land_ListRooms_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LandServer).ListRooms(ctx, req.(*ListRoomsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Land_GetRoomState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRoomStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LandServer).GetRoomState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Land_GetRoomState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LandServer).GetRoomState(ctx, req.(*GetRoomStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Land_ServiceDesc is the grpc.ServiceDesc for Land service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Land_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "land.Land",
+	HandlerType: (*LandServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRooms",
+			Handler:    _Land_ListRooms_Handler,
+		},
+		{
+			MethodName: "GetRoomState",
+			Handler:    _Land_GetRoomState_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "JoinRoom",
+			Handler:       _Land_JoinRoom_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pb/game.proto",
+}
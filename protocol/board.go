@@ -0,0 +1,64 @@
+package protocol
+
+import "fmt"
+
+// CompactBoard is a board encoded for clients that negotiate "compactBoard":
+// Palette maps indices to colors, with index 0 always the empty cell, and
+// Runs is the board read row by row as [paletteIndex, length] pairs.
+type CompactBoard struct {
+	Size    int      `json:"size"`
+	Palette []string `json:"palette"`
+	Runs    []int    `json:"runs"`
+}
+
+// Compact run-length encodes the board against a palette of the colors on
+// it.
+func Compact(board [][]string) *CompactBoard {
+	compact := &CompactBoard{Size: len(board), Palette: []string{""}}
+	indices := map[string]int{"": 0}
+
+	current, length := 0, 0
+	for _, row := range board {
+		for _, cell := range row {
+			index, ok := indices[cell]
+			if !ok {
+				index = len(compact.Palette)
+				indices[cell] = index
+				compact.Palette = append(compact.Palette, cell)
+			}
+			if index != current && length > 0 {
+				compact.Runs = append(compact.Runs, current, length)
+				length = 0
+			}
+			current = index
+			length++
+		}
+	}
+	if length > 0 {
+		compact.Runs = append(compact.Runs, current, length)
+	}
+	return compact
+}
+
+// Decode expands the board into rows of colors.
+func (b *CompactBoard) Decode() ([][]string, error) {
+	cells := make([]string, 0, b.Size*b.Size)
+	for i := 0; i+1 < len(b.Runs); i += 2 {
+		index, length := b.Runs[i], b.Runs[i+1]
+		if index < 0 || index >= len(b.Palette) {
+			return nil, fmt.Errorf("board run has unknown palette index %d", index)
+		}
+		for j := 0; j < length; j++ {
+			cells = append(cells, b.Palette[index])
+		}
+	}
+	if len(cells) != b.Size*b.Size {
+		return nil, fmt.Errorf("board has %d cells, want %d", len(cells), b.Size*b.Size)
+	}
+
+	board := make([][]string, b.Size)
+	for y := range board {
+		board[y] = cells[y*b.Size : (y+1)*b.Size]
+	}
+	return board, nil
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomBoard is a size by size board with cells owned by up to colors
+// players. Each cell keeps its left neighbour's owner with probability
+// runs, so that higher values give the long runs of a real board.
+func randomBoard(rand *rand.Rand, size, colors int, runs float64) [][]string {
+	board := make([][]string, size)
+	owner := ""
+	for y := range board {
+		board[y] = make([]string, size)
+		for x := range board[y] {
+			if rand.Float64() >= runs {
+				owner = ""
+				if n := rand.Intn(colors + 1); n > 0 {
+					owner = fmt.Sprintf("#%06x", n)
+				}
+			}
+			board[y][x] = owner
+		}
+	}
+	return board
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 2, 7, 40} {
+		for _, colors := range []int{0, 1, 4, 16} {
+			for _, runs := range []float64{0, 0.5, 0.95} {
+				board := randomBoard(rand, size, colors, runs)
+				compact := Compact(board)
+
+				if compact.Size != size || len(compact.Palette) == 0 || compact.Palette[0] != "" {
+					t.Fatalf("size %d: compact board has size %d and palette %q", size, compact.Size, compact.Palette)
+				}
+				seen := make(map[string]bool)
+				for _, color := range compact.Palette {
+					if seen[color] {
+						t.Fatalf("palette %q lists %q twice", compact.Palette, color)
+					}
+					seen[color] = true
+				}
+				for i := 2; i < len(compact.Runs); i += 2 {
+					if compact.Runs[i] == compact.Runs[i-2] {
+						t.Fatalf("runs %v: two runs of %d in a row", compact.Runs, compact.Runs[i])
+					}
+				}
+
+				got, err := compact.Decode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size == 0 {
+					if len(got) != 0 {
+						t.Fatalf("empty board decoded to %q", got)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, board) {
+					t.Fatalf("size %d, %d colors: decoded\n%q\nwant\n%q", size, colors, got, board)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		board CompactBoard
+	}{
+		{"unknown palette index", CompactBoard{Size: 1, Palette: []string{""}, Runs: []int{1, 1}}},
+		{"negative palette index", CompactBoard{Size: 1, Palette: []string{""}, Runs: []int{-1, 1}}},
+		{"too few cells", CompactBoard{Size: 2, Palette: []string{""}, Runs: []int{0, 3}}},
+		{"too many cells", CompactBoard{Size: 2, Palette: []string{"", "#ff0000"}, Runs: []int{0, 3, 1, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if board, err := tt.board.Decode(); err == nil {
+				t.Fatalf("decoded %+v to %q", tt.board, board)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package protocol
+
+// Version is the protocol version clients ask for in their hello.
+const Version = 1
+
+// HelloPayload opens every connection: the protocol version the client
+// speaks and a name identifying the client software. Encoding asks for a
+// codec other than JSON for the rest of the connection; the hello and the
+// welcome are always JSON. Features lists optional features the client
+// supports. Token is the account token from registering, for clients that
+// can't send it with the connection request; without one the client plays
+// as a guest.
+type HelloPayload struct {
+	Version  int      `json:"version"`
+	Client   string   `json:"client"`
+	Encoding string   `json:"encoding"`
+	Features []string `json:"features"`
+	Token    string   `json:"token,omitempty"`
+}
+
+// JoinPayload names the player. When it is the first message on a
+// connection, RoomID and JoinCode pick a room instead of matchmaking.
+type JoinPayload struct {
+	Name     string `json:"name"`
+	RoomID   string `json:"roomID"`
+	JoinCode string `json:"joinCode"`
+}
+
+// MovePayload moves the player one cell: "up", "down", "left" or "right".
+type MovePayload struct {
+	Direction string `json:"direction"`
+}
+
+// ChatPayload is a chat message for the room. Channel is "all", the
+// default, or "team" for the sender's team only.
+type ChatPayload struct {
+	Message string `json:"message"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// EmotePayload shows an emote, by ID, above the player's square.
+type EmotePayload struct {
+	Emote string `json:"emote"`
+}
+
+// PingPayload asks for a pong. ClientTime is echoed back so the client can
+// measure the round trip without keeping state.
+type PingPayload struct {
+	ClientTime int64 `json:"clientTime"`
+}
+
+// PongPayload answers a ping. Times are Unix milliseconds.
+type PongPayload struct {
+	ClientTime int64 `json:"clientTime"`
+	ServerTime int64 `json:"serverTime"`
+}
+
+// SessionPayload tells a player their ID and the token that lets them resume
+// their seat after a disconnect.
+type SessionPayload struct {
+	PlayerID string `json:"playerID"`
+	Token    string `json:"token"`
+}
+
+// ErrorPayload rejects something a client sent. Field names the payload
+// field at fault, if any, and Seq is the sequence number of the offending
+// message, if it had one. RetryAfterMs is how long to wait before trying
+// again, for refusals that pass.
+type ErrorPayload struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	Field        string `json:"field,omitempty"`
+	Seq          uint64 `json:"seq"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
@@ -0,0 +1,29 @@
+package protocol
+
+// Emote is an emote players can pop above their square. An emote with an
+// Item is unlocked by buying that shop item; the others every player has.
+type Emote struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Item string `json:"item,omitempty"`
+}
+
+// Emotes are every emote the server knows, in the order clients list them.
+var Emotes = []Emote{
+	{ID: "wave", Name: "Wave"},
+	{ID: "laugh", Name: "Laugh"},
+	{ID: "cry", Name: "Cry"},
+	{ID: "angry", Name: "Angry"},
+	{ID: "thumbsUp", Name: "Thumbs up"},
+	{ID: "gg", Name: "Good game"},
+}
+
+// LookupEmote is the emote with the ID, if there is one.
+func LookupEmote(id string) (Emote, bool) {
+	for _, emote := range Emotes {
+		if emote.ID == id {
+			return emote, true
+		}
+	}
+	return Emote{}, false
+}
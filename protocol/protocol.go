@@ -0,0 +1,152 @@
+// Package protocol holds the messages the server broadcasts about a room's
+// game and the ones clients send it, shared by the server, the WASM client
+// and the load tester so all of them read the same fields the same way.
+// Positions are board cells, with 0,0 the top left; clients convert them to
+// pixels only when drawing.
+package protocol
+
+// RoomSettings are the per-room game parameters the host can change while
+// the room is waiting. Duration is in seconds and TickInterval, the time
+// between game ticks, in milliseconds. TeamMode is "solo", everyone for
+// themselves, or "teams", with the players split between two teams.
+type RoomSettings struct {
+	Duration     int    `json:"duration"`
+	BoardSize    int    `json:"boardSize"`
+	MaxPlayers   int    `json:"maxPlayers"`
+	StealRule    string `json:"stealRule"`
+	Mode         string `json:"mode"`
+	TickInterval int    `json:"tickInterval"`
+	ChatFilter   string `json:"chatFilter"`
+	TeamMode     string `json:"teamMode"`
+
+	SpectatorTeamChat string `json:"spectatorTeamChat"`
+}
+
+// StateView is a room's board and roster as clients see them, sent as
+// gameState. Board holds each cell's owner color, empty for neutral cells,
+// row by row from the top; it is nil in compact snapshots.
+type StateView struct {
+	Board        [][]string    `json:"board"`
+	Players      []PlayerState `json:"players"`
+	ChatMessages []string      `json:"chatMessages,omitempty"`
+}
+
+// PlayerState is a player as broadcast to clients. Team is empty outside
+// team modes, and Effects lists the power-ups active on the player, such as
+// "speedBoost".
+type PlayerState struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Color     string   `json:"color"`
+	Skin      string   `json:"skin,omitempty"`
+	Character string   `json:"character,omitempty"`
+	Score     int      `json:"score"`
+	X         int      `json:"x"`
+	Y         int      `json:"y"`
+	Team      string   `json:"team,omitempty"`
+	Effects   []string `json:"effects,omitempty"`
+	LatencyMs int      `json:"latencyMs,omitempty"`
+}
+
+// GameStatePayload is a full snapshot of a room. LastEventID is the latest
+// logged event the snapshot already reflects. For clients that negotiated
+// compactBoard the board is in CompactBoard rather than GameState.
+//
+// EndsAt is when the game ends in server time, Unix milliseconds, for clients
+// rendering their own countdown. Remaining is the same in whole seconds, kept
+// for convenience; while the clock is stopped, before the start or during a
+// pause, EndsAt is zero and Remaining is what is left.
+type GameStatePayload struct {
+	RoomID       string        `json:"roomID"`
+	GameState    *StateView    `json:"gameState"`
+	CompactBoard *CompactBoard `json:"compactBoard"`
+	Remaining    int           `json:"remaining"`
+	EndsAt       int64         `json:"endsAt"`
+	Spectators   int           `json:"spectators"`
+	Phase        string        `json:"phase"`
+	Settings     *RoomSettings `json:"settings"`
+	LastEventID  uint64        `json:"lastEventID"`
+}
+
+// Board is the snapshot's board, from whichever of GameState and
+// CompactBoard carries it.
+func (p *GameStatePayload) Board() ([][]string, error) {
+	if p.CompactBoard != nil {
+		return p.CompactBoard.Decode()
+	}
+	if p.GameState != nil {
+		return p.GameState.Board, nil
+	}
+	return nil, nil
+}
+
+// CellChange is a board cell that changed owner; an empty Color is a cell
+// returned to neutral.
+type CellChange struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Color string `json:"color"`
+}
+
+// PlayerDelta is a player's position, score and latency as last broadcast.
+type PlayerDelta struct {
+	PlayerID  string `json:"playerID"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Score     int    `json:"score"`
+	LatencyMs int    `json:"latencyMs,omitempty"`
+}
+
+// StateDeltaPayload is what changed in a room since the previous tick.
+type StateDeltaPayload struct {
+	Cells      []CellChange  `json:"cells"`
+	Players    []PlayerDelta `json:"players"`
+	Remaining  int           `json:"remaining"`
+	EndsAt     int64         `json:"endsAt"`
+	Spectators int           `json:"spectators"`
+	Phase      string        `json:"phase"`
+}
+
+type GameStartingPayload struct {
+	GameState *StateView `json:"gameState"`
+	Remaining int        `json:"remaining"`
+	StartsAt  int64      `json:"startsAt"`
+}
+
+// GameOverPayload announces the end of a game. Winner is nil if nobody
+// scored. Coins are what each player with an account earned, by player ID,
+// when the server keeps accounts.
+type GameOverPayload struct {
+	Winner *PlayerState   `json:"winner"`
+	Coins  map[string]int `json:"coins,omitempty"`
+}
+
+type PlayerJoinedPayload struct {
+	PlayerID string `json:"playerID"`
+	Name     string `json:"name"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// PlayerPayload identifies a player in playerLeft, playerDisconnected and
+// playerReconnected.
+type PlayerPayload struct {
+	PlayerID string `json:"playerID"`
+	Name     string `json:"name"`
+}
+
+// PlayerEmotedPayload is a player showing an emote, by ID, for clients to
+// pop above their square for a moment.
+type PlayerEmotedPayload struct {
+	PlayerID string `json:"playerID"`
+	Emote    string `json:"emote"`
+}
+
+// PositionPayload moves a player. Seq is the sequence number of the move
+// that put them there, so the mover can reconcile its predicted position.
+type PositionPayload struct {
+	PlayerID string `json:"playerID"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Seq      uint64 `json:"seq"`
+}
@@ -18,13 +18,13 @@ document.addEventListener('keydown', function(event) {
         case 'ArrowRight': case 'd': direction = 'right'; break;
         case ' ':
             if (ws && ws.readyState === WebSocket.OPEN) {
-                ws.send(JSON.stringify({ type: 'stop' }));
+                send('stop', {});
             }
             return;
         default: return;
     }
     if (ws && ws.readyState === WebSocket.OPEN) {
-        ws.send(JSON.stringify({ type: 'move', direction: direction, speed: 5 }));
+        send('move', { direction: direction });
     }
 });
 
@@ -32,11 +32,17 @@ function startGame() {
     ws = new WebSocket('ws://localhost:8080');
     ws.onopen = function() {
         console.log('Connection is open...');
+        send('hello', { version: 1, client: 'land-web', encoding: 'json' });
         showNameModal();
     };
     ws.onmessage = function(e) {
-        var data = JSON.parse(e.data);
-        switch (data.type) {
+        var msg = JSON.parse(e.data);
+        var data = msg.payload;
+        switch (msg.type) {
+            case 'welcome':
+            case 'session':
+                playerID = data.playerID;
+                break;
             case 'gameState':
                 updateGame(data);
                 break;
@@ -50,7 +56,7 @@ function startGame() {
                 showGameOverModal(data.winner);
                 break;
             case 'chat':
-                addChatMessage(data.name, data.chatMessage);
+                addChatMessage(data.name, data.message);
                 break;
         }
     };
@@ -62,11 +68,15 @@ function startGame() {
     };
 }
 
+function send(type, payload) {
+    ws.send(JSON.stringify({ type: type, payload: payload }));
+}
+
 function joinGame() {
     var playerName = document.getElementById('nameInput').value.trim();
     if (playerName !== '') {
         document.getElementById('nameModal').style.display = 'none';
-        ws.send(JSON.stringify({ type: 'join', name: playerName }));
+        send('join', { name: playerName });
     }
 }
 
@@ -201,7 +211,7 @@ document.getElementById('chatInput').addEventListener('keyup', function(event) {
         var message = chatInput.value.trim();
         if (message !== '') {
             console.log("Sending chat message:", message);
-            ws.send(JSON.stringify({ type: 'chat', chatMessage: message }));
+            send('chat', { message: message });
             chatInput.value = '';
         }
     }
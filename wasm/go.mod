@@ -1,3 +0,0 @@
-module wasm
-
-go 1.22.1
@@ -1,20 +1,46 @@
 // land/wasm/main.go
+
+//go:build js && wasm
+
+// Command wasm is the browser client's game logic, compiled to WebAssembly
+// and loaded by index.html:
+//
+//	GOOS=js GOARCH=wasm go build -o wasm/game.wasm ./wasm
 package main
 
 import (
 	"encoding/json"
 	"syscall/js"
-)
 
-const (
-	gridSize     = 20
-	canvasWidth  = 800
-	canvasHeight = 600
+	"land/internal/game"
+	"land/protocol"
 )
 
+// cellSize is how many pixels a board cell takes on the canvas. The game's
+// state is in board cells throughout; it is only scaled when drawn.
+const cellSize = 20
+
 var (
-	gameState = make(map[string]interface{})
-	players   = make(map[string]interface{})
+	// board is each cell's owner color, row by row, empty for neutral cells.
+	board [][]string
+
+	// players are the room's players by ID, positioned in board cells.
+	players = make(map[string]*protocol.PlayerState)
+
+	// gameStartsAt is the server's start timestamp from the last gameStarting
+	// message, in Unix milliseconds.
+	gameStartsAt float64
+
+	// gameEndsAt is the server's end timestamp from the last gameState, in
+	// Unix milliseconds; zero while the clock is stopped.
+	gameEndsAt float64
+
+	// latency is the round trip measured by the last pong, in milliseconds.
+	latency float64
+
+	// clockOffset is how far the server's clock is ahead of ours, measured
+	// by the last timeSync, in milliseconds.
+	clockOffset float64
 )
 
 func main() {
@@ -23,29 +49,33 @@ func main() {
 	js.Global().Set("getGameState", js.FuncOf(getGameState))
 	js.Global().Set("getPlayers", js.FuncOf(getPlayers))
 	js.Global().Set("setGameState", js.FuncOf(setGameState))
+	js.Global().Set("applyStateDelta", js.FuncOf(applyStateDelta))
 	js.Global().Set("movePlayer", js.FuncOf(movePlayer))
+	js.Global().Set("toPixels", js.FuncOf(toPixels))
+	js.Global().Set("setGameStartsAt", js.FuncOf(setGameStartsAt))
+	js.Global().Set("getCountdown", js.FuncOf(getCountdown))
+	js.Global().Set("decodeBoard", js.FuncOf(decodeBoard))
+	js.Global().Set("recordPong", js.FuncOf(recordPong))
+	js.Global().Set("getLatency", js.FuncOf(getLatency))
+	js.Global().Set("recordTimeSync", js.FuncOf(recordTimeSync))
+	js.Global().Set("setGameEndsAt", js.FuncOf(setGameEndsAt))
+	js.Global().Set("getRemaining", js.FuncOf(getRemaining))
+	js.Global().Set("getEmotes", js.FuncOf(getEmotes))
 
 	// Keep the program running
 	select {}
 }
 
 func updateGameState(this js.Value, args []js.Value) interface{} {
-	// Implement the game state update logic
+	// Predict the claims the server will make: each player takes the
+	// neutral cell they stand on
 	for _, player := range players {
-		playerData := player.(map[string]interface{})
-		x := playerData["x"].(float64)
-		y := playerData["y"].(float64)
-		color := playerData["color"].(string)
-
-		// Check if the player is on a claimable square
-		squareX := int(x) / gridSize
-		squareY := int(y) / gridSize
-		squareKey := getSquareKey(squareX, squareY)
-
-		if _, claimed := gameState[squareKey]; !claimed {
-			// Claim the square
-			gameState[squareKey] = color
-			playerData["score"] = playerData["score"].(float64) + 1
+		if !onBoard(player.X, player.Y) {
+			continue
+		}
+		if board[player.Y][player.X] == "" {
+			board[player.Y][player.X] = player.Color
+			player.Score++
 		}
 	}
 
@@ -53,8 +83,8 @@ func updateGameState(this js.Value, args []js.Value) interface{} {
 }
 
 func getGameState(this js.Value, args []js.Value) interface{} {
-	// Return the current game state as a JavaScript object
-	jsonData, err := json.Marshal(gameState)
+	// Return the board as JSON rows of colors
+	jsonData, err := json.Marshal(board)
 	if err != nil {
 		println("Failed to marshal game state:", err.Error())
 		return nil
@@ -64,7 +94,7 @@ func getGameState(this js.Value, args []js.Value) interface{} {
 }
 
 func getPlayers(this js.Value, args []js.Value) interface{} {
-	// Return the list of players as a JavaScript array
+	// Return the players by ID as JSON, positioned in board cells
 	jsonData, err := json.Marshal(players)
 	if err != nil {
 		println("Failed to marshal players:", err.Error())
@@ -74,61 +104,178 @@ func getPlayers(this js.Value, args []js.Value) interface{} {
 	return js.ValueOf(string(jsonData))
 }
 
-func setGameState(this js.Value, args []js.Value) interface{} {
-	// Parse the game state from the JavaScript object
-	gameStateJSON := args[0].String()
-	err := json.Unmarshal([]byte(gameStateJSON), &gameState)
+func getEmotes(this js.Value, args []js.Value) interface{} {
+	// Return the emotes the server knows as JSON, in the order to list them
+	jsonData, err := json.Marshal(protocol.Emotes)
 	if err != nil {
+		println("Failed to marshal emotes:", err.Error())
+		return nil
+	}
+
+	return js.ValueOf(string(jsonData))
+}
+
+func setGameState(this js.Value, args []js.Value) interface{} {
+	// Take the board, roster and clock from a gameState payload
+	var snapshot protocol.GameStatePayload
+	if err := json.Unmarshal([]byte(args[0].String()), &snapshot); err != nil {
 		println("Failed to unmarshal game state:", err.Error())
+		return nil
 	}
 
+	rows, err := snapshot.Board()
+	if err != nil {
+		println("Failed to decode board:", err.Error())
+		return nil
+	}
+	if rows != nil {
+		board = rows
+	}
+	if snapshot.GameState != nil {
+		players = make(map[string]*protocol.PlayerState, len(snapshot.GameState.Players))
+		for i := range snapshot.GameState.Players {
+			player := &snapshot.GameState.Players[i]
+			players[player.ID] = player
+		}
+	}
+	gameEndsAt = float64(snapshot.EndsAt)
+
 	return nil
 }
 
+func applyStateDelta(this js.Value, args []js.Value) interface{} {
+	// Apply a stateDelta payload on top of the last gameState
+	var delta protocol.StateDeltaPayload
+	if err := json.Unmarshal([]byte(args[0].String()), &delta); err != nil {
+		println("Failed to unmarshal state delta:", err.Error())
+		return nil
+	}
+
+	for _, cell := range delta.Cells {
+		if onBoard(cell.X, cell.Y) {
+			board[cell.Y][cell.X] = cell.Color
+		}
+	}
+	for _, update := range delta.Players {
+		if player := players[update.PlayerID]; player != nil {
+			player.X, player.Y = update.X, update.Y
+			player.Score = update.Score
+			player.LatencyMs = update.LatencyMs
+		}
+	}
+	gameEndsAt = float64(delta.EndsAt)
+
+	return nil
+}
+
+// keyDirections maps movement keys to the directions the server accepts.
+var keyDirections = map[string]string{
+	"ArrowLeft": "left", "a": "left",
+	"ArrowRight": "right", "d": "right",
+	"ArrowUp": "up", "w": "up",
+	"ArrowDown": "down", "s": "down",
+}
+
 func movePlayer(this js.Value, args []js.Value) interface{} {
-	// Handle player movement based on the input key
+	// Predict a move one cell in the key's direction, the way the server
+	// will make it
 	key := args[0].String()
 	playerID := args[1].String()
 
-	player := players[playerID].(map[string]interface{})
-	x := player["x"].(float64)
-	y := player["y"].(float64)
-
-	switch key {
-	case "ArrowLeft", "a":
-		x = max(0, x-gridSize)
-	case "ArrowRight", "d":
-		x = min(canvasWidth-gridSize, x+gridSize)
-	case "ArrowUp", "w":
-		y = max(0, y-gridSize)
-	case "ArrowDown", "s":
-		y = min(canvasHeight-gridSize, y+gridSize)
+	player := players[playerID]
+	direction, ok := keyDirections[key]
+	if player == nil || !ok {
+		return nil
 	}
+	to := game.Step(game.Position{X: player.X, Y: player.Y}, direction, len(board))
+	player.X, player.Y = to.X, to.Y
 
-	// Snap to grid
-	x = float64(int(x/gridSize) * gridSize)
-	y = float64(int(y/gridSize) * gridSize)
+	return nil
+}
 
-	player["x"] = x
-	player["y"] = y
+func toPixels(this js.Value, args []js.Value) interface{} {
+	// Convert a board coordinate to canvas pixels
+	return js.ValueOf(args[0].Int() * cellSize)
+}
 
+// onBoard reports whether x, y is a cell of the board.
+func onBoard(x, y int) bool {
+	return y >= 0 && y < len(board) && x >= 0 && x < len(board[y])
+}
+
+func setGameStartsAt(this js.Value, args []js.Value) interface{} {
+	// Remember when the server says the game starts
+	gameStartsAt = args[0].Float()
 	return nil
 }
 
-func getSquareKey(x, y int) string {
-	return string(x) + "," + string(y)
+func getCountdown(this js.Value, args []js.Value) interface{} {
+	// Return the seconds left before the game starts, rendered locally so it
+	// doesn't depend on further messages arriving
+	return js.ValueOf(max(0, (gameStartsAt-serverNow())/1000))
+}
+
+func setGameEndsAt(this js.Value, args []js.Value) interface{} {
+	// Remember when the server says the game ends
+	gameEndsAt = args[0].Float()
+	return nil
 }
 
-func min(a, b float64) float64 {
-	if a < b {
-		return a
+func getRemaining(this js.Value, args []js.Value) interface{} {
+	// Return the seconds left in the game, with sub-second precision, or -1
+	// while the clock is stopped and the server's remaining should be shown
+	if gameEndsAt == 0 {
+		return js.ValueOf(-1)
 	}
-	return b
+	return js.ValueOf(max(0, (gameEndsAt-serverNow())/1000))
+}
+
+func recordTimeSync(this js.Value, args []js.Value) interface{} {
+	// Estimate the server clock offset from a timeSync reply, assuming the
+	// reply took half the round trip
+	now := js.Global().Get("Date").Call("now").Float()
+	clientTime, serverTime := args[0].Float(), args[1].Float()
+	rtt := max(0, now-clientTime)
+	clockOffset = serverTime + rtt/2 - now
+	return nil
 }
 
-func max(a, b float64) float64 {
-	if a > b {
-		return a
+// serverNow is the current time on the server's clock, in Unix milliseconds.
+func serverNow() float64 {
+	return js.Global().Get("Date").Call("now").Float() + clockOffset
+}
+
+func recordPong(this js.Value, args []js.Value) interface{} {
+	// Measure the round trip from the clientTime a pong echoes back
+	now := js.Global().Get("Date").Call("now").Float()
+	latency = max(0, now-args[0].Float())
+	return nil
+}
+
+func getLatency(this js.Value, args []js.Value) interface{} {
+	// Return the last measured round trip in milliseconds
+	return js.ValueOf(latency)
+}
+
+func decodeBoard(this js.Value, args []js.Value) interface{} {
+	// Expand a compactBoard from a gameState into rows of colors, returned
+	// as JSON
+	var compact protocol.CompactBoard
+	if err := json.Unmarshal([]byte(args[0].String()), &compact); err != nil {
+		println("Failed to unmarshal board:", err.Error())
+		return nil
 	}
-	return b
+
+	rows, err := compact.Decode()
+	if err != nil {
+		println("Failed to decode board:", err.Error())
+		return nil
+	}
+	jsonData, err := json.Marshal(rows)
+	if err != nil {
+		println("Failed to marshal board:", err.Error())
+		return nil
+	}
+
+	return js.ValueOf(string(jsonData))
 }